@@ -1,31 +1,55 @@
 package api
 
 import (
+	"github.com/MetaDandy/cuent-ai-core/helper"
+	"github.com/MetaDandy/cuent-ai-core/middleware"
 	"github.com/MetaDandy/cuent-ai-core/src"
+	"github.com/MetaDandy/cuent-ai-core/src/model"
 	ws "github.com/MetaDandy/cuent-ai-core/src/modules/websocket"
 	"github.com/gofiber/fiber/v2"
-	"github.com/gofiber/websocket/v2"
 )
 
 func SetupApi(app *fiber.App, c *src.Container) {
 	v1 := app.Group("/api/v1")
-	hub := ws.NewHub(4)
+	hub := c.Hub
 
-	app.Get("/ws", websocket.New(ws.ServeWs(hub)))
+	// Salas de websocket: la del script es la de edición colaborativa; la
+	// del proyecto sólo recibe los eventos de generación.
+	app.Get("/ws/scripts/:id", middleware.WsJwtMiddleware(), ws.Upgrade(hub, c.ScriptCollab))
+	app.Get("/ws/projects/:id", middleware.WsJwtMiddleware(), ws.Upgrade(hub, c.ProjectRoom))
 
-	v1.Get("/ws/disconnect", func(c *fiber.Ctx) error {
-		userID := c.Query("user")
-		roomID := c.Query("room")
-		hub.Unregister(roomID, userID)
+	// Cierra las conexiones propias en una sala.
+	v1.Get("/ws/disconnect", middleware.JwtMiddleware(), func(c *fiber.Ctx) error {
+		userID, ok := c.Locals("user_id").(string)
+		if !ok || userID == "" {
+			return helper.JSONError(c, fiber.StatusUnauthorized,
+				"Token sin user_id", "")
+		}
+		hub.Disconnect(c.Query("room"), userID)
 		return c.SendStatus(fiber.StatusOK)
 	})
 
-	v1.Get("/ws/close-room", func(c *fiber.Ctx) error {
+	v1.Get("/ws/close-room", middleware.JwtMiddleware(), middleware.RequireRole(model.RoleAdmin), func(c *fiber.Ctx) error {
 		roomID := c.Query("room")
 		hub.CloseRoom(roomID)
 		return c.SendStatus(fiber.StatusOK)
 	})
 
+	// Contadores de las salas en esta réplica.
+	v1.Get("/ws/stats", middleware.JwtMiddleware(), middleware.RequireRole(model.RoleAdmin), func(c *fiber.Ctx) error {
+		return c.JSON(helper.Response{Data: hub.Stats()})
+	})
+
+	// El storage local sirve sus propias URLs firmadas.
+	if local, ok := c.Store.(*helper.LocalStore); ok {
+		app.Get(local.Route(), local.Handler())
+	}
+
+	// La biblioteca de imágenes de stock es pública.
+	if lib, ok := c.Images[model.ImageLibrary].(*helper.ImageLibrary); ok {
+		app.Get(lib.Route(), lib.Handler())
+	}
+
 	app.Get("/", func(ctx *fiber.Ctx) error {
 		return ctx.SendString("Aloha")
 	})
@@ -33,9 +57,13 @@ func SetupApi(app *fiber.App, c *src.Container) {
 	handlers := []func(fiber.Router){
 		c.ProjectHdl.RegisterRoutes,
 		c.UserHdl.RegisterRoutes,
+		c.AdminHdl.RegisterRoutes,
 		c.ScriptHdl.RegisterRoutes,
 		c.AssetHdl.RegisterRoutes,
 		c.SubsHdl.RegisterRoutes,
+		c.VoiceHdl.RegisterRoutes,
+		c.CharacterHdl.RegisterRoutes,
+		c.ImageHdl.RegisterRoutes,
 	}
 
 	for _, register := range handlers {
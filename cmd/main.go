@@ -1,7 +1,11 @@
 package main
 
 import (
+	"context"
+	"log"
 	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/MetaDandy/cuent-ai-core/cmd/api"
 	"github.com/MetaDandy/cuent-ai-core/config"
@@ -23,8 +27,25 @@ func main() {
 		AllowHeaders: "Origin, Content-Type, Accept, Authorization",
 	}))
 
-	c := src.SetupContainer()
+	// Al recibir la señal de apagado se cancela ctx, que detiene la cola y el
+	// Hub, y se cierra el servidor.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	c := src.SetupContainer(ctx)
+	if err := c.AssetQ.Start(ctx); err != nil {
+		log.Fatalf("Error iniciando la cola de generación: %v", err)
+	}
 	api.SetupApi(app, c)
 
-	app.Listen("0.0.0.0:" + config.Port)
+	go func() {
+		<-ctx.Done()
+		if err := app.Shutdown(); err != nil {
+			log.Printf("Error cerrando el servidor: %v", err)
+		}
+	}()
+
+	if err := app.Listen("0.0.0.0:" + config.Port); err != nil {
+		log.Fatalf("Error del servidor: %v", err)
+	}
 }
@@ -25,18 +25,72 @@ func Migrate(db *gorm.DB) {
 		log.Fatal("Failed to create enums", err)
 	}
 
+	// ADD VALUE no puede ir dentro del bloque DO, por eso va aparte.
+	if err := db.Exec(`ALTER TYPE provider ADD VALUE IF NOT EXISTS 'OFFLINE'`).Error; err != nil {
+		log.Fatal("Failed to extend provider enum", err)
+	}
+	if err := db.Exec(`ALTER TYPE state ADD VALUE IF NOT EXISTS 'REFUNDED'`).Error; err != nil {
+		log.Fatal("Failed to extend state enum", err)
+	}
+
 	err := db.AutoMigrate(
 		&model.Asset{},
+		&model.Character{},
 		&model.GeneratedJob{},
 		&model.Payment{},
 		&model.Project{},
+		&model.RefreshToken{},
+		&model.RevokedToken{},
 		&model.Script{},
+		&model.ScriptVersion{},
+		&model.StripeEvent{},
 		&model.Subscription{},
+		&model.TokenLedger{},
+		&model.TokenReservation{},
 		&model.User{},
+		&model.UserToken{},
 		&model.UserSubscribed{},
+		&model.Voice{},
+		&model.WsMessage{},
 	)
 
 	if err != nil {
 		log.Fatal("Failed to migrate database", err)
 	}
+
+	// Los archivos se guardan como referencias "bucket/clave"; las URLs de
+	// Supabase que quedaban de antes se convierten.
+	legacyURLs := `
+	UPDATE assets SET audio_url = regexp_replace(audio_url, '^https?://[^/]+/storage/v1/object/(public/)?', '')
+	    WHERE audio_url ~ '^https?://[^/]+/storage/v1/object/';
+	UPDATE assets SET video_url = regexp_replace(video_url, '^https?://[^/]+/storage/v1/object/(public/)?', '')
+	    WHERE video_url ~ '^https?://[^/]+/storage/v1/object/';
+	UPDATE scripts SET mixed_audio = regexp_replace(mixed_audio, '^https?://[^/]+/storage/v1/object/(public/)?', '')
+	    WHERE mixed_audio ~ '^https?://[^/]+/storage/v1/object/';`
+	if err := db.Exec(legacyURLs).Error; err != nil {
+		log.Fatal("Failed to migrate storage URLs", err)
+	}
+
+	// Sólo las suscripciones ACTIVE dan saldo; el plan gratuito se creaba
+	// sin estado y quedaba PENDING.
+	freeActive := `
+	UPDATE user_subscribeds SET status = 'ACTIVE'
+	    WHERE status = 'PENDING' AND subscription_id IN (SELECT id FROM subscriptions WHERE price = 0);`
+	if err := db.Exec(freeActive).Error; err != nil {
+		log.Fatal("Failed to activate free subscriptions", err)
+	}
+
+	// El ledger es sólo de inserción: la base rechaza UPDATE y DELETE.
+	immutableLedger := `
+	CREATE OR REPLACE FUNCTION token_ledger_immutable() RETURNS trigger AS $$
+	BEGIN
+	    RAISE EXCEPTION 'token_ledger es inmutable';
+	END$$ LANGUAGE plpgsql;
+	DROP TRIGGER IF EXISTS token_ledger_immutable ON token_ledger;
+	CREATE TRIGGER token_ledger_immutable
+	    BEFORE UPDATE OR DELETE ON token_ledger
+	    FOR EACH ROW EXECUTE FUNCTION token_ledger_immutable();`
+	if err := db.Exec(immutableLedger).Error; err != nil {
+		log.Fatal("Failed to protect token ledger", err)
+	}
 }
@@ -2,6 +2,8 @@ package seed
 
 import (
 	"log"
+	"os"
+	"strings"
 	"time"
 
 	"github.com/MetaDandy/cuent-ai-core/src/model"
@@ -57,6 +59,12 @@ func SeedSubscriptions(db *gorm.DB) error {
 			Price:      30,
 		},
 	}
+	// Los precios recurrentes dependen de la cuenta de Stripe, así que se
+	// toman de STRIPE_PRICE_<PLAN> si están definidos.
+	for i := range plans {
+		plans[i].StripePriceID = os.Getenv("STRIPE_PRICE_" + strings.ToUpper(plans[i].Name))
+	}
+
 	if err := db.Create(&plans).Error; err != nil {
 		log.Fatalf("❌ Error creando las suscripciones: %v", err)
 	}
@@ -23,6 +23,12 @@ func SeedUser(db *gorm.DB) error {
 	var existing model.User
 	err := db.Where("email = ?", adminEmail).First(&existing).Error
 	if err == nil {
+		// Instalaciones previas a los roles: el admin sembrado pasa a ADMIN.
+		if existing.Role != model.RoleAdmin {
+			if err := db.Model(&existing).Update("role", model.RoleAdmin).Error; err != nil {
+				log.Fatalf("❌ Error asignando rol admin: %v", err)
+			}
+		}
 		log.Printf("⚠️ Usuario %q (%s) ya existe; skip.", existing.Name, existing.Email)
 		return nil
 	}
@@ -44,11 +50,14 @@ func SeedUser(db *gorm.DB) error {
 	}
 
 	// 3) Construir registro
+	now := time.Now()
 	user := &model.User{
-		ID:       uuid.New(),
-		Name:     adminName,
-		Email:    adminEmail,
-		Password: string(hash),
+		ID:              uuid.New(),
+		Name:            adminName,
+		Email:           adminEmail,
+		Password:        string(hash),
+		Role:            model.RoleAdmin,
+		EmailVerifiedAt: &now,
 	}
 
 	sub := &model.UserSubscribed{
@@ -66,7 +75,18 @@ func SeedUser(db *gorm.DB) error {
 			return err
 		}
 
-		return tx.Create(sub).Error
+		if err := tx.Create(sub).Error; err != nil {
+			return err
+		}
+
+		return tx.Create(&model.TokenLedger{
+			ID:               uuid.New(),
+			UserID:           user.ID,
+			UserSubscribedID: sub.ID,
+			Amount:           int(sub.TokensRemaining),
+			BalanceAfter:     sub.TokensRemaining,
+			Reason:           model.LedgerSubscriptionGrant,
+		}).Error
 	}); err != nil {
 		log.Fatalf("❌ Error creando usuario admin: %v", err)
 	}
@@ -0,0 +1,70 @@
+package seed
+
+import (
+	"log"
+
+	"github.com/MetaDandy/cuent-ai-core/src/model"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// SeedVoices inserta un catálogo mínimo de voces por proveedor solo
+// si la tabla está vacía.
+func SeedVoices(db *gorm.DB) error {
+	var count int64
+	if err := db.Model(&model.Voice{}).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		log.Printf("⚠️ Las voces ya existen.")
+		return nil
+	}
+
+	voices := []model.Voice{
+		{
+			ID:              uuid.New(),
+			Name:            "Drew",
+			Provider:        model.ProviderElevenlab,
+			ProviderVoiceID: "29vD33N1CtxCmqQRPOHJ",
+			Language:        "en",
+			Stability:       0.5,
+			Similarity:      0.75,
+		},
+		{
+			ID:              uuid.New(),
+			Name:            "Arnold",
+			Provider:        model.ProviderElevenlab,
+			ProviderVoiceID: "VR6AewLTigWG4xSOukaG",
+			Language:        "en",
+			Stability:       0.5,
+			Similarity:      0.75,
+		},
+		{
+			ID:              uuid.New(),
+			Name:            "Alloy",
+			Provider:        model.ProviderOpenAI,
+			ProviderVoiceID: "alloy",
+			Language:        "multi",
+		},
+		{
+			ID:              uuid.New(),
+			Name:            "Nova",
+			Provider:        model.ProviderOpenAI,
+			ProviderVoiceID: "nova",
+			Language:        "multi",
+		},
+		{
+			ID:              uuid.New(),
+			Name:            "Offline",
+			Provider:        model.ProviderOffline,
+			ProviderVoiceID: "offline",
+			Language:        "multi",
+		},
+	}
+	if err := db.Create(&voices).Error; err != nil {
+		log.Fatalf("❌ Error creando las voces: %v", err)
+	}
+
+	log.Printf("✅ Voces creadas correctamente.")
+	return nil
+}
@@ -13,4 +13,7 @@ func Seeder(db *gorm.DB) {
 	if err := SeedUser(db); err != nil {
 		log.Fatalf("Error al seedear usuarios: %v", err)
 	}
+	if err := SeedVoices(db); err != nil {
+		log.Fatalf("Error al seedear voces: %v", err)
+	}
 }
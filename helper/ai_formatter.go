@@ -2,23 +2,86 @@ package helper
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"regexp"
 	"strings"
+	"unicode/utf8"
 
 	"google.golang.org/genai"
 )
 
+const (
+	// MaxTTSChars es el largo máximo de una línea TTS; más largo el proveedor
+	// corta o desafina la lectura.
+	MaxTTSChars = 200
+
+	// Límites de ElevenLabs para la duración de un efecto de sonido.
+	MinSFXSeconds = 0.5
+	MaxSFXSeconds = 22.0
+
+	// MaxPauseSeconds es el silencio máximo que se admite tras una línea.
+	MaxPauseSeconds = 10.0
+
+	// Cuántas veces se le pide al modelo que corrija una salida inválida.
+	formatterRepairAttempts = 1
+)
+
+// FormattedLine es una línea del guion procesado. Speaker vacío significa
+// narración; las líneas SFX nunca llevan speaker. Duration es la duración
+// pedida para un SFX y Pause el silencio tras la línea, ambos en segundos y
+// opcionales.
+type FormattedLine struct {
+	Type     string  `json:"type"`
+	Text     string  `json:"text"`
+	Speaker  string  `json:"speaker,omitempty"`
+	Duration float64 `json:"duration,omitempty"`
+	Pause    float64 `json:"pause,omitempty"`
+}
+
 type AIFormatterResponse struct {
-	Prompt_Tokens        uint32
-	Completion_Tokens    uint32
-	Total_Tokens         uint32
-	Processed_Text       string
-	Processed_Text_Array []string
+	Prompt_Tokens     uint32
+	Completion_Tokens uint32
+	Total_Tokens      uint32
+	Processed_Text    string
+	Lines             []FormattedLine
 }
 
-func AIFormatter(text_entry string) (*AIFormatterResponse, error) {
+// FormatterError indica que el modelo devolvió algo que no cumple el esquema,
+// incluso tras pedirle que lo corrija.
+type FormatterError struct {
+	Problems []string
+}
+
+func (e *FormatterError) Error() string {
+	return "el formateador devolvió un guion inválido: " + strings.Join(e.Problems, "; ")
+}
+
+// Esquema de la respuesta de Gemini: un arreglo de líneas.
+var formatterSchema = &genai.Schema{
+	Type: genai.TypeArray,
+	Items: &genai.Schema{
+		Type: genai.TypeObject,
+		Properties: map[string]*genai.Schema{
+			"type":     {Type: genai.TypeString, Enum: []string{"TTS", "SFX"}},
+			"text":     {Type: genai.TypeString},
+			"speaker":  {Type: genai.TypeString},
+			"duration": {Type: genai.TypeNumber, Nullable: genai.Ptr(true)},
+			"pause":    {Type: genai.TypeNumber, Nullable: genai.Ptr(true)},
+		},
+		Required:         []string{"type", "text", "speaker"},
+		PropertyOrdering: []string{"type", "speaker", "text", "duration", "pause"},
+	},
+}
+
+// AIFormatter divide el texto en líneas de narración, diálogo y efectos de
+// sonido. speakers son los personajes ya conocidos del proyecto, para que el
+// modelo reutilice sus nombres en lugar de inventar variantes. Si la salida no
+// cumple el esquema se le pide al modelo que la repare; si aun así falla se
+// devuelve un *FormatterError.
+func AIFormatter(text_entry string, speakers []string) (*AIFormatterResponse, error) {
 	ctx := context.Background()
 	client, err := genai.NewClient(ctx, &genai.ClientConfig{
 		APIKey:  os.Getenv("GEMINI_API_KEY"),
@@ -28,52 +91,185 @@ func AIFormatter(text_entry string) (*AIFormatterResponse, error) {
 		return nil, err
 	}
 
+	known := "none"
+	if len(speakers) > 0 {
+		known = strings.Join(speakers, ", ")
+	}
+
 	propmt := fmt.Sprintf(`
-	You are a text-to-speech pre-processor.
+	You are a text-to-speech pre-processor for multi-voice audiobooks.
 	Task:
 	1. Read the user text delimited by triple slash.
 	2. Split it into logical lines (one sentence or dialogue unit per line).
-	3. Whenever the text mentions or implies a sound effect
+	Spoken lines must not exceed %d characters; split longer sentences.
+	3. For every line, set "type" to "TTS" and "speaker" to the name of the
+	character who says it. Narration has an empty speaker. Dialogue tags
+	("she said", "—dijo Juan—") stay in a separate narration line, and the
+	quoted words go to the character without quotes or dashes.
+	4. Reuse these known character names exactly when they appear: %s.
+	5. Whenever the text mentions or implies a sound effect
 	(e.g. shattering glass, footsteps, thunder), output a **separate** line
-	that starts with an asterisk (*) followed by a detailed English,
-	onomatopoeic description of the sound suitable for ElevenLabs
-	(Example: *shattering glass — sharp crystalline crack followed by tinkling fragments scattering on a hard tile floor*).
-	4. Keep the original language for normal narrative or dialogue lines;
+	with "type" "SFX", an empty speaker, a detailed English, onomatopoeic
+	description of the sound suitable for ElevenLabs
+	(Example: shattering glass — sharp crystalline crack followed by tinkling fragments scattering on a hard tile floor)
+	and optionally its "duration" in seconds, between %.1f and %.0f.
+	6. Optionally set "pause" to the seconds of silence after a line
+	(at most %.0f), e.g. after a scene change.
+	7. Keep the original language for narrative or dialogue lines;
 	only the sound-effect lines must be in English.
-	5. Return **only** the processed lines, one per output line, with no extra commentary.
 	///%s///
-	`, text_entry)
-
-	resp, err := client.Models.GenerateContent(
-		ctx,
-		os.Getenv("GEMINI_MODEL"),
-		genai.Text(propmt),
-		nil,
-	)
-	if err != nil {
-		return nil, err
+	`, MaxTTSChars, known, MinSFXSeconds, MaxSFXSeconds, MaxPauseSeconds, text_entry)
+
+	config := &genai.GenerateContentConfig{
+		ResponseMIMEType: "application/json",
+		ResponseSchema:   formatterSchema,
+	}
+
+	var aiResponse AIFormatterResponse
+	for attempt := 0; ; attempt++ {
+		resp, err := client.Models.GenerateContent(
+			ctx,
+			os.Getenv("GEMINI_MODEL"),
+			genai.Text(propmt),
+			config,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		if usage := resp.UsageMetadata; usage != nil {
+			aiResponse.Prompt_Tokens += uint32(usage.PromptTokenCount)
+			aiResponse.Completion_Tokens += uint32(usage.CandidatesTokenCount)
+			aiResponse.Total_Tokens += uint32(usage.TotalTokenCount)
+		}
+
+		out := resp.Text()
+		lines, err := ParseFormattedLines(out)
+		if err == nil {
+			aiResponse.Lines = lines
+			aiResponse.Processed_Text = RenderLines(lines)
+			return &aiResponse, nil
+		}
+		if attempt >= formatterRepairAttempts {
+			return nil, err
+		}
+
+		propmt = repairPrompt(out, err)
 	}
+}
+
+// repairPrompt le devuelve al modelo su propia salida junto con los problemas
+// detectados para que la corrija sin volver a procesar el texto.
+func repairPrompt(output string, err error) string {
+	problems := []string{err.Error()}
+	var ferr *FormatterError
+	if errors.As(err, &ferr) {
+		problems = ferr.Problems
+	}
+
+	return fmt.Sprintf(`
+	Your previous answer does not conform to the required JSON schema.
+	Problems:
+	- %s
+	Fix only these problems and return the corrected JSON array, keeping
+	every other line unchanged. Previous answer delimited by triple slash:
+	///%s///
+	`, strings.Join(problems, "\n\t- "), output)
+}
+
+// ParseFormattedLines decodifica, normaliza y valida la respuesta JSON del
+// modelo.
+func ParseFormattedLines(raw string) ([]FormattedLine, error) {
+	var lines []FormattedLine
+	if err := json.Unmarshal([]byte(raw), &lines); err != nil {
+		return nil, &FormatterError{Problems: []string{"la respuesta no es un arreglo JSON válido: " + err.Error()}}
+	}
+
+	lines = NormalizeLines(lines)
+	if problems := ValidateLines(lines); len(problems) > 0 {
+		return nil, &FormatterError{Problems: problems}
+	}
+	return lines, nil
+}
 
-	out := resp.Text()
+// NormalizeLines limpia espacios, unifica las etiquetas de narrador a speaker
+// vacío, quita el speaker de los SFX y la duración de las líneas TTS. No
+// corrige nada que requiera adivinar: eso lo detecta ValidateLines.
+func NormalizeLines(lines []FormattedLine) []FormattedLine {
+	out := make([]FormattedLine, 0, len(lines))
+	for _, l := range lines {
+		l.Type = strings.ToUpper(strings.TrimSpace(l.Type))
+		l.Text = strings.TrimSpace(l.Text)
+		l.Speaker = strings.TrimSpace(l.Speaker)
 
-	var lines []string
-	for line := range strings.SplitSeq(out, "\n") {
-		trimmed := strings.TrimSpace(line)
-		if trimmed != "" {
-			lines = append(lines, trimmed)
+		if l.Type == "SFX" {
+			l.Text = strings.TrimSpace(strings.Trim(l.Text, "*"))
+			l.Speaker = ""
+		} else {
+			l.Duration = 0
 		}
+		if isNarrator(l.Speaker) {
+			l.Speaker = ""
+		}
+		out = append(out, l)
 	}
+	return out
+}
 
-	usage := resp.UsageMetadata
-	aiResponse := AIFormatterResponse{
-		Prompt_Tokens:        uint32(usage.PromptTokenCount),
-		Completion_Tokens:    uint32(usage.CandidatesTokenCount),
-		Total_Tokens:         uint32(usage.TotalTokenCount),
-		Processed_Text:       out,
-		Processed_Text_Array: lines,
+// ValidateLines devuelve los problemas de cada línea, con su índice, o nil si
+// el guion es válido.
+func ValidateLines(lines []FormattedLine) []string {
+	if len(lines) == 0 {
+		return []string{"el guion no tiene líneas"}
 	}
 
-	return &aiResponse, nil
+	var problems []string
+	for i, l := range lines {
+		if l.Type != "TTS" && l.Type != "SFX" {
+			problems = append(problems, fmt.Sprintf("línea %d: type %q debe ser TTS o SFX", i, l.Type))
+		}
+		if l.Text == "" {
+			problems = append(problems, fmt.Sprintf("línea %d: text vacío", i))
+		}
+		if l.Type == "TTS" && utf8.RuneCountInString(l.Text) > MaxTTSChars {
+			problems = append(problems, fmt.Sprintf("línea %d: text supera %d caracteres", i, MaxTTSChars))
+		}
+		if l.Duration != 0 && (l.Duration < MinSFXSeconds || l.Duration > MaxSFXSeconds) {
+			problems = append(problems, fmt.Sprintf("línea %d: duration debe estar entre %.1f y %.0f segundos", i, MinSFXSeconds, MaxSFXSeconds))
+		}
+		if l.Pause < 0 || l.Pause > MaxPauseSeconds {
+			problems = append(problems, fmt.Sprintf("línea %d: pause debe estar entre 0 y %.0f segundos", i, MaxPauseSeconds))
+		}
+	}
+	return problems
+}
+
+func isNarrator(speaker string) bool {
+	switch strings.ToLower(speaker) {
+	case "", "narrator", "narrador", "narradora":
+		return true
+	}
+	return false
+}
+
+// RenderLines arma la versión legible del guion: "Speaker: texto" para los
+// diálogos y "*descripción" para los efectos, una línea por renglón.
+func RenderLines(lines []FormattedLine) string {
+	var sb strings.Builder
+	for i, l := range lines {
+		if i > 0 {
+			sb.WriteRune('\n')
+		}
+		switch {
+		case l.Type == "SFX":
+			sb.WriteString("*" + l.Text)
+		case l.Speaker != "":
+			sb.WriteString(l.Speaker + ": " + l.Text)
+		default:
+			sb.WriteString(l.Text)
+		}
+	}
+	return sb.String()
 }
 
 // ! Función de emergencia buscar una solución mejor.
@@ -7,79 +7,145 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"path"
 	"strings"
 	"time"
 
+	"github.com/MetaDandy/cuent-ai-core/src/model"
 	"github.com/go-resty/resty/v2"
 	"github.com/hajimehoshi/go-mp3"
 )
 
+// AudioOutputResult describe el audio ya subido y quién lo generó.
+type AudioOutputResult struct {
+	Ref      string // referencia "bucket/clave" en el storage
+	Provider model.Provider
+	Model    string
+	Duration time.Duration
+	Chars    int
+	Cost     float64
+}
+
+// Duración de un SFX cuando la línea no pide una.
+const defaultSFXDuration = 3 * time.Second
+
 // ? Ver si enviar el context como parametro
-func AudioOutput(line, id, bucket, dirPath, audioType string) (
-	url, historyID string,
-	duration time.Duration,
-	err error,
-) {
+func AudioOutput(store BlobStore, provider SpeechProvider, voice VoiceSettings, line, id, bucket, dirPath, audioType string, sfxDuration time.Duration) (*AudioOutputResult, error) {
 	var (
-		audio    []byte
-		fileName string
+		audio  *SpeechAudio
+		prefix string
+		name   model.Provider
+		mdl    string
+		err    error
 	)
-	duration = 3 * time.Second
 
 	if audioType == "SFX" {
+		sfx := SoundEffectProviderFor(provider)
 		prompt := strings.TrimSpace(strings.TrimPrefix(line, "*"))
-		audio, historyID, err = TextToSoundEffects(
-			prompt,
-			duration.Seconds(),
-			1.0,
-			"mp3_44100_128",
-		)
-
-		fileName = fmt.Sprintf("sfx_%v.mp3", id)
+		if sfxDuration <= 0 {
+			sfxDuration = defaultSFXDuration
+		}
+		audio, err = sfx.SoundEffect(prompt, sfxDuration)
+		prefix, name, mdl = "sfx", sfx.Name(), sfx.Model()
 	} else {
 		// Esto es TTS normal
-		audio, historyID, err = TextToSpeechElevenlabs(line, "")
-		if err != nil {
-			return "", historyID, 0, err
-		}
-		fileName = fmt.Sprintf("tts_%v.mp3", id)
-		duration, err = Mp3Duration(audio)
-		if err != nil {
-			return "", historyID, 0, err
-		}
+		audio, err = provider.TextToSpeech(line, voice)
+		prefix, name, mdl = "tts", provider.Name(), provider.Model()
 	}
-
 	if err != nil {
-		return "", historyID, 0, err
+		return nil, err
+	}
+
+	if audio.Duration == 0 && audio.Mime == "audio/mpeg" {
+		if audio.Duration, err = Mp3Duration(audio.Data); err != nil {
+			return nil, err
+		}
 	}
 
-	if url, err = Upload(
+	key := path.Join(dirPath, fmt.Sprintf("%s_%v.%s", prefix, id, audio.Ext))
+	if _, err := store.Put(
 		context.TODO(),
 		bucket,
-		dirPath,
-		fileName,
-		bytes.NewReader(audio),
-		"audio/mpeg",
-		true,
+		key,
+		bytes.NewReader(audio.Data),
+		audio.Mime,
 	); err != nil {
-		return "", historyID, 0, err
+		return nil, err
+	}
+
+	return &AudioOutputResult{
+		Ref:      ObjectRef(bucket, key),
+		Provider: name,
+		Model:    mdl,
+		Duration: audio.Duration,
+		Chars:    audio.Chars,
+		Cost:     audio.Cost,
+	}, nil
+}
+
+// ElevenLabsProvider genera voz y efectos con la API de ElevenLabs.
+type ElevenLabsProvider struct{}
+
+func (p *ElevenLabsProvider) Name() model.Provider { return model.ProviderElevenlab }
+func (p *ElevenLabsProvider) Model() string        { return "eleven_monolingual_v1" }
+
+func (p *ElevenLabsProvider) TextToSpeech(text string, voice VoiceSettings) (*SpeechAudio, error) {
+	audio, historyID, err := TextToSpeechElevenlabs(text, voice)
+	if err != nil {
+		return nil, err
 	}
+	return p.result(audio, historyID), nil
+}
 
-	return url, historyID, duration, nil
+func (p *ElevenLabsProvider) SoundEffect(description string, duration time.Duration) (*SpeechAudio, error) {
+	audio, historyID, err := TextToSoundEffects(
+		description,
+		duration.Seconds(),
+		1.0,
+		"mp3_44100_128",
+	)
+	if err != nil {
+		return nil, err
+	}
+	res := p.result(audio, historyID)
+	res.Duration = duration
+	return res, nil
 }
 
-func TextToSpeechElevenlabs(text, voice_id string) ([]byte, string, error) {
+func (p *ElevenLabsProvider) result(audio []byte, historyID string) *SpeechAudio {
+	chars, err := CharactersUsed(historyID)
+	if err != nil {
+		chars = 0
+	}
+	return &SpeechAudio{
+		Data:  audio,
+		Mime:  "audio/mpeg",
+		Ext:   "mp3",
+		Chars: chars,
+		Cost:  float64(chars) / 1000 * 0.30, // tarifa por 1 K caracteres
+	}
+}
+
+func TextToSpeechElevenlabs(text string, voice VoiceSettings) ([]byte, string, error) {
 	apiKey := os.Getenv("ELEVEN_API_KEY")
 	if apiKey == "" {
 		return nil, "", fmt.Errorf("API key no encontrada en variables de entorno")
 	}
 
 	client := resty.New()
-	if voice_id == "" {
-		voice_id = "29vD33N1CtxCmqQRPOHJ" // VR6AewLTigWG4xSOukaG
+	voiceID := voice.ID
+	if voiceID == "" {
+		voiceID = "29vD33N1CtxCmqQRPOHJ" // VR6AewLTigWG4xSOukaG
+	}
+	stability, similarity := voice.Stability, voice.Similarity
+	if stability == 0 {
+		stability = 0.5
+	}
+	if similarity == 0 {
+		similarity = 0.75
 	}
 
-	url := fmt.Sprintf("https://api.elevenlabs.io/v1/text-to-speech/%s", voice_id)
+	url := fmt.Sprintf("https://api.elevenlabs.io/v1/text-to-speech/%s", voiceID)
 
 	resp, err := client.R().
 		SetHeader("Content-Type", "application/json").
@@ -90,8 +156,8 @@ func TextToSpeechElevenlabs(text, voice_id string) ([]byte, string, error) {
 			"text":     text,
 			"model_id": "eleven_monolingual_v1", // eleven_monolingual_v2
 			"voice_settings": map[string]interface{}{
-				"stability":        0.5,
-				"similarity_boost": 0.75,
+				"stability":        stability,
+				"similarity_boost": similarity,
 			},
 		}).
 		SetDoNotParseResponse(true).
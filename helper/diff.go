@@ -0,0 +1,58 @@
+package helper
+
+// DiffOp es el tipo de cambio de una línea entre dos versiones.
+type DiffOp string
+
+const (
+	DiffEqual  DiffOp = "equal"
+	DiffInsert DiffOp = "insert"
+	DiffDelete DiffOp = "delete"
+)
+
+// LineDiff es una línea del diff. From y To son sus posiciones en cada
+// versión; -1 cuando la línea no existe en ella.
+type LineDiff struct {
+	Op   DiffOp
+	From int
+	To   int
+}
+
+// DiffLines compara dos listas de líneas con la subsecuencia común más
+// larga y devuelve las operaciones en orden de lectura; ante un cambio, las
+// líneas borradas van antes que las insertadas.
+func DiffLines[T any](from, to []T, equal func(a, b T) bool) []LineDiff {
+	n, m := len(from), len(to)
+
+	// lcs[i][j] es la subsecuencia común más larga de from[i:] y to[j:].
+	lcs := make([][]int, n+1)
+	for i := range lcs {
+		lcs[i] = make([]int, m+1)
+	}
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			if equal(from[i], to[j]) {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	out := make([]LineDiff, 0, max(n, m))
+	i, j := 0, 0
+	for i < n || j < m {
+		switch {
+		case i < n && j < m && equal(from[i], to[j]):
+			out = append(out, LineDiff{Op: DiffEqual, From: i, To: j})
+			i++
+			j++
+		case j == m || (i < n && lcs[i+1][j] >= lcs[i][j+1]):
+			out = append(out, LineDiff{Op: DiffDelete, From: i, To: -1})
+			i++
+		default:
+			out = append(out, LineDiff{Op: DiffInsert, From: -1, To: j})
+			j++
+		}
+	}
+	return out
+}
@@ -1,6 +1,13 @@
 package helper
 
-import "golang.org/x/crypto/bcrypt"
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+
+	"golang.org/x/crypto/bcrypt"
+)
 
 func HashPassword(pass string) (string, error) {
 	bytes, err := bcrypt.GenerateFromPassword([]byte(pass), bcrypt.DefaultCost)
@@ -11,3 +18,22 @@ func CheckPasswordHash(pass, hash string) bool {
 	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(pass))
 	return err == nil
 }
+
+// NewOpaqueToken genera un token aleatorio para refresh tokens y enlaces de
+// un solo uso. Al cliente se le da raw; en la BD sólo se guarda el hash.
+func NewOpaqueToken() (raw, hash string, err error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", "", err
+	}
+	raw = base64.RawURLEncoding.EncodeToString(buf)
+	return raw, HashOpaqueToken(raw), nil
+}
+
+// HashOpaqueToken devuelve el SHA-256 en hex. Al ser un valor aleatorio de
+// 256 bits no hace falta un hash lento como bcrypt, y así se puede buscar por
+// índice.
+func HashOpaqueToken(raw string) string {
+	sum := sha256.Sum256([]byte(raw))
+	return hex.EncodeToString(sum[:])
+}
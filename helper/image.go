@@ -1,83 +1,206 @@
 package helper
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"net/url"
 	"os"
 	"strings"
+
+	"github.com/MetaDandy/cuent-ai-core/src/model"
 )
 
-// Image contiene los datos que quieres extraer de cada resultado.
-// Aquí guardamos sólo la URL de tamaño "regular", pero puedes añadir más campos.
-type Image struct {
-	ID  string `json:"id"`
-	Url string `json:"url"`
+// Image es una imagen que puede ir en un video; es la misma que se guarda en
+// el asset.
+type Image = model.AssetImage
+
+// ImageQuery es una búsqueda de imágenes. UserID sólo lo usan los
+// proveedores con imágenes privadas (las subidas del usuario).
+type ImageQuery struct {
+	Text   string
+	UserID string
+}
+
+// ImageProvider es una fuente de imágenes para los videos.
+type ImageProvider interface {
+	Source() model.ImageSource
+	Search(ctx context.Context, q ImageQuery) ([]Image, error)
+	// Lookup resuelve una imagen elegida por el cliente a partir de su ID, y
+	// comprueba que el usuario pueda usarla.
+	Lookup(ctx context.Context, userID, id string) (*Image, error)
+	// Open lee el archivo de la imagen para renderizar.
+	Open(ctx context.Context, img Image) (io.ReadCloser, error)
+}
+
+var (
+	ErrImageSource   = errors.New("fuente de imágenes no disponible")
+	ErrImageNotFound = errors.New("imagen no encontrada")
+)
+
+// ImageProviders agrupa los proveedores configurados por fuente.
+type ImageProviders map[model.ImageSource]ImageProvider
+
+// NewImageProvidersFromEnv registra Unsplash, las subidas de los usuarios y,
+// si IMAGE_LIBRARY_DIR apunta a una carpeta, la biblioteca local de stock.
+func NewImageProvidersFromEnv(store BlobStore) (ImageProviders, error) {
+	providers := ImageProviders{
+		model.ImageUnsplash: &UnsplashProvider{},
+		model.ImageUpload:   NewUploadImages(store),
+	}
+
+	if dir := os.Getenv("IMAGE_LIBRARY_DIR"); dir != "" {
+		base := os.Getenv("IMAGE_LIBRARY_URL")
+		if base == "" {
+			base = "http://localhost:" + os.Getenv("PORT") + "/library"
+		}
+		lib, err := NewImageLibrary(dir, base)
+		if err != nil {
+			return nil, err
+		}
+		providers[model.ImageLibrary] = lib
+	}
+	return providers, nil
+}
+
+// Get devuelve el proveedor de la fuente indicada. Vacío usa IMAGE_PROVIDER
+// y, en su defecto, Unsplash.
+func (p ImageProviders) Get(source string) (ImageProvider, error) {
+	if source == "" {
+		source = os.Getenv("IMAGE_PROVIDER")
+	}
+	name := model.ImageSource(strings.ToUpper(strings.TrimSpace(source)))
+	if name == "" {
+		name = model.ImageUnsplash
+	}
+	if provider, ok := p[name]; ok {
+		return provider, nil
+	}
+	return nil, fmt.Errorf("%w: %s", ErrImageSource, source)
+}
+
+// Download copia la imagen al archivo dest usando su proveedor.
+func (p ImageProviders) Download(ctx context.Context, img Image, dest string) error {
+	provider, ok := p[img.Source]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrImageSource, img.Source)
+	}
+	body, err := provider.Open(ctx, img)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	f, err := os.Create(dest)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = io.Copy(f, body)
+	return err
+}
+
+// PresignImages firma las imágenes subidas por los usuarios; las URLs
+// públicas quedan tal cual.
+func PresignImages(store BlobStore, images []Image) {
+	for i := range images {
+		images[i].URL = PresignRef(context.TODO(), store, images[i].URL)
+	}
+}
+
+// UnsplashProvider busca fotos en la API de Unsplash con UNSPLASH_ACCESS_KEY.
+type UnsplashProvider struct{}
+
+const unsplashAPI = "https://api.unsplash.com"
+
+// unsplashPhoto refleja la estructura parcial de una foto de Unsplash.
+type unsplashPhoto struct {
+	ID   string `json:"id"`
+	Urls struct {
+		Regular string `json:"regular"`
+	} `json:"urls"`
 }
 
 // searchResponse refleja la estructura parcial de la respuesta JSON de Unsplash.
 type searchResponse struct {
-	Results []struct {
-		ID   string `json:"id"`
-		Urls struct {
-			Regular string `json:"regular"`
-		} `json:"urls"`
-	} `json:"results"`
+	Results []unsplashPhoto `json:"results"`
 }
 
-// SearchImage consulta la API de Unsplash para obtener todas las imágenes
-// relacionadas con el texto `prompt`. Devuelve un slice de Image o error.
-func SearchImage(prompt string) ([]Image, error) {
-	apiKey := os.Getenv("UNSPLASH_ACCESS_KEY")
-	if apiKey == "" {
-		return nil, fmt.Errorf("debes definir la variable de entorno UNSPLASH_ACCESS_KEY")
-	}
+func (u *UnsplashProvider) Source() model.ImageSource { return model.ImageUnsplash }
 
-	prompt = strings.TrimSpace(prompt)
+// Search consulta la API de Unsplash para obtener las imágenes relacionadas
+// con el texto de la búsqueda.
+func (u *UnsplashProvider) Search(ctx context.Context, q ImageQuery) ([]Image, error) {
+	prompt := strings.TrimSpace(q.Text)
 	if prompt == "" {
 		return nil, errors.New("el parámetro prompt no puede estar vacío")
 	}
 
-	endpoint := "https://api.unsplash.com/search/photos"
 	params := url.Values{}
-	params.Set("client_id", apiKey)
 	params.Set("query", prompt)
 	params.Set("page", "1")
 	params.Set("per_page", "10")
 
-	reqURL := endpoint + "?" + params.Encode()
+	var data searchResponse
+	if err := u.get(ctx, "/search/photos?"+params.Encode(), &data); err != nil {
+		return nil, err
+	}
 
-	req, err := http.NewRequest("GET", reqURL, nil)
-	if err != nil {
+	images := make([]Image, len(data.Results))
+	for i, r := range data.Results {
+		images[i] = u.image(r)
+	}
+	return images, nil
+}
+
+func (u *UnsplashProvider) Lookup(ctx context.Context, _ string, id string) (*Image, error) {
+	if id == "" || strings.ContainsAny(id, "/?#") {
+		return nil, ErrImageNotFound
+	}
+	var photo unsplashPhoto
+	if err := u.get(ctx, "/photos/"+url.PathEscape(id), &photo); err != nil {
 		return nil, err
 	}
+	img := u.image(photo)
+	return &img, nil
+}
+
+func (u *UnsplashProvider) Open(ctx context.Context, img Image) (io.ReadCloser, error) {
+	return OpenURL(ctx, nil, img.URL)
+}
+
+func (u *UnsplashProvider) image(p unsplashPhoto) Image {
+	return Image{Source: model.ImageUnsplash, ID: p.ID, URL: p.Urls.Regular}
+}
+
+func (u *UnsplashProvider) get(ctx context.Context, path string, out any) error {
+	apiKey := os.Getenv("UNSPLASH_ACCESS_KEY")
+	if apiKey == "" {
+		return fmt.Errorf("debes definir la variable de entorno UNSPLASH_ACCESS_KEY")
+	}
 
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, unsplashAPI+path, nil)
+	if err != nil {
+		return err
+	}
 	req.Header.Set("Accept-Version", "v1")
 	req.Header.Set("Authorization", "Client-ID "+apiKey)
 
 	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
-		return nil, err
+		return err
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("error Unsplash API: code %d", resp.StatusCode)
-	}
-
-	var data searchResponse
-	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
-		return nil, err
+	if resp.StatusCode == http.StatusNotFound {
+		return ErrImageNotFound
 	}
-
-	images := make([]Image, len(data.Results))
-	for i, r := range data.Results {
-		images[i] = Image{
-			ID:  r.ID,
-			Url: r.Urls.Regular,
-		}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("error Unsplash API: code %d", resp.StatusCode)
 	}
-	return images, nil
+	return json.NewDecoder(resp.Body).Decode(out)
 }
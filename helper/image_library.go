@@ -0,0 +1,143 @@
+package helper
+
+import (
+	"context"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/MetaDandy/cuent-ai-core/src/model"
+	"github.com/gofiber/fiber/v2"
+)
+
+// maxLibraryResults limita las imágenes devueltas por búsqueda.
+const maxLibraryResults = 30
+
+var libraryExts = map[string]bool{".jpg": true, ".jpeg": true, ".png": true, ".webp": true}
+
+// ImageLibrary es una carpeta local con imágenes de stock. La búsqueda
+// compara las palabras pedidas con la ruta de cada archivo, así que conviene
+// nombrarlos y ordenarlos por tema (p. ej. "bosque/noche-luna.jpg"). Las
+// imágenes son públicas y las sirve Handler en la ruta de baseURL.
+type ImageLibrary struct {
+	dir     string
+	baseURL string // p. ej. http://localhost:8080/library
+}
+
+func NewImageLibrary(dir, baseURL string) (*ImageLibrary, error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, &fs.PathError{Op: "library", Path: dir, Err: fs.ErrInvalid}
+	}
+	return &ImageLibrary{dir: dir, baseURL: strings.TrimRight(baseURL, "/")}, nil
+}
+
+func (l *ImageLibrary) Source() model.ImageSource { return model.ImageLibrary }
+
+// path devuelve la ruta en disco de la imagen y rechaza las que salen de la
+// carpeta o no son imágenes.
+func (l *ImageLibrary) path(id string) (string, bool) {
+	clean := path.Clean("/" + id)[1:]
+	if clean == "" || !libraryExts[strings.ToLower(path.Ext(clean))] {
+		return "", false
+	}
+	return filepath.Join(l.dir, filepath.FromSlash(clean)), true
+}
+
+func (l *ImageLibrary) image(id string) Image {
+	return Image{Source: model.ImageLibrary, ID: id, URL: l.baseURL + "/" + (&url.URL{Path: id}).EscapedPath()}
+}
+
+// Search devuelve las imágenes cuya ruta contiene todas las palabras de la
+// búsqueda; sin palabras devuelve las primeras de la carpeta.
+func (l *ImageLibrary) Search(ctx context.Context, q ImageQuery) ([]Image, error) {
+	words := strings.Fields(strings.ToLower(q.Text))
+	var images []Image
+
+	err := filepath.WalkDir(l.dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !libraryExts[strings.ToLower(filepath.Ext(p))] {
+			return nil
+		}
+		rel, err := filepath.Rel(l.dir, p)
+		if err != nil {
+			return err
+		}
+		id := filepath.ToSlash(rel)
+		name := strings.NewReplacer("-", " ", "_", " ", "/", " ").Replace(strings.ToLower(id))
+		for _, w := range words {
+			if !strings.Contains(name, w) {
+				return nil
+			}
+		}
+		images = append(images, l.image(id))
+		return ctx.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(images, func(i, j int) bool { return images[i].ID < images[j].ID })
+	if len(images) > maxLibraryResults {
+		images = images[:maxLibraryResults]
+	}
+	return images, nil
+}
+
+func (l *ImageLibrary) Lookup(_ context.Context, _ string, id string) (*Image, error) {
+	p, ok := l.path(id)
+	if !ok {
+		return nil, ErrImageNotFound
+	}
+	if info, err := os.Stat(p); err != nil || info.IsDir() {
+		return nil, ErrImageNotFound
+	}
+	img := l.image(path.Clean("/" + id)[1:])
+	return &img, nil
+}
+
+func (l *ImageLibrary) Open(_ context.Context, img Image) (io.ReadCloser, error) {
+	p, ok := l.path(img.ID)
+	if !ok {
+		return nil, ErrImageNotFound
+	}
+	return os.Open(p)
+}
+
+// Route es la ruta de Fiber donde montar Handler, derivada de baseURL.
+func (l *ImageLibrary) Route() string {
+	prefix := "/library"
+	if u, err := url.Parse(l.baseURL); err == nil && u.Path != "" {
+		prefix = u.Path
+	}
+	return prefix + "/*"
+}
+
+// Handler sirve las imágenes de la biblioteca, que son públicas.
+func (l *ImageLibrary) Handler() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		id, err := url.PathUnescape(c.Params("*"))
+		if err != nil {
+			return JSONError(c, http.StatusBadRequest, "Ruta inválida", err.Error())
+		}
+		p, ok := l.path(id)
+		if !ok {
+			return JSONError(c, http.StatusNotFound, "Imagen no encontrada", "")
+		}
+		if info, err := os.Stat(p); err != nil || info.IsDir() {
+			return JSONError(c, http.StatusNotFound, "Imagen no encontrada", "")
+		}
+		return c.SendFile(p)
+	}
+}
@@ -0,0 +1,130 @@
+package helper
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/MetaDandy/cuent-ai-core/src/model"
+	"github.com/google/uuid"
+)
+
+// imageBucket guarda las imágenes subidas, bajo <userID>/.
+const imageBucket = "images"
+
+// ErrInvalidImage se devuelve al subir un archivo que no es una imagen.
+var ErrInvalidImage = errors.New("el archivo debe ser una imagen jpg, png o webp")
+
+var uploadMimes = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/webp": ".webp",
+}
+
+var nonSlug = regexp.MustCompile(`[^a-z0-9]+`)
+
+// UploadImages son las imágenes que cada usuario sube al storage. Sólo las ve
+// y las usa su dueño.
+type UploadImages struct {
+	store BlobStore
+}
+
+func NewUploadImages(store BlobStore) *UploadImages {
+	return &UploadImages{store: store}
+}
+
+func (u *UploadImages) Source() model.ImageSource { return model.ImageUpload }
+
+func (u *UploadImages) image(key string) Image {
+	return Image{Source: model.ImageUpload, ID: key, URL: ObjectRef(imageBucket, key)}
+}
+
+// Upload guarda la imagen como <userID>/<uuid>_<nombre>.<ext>; el nombre
+// original queda en la clave para poder buscarla. El tipo se deduce del
+// contenido, no del Content-Type que manda el cliente.
+func (u *UploadImages) Upload(ctx context.Context, userID, filename string, body io.Reader) (*Image, error) {
+	head := make([]byte, 512)
+	n, err := io.ReadFull(body, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return nil, err
+	}
+	head = head[:n]
+	mime := http.DetectContentType(head)
+	ext, ok := uploadMimes[mime]
+	if !ok {
+		return nil, ErrInvalidImage
+	}
+	body = io.MultiReader(bytes.NewReader(head), body)
+	name := strings.TrimSuffix(path.Base(strings.ReplaceAll(filename, `\`, "/")), path.Ext(filename))
+	slug := strings.Trim(nonSlug.ReplaceAllString(strings.ToLower(name), "-"), "-")
+	if len(slug) > 60 {
+		slug = slug[:60]
+	}
+
+	key := path.Join(userID, uuid.NewString()+"_"+slug+ext)
+	if _, err := u.store.Put(ctx, imageBucket, key, body, mime); err != nil {
+		return nil, err
+	}
+	img := u.image(key)
+	return &img, nil
+}
+
+// Search lista las imágenes subidas por el usuario cuyo nombre contiene las
+// palabras de la búsqueda.
+func (u *UploadImages) Search(ctx context.Context, q ImageQuery) ([]Image, error) {
+	if q.UserID == "" {
+		return nil, ErrImageNotFound
+	}
+	keys, err := u.store.List(ctx, imageBucket, q.UserID)
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(keys)
+
+	words := strings.Fields(strings.ToLower(q.Text))
+	images := make([]Image, 0, len(keys))
+	for _, key := range keys {
+		_, name, _ := strings.Cut(path.Base(key), "_")
+		name = strings.ReplaceAll(name, "-", " ")
+		match := true
+		for _, w := range words {
+			if !strings.Contains(name, w) {
+				match = false
+				break
+			}
+		}
+		if match {
+			images = append(images, u.image(key))
+		}
+	}
+	return images, nil
+}
+
+// Lookup sólo acepta imágenes dentro de la carpeta del usuario.
+func (u *UploadImages) Lookup(ctx context.Context, userID, id string) (*Image, error) {
+	key := path.Clean("/" + id)[1:]
+	if userID == "" || !strings.HasPrefix(key, userID+"/") {
+		return nil, ErrImageNotFound
+	}
+	body, err := u.store.Get(ctx, imageBucket, key)
+	if err != nil {
+		if errors.Is(err, ErrObjectNotFound) {
+			return nil, ErrImageNotFound
+		}
+		return nil, err
+	}
+	body.Close()
+
+	img := u.image(key)
+	return &img, nil
+}
+
+func (u *UploadImages) Open(ctx context.Context, img Image) (io.ReadCloser, error) {
+	return u.store.Get(ctx, imageBucket, img.ID)
+}
@@ -5,14 +5,45 @@ import (
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
 )
 
-func GenerateJwt(user_id, email string) (string, error) {
+const (
+	defaultAccessTokenTTL  = 15 * time.Minute
+	defaultRefreshTokenTTL = 30 * 24 * time.Hour
+)
+
+// AccessTokenTTL lee JWT_ACCESS_TTL (p. ej. "15m"); por defecto 15 minutos.
+func AccessTokenTTL() time.Duration {
+	if ttl, err := time.ParseDuration(os.Getenv("JWT_ACCESS_TTL")); err == nil && ttl > 0 {
+		return ttl
+	}
+	return defaultAccessTokenTTL
+}
+
+// RefreshTokenTTL lee JWT_REFRESH_TTL (p. ej. "720h"); por defecto 30 días.
+func RefreshTokenTTL() time.Duration {
+	if ttl, err := time.ParseDuration(os.Getenv("JWT_REFRESH_TTL")); err == nil && ttl > 0 {
+		return ttl
+	}
+	return defaultRefreshTokenTTL
+}
+
+// GenerateJwt emite un access token suelto, con un jti propio.
+func GenerateJwt(user_id, email, role string) (string, error) {
+	return GenerateJwtWithID(uuid.NewString(), user_id, email, role)
+}
+
+// GenerateJwtWithID emite un access token cuyo jti es el de la sesión, para
+// que revocar la sesión invalide también los access tokens que siguen vivos.
+func GenerateJwtWithID(jti, user_id, email, role string) (string, error) {
 	token := jwt.New(jwt.SigningMethodHS256)
 	claims := token.Claims.(jwt.MapClaims)
+	claims["jti"] = jti
 	claims["sub"] = user_id
 	claims["email"] = email
-	claims["exp"] = time.Now().Add(time.Hour * 24).Unix() // Token expira en 24 horas
+	claims["role"] = role
+	claims["exp"] = time.Now().Add(AccessTokenTTL()).Unix()
 
 	return token.SignedString([]byte(os.Getenv("JWT_SECRET")))
 }
@@ -0,0 +1,67 @@
+package helper
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"mime"
+	"os"
+	"strings"
+	"time"
+)
+
+// Mail es un correo de texto plano.
+type Mail struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer envía correos transaccionales (verificación de email, recuperación
+// de contraseña). Hay una implementación SMTP y otra que los deja en disco
+// para desarrollo y tests.
+type Mailer interface {
+	Send(ctx context.Context, m Mail) error
+}
+
+// NewMailerFromEnv elige la implementación según MAILER_BACKEND (SMTP o
+// FILE). Por defecto usa FILE, así en local no hace falta un servidor SMTP.
+func NewMailerFromEnv() (Mailer, error) {
+	from := os.Getenv("MAIL_FROM")
+	if from == "" {
+		from = "no-reply@cuent.ai"
+	}
+
+	switch backend := strings.ToUpper(os.Getenv("MAILER_BACKEND")); backend {
+	case "", "FILE":
+		dir := os.Getenv("MAIL_DIR")
+		if dir == "" {
+			dir = "mail"
+		}
+		return NewFileMailer(dir, from)
+	case "SMTP":
+		return NewSMTPMailer(SMTPConfig{
+			Host:     os.Getenv("SMTP_HOST"),
+			Port:     os.Getenv("SMTP_PORT"),
+			Username: os.Getenv("SMTP_USERNAME"),
+			Password: os.Getenv("SMTP_PASSWORD"),
+			From:     from,
+		})
+	default:
+		return nil, fmt.Errorf("backend de correo no soportado: %s", backend)
+	}
+}
+
+// buildMessage arma el mensaje RFC 5322 que comparten SMTP y FILE.
+func buildMessage(from string, m Mail) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", m.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", m.Subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("Content-Transfer-Encoding: 8bit\r\n\r\n")
+	b.WriteString(strings.ReplaceAll(m.Body, "\n", "\r\n"))
+	return b.Bytes()
+}
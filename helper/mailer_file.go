@@ -0,0 +1,45 @@
+package helper
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// FileMailer no envía nada: guarda cada correo como .eml en dir y lo deja en
+// el log. Sirve para desarrollo y para que los tests lean los enlaces.
+type FileMailer struct {
+	dir  string
+	from string
+}
+
+func NewFileMailer(dir, from string) (*FileMailer, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &FileMailer{dir: dir, from: from}, nil
+}
+
+func (m *FileMailer) Send(ctx context.Context, mail Mail) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	name := fmt.Sprintf("%s-%s-%s.eml",
+		time.Now().UTC().Format("20060102T150405"),
+		strings.NewReplacer("@", "_at_", "/", "_", `\`, "_").Replace(mail.To),
+		uuid.NewString()[:8])
+	path := filepath.Join(m.dir, name)
+	if err := os.WriteFile(path, buildMessage(m.from, mail), 0o644); err != nil {
+		return err
+	}
+
+	log.Printf("[mail] %q para %s guardado en %s", mail.Subject, mail.To, path)
+	return nil
+}
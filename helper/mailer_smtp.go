@@ -0,0 +1,52 @@
+package helper
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/smtp"
+)
+
+type SMTPConfig struct {
+	Host     string
+	Port     string // por defecto 587
+	Username string
+	Password string
+	From     string
+}
+
+// SMTPMailer envía por SMTP con STARTTLS cuando el servidor lo ofrece. Sin
+// usuario no se autentica (relays internos, MailHog).
+type SMTPMailer struct {
+	addr string
+	auth smtp.Auth
+	from string
+}
+
+func NewSMTPMailer(cfg SMTPConfig) (*SMTPMailer, error) {
+	if cfg.Host == "" {
+		return nil, errors.New("SMTP_HOST es obligatorio")
+	}
+	if cfg.Port == "" {
+		cfg.Port = "587"
+	}
+
+	var auth smtp.Auth
+	if cfg.Username != "" {
+		auth = smtp.PlainAuth("", cfg.Username, cfg.Password, cfg.Host)
+	}
+	return &SMTPMailer{
+		addr: net.JoinHostPort(cfg.Host, cfg.Port),
+		auth: auth,
+		from: cfg.From,
+	}, nil
+}
+
+// Send no puede cancelarse a mitad: net/smtp no acepta contexto, así que sólo
+// se revisa antes de conectar.
+func (m *SMTPMailer) Send(ctx context.Context, mail Mail) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return smtp.SendMail(m.addr, m.auth, m.from, []string{mail.To}, buildMessage(m.from, mail))
+}
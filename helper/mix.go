@@ -3,100 +3,280 @@ package helper
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
-	"io"
-	"net/http"
+	"math"
 	"os"
 	"os/exec"
+	"path"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/MetaDandy/cuent-ai-core/src/model"
 )
 
-func MixAudio(id string, assets []model.Asset) (string, error) {
+// MixLayer agrupa los clips que se suman antes de la mezcla final.
+type MixLayer string
+
+const (
+	LayerVoice MixLayer = "voice"
+	LayerSFX   MixLayer = "sfx"
+)
+
+// MixClip es un asset colocado en la línea de tiempo. Los tiempos van en
+// segundos y Gain en dB.
+type MixClip struct {
+	Input    int // índice del archivo de entrada en ffmpeg
+	Layer    MixLayer
+	Start    float64
+	Duration float64
+	Gain     float64
+	FadeIn   float64
+	FadeOut  float64
+}
+
+func (c MixClip) End() float64 { return c.Start + c.Duration }
+
+// BuildTimeline coloca los assets (ya ordenados por posición) en la línea de
+// tiempo. La narración va una línea tras otra, separadas por el Pause del
+// asset o, si no tiene, por mix.Gap; con Crossfade la siguiente línea entra
+// antes, descontándolo del silencio, y ambas se funden. Los SFX se superponen
+// a la narración: empiezan donde iría la siguiente línea pero no la empujan.
+// durations trae la duración real de cada asset. Devuelve los clips y la
+// duración total.
+func BuildTimeline(assets []model.Asset, durations []float64, mix model.MixSettings) ([]MixClip, float64) {
+	clips := make([]MixClip, 0, len(assets))
+	cursor := 0.0
+	prevVoice := -1
+
+	for i, a := range assets {
+		t := mix.Tracks[a.ID.String()]
+		clip := MixClip{
+			Input:    i,
+			Layer:    LayerVoice,
+			Duration: durations[i],
+			Gain:     t.Gain,
+			FadeIn:   t.FadeIn,
+			FadeOut:  t.FadeOut,
+		}
+
+		if a.Type == model.AudioSFX {
+			clip.Layer = LayerSFX
+			clip.Start = math.Max(0, cursor+t.Offset)
+		} else {
+			start := cursor
+			if prevVoice >= 0 && mix.Crossfade > 0 {
+				xf := math.Min(mix.Crossfade, math.Min(clips[prevVoice].Duration, clip.Duration))
+				start -= xf
+				clips[prevVoice].FadeOut = math.Max(clips[prevVoice].FadeOut, xf)
+				clip.FadeIn = math.Max(clip.FadeIn, xf)
+			}
+			clip.Start = math.Max(0, start+t.Offset)
+
+			gap := mix.Gap
+			if a.Pause > 0 {
+				gap = a.Pause
+			}
+			cursor = clip.End() + gap
+			prevVoice = len(clips)
+		}
+		clips = append(clips, clip)
+	}
+
+	total := 0.0
+	for i := range clips {
+		clampFades(&clips[i])
+		total = math.Max(total, clips[i].End())
+	}
+	return clips, total
+}
+
+// clampFades recorta los fundidos para que no pasen de la duración del clip.
+func clampFades(c *MixClip) {
+	if sum := c.FadeIn + c.FadeOut; sum > c.Duration && sum > 0 {
+		k := c.Duration / sum
+		c.FadeIn *= k
+		c.FadeOut *= k
+	}
+}
+
+// Parámetros del ducking y del cierre de la música.
+const (
+	duckThreshold = 0.03
+	duckRatio     = 8
+	duckAttackMs  = 20
+	duckReleaseMs = 500
+	musicFadeOut  = 2.0
+)
+
+// MixFilterGraph arma el filter_complex de ffmpeg para la línea de tiempo.
+// Cada clip se normaliza a 44.1 kHz estéreo, se ajusta su volumen y fundidos
+// y se retrasa hasta su inicio; luego se suman por capa. Si musicInput >= 0
+// la música (en bucle) se recorta a la duración total y, con ducking, se
+// comprime usando la voz como sidechain. La salida [out] se normaliza a la
+// sonoridad pedida con loudnorm (EBU R128).
+func MixFilterGraph(clips []MixClip, total float64, mix model.MixSettings, musicInput int) string {
+	var (
+		g      strings.Builder
+		layers = map[MixLayer][]string{}
+	)
+
+	for i, c := range clips {
+		fmt.Fprintf(&g, "[%d:a]aformat=sample_fmts=fltp:sample_rates=44100:channel_layouts=stereo,volume=%sdB", c.Input, ffFloat(c.Gain))
+		if c.FadeIn > 0 {
+			fmt.Fprintf(&g, ",afade=t=in:st=0:d=%s", ffFloat(c.FadeIn))
+		}
+		if c.FadeOut > 0 {
+			fmt.Fprintf(&g, ",afade=t=out:st=%s:d=%s", ffFloat(c.Duration-c.FadeOut), ffFloat(c.FadeOut))
+		}
+		delay := int64(math.Round(c.Start * 1000))
+		fmt.Fprintf(&g, ",adelay=%d|%d[c%d];", delay, delay, i)
+		layers[c.Layer] = append(layers[c.Layer], fmt.Sprintf("[c%d]", i))
+	}
+
+	var buses []string
+	for _, layer := range []MixLayer{LayerVoice, LayerSFX} {
+		if in := layers[layer]; len(in) > 0 {
+			label := "[" + string(layer) + "]"
+			g.WriteString(sumFilter(in, label))
+			buses = append(buses, label)
+		}
+	}
+
+	if musicInput >= 0 {
+		fadeStart := math.Max(0, total-musicFadeOut)
+		fmt.Fprintf(&g, "[%d:a]aformat=sample_fmts=fltp:sample_rates=44100:channel_layouts=stereo,volume=%sdB,atrim=0:%s,afade=t=out:st=%s:d=%s[music];",
+			musicInput, ffFloat(mix.MusicGainDB()), ffFloat(total), ffFloat(fadeStart), ffFloat(math.Min(musicFadeOut, total)))
+
+		music := "[music]"
+		if mix.DuckingEnabled() && len(layers[LayerVoice]) > 0 {
+			// La voz se divide: una copia va a la mezcla y otra controla el compresor.
+			g.WriteString("[voice]asplit=2[vmix][vkey];")
+			fmt.Fprintf(&g, "[music][vkey]sidechaincompress=threshold=%s:ratio=%d:attack=%d:release=%d[ducked];",
+				ffFloat(duckThreshold), duckRatio, duckAttackMs, duckReleaseMs)
+			buses[0] = "[vmix]"
+			music = "[ducked]"
+		}
+		buses = append(buses, music)
+	}
+
+	g.WriteString(sumFilter(buses, "[mix]"))
+	fmt.Fprintf(&g, "[mix]loudnorm=I=%s:TP=-1.5:LRA=11,aresample=44100[out]", ffFloat(mix.LoudnessLUFS()))
+	return g.String()
+}
+
+// sumFilter suma las entradas sin atenuarlas (amix divide por el número de
+// entradas si no se le pide lo contrario).
+func sumFilter(inputs []string, out string) string {
+	if len(inputs) == 1 {
+		return inputs[0] + "anull" + out + ";"
+	}
+	return fmt.Sprintf("%samix=inputs=%d:duration=longest:dropout_transition=0:normalize=0%s;",
+		strings.Join(inputs, ""), len(inputs), out)
+}
+
+func ffFloat(v float64) string {
+	return strconv.FormatFloat(v, 'f', 3, 64)
+}
+
+// MixAudio mezcla los assets del script según mix y sube el resultado. Los
+// assets deben venir ordenados por posición.
+func MixAudio(store BlobStore, id string, assets []model.Asset, mix model.MixSettings) (string, error) {
 	var (
 		bucket  = "audio"
 		dirPath = id
-		apiKey  = os.Getenv("SUPABASE_API_KEY_SERVICE_ROLE")
 		ctx     = context.TODO()
 	)
 
-	// 2. Preparar temporales
+	if len(assets) == 0 {
+		return "", errors.New("el script no tiene assets para mezclar")
+	}
+
+	// 1. Preparar temporales
 	var tmpFiles []string
 	defer func() {
 		for _, f := range tmpFiles {
 			_ = os.Remove(f)
 		}
 	}()
-
-	// 3. Descargar cada URL a un mp3 temporal
-	for _, a := range assets {
-		// crea fichero tmp
-		tmp, err := os.CreateTemp("", fmt.Sprintf("asset_%d_*.mp3", a.Position))
+	download := func(pattern, ref string) (string, error) {
+		tmp, err := os.CreateTemp("", pattern)
 		if err != nil {
 			return "", err
 		}
 		tmpFiles = append(tmpFiles, tmp.Name())
 		tmp.Close()
+		return tmp.Name(), DownloadURL(ctx, store, ref, tmp.Name())
+	}
 
-		// descarga
-		req, _ := http.NewRequestWithContext(ctx, http.MethodGet, a.Audio_URL, nil)
-		req.Header.Set("apikey", apiKey)
-		res, err := http.DefaultClient.Do(req)
-		if err != nil {
-			return "", err
-		}
-		defer res.Body.Close()
-
-		out, err := os.OpenFile(tmp.Name(), os.O_WRONLY, 0)
+	// 2. Descargar cada asset y conocer su duración
+	args := []string{"-y"}
+	durations := make([]float64, len(assets))
+	for i, a := range assets {
+		file, err := download(fmt.Sprintf("asset_%d_*.mp3", a.Position), a.Audio_URL)
 		if err != nil {
 			return "", err
 		}
-		if _, err := io.Copy(out, res.Body); err != nil {
-			out.Close()
-			return "", err
+		durations[i] = a.Duration
+		if durations[i] <= 0 {
+			if durations[i], err = probeDuration(file); err != nil {
+				return "", err
+			}
 		}
-		out.Close()
+		args = append(args, "-i", file)
 	}
 
-	// 4. Crear archivo de lista para concat
-	listFile, err := os.CreateTemp("", "ffmpeg_list_*.txt")
-	if err != nil {
-		return "", err
-	}
-	for _, p := range tmpFiles {
-		fmt.Fprintf(listFile, "file '%s'\n", filepath.ToSlash(p))
+	musicInput := -1
+	if mix.Music != "" {
+		file, err := download("music_*"+path.Ext(mix.Music), mix.Music)
+		if err != nil {
+			return "", fmt.Errorf("descargando la música: %w", err)
+		}
+		musicInput = len(assets)
+		args = append(args, "-stream_loop", "-1", "-i", file)
 	}
-	listFile.Close()
-	defer os.Remove(listFile.Name())
 
-	// 5. Ejecutar ffmpeg concat
+	// 3. Ejecutar ffmpeg con la línea de tiempo
+	clips, total := BuildTimeline(assets, durations, mix)
 	mixPath := filepath.Join(os.TempDir(), fmt.Sprintf("mix_%d.mp3", time.Now().UnixNano()))
-	cmd := exec.Command(
-		"ffmpeg", "-y",
-		"-f", "concat", "-safe", "0",
-		"-i", listFile.Name(),
+	args = append(args,
+		"-filter_complex", MixFilterGraph(clips, total, mix, musicInput),
+		"-map", "[out]",
 		"-acodec", "libmp3lame", "-b:a", "192k",
 		"-ar", "44100", "-ac", "2",
 		mixPath,
 	)
+	cmd := exec.Command("ffmpeg", args...)
 	if out, err := cmd.CombinedOutput(); err != nil {
 		return "", fmt.Errorf("ffmpeg error: %v – %s", err, string(out))
 	}
 	defer os.Remove(mixPath)
 
-	// 6. Subir mix a Supabase
+	// 4. Subir mix al storage
 	mixBytes, err := os.ReadFile(mixPath)
 	if err != nil {
 		return "", err
 	}
-	mixName := fmt.Sprintf("mix_%s.mp3", id)
-	mixedURL, err := Upload(ctx, bucket, dirPath, mixName,
-		bytes.NewReader(mixBytes), "audio/mpeg", true)
-	if err != nil {
+	mixKey := path.Join(dirPath, fmt.Sprintf("mix_%s.mp3", id))
+	if _, err := store.Put(ctx, bucket, mixKey,
+		bytes.NewReader(mixBytes), "audio/mpeg"); err != nil {
 		return "", err
 	}
 
-	return mixedURL, nil
+	return ObjectRef(bucket, mixKey), nil
+}
+
+// probeDuration lee la duración de un archivo con ffprobe, para assets que
+// no la tienen guardada.
+func probeDuration(file string) (float64, error) {
+	out, err := exec.Command("ffprobe", "-v", "error",
+		"-show_entries", "format=duration",
+		"-of", "default=noprint_wrappers=1:nokey=1",
+		file).Output()
+	if err != nil {
+		return 0, fmt.Errorf("ffprobe error: %v", err)
+	}
+	return strconv.ParseFloat(strings.TrimSpace(string(out)), 64)
 }
@@ -0,0 +1,93 @@
+package helper
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/fnv"
+	"math"
+	"time"
+	"unicode/utf8"
+
+	"github.com/MetaDandy/cuent-ai-core/src/model"
+)
+
+const (
+	offlineSampleRate = 22050
+	// Velocidad de lectura aproximada para estimar la duración de una línea.
+	offlineCharsPerSecond = 15
+	offlineMinDuration    = time.Second
+)
+
+// OfflineProvider genera audio determinista sin llamar a ninguna API:
+// un tono senoidal para TTS y silencio para SFX. Pensado para CI y
+// desarrollo local, donde no hay API keys.
+type OfflineProvider struct{}
+
+func (p *OfflineProvider) Name() model.Provider { return model.ProviderOffline }
+func (p *OfflineProvider) Model() string        { return "sine-v1" }
+
+// TextToSpeech devuelve un tono cuya frecuencia depende del texto y la voz,
+// y cuya duración es proporcional a la longitud de la línea.
+func (p *OfflineProvider) TextToSpeech(text string, voice VoiceSettings) (*SpeechAudio, error) {
+	chars := utf8.RuneCountInString(text)
+	duration := max(time.Duration(chars)*time.Second/offlineCharsPerSecond, offlineMinDuration)
+
+	h := fnv.New32a()
+	h.Write([]byte(voice.ID))
+	h.Write([]byte(text))
+	freq := 220 + float64(h.Sum32()%660) // 220–880 Hz
+
+	return &SpeechAudio{
+		Data:     SineWav(freq, duration),
+		Mime:     "audio/wav",
+		Ext:      "wav",
+		Duration: duration,
+		Chars:    chars,
+	}, nil
+}
+
+func (p *OfflineProvider) SoundEffect(description string, duration time.Duration) (*SpeechAudio, error) {
+	return &SpeechAudio{
+		Data:     SineWav(0, duration),
+		Mime:     "audio/wav",
+		Ext:      "wav",
+		Duration: duration,
+	}, nil
+}
+
+// SineWav codifica un WAV PCM 16-bit mono con un tono de la frecuencia dada.
+// Con freq == 0 el resultado es silencio.
+func SineWav(freq float64, duration time.Duration) []byte {
+	samples := int(duration.Seconds() * offlineSampleRate)
+	dataLen := samples * 2
+
+	var buf bytes.Buffer
+	buf.Grow(44 + dataLen)
+
+	// Cabecera RIFF/WAVE
+	buf.WriteString("RIFF")
+	binary.Write(&buf, binary.LittleEndian, uint32(36+dataLen))
+	buf.WriteString("WAVE")
+	buf.WriteString("fmt ")
+	binary.Write(&buf, binary.LittleEndian, uint32(16))                  // tamaño del chunk fmt
+	binary.Write(&buf, binary.LittleEndian, uint16(1))                   // PCM
+	binary.Write(&buf, binary.LittleEndian, uint16(1))                   // mono
+	binary.Write(&buf, binary.LittleEndian, uint32(offlineSampleRate))   // sample rate
+	binary.Write(&buf, binary.LittleEndian, uint32(offlineSampleRate*2)) // byte rate
+	binary.Write(&buf, binary.LittleEndian, uint16(2))                   // block align
+	binary.Write(&buf, binary.LittleEndian, uint16(16))                  // bits por sample
+	buf.WriteString("data")
+	binary.Write(&buf, binary.LittleEndian, uint32(dataLen))
+
+	data := make([]byte, dataLen)
+	for i := range samples {
+		var v int16
+		if freq > 0 {
+			v = int16(0.3 * math.MaxInt16 * math.Sin(2*math.Pi*freq*float64(i)/offlineSampleRate))
+		}
+		binary.LittleEndian.PutUint16(data[i*2:], uint16(v))
+	}
+	buf.Write(data)
+
+	return buf.Bytes()
+}
@@ -0,0 +1,74 @@
+package helper
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+	"unicode/utf8"
+
+	"github.com/MetaDandy/cuent-ai-core/src/model"
+	"github.com/go-resty/resty/v2"
+)
+
+// OpenAIProvider genera voz con el endpoint /v1/audio/speech de OpenAI.
+// No soporta efectos de sonido, así que las líneas SFX caen en ElevenLabs.
+type OpenAIProvider struct{}
+
+func (p *OpenAIProvider) Name() model.Provider { return model.ProviderOpenAI }
+
+func (p *OpenAIProvider) Model() string {
+	if m := os.Getenv("OPENAI_TTS_MODEL"); m != "" {
+		return m
+	}
+	return "tts-1"
+}
+
+func (p *OpenAIProvider) TextToSpeech(text string, voice VoiceSettings) (*SpeechAudio, error) {
+	apiKey := os.Getenv("OPENAI_API_KEY")
+	if apiKey == "" {
+		return nil, fmt.Errorf("API key de OpenAI no encontrada en variables de entorno")
+	}
+	voiceID := voice.ID
+	if voiceID == "" {
+		voiceID = "alloy"
+	}
+
+	client := resty.New().SetTimeout(60 * time.Second)
+	resp, err := client.R().
+		SetHeader("Content-Type", "application/json").
+		SetHeader("Authorization", "Bearer "+apiKey).
+		SetHeader("User-Agent", "Cuent-ai/1.0 (Go; +https://github.com/MetaDandy/cuent-ai-core)").
+		SetBody(map[string]interface{}{
+			"model":           p.Model(),
+			"input":           text,
+			"voice":           voiceID,
+			"response_format": "mp3",
+		}).
+		SetDoNotParseResponse(true).
+		Post("https://api.openai.com/v1/audio/speech")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.RawBody().Close()
+
+	if resp.StatusCode() != 200 {
+		b, _ := io.ReadAll(resp.RawBody())
+		return nil, fmt.Errorf("error OpenAI TTS: %s – %s", resp.Status(), string(b))
+	}
+
+	audio, err := io.ReadAll(resp.RawBody())
+	if err != nil {
+		return nil, err
+	}
+
+	// OpenAI factura por carácter de entrada.
+	chars := utf8.RuneCountInString(text)
+	return &SpeechAudio{
+		Data:  audio,
+		Mime:  "audio/mpeg",
+		Ext:   "mp3",
+		Chars: chars,
+		Cost:  float64(chars) / 1000 * 0.015,
+	}, nil
+}
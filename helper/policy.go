@@ -0,0 +1,55 @@
+package helper
+
+import (
+	"errors"
+
+	"gorm.io/gorm"
+)
+
+// Scopes de autorización por dueño. Los scripts cuelgan de un proyecto y los
+// assets de un script, así que todo termina filtrando por projects.user_id.
+// Un recurso ajeno no aparece en la consulta: se responde igual que si no
+// existiera (gorm.ErrRecordNotFound → 404) para no revelar IDs de otros.
+
+// OwnedProjects limita la consulta a los proyectos de userID.
+func OwnedProjects(userID string) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("projects.user_id = ?", userID)
+	}
+}
+
+// OwnedScripts limita la consulta a los scripts de proyectos de userID.
+func OwnedScripts(userID string) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("scripts.project_id IN (SELECT id FROM projects WHERE user_id = ?)", userID)
+	}
+}
+
+// OwnedAssets limita la consulta a los assets de scripts de userID.
+func OwnedAssets(userID string) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where(`assets.script_id IN (
+			SELECT scripts.id FROM scripts
+			JOIN projects ON projects.id = scripts.project_id
+			WHERE projects.user_id = ?)`, userID)
+	}
+}
+
+// OwnedCharacters limita la consulta a los personajes de proyectos de userID.
+func OwnedCharacters(userID string) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("characters.project_id IN (SELECT id FROM projects WHERE user_id = ?)", userID)
+	}
+}
+
+// OwnedJobs limita la consulta a los jobs lanzados por userID.
+func OwnedJobs(userID string) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("generated_jobs.user_id = ?", userID)
+	}
+}
+
+// IsNotFound indica si err corresponde a un recurso inexistente o ajeno.
+func IsNotFound(err error) bool {
+	return errors.Is(err, gorm.ErrRecordNotFound)
+}
@@ -0,0 +1,294 @@
+package helper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Relaciones de aspecto soportadas por RenderVideo.
+const (
+	AspectLandscape = "16:9"
+	AspectPortrait  = "9:16"
+	AspectSquare    = "1:1"
+)
+
+// TransitionNone une los segmentos con un corte seco.
+const TransitionNone = "none"
+
+// renderTransitions son las transiciones de xfade que se aceptan.
+var renderTransitions = map[string]bool{
+	"fade": true, "fadeblack": true, "fadewhite": true, "dissolve": true,
+	"wipeleft": true, "wiperight": true, "wipeup": true, "wipedown": true,
+	"slideleft": true, "slideright": true, "slideup": true, "slidedown": true,
+	"smoothleft": true, "smoothright": true, "circleopen": true, "circleclose": true,
+	"radial": true, "pixelize": true, TransitionNone: true,
+}
+
+const renderFPS = 30
+
+var ErrRenderOptions = errors.New("opciones de video inválidas")
+
+// RenderOptions configura el video del script. Resolution es el lado corto
+// en píxeles (480, 720 o 1080).
+type RenderOptions struct {
+	Aspect             string
+	Resolution         int
+	Transition         string
+	TransitionDuration float64
+	Subtitles          bool
+	SFX                SFXMode
+}
+
+// Normalize completa los valores por defecto (16:9, 720, fade de 0.5 s) y
+// valida el resto.
+func (o *RenderOptions) Normalize() error {
+	if o.Aspect == "" {
+		o.Aspect = AspectLandscape
+	}
+	if o.Resolution == 0 {
+		o.Resolution = 720
+	}
+	if o.Transition == "" {
+		o.Transition = "fade"
+	}
+	o.Transition = strings.ToLower(o.Transition)
+
+	switch {
+	case o.Aspect != AspectLandscape && o.Aspect != AspectPortrait && o.Aspect != AspectSquare:
+		return fmt.Errorf("%w: aspect debe ser 16:9, 9:16 o 1:1", ErrRenderOptions)
+	case o.Resolution != 480 && o.Resolution != 720 && o.Resolution != 1080:
+		return fmt.Errorf("%w: resolution debe ser 480, 720 o 1080", ErrRenderOptions)
+	case !renderTransitions[o.Transition]:
+		return fmt.Errorf("%w: transición %q no soportada", ErrRenderOptions, o.Transition)
+	case math.IsNaN(o.TransitionDuration) || o.TransitionDuration < 0 || o.TransitionDuration > 3:
+		return fmt.Errorf("%w: transition_duration debe estar entre 0 y 3 s", ErrRenderOptions)
+	}
+	if o.TransitionDuration == 0 {
+		o.TransitionDuration = 0.5
+	}
+
+	sfx, err := ParseSFXMode(string(o.SFX))
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrRenderOptions, err)
+	}
+	o.SFX = sfx
+	return nil
+}
+
+// Size devuelve ancho y alto del video, siempre pares.
+func (o RenderOptions) Size() (int, int) {
+	short := o.Resolution
+	long := (short*16/9 + 1) &^ 1
+	switch o.Aspect {
+	case AspectPortrait:
+		return short, long
+	case AspectSquare:
+		return short, short
+	}
+	return long, short
+}
+
+// VideoSegment es el tramo de la línea de tiempo en el que se ve la imagen
+// de un asset: desde que empieza su línea hasta que empieza la siguiente.
+type VideoSegment struct {
+	Asset    int // índice del asset en la lista ordenada
+	Start    float64
+	Duration float64
+}
+
+// VideoSegments reparte la línea de tiempo de la mezcla entre las líneas de
+// narración; los SFX suenan encima y no cambian la imagen. Un script sólo con
+// SFX usa un segmento por efecto. El primer segmento arranca en 0 y el último
+// llega hasta total.
+func VideoSegments(clips []MixClip, total float64) []VideoSegment {
+	var segs []VideoSegment
+	for i, c := range clips {
+		if c.Layer == LayerVoice {
+			segs = append(segs, VideoSegment{Asset: i, Start: c.Start})
+		}
+	}
+	if len(segs) == 0 {
+		for i, c := range clips {
+			segs = append(segs, VideoSegment{Asset: i, Start: c.Start})
+		}
+	}
+	if len(segs) == 0 {
+		return nil
+	}
+
+	segs[0].Start = 0
+	for i := range segs {
+		end := total
+		if i+1 < len(segs) {
+			end = segs[i+1].Start
+		}
+		segs[i].Duration = math.Max(0, end-segs[i].Start)
+	}
+
+	// Los segmentos vacíos (líneas que empiezan juntas) no aportan imagen.
+	out := segs[:0]
+	for _, s := range segs {
+		if s.Duration > 0 {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// transitionFor limita la transición a la mitad del segmento más corto para
+// que xfade nunca se coma un segmento entero.
+func transitionFor(segs []VideoSegment, opts RenderOptions) float64 {
+	if opts.Transition == TransitionNone || len(segs) < 2 {
+		return 0
+	}
+	xf := opts.TransitionDuration
+	for _, s := range segs {
+		xf = math.Min(xf, s.Duration/2)
+	}
+	return xf
+}
+
+// RenderInputDurations devuelve cuánto debe durar cada entrada: su segmento
+// más la transición con el siguiente, que se solapa.
+func RenderInputDurations(segs []VideoSegment, opts RenderOptions) []float64 {
+	xf := transitionFor(segs, opts)
+	out := make([]float64, len(segs))
+	for i, s := range segs {
+		out[i] = s.Duration
+		if i+1 < len(segs) {
+			out[i] += xf
+		}
+	}
+	return out
+}
+
+// RenderFilterGraph arma el filter_complex del video: cada entrada se escala
+// y recorta para cubrir el cuadro, se fija a 30 fps y se encadena con xfade
+// (o concat sin transición). Si subtitles es true quema subs.srt, relativo al
+// directorio de trabajo de ffmpeg. La salida es [v].
+func RenderFilterGraph(segs []VideoSegment, opts RenderOptions, subtitles bool) string {
+	var (
+		g    strings.Builder
+		w, h = opts.Size()
+		xf   = transitionFor(segs, opts)
+		durs = RenderInputDurations(segs, opts)
+	)
+
+	for i := range segs {
+		fmt.Fprintf(&g, "[%d:v]scale=%d:%d:force_original_aspect_ratio=increase,crop=%d:%d,setsar=1,fps=%d,format=yuv420p,trim=duration=%s,setpts=PTS-STARTPTS[s%d];",
+			i, w, h, w, h, renderFPS, ffFloat(durs[i]), i)
+	}
+
+	last := "[s0]"
+	switch {
+	case len(segs) == 1:
+	case xf == 0:
+		for i := range segs {
+			fmt.Fprintf(&g, "[s%d]", i)
+		}
+		fmt.Fprintf(&g, "concat=n=%d:v=1:a=0[x];", len(segs))
+		last = "[x]"
+	default:
+		// Tras cada xfade la salida dura hasta el final del segmento entrante
+		// más la transición siguiente, así que el offset es el inicio del
+		// segmento en la línea de tiempo.
+		for i := 1; i < len(segs); i++ {
+			out := fmt.Sprintf("[x%d]", i)
+			fmt.Fprintf(&g, "%s[s%d]xfade=transition=%s:duration=%s:offset=%s%s;",
+				last, i, opts.Transition, ffFloat(xf), ffFloat(segs[i].Start), out)
+			last = out
+		}
+	}
+
+	if subtitles {
+		fmt.Fprintf(&g, "%ssubtitles=subs.srt[v]", last)
+	} else {
+		fmt.Fprintf(&g, "%snull[v]", last)
+	}
+	return g.String()
+}
+
+// Visual es lo que se muestra en un segmento: un video ya generado del asset
+// (ref del storage) o una imagen de alguno de los proveedores.
+type Visual struct {
+	VideoRef string
+	Image    Image
+}
+
+// RenderVideo arma el video completo del script: una entrada por segmento
+// con su visual y, debajo, el audio ya mezclado (audioRef). srt, si no está
+// vacío, se quema como subtítulos. Devuelve el MP4.
+func RenderVideo(store BlobStore, providers ImageProviders, segs []VideoSegment, visuals []Visual, audioRef string, total float64, opts RenderOptions, srt string) ([]byte, error) {
+	if len(segs) == 0 || len(segs) != len(visuals) {
+		return nil, errors.New("no hay segmentos para renderizar")
+	}
+
+	tmpDir, err := os.MkdirTemp("", "render-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+
+	// 1. Descargar los visuales de cada segmento
+	args := []string{"-y"}
+	durs := RenderInputDurations(segs, opts)
+	for i, v := range visuals {
+		d := ffFloat(durs[i])
+		if v.VideoRef != "" {
+			file := filepath.Join(tmpDir, fmt.Sprintf("seg-%03d.mp4", i))
+			if err := DownloadURL(ctx, store, v.VideoRef, file); err != nil {
+				return nil, err
+			}
+			args = append(args, "-stream_loop", "-1", "-t", d, "-i", file)
+			continue
+		}
+		file := filepath.Join(tmpDir, fmt.Sprintf("seg-%03d.jpg", i))
+		if err := providers.Download(ctx, v.Image, file); err != nil {
+			return nil, err
+		}
+		args = append(args, "-loop", "1", "-framerate", fmt.Sprint(renderFPS), "-t", d, "-i", file)
+	}
+
+	// 2. Descargar la mezcla
+	audioPath := filepath.Join(tmpDir, "audio.mp3")
+	if err := DownloadURL(ctx, store, audioRef, audioPath); err != nil {
+		return nil, err
+	}
+	args = append(args, "-i", audioPath)
+
+	if srt != "" {
+		if err := os.WriteFile(filepath.Join(tmpDir, "subs.srt"), []byte(srt), 0o644); err != nil {
+			return nil, err
+		}
+	}
+
+	// 3. Ejecutar ffmpeg
+	out := filepath.Join(tmpDir, "render.mp4")
+	args = append(args,
+		"-filter_complex", RenderFilterGraph(segs, opts, srt != ""),
+		"-map", "[v]",
+		"-map", fmt.Sprintf("%d:a", len(segs)),
+		"-c:v", "libx264", "-preset", "medium", "-pix_fmt", "yuv420p",
+		"-c:a", "aac", "-b:a", "192k",
+		"-t", ffFloat(total),
+		"-movflags", "+faststart",
+		out,
+	)
+	cmd := exec.Command("ffmpeg", args...)
+	cmd.Dir = tmpDir
+	if outp, err := cmd.CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("ffmpeg render: %s / %w", outp, err)
+	}
+
+	return os.ReadFile(out)
+}
@@ -10,7 +10,8 @@ type PaginatedResponse[T any] struct {
 
 // Todo: Revisar el tema del any, ver si poner T o no
 type Response struct {
-	Data    any    `json:"data"`
-	Token   string `json:"token,omitempty"`
-	Message string `json:"message"`
+	Data         any    `json:"data"`
+	Token        string `json:"token,omitempty"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	Message      string `json:"message"`
 }
@@ -0,0 +1,192 @@
+package helper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// ErrObjectNotFound lo devuelven los BlobStore cuando la clave no existe.
+var ErrObjectNotFound = errors.New("objeto no encontrado")
+
+// BlobStore guarda los archivos generados (audio, vídeo, mezclas). Los
+// objetos se identifican por bucket y clave, p. ej. "audio" y
+// "<scriptID>/tts_<assetID>.mp3".
+type BlobStore interface {
+	// Put crea o sobrescribe el objeto y devuelve su URL permanente.
+	Put(ctx context.Context, bucket, key string, body io.Reader, mime string) (string, error)
+	Get(ctx context.Context, bucket, key string) (io.ReadCloser, error)
+	// GetRange lee el objeto desde offset hasta el final y devuelve también
+	// su tamaño total. Lo usa Object para servir un Range.
+	GetRange(ctx context.Context, bucket, key string, offset int64) (io.ReadCloser, int64, error)
+	Delete(ctx context.Context, bucket, key string) error
+	// List devuelve las claves de los objetos dentro de la carpeta prefix.
+	List(ctx context.Context, bucket, prefix string) ([]string, error)
+	// SignedURL devuelve una URL que permite leer el objeto sin
+	// credenciales hasta que vence ttl.
+	SignedURL(ctx context.Context, bucket, key string, ttl time.Duration) (string, error)
+}
+
+// objectLocator lo implementan los stores que saben traducir una URL devuelta
+// por Put de vuelta a bucket y clave.
+type objectLocator interface {
+	locate(rawURL string) (bucket, key string, ok bool)
+}
+
+// NewBlobStoreFromEnv elige la implementación según STORAGE_BACKEND
+// (SUPABASE, S3 o LOCAL). Por defecto usa Supabase.
+func NewBlobStoreFromEnv() (BlobStore, error) {
+	switch backend := strings.ToUpper(os.Getenv("STORAGE_BACKEND")); backend {
+	case "", "SUPABASE":
+		return NewSupabaseStore(
+			os.Getenv("SUPABASE_PROJECT_URL"),
+			os.Getenv("SUPABASE_API_KEY_SERVICE_ROLE"),
+		), nil
+	case "S3":
+		return NewS3Store(S3Config{
+			Endpoint:  os.Getenv("S3_ENDPOINT"),
+			Region:    os.Getenv("S3_REGION"),
+			AccessKey: os.Getenv("S3_ACCESS_KEY_ID"),
+			SecretKey: os.Getenv("S3_SECRET_ACCESS_KEY"),
+		})
+	case "LOCAL":
+		dir := os.Getenv("LOCAL_STORAGE_DIR")
+		if dir == "" {
+			dir = "storage"
+		}
+		secret := os.Getenv("STORAGE_SIGNING_KEY")
+		if secret == "" {
+			secret = os.Getenv("JWT_SECRET")
+		}
+		base := os.Getenv("LOCAL_STORAGE_URL")
+		if base == "" {
+			base = "http://localhost:" + os.Getenv("PORT") + "/storage"
+		}
+		return NewLocalStore(dir, base, secret)
+	default:
+		return nil, fmt.Errorf("backend de storage no soportado: %s", backend)
+	}
+}
+
+// Vigencia por defecto de las URLs firmadas que se entregan al frontend.
+const defaultSignedURLTTL = 15 * time.Minute
+
+// ObjectRef es la referencia que se guarda en la base para un objeto:
+// "<bucket>/<clave>". No depende del backend ni caduca.
+func ObjectRef(bucket, key string) string {
+	return bucket + "/" + cleanKey(key)
+}
+
+// SplitObjectRef separa una referencia en bucket y clave. También acepta las
+// URLs completas que se guardaban antes, si pertenecen al store.
+func SplitObjectRef(store BlobStore, ref string) (bucket, key string, ok bool) {
+	if strings.Contains(ref, "://") {
+		if loc, isLoc := store.(objectLocator); isLoc {
+			return loc.locate(ref)
+		}
+		return "", "", false
+	}
+	bucket, key, ok = strings.Cut(cleanKey(ref), "/")
+	if !ok || bucket == "" || key == "" {
+		return "", "", false
+	}
+	return bucket, key, true
+}
+
+// SignedURLTTL lee STORAGE_URL_TTL (p. ej. "15m"); por defecto 15 minutos.
+func SignedURLTTL() time.Duration {
+	if ttl, err := time.ParseDuration(os.Getenv("STORAGE_URL_TTL")); err == nil && ttl > 0 {
+		return ttl
+	}
+	return defaultSignedURLTTL
+}
+
+// PresignRef convierte una referencia guardada en una URL firmada de corta
+// duración. Las referencias vacías quedan vacías y las URLs externas se
+// devuelven tal cual. Si no se puede firmar devuelve "" para no exponer la
+// URL privada.
+func PresignRef(ctx context.Context, store BlobStore, ref string) string {
+	if ref == "" || store == nil {
+		return ref
+	}
+	bucket, key, ok := SplitObjectRef(store, ref)
+	if !ok {
+		if strings.Contains(ref, "://") {
+			return ref
+		}
+		return ""
+	}
+
+	signed, err := store.SignedURL(ctx, bucket, key, SignedURLTTL())
+	if err != nil {
+		log.Printf("[storage] no se pudo firmar %s: %v", ref, err)
+		return ""
+	}
+	return signed
+}
+
+// OpenURL abre un objeto a partir de la referencia o URL guardada en la base.
+// Si pertenece al store se lee con sus credenciales; si no, se descarga por
+// HTTP (p. ej. imágenes externas).
+func OpenURL(ctx context.Context, store BlobStore, rawURL string) (io.ReadCloser, error) {
+	if bucket, key, ok := SplitObjectRef(store, rawURL); ok {
+		return store.Get(ctx, bucket, key)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode != http.StatusOK {
+		res.Body.Close()
+		return nil, fmt.Errorf("código HTTP %d", res.StatusCode)
+	}
+	return res.Body, nil
+}
+
+// DownloadURL copia el contenido de rawURL al archivo dest.
+func DownloadURL(ctx context.Context, store BlobStore, rawURL, dest string) error {
+	body, err := OpenURL(ctx, store, rawURL)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	f, err := os.Create(dest)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = io.Copy(f, body)
+	return err
+}
+
+// DeletePrefix borra todos los objetos de la carpeta prefix.
+func DeletePrefix(ctx context.Context, store BlobStore, bucket, prefix string) error {
+	keys, err := store.List(ctx, bucket, prefix)
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		if err := store.Delete(ctx, bucket, key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// cleanKey normaliza una clave quitando las barras de los extremos.
+func cleanKey(key string) string {
+	return strings.Trim(key, "/")
+}
@@ -0,0 +1,236 @@
+package helper
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// LocalStore guarda los objetos en disco, bajo dir/<bucket>/<clave>. Sirve
+// para desarrollo, tests end-to-end y despliegues on-prem sin Supabase. Las
+// URLs firmadas las valida Handler, que debe montarse en la ruta de baseURL.
+type LocalStore struct {
+	dir     string
+	baseURL string // p. ej. http://localhost:8080/storage
+	secret  []byte
+}
+
+func NewLocalStore(dir, baseURL, secret string) (*LocalStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &LocalStore{
+		dir:     dir,
+		baseURL: strings.TrimRight(baseURL, "/"),
+		secret:  []byte(secret),
+	}, nil
+}
+
+// path devuelve la ruta en disco del objeto y rechaza claves que intenten
+// salir del bucket.
+func (s *LocalStore) path(bucket, key string) (string, error) {
+	root := filepath.Join(s.dir, bucket)
+	p := filepath.Join(root, filepath.FromSlash(cleanKey(key)))
+	if bucket == "" || strings.ContainsAny(bucket, `/\`) || !strings.HasPrefix(p, root+string(filepath.Separator)) {
+		return "", fmt.Errorf("clave inválida: %s/%s", bucket, key)
+	}
+	return p, nil
+}
+
+func (s *LocalStore) objectURL(bucket, key string) string {
+	return fmt.Sprintf("%s/%s/%s", s.baseURL, bucket, cleanKey(key))
+}
+
+func (s *LocalStore) Put(ctx context.Context, bucket, key string, body io.Reader, mime string) (string, error) {
+	p, err := s.path(bucket, key)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return "", err
+	}
+
+	// Se escribe a un temporal y se renombra para no dejar archivos a medias.
+	tmp, err := os.CreateTemp(filepath.Dir(p), ".upload-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, body); err != nil {
+		tmp.Close()
+		return "", err
+	}
+	if err := tmp.Close(); err != nil {
+		return "", err
+	}
+	if err := os.Rename(tmp.Name(), p); err != nil {
+		return "", err
+	}
+	return s.objectURL(bucket, key), nil
+}
+
+func (s *LocalStore) open(bucket, key string) (*os.File, error) {
+	p, err := s.path(bucket, key)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(p)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s/%s", ErrObjectNotFound, bucket, key)
+	}
+	return f, err
+}
+
+func (s *LocalStore) Get(ctx context.Context, bucket, key string) (io.ReadCloser, error) {
+	f, err := s.open(bucket, key)
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (s *LocalStore) GetRange(ctx context.Context, bucket, key string, offset int64) (io.ReadCloser, int64, error) {
+	f, err := s.open(bucket, key)
+	if err != nil {
+		return nil, 0, err
+	}
+	info, err := f.Stat()
+	if err == nil {
+		_, err = f.Seek(offset, io.SeekStart)
+	}
+	if err != nil {
+		f.Close()
+		return nil, 0, err
+	}
+	return f, info.Size(), nil
+}
+
+func (s *LocalStore) Delete(ctx context.Context, bucket, key string) error {
+	p, err := s.path(bucket, key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(p); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (s *LocalStore) List(ctx context.Context, bucket, prefix string) ([]string, error) {
+	root := filepath.Join(s.dir, bucket)
+	dir, err := s.path(bucket, prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	var keys []string
+	err = filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || strings.HasPrefix(d.Name(), ".upload-") {
+			return nil
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		keys = append(keys, filepath.ToSlash(rel))
+		return nil
+	})
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	return keys, err
+}
+
+func (s *LocalStore) SignedURL(ctx context.Context, bucket, key string, ttl time.Duration) (string, error) {
+	if len(s.secret) == 0 {
+		return "", errors.New("storage local sin clave de firma")
+	}
+	key = cleanKey(key)
+	expires := strconv.FormatInt(time.Now().Add(ttl).Unix(), 10)
+
+	q := url.Values{}
+	q.Set("expires", expires)
+	q.Set("signature", s.sign(bucket, key, expires))
+	return s.objectURL(bucket, key) + "?" + q.Encode(), nil
+}
+
+func (s *LocalStore) sign(bucket, key, expires string) string {
+	mac := hmac.New(sha256.New, s.secret)
+	fmt.Fprintf(mac, "%s/%s:%s", bucket, key, expires)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify comprueba la firma y la vigencia de una URL firmada.
+func (s *LocalStore) Verify(bucket, key, expires, signature string) error {
+	if len(s.secret) == 0 {
+		return errors.New("storage local sin clave de firma")
+	}
+	exp, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || time.Now().Unix() > exp {
+		return errors.New("URL vencida")
+	}
+	want := s.sign(bucket, cleanKey(key), expires)
+	if !hmac.Equal([]byte(want), []byte(signature)) {
+		return errors.New("firma inválida")
+	}
+	return nil
+}
+
+func (s *LocalStore) locate(rawURL string) (string, string, bool) {
+	rest, ok := strings.CutPrefix(rawURL, s.baseURL+"/")
+	if !ok {
+		return "", "", false
+	}
+	if i := strings.IndexByte(rest, '?'); i >= 0 {
+		rest = rest[:i]
+	}
+	bucket, key, ok := strings.Cut(rest, "/")
+	return bucket, key, ok && key != ""
+}
+
+// Route es la ruta de Fiber donde montar Handler, derivada de baseURL.
+func (s *LocalStore) Route() string {
+	prefix := "/storage"
+	if u, err := url.Parse(s.baseURL); err == nil && u.Path != "" {
+		prefix = u.Path
+	}
+	return prefix + "/:bucket/*"
+}
+
+// Handler sirve los objetos a quien presente una URL firmada vigente. Se
+// monta como GET <ruta de baseURL>/:bucket/*.
+func (s *LocalStore) Handler() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		bucket, key := c.Params("bucket"), c.Params("*")
+		if err := s.Verify(bucket, key, c.Query("expires"), c.Query("signature")); err != nil {
+			return JSONError(c, http.StatusForbidden, "Acceso denegado", err.Error())
+		}
+
+		p, err := s.path(bucket, key)
+		if err != nil {
+			return JSONError(c, http.StatusBadRequest, "Clave inválida", err.Error())
+		}
+		if _, err := os.Stat(p); err != nil {
+			return JSONError(c, http.StatusNotFound, "Objeto no encontrado", "")
+		}
+		return c.SendFile(p)
+	}
+}
@@ -0,0 +1,126 @@
+package helper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Object lee un objeto del storage por partes: después de un Seek, el
+// siguiente Read le pide al store sólo desde esa posición. Así
+// http.ServeContent puede responder un Range sin bajar el objeto entero.
+type Object struct {
+	ctx    context.Context
+	store  BlobStore
+	bucket string
+	key    string
+	size   int64
+	offset int64
+
+	body io.ReadCloser // abierto en at
+	at   int64
+}
+
+// OpenObject abre la referencia ref del store y lee su tamaño.
+func OpenObject(ctx context.Context, store BlobStore, ref string) (*Object, error) {
+	bucket, key, ok := SplitObjectRef(store, ref)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrObjectNotFound, ref)
+	}
+	body, size, err := store.GetRange(ctx, bucket, key, 0)
+	if err != nil {
+		return nil, err
+	}
+	return &Object{ctx: ctx, store: store, bucket: bucket, key: key, size: size, body: body}, nil
+}
+
+// Size es el tamaño total del objeto.
+func (o *Object) Size() int64 { return o.size }
+
+func (o *Object) Read(p []byte) (int, error) {
+	if o.offset >= o.size {
+		return 0, io.EOF
+	}
+	if o.body != nil && o.at != o.offset {
+		o.body.Close()
+		o.body = nil
+	}
+	if o.body == nil {
+		body, _, err := o.store.GetRange(o.ctx, o.bucket, o.key, o.offset)
+		if err != nil {
+			return 0, err
+		}
+		o.body, o.at = body, o.offset
+	}
+
+	n, err := o.body.Read(p)
+	o.offset += int64(n)
+	o.at += int64(n)
+	return n, err
+}
+
+// Seek sólo mueve la posición; el objeto se vuelve a pedir en el siguiente
+// Read si hace falta.
+func (o *Object) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += o.offset
+	case io.SeekEnd:
+		offset += o.size
+	default:
+		return 0, errors.New("whence inválido")
+	}
+	if offset < 0 {
+		return 0, errors.New("posición negativa")
+	}
+	o.offset = offset
+	return offset, nil
+}
+
+func (o *Object) Close() error {
+	if o.body == nil {
+		return nil
+	}
+	err := o.body.Close()
+	o.body = nil
+	return err
+}
+
+// rangeRequest pide el objeto desde offset; desde el principio se pide
+// entero, que también sirve para objetos vacíos.
+func rangeRequest(req *http.Request, offset int64) {
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+}
+
+// rangeBody devuelve el cuerpo de la respuesta a rangeRequest, ya en
+// offset, y el tamaño total del objeto.
+func rangeBody(res *http.Response, offset int64) (io.ReadCloser, int64, error) {
+	if res.StatusCode == http.StatusPartialContent {
+		// Content-Range: bytes <inicio>-<fin>/<total>
+		_, total, _ := strings.Cut(res.Header.Get("Content-Range"), "/")
+		size, err := strconv.ParseInt(total, 10, 64)
+		if err != nil {
+			res.Body.Close()
+			return nil, 0, fmt.Errorf("Content-Range inválido: %q", res.Header.Get("Content-Range"))
+		}
+		return res.Body, size, nil
+	}
+
+	// El servidor ignoró el Range y mandó el objeto entero.
+	if res.ContentLength < 0 {
+		res.Body.Close()
+		return nil, 0, errors.New("el storage no informó el tamaño del objeto")
+	}
+	if _, err := io.CopyN(io.Discard, res.Body, offset); err != nil {
+		res.Body.Close()
+		return nil, 0, err
+	}
+	return res.Body, res.ContentLength, nil
+}
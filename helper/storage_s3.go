@@ -0,0 +1,316 @@
+package helper
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// S3Config apunta a cualquier servicio compatible con S3 (AWS, MinIO, R2…).
+type S3Config struct {
+	Endpoint  string // https://s3.us-east-1.amazonaws.com o http://localhost:9000
+	Region    string
+	AccessKey string
+	SecretKey string
+}
+
+// S3Store guarda los objetos en un servicio S3 con URLs path-style
+// (<endpoint>/<bucket>/<clave>). Firma las peticiones con SigV4 sin depender
+// del SDK de AWS.
+type S3Store struct {
+	cfg    S3Config
+	host   string
+	client *http.Client
+}
+
+const (
+	s3Algorithm       = "AWS4-HMAC-SHA256"
+	s3UnsignedPayload = "UNSIGNED-PAYLOAD"
+	s3MaxPresign      = 7 * 24 * time.Hour
+)
+
+func NewS3Store(cfg S3Config) (*S3Store, error) {
+	if cfg.Endpoint == "" || cfg.AccessKey == "" || cfg.SecretKey == "" {
+		return nil, errors.New("S3_ENDPOINT, S3_ACCESS_KEY_ID y S3_SECRET_ACCESS_KEY son obligatorios")
+	}
+	u, err := url.Parse(cfg.Endpoint)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("S3_ENDPOINT inválido: %s", cfg.Endpoint)
+	}
+	if cfg.Region == "" {
+		cfg.Region = "us-east-1"
+	}
+	cfg.Endpoint = strings.TrimRight(cfg.Endpoint, "/")
+
+	return &S3Store{cfg: cfg, host: u.Host, client: http.DefaultClient}, nil
+}
+
+func (s *S3Store) objectURL(bucket, key string) string {
+	return fmt.Sprintf("%s/%s/%s", s.cfg.Endpoint, bucket, cleanKey(key))
+}
+
+func (s *S3Store) Put(ctx context.Context, bucket, key string, body io.Reader, mime string) (string, error) {
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return "", err
+	}
+
+	url := s.objectURL(bucket, key)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, url, bytes.NewReader(data))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", mime)
+
+	res, err := s.do(req, data)
+	if err != nil {
+		return "", err
+	}
+	res.Body.Close()
+	return url, nil
+}
+
+func (s *S3Store) Get(ctx context.Context, bucket, key string) (io.ReadCloser, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.objectURL(bucket, key), nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := s.do(req, nil)
+	if err != nil {
+		return nil, err
+	}
+	return res.Body, nil
+}
+
+func (s *S3Store) GetRange(ctx context.Context, bucket, key string, offset int64) (io.ReadCloser, int64, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.objectURL(bucket, key), nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	rangeRequest(req, offset)
+	res, err := s.do(req, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	return rangeBody(res, offset)
+}
+
+func (s *S3Store) Delete(ctx context.Context, bucket, key string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, s.objectURL(bucket, key), nil)
+	if err != nil {
+		return err
+	}
+	res, err := s.do(req, nil)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	return nil
+}
+
+// List recorre ListObjectsV2 página a página.
+func (s *S3Store) List(ctx context.Context, bucket, prefix string) ([]string, error) {
+	var (
+		keys  []string
+		token string
+	)
+	for {
+		q := url.Values{}
+		q.Set("list-type", "2")
+		q.Set("prefix", cleanKey(prefix)+"/")
+		if token != "" {
+			q.Set("continuation-token", token)
+		}
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet,
+			fmt.Sprintf("%s/%s?%s", s.cfg.Endpoint, bucket, q.Encode()), nil)
+		if err != nil {
+			return nil, err
+		}
+		res, err := s.do(req, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		var page struct {
+			Contents []struct {
+				Key string `xml:"Key"`
+			} `xml:"Contents"`
+			IsTruncated           bool   `xml:"IsTruncated"`
+			NextContinuationToken string `xml:"NextContinuationToken"`
+		}
+		err = xml.NewDecoder(res.Body).Decode(&page)
+		res.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, c := range page.Contents {
+			keys = append(keys, c.Key)
+		}
+		if !page.IsTruncated || page.NextContinuationToken == "" {
+			return keys, nil
+		}
+		token = page.NextContinuationToken
+	}
+}
+
+// SignedURL genera una URL prefirmada (query string SigV4). S3 no admite
+// más de 7 días de vigencia.
+func (s *S3Store) SignedURL(ctx context.Context, bucket, key string, ttl time.Duration) (string, error) {
+	ttl = min(ttl, s3MaxPresign)
+	now := time.Now().UTC()
+	amzDate := now.Format("20060102T150405Z")
+	scope := s.scope(now)
+
+	path := "/" + bucket + "/" + cleanKey(key)
+	q := url.Values{}
+	q.Set("X-Amz-Algorithm", s3Algorithm)
+	q.Set("X-Amz-Credential", s.cfg.AccessKey+"/"+scope)
+	q.Set("X-Amz-Date", amzDate)
+	q.Set("X-Amz-Expires", strconv.Itoa(int(ttl.Seconds())))
+	q.Set("X-Amz-SignedHeaders", "host")
+
+	canonical := strings.Join([]string{
+		http.MethodGet,
+		awsEscape(path, false),
+		canonicalQuery(q),
+		"host:" + s.host + "\n",
+		"host",
+		s3UnsignedPayload,
+	}, "\n")
+	q.Set("X-Amz-Signature", s.signature(now, amzDate, scope, canonical))
+
+	return s.cfg.Endpoint + awsEscape(path, false) + "?" + canonicalQuery(q), nil
+}
+
+func (s *S3Store) locate(rawURL string) (string, string, bool) {
+	rest, ok := strings.CutPrefix(rawURL, s.cfg.Endpoint+"/")
+	if !ok {
+		return "", "", false
+	}
+	if i := strings.IndexByte(rest, '?'); i >= 0 {
+		rest = rest[:i]
+	}
+	bucket, key, ok := strings.Cut(rest, "/")
+	return bucket, key, ok && key != ""
+}
+
+// do firma la petición con las cabeceras SigV4 y la ejecuta. payload es el
+// cuerpo ya leído (nil si no hay).
+func (s *S3Store) do(req *http.Request, payload []byte) (*http.Response, error) {
+	now := time.Now().UTC()
+	amzDate := now.Format("20060102T150405Z")
+	scope := s.scope(now)
+
+	sum := sha256.Sum256(payload)
+	payloadHash := hex.EncodeToString(sum[:])
+	req.Header.Set("x-amz-date", amzDate)
+	req.Header.Set("x-amz-content-sha256", payloadHash)
+
+	signed := "host;x-amz-content-sha256;x-amz-date"
+	canonical := strings.Join([]string{
+		req.Method,
+		awsEscape(req.URL.EscapedPath(), false),
+		canonicalQuery(req.URL.Query()),
+		"host:" + s.host + "\n" +
+			"x-amz-content-sha256:" + payloadHash + "\n" +
+			"x-amz-date:" + amzDate + "\n",
+		signed,
+		payloadHash,
+	}, "\n")
+
+	req.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s3Algorithm, s.cfg.AccessKey, scope, signed, s.signature(now, amzDate, scope, canonical)))
+
+	res, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode >= 300 {
+		defer res.Body.Close()
+		b, _ := io.ReadAll(res.Body)
+		if res.StatusCode == http.StatusNotFound {
+			return nil, fmt.Errorf("%w: %s", ErrObjectNotFound, req.URL.Path)
+		}
+		return nil, fmt.Errorf("s3: %s – %s", res.Status, string(b))
+	}
+	return res, nil
+}
+
+func (s *S3Store) scope(now time.Time) string {
+	return now.Format("20060102") + "/" + s.cfg.Region + "/s3/aws4_request"
+}
+
+func (s *S3Store) signature(now time.Time, amzDate, scope, canonical string) string {
+	hash := sha256.Sum256([]byte(canonical))
+	toSign := strings.Join([]string{s3Algorithm, amzDate, scope, hex.EncodeToString(hash[:])}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+s.cfg.SecretKey), now.Format("20060102"))
+	key = hmacSHA256(key, s.cfg.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	return hex.EncodeToString(hmacSHA256(key, toSign))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// canonicalQuery ordena y codifica los parámetros como exige SigV4.
+func canonicalQuery(q url.Values) string {
+	keys := make([]string, 0, len(q))
+	for k := range q {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var parts []string
+	for _, k := range keys {
+		vals := append([]string(nil), q[k]...)
+		sort.Strings(vals)
+		for _, v := range vals {
+			parts = append(parts, awsEscape(k, true)+"="+awsEscape(v, true))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// awsEscape codifica según RFC 3986. En las rutas se conservan las barras y
+// se respetan las secuencias %XX ya codificadas.
+func awsEscape(s string, encodeSlash bool) string {
+	if !encodeSlash {
+		if unescaped, err := url.PathUnescape(s); err == nil {
+			s = unescaped
+		}
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,187 @@
+package helper
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+)
+
+// SupabaseStore guarda los objetos en Supabase Storage usando la service
+// role key, así que los buckets pueden ser privados.
+type SupabaseStore struct {
+	baseURL string // https://<proyecto>.supabase.co
+	apiKey  string
+	client  *http.Client
+}
+
+func NewSupabaseStore(baseURL, apiKey string) *SupabaseStore {
+	return &SupabaseStore{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		apiKey:  apiKey,
+		client:  http.DefaultClient,
+	}
+}
+
+func (s *SupabaseStore) objectURL(bucket, key string) string {
+	return fmt.Sprintf("%s/storage/v1/object/%s/%s", s.baseURL, bucket, cleanKey(key))
+}
+
+func (s *SupabaseStore) Put(ctx context.Context, bucket, key string, body io.Reader, mime string) (string, error) {
+	url := s.objectURL(bucket, key)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, body)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", mime)
+	req.Header.Set("x-upsert", "true") // Crea si no existe, sobreescribe si existe
+
+	res, err := s.do(req)
+	if err != nil {
+		return "", err
+	}
+	res.Body.Close()
+	return url, nil
+}
+
+func (s *SupabaseStore) Get(ctx context.Context, bucket, key string) (io.ReadCloser, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.objectURL(bucket, key), nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := s.do(req)
+	if err != nil {
+		return nil, err
+	}
+	return res.Body, nil
+}
+
+func (s *SupabaseStore) GetRange(ctx context.Context, bucket, key string, offset int64) (io.ReadCloser, int64, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.objectURL(bucket, key), nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	rangeRequest(req, offset)
+	res, err := s.do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	return rangeBody(res, offset)
+}
+
+func (s *SupabaseStore) Delete(ctx context.Context, bucket, key string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, s.objectURL(bucket, key), nil)
+	if err != nil {
+		return err
+	}
+	res, err := s.do(req)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	return nil
+}
+
+// List usa el endpoint de listado de Supabase, que sólo devuelve el primer
+// nivel de la carpeta; las subcarpetas (sin id) se omiten.
+func (s *SupabaseStore) List(ctx context.Context, bucket, prefix string) ([]string, error) {
+	cleanDir := cleanKey(prefix)
+	url := fmt.Sprintf("%s/storage/v1/object/list/%s", s.baseURL, bucket)
+
+	bodyBytes, _ := json.Marshal(map[string]any{
+		"prefix": cleanDir + "/",
+		"limit":  1000,
+	})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(bodyBytes))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := s.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	var files []struct {
+		Name string  `json:"name"`
+		ID   *string `json:"id"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&files); err != nil {
+		return nil, err
+	}
+
+	keys := make([]string, 0, len(files))
+	for _, f := range files {
+		if f.ID != nil {
+			keys = append(keys, path.Join(cleanDir, f.Name))
+		}
+	}
+	return keys, nil
+}
+
+func (s *SupabaseStore) SignedURL(ctx context.Context, bucket, key string, ttl time.Duration) (string, error) {
+	url := fmt.Sprintf("%s/storage/v1/object/sign/%s/%s", s.baseURL, bucket, cleanKey(key))
+
+	bodyBytes, _ := json.Marshal(map[string]any{
+		"expiresIn": int(ttl.Seconds()),
+	})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(bodyBytes))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := s.do(req)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+
+	var signed struct {
+		SignedURL string `json:"signedURL"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&signed); err != nil {
+		return "", err
+	}
+	return s.baseURL + "/storage/v1" + signed.SignedURL, nil
+}
+
+// locate reconoce las URLs de objeto, públicas o privadas, del proyecto.
+func (s *SupabaseStore) locate(rawURL string) (string, string, bool) {
+	rest, ok := strings.CutPrefix(rawURL, s.baseURL+"/storage/v1/object/")
+	if !ok {
+		return "", "", false
+	}
+	rest = strings.TrimPrefix(rest, "public/")
+	bucket, key, ok := strings.Cut(rest, "/")
+	return bucket, key, ok && key != ""
+}
+
+// do firma la petición con la service role key y convierte las respuestas de
+// error en errores de Go.
+func (s *SupabaseStore) do(req *http.Request) (*http.Response, error) {
+	req.Header.Set("apikey", s.apiKey)
+	req.Header.Set("Authorization", "Bearer "+s.apiKey)
+
+	res, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode >= 300 {
+		defer res.Body.Close()
+		b, _ := io.ReadAll(res.Body)
+		if res.StatusCode == http.StatusNotFound || bytes.Contains(b, []byte("not_found")) {
+			return nil, fmt.Errorf("%w: %s", ErrObjectNotFound, req.URL.Path)
+		}
+		return nil, fmt.Errorf("supabase: %s – %s", res.Status, string(b))
+	}
+	return res, nil
+}
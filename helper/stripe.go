@@ -3,6 +3,7 @@ package helper
 import (
 	"context"
 	"os"
+	"time"
 
 	"github.com/stripe/stripe-go/v82"
 	"github.com/stripe/stripe-go/v82/checkout/session"
@@ -17,6 +18,21 @@ type StripeClient struct {
 func NewStripeClient() *StripeClient {
 	key := os.Getenv("STRIPE_SECRET_KEY")
 	stripe.Key = key
+
+	// STRIPE_API_BASE apunta el SDK a otro servidor, p. ej. el stub local que
+	// usan los tests. Se cambia el backend global para que las llamadas a
+	// nivel de paquete (session.New, invoice.Get…) también lo usen.
+	if base := os.Getenv("STRIPE_API_BASE"); base != "" {
+		stripe.SetBackend(stripe.APIBackend, stripe.GetBackendWithConfig(
+			stripe.APIBackend,
+			&stripe.BackendConfig{
+				URL:               stripe.String(base),
+				MaxNetworkRetries: stripe.Int64(0),
+				LeveledLogger:     &stripe.LeveledLogger{Level: stripe.LevelNull},
+			},
+		))
+	}
+
 	return &StripeClient{client: stripe.NewClient(key)}
 }
 
@@ -39,14 +55,15 @@ func (s *StripeClient) CreateSubscriptionSession(
 		}},
 		SuccessURL: stripe.String(successURL),
 		CancelURL:  stripe.String(cancelURL),
+		Metadata:   metadata, // viaja en la sesión
 	}
 
+	// Con persist la metadata viaja también en la suscripción, y de ahí en
+	// cada factura de renovación.
 	if persist {
 		params.SubscriptionData = &stripe.CheckoutSessionSubscriptionDataParams{
 			Metadata: metadata,
 		}
-	} else {
-		params.Metadata = metadata
 	}
 
 	return session.New(params)
@@ -90,6 +107,48 @@ func (s *StripeClient) GetSubscription(ctx context.Context, subscriptionID strin
 	return subscription.Get(subscriptionID, &stripe.SubscriptionParams{})
 }
 
+// SetCancelAtPeriodEnd programa (o deshace) la cancelación de una suscripción
+// al final del periodo ya pagado.
+func (s *StripeClient) SetCancelAtPeriodEnd(ctx context.Context, subscriptionID string, cancel bool) (*stripe.Subscription, error) {
+	return s.client.V1Subscriptions.Update(ctx, subscriptionID, &stripe.SubscriptionUpdateParams{
+		CancelAtPeriodEnd: stripe.Bool(cancel),
+	})
+}
+
+// InvoiceSubscription devuelve el ID y la metadata de la suscripción que
+// generó la factura, o "" si la factura no viene de una suscripción.
+func InvoiceSubscription(inv *stripe.Invoice) (string, map[string]string) {
+	if inv.Parent == nil || inv.Parent.SubscriptionDetails == nil {
+		return "", nil
+	}
+	details := inv.Parent.SubscriptionDetails
+	if details.Subscription == nil {
+		return "", details.Metadata
+	}
+	return details.Subscription.ID, details.Metadata
+}
+
+// InvoicePeriod devuelve el periodo facturado. En las facturas de suscripción
+// el periodo real está en las líneas; el de la factura es el anterior.
+func InvoicePeriod(inv *stripe.Invoice) (time.Time, time.Time) {
+	if inv.Lines != nil {
+		for _, line := range inv.Lines.Data {
+			if line.Period != nil && line.Period.End > 0 {
+				return time.Unix(line.Period.Start, 0), time.Unix(line.Period.End, 0)
+			}
+		}
+	}
+	return time.Unix(inv.PeriodStart, 0), time.Unix(inv.PeriodEnd, 0)
+}
+
+// SubscriptionPriceID devuelve el precio del primer ítem de la suscripción.
+func SubscriptionPriceID(sub *stripe.Subscription) string {
+	if sub.Items == nil || len(sub.Items.Data) == 0 || sub.Items.Data[0].Price == nil {
+		return ""
+	}
+	return sub.Items.Data[0].Price.ID
+}
+
 func GetPaymentIntent(id string) (*stripe.PaymentIntent, error) {
 	return paymentintent.Get(id, nil)
 }
@@ -0,0 +1,205 @@
+package helper
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/MetaDandy/cuent-ai-core/src/model"
+)
+
+// SubtitleFormat es el formato de salida de los subtítulos.
+type SubtitleFormat string
+
+const (
+	SubtitleSRT SubtitleFormat = "srt"
+	SubtitleVTT SubtitleFormat = "vtt"
+)
+
+// SFXMode indica qué hacer con las líneas de efectos al subtitular.
+type SFXMode string
+
+const (
+	SFXSkip    SFXMode = "skip"    // no aparecen
+	SFXBracket SFXMode = "bracket" // aparecen entre corchetes: [lluvia]
+)
+
+var (
+	ErrSubtitleFormat = errors.New("formato de subtítulos inválido, use srt o vtt")
+	ErrSFXMode        = errors.New("modo de SFX inválido, use skip o bracket")
+	ErrNoDuration     = errors.New("hay líneas de narración sin audio generado")
+)
+
+// maxCueChars es el largo máximo de un subtítulo: dos renglones de 42
+// caracteres, lo habitual en plataformas de video.
+const maxCueChars = 84
+
+// Cue es un subtítulo con sus tiempos en segundos.
+type Cue struct {
+	Start float64
+	End   float64
+	Text  string
+}
+
+// ParseSubtitleFormat valida el formato pedido; vacío equivale a srt.
+func ParseSubtitleFormat(s string) (SubtitleFormat, error) {
+	switch f := SubtitleFormat(strings.ToLower(strings.TrimSpace(s))); f {
+	case "":
+		return SubtitleSRT, nil
+	case SubtitleSRT, SubtitleVTT:
+		return f, nil
+	}
+	return "", ErrSubtitleFormat
+}
+
+// ParseSFXMode valida el modo pedido; vacío equivale a skip.
+func ParseSFXMode(s string) (SFXMode, error) {
+	switch m := SFXMode(strings.ToLower(strings.TrimSpace(s))); m {
+	case "":
+		return SFXSkip, nil
+	case SFXSkip, SFXBracket:
+		return m, nil
+	}
+	return "", ErrSFXMode
+}
+
+// AssetDurations devuelve la duración de cada asset para armar la línea de
+// tiempo sin descargar el audio. Los SFX sin audio usan la duración pedida;
+// una línea de narración sin duración no se puede subtitular.
+func AssetDurations(assets []model.Asset) ([]float64, error) {
+	durations := make([]float64, len(assets))
+	for i, a := range assets {
+		durations[i] = a.Duration
+		if durations[i] > 0 {
+			continue
+		}
+		if a.Type == model.AudioSFX {
+			durations[i] = a.SfxDuration
+			continue
+		}
+		return nil, fmt.Errorf("%w (posición %d)", ErrNoDuration, a.Position)
+	}
+	return durations, nil
+}
+
+// BuildCues arma los subtítulos con la misma línea de tiempo que la mezcla,
+// para que queden alineados con el audio mezclado. Las líneas largas se
+// parten en varios subtítulos repartiendo el tiempo según el largo de cada
+// parte. Una línea de narración termina, como tarde, cuando empieza la
+// siguiente.
+func BuildCues(assets []model.Asset, durations []float64, mix model.MixSettings, sfx SFXMode) []Cue {
+	clips, _ := BuildTimeline(assets, durations, mix)
+
+	var voice, effects []Cue
+	for i, c := range clips {
+		text := strings.Join(strings.Fields(assets[i].Line), " ")
+		if c.Layer == LayerSFX {
+			text = strings.TrimSpace(strings.Trim(text, "*"))
+			if sfx != SFXBracket || text == "" || c.Duration <= 0 {
+				continue
+			}
+			effects = append(effects, Cue{Start: c.Start, End: c.End(), Text: "[" + text + "]"})
+			continue
+		}
+		if text == "" || c.Duration <= 0 {
+			continue
+		}
+		voice = append(voice, splitCue(c.Start, c.End(), text)...)
+	}
+
+	for i := 0; i+1 < len(voice); i++ {
+		voice[i].End = math.Min(voice[i].End, voice[i+1].Start)
+	}
+
+	cues := append(voice, effects...)
+	sort.SliceStable(cues, func(i, j int) bool { return cues[i].Start < cues[j].Start })
+	return cues
+}
+
+// splitCue parte el texto en trozos de hasta maxCueChars por palabras y
+// reparte el intervalo de forma proporcional a su largo.
+func splitCue(start, end float64, text string) []Cue {
+	var (
+		chunks []string
+		cur    strings.Builder
+	)
+	for _, w := range strings.Fields(text) {
+		if cur.Len() > 0 && len([]rune(cur.String()))+1+len([]rune(w)) > maxCueChars {
+			chunks = append(chunks, cur.String())
+			cur.Reset()
+		}
+		if cur.Len() > 0 {
+			cur.WriteByte(' ')
+		}
+		cur.WriteString(w)
+	}
+	chunks = append(chunks, cur.String())
+
+	total := 0
+	for _, ch := range chunks {
+		total += len([]rune(ch))
+	}
+
+	cues := make([]Cue, len(chunks))
+	at, seen := start, 0
+	for i, ch := range chunks {
+		seen += len([]rune(ch))
+		next := start + (end-start)*float64(seen)/float64(total)
+		if i == len(chunks)-1 {
+			next = end
+		}
+		cues[i] = Cue{Start: at, End: next, Text: wrapCue(ch)}
+		at = next
+	}
+	return cues
+}
+
+// wrapCue reparte en dos renglones el texto que no entra en uno, cortando en
+// el espacio más cercano a la mitad.
+func wrapCue(text string) string {
+	r := []rune(text)
+	if len(r) <= maxCueChars/2 {
+		return text
+	}
+	dist := func(i int) int {
+		if d := i - len(r)/2; d < 0 {
+			return -d
+		}
+		return i - len(r)/2
+	}
+	best := -1
+	for i, c := range r {
+		if c == ' ' && (best < 0 || dist(i) < dist(best)) {
+			best = i
+		}
+	}
+	if best < 0 {
+		return text
+	}
+	return string(r[:best]) + "\n" + string(r[best+1:])
+}
+
+// FormatSubtitles escribe los subtítulos en el formato pedido.
+func FormatSubtitles(cues []Cue, format SubtitleFormat) string {
+	var sb strings.Builder
+	sep := ","
+	if format == SubtitleVTT {
+		sb.WriteString("WEBVTT\n\n")
+		sep = "."
+	}
+	for i, c := range cues {
+		if format == SubtitleSRT {
+			fmt.Fprintf(&sb, "%d\n", i+1)
+		}
+		fmt.Fprintf(&sb, "%s --> %s\n%s\n\n", cueTime(c.Start, sep), cueTime(c.End, sep), c.Text)
+	}
+	return sb.String()
+}
+
+// cueTime formatea segundos como hh:mm:ss,mmm (SRT) o hh:mm:ss.mmm (VTT).
+func cueTime(sec float64, sep string) string {
+	ms := int64(math.Round(math.Max(0, sec) * 1000))
+	return fmt.Sprintf("%02d:%02d:%02d%s%03d", ms/3600000, ms/60000%60, ms/1000%60, sep, ms%1000)
+}
@@ -0,0 +1,92 @@
+package helper
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/MetaDandy/cuent-ai-core/src/model"
+)
+
+// SpeechAudio es el resultado crudo de un proveedor de audio, antes de subirlo
+// al storage.
+type SpeechAudio struct {
+	Data     []byte
+	Mime     string
+	Ext      string
+	Duration time.Duration // 0 si el proveedor no la conoce
+	Chars    int           // caracteres facturados por el proveedor
+	Cost     float64       // costo estimado en USD
+}
+
+// VoiceSettings es la voz con la que se sintetiza una línea. Un ID vacío usa
+// la voz por defecto del proveedor; los valores en 0 usan sus ajustes por
+// defecto.
+type VoiceSettings struct {
+	ID         string
+	Stability  float64
+	Similarity float64
+}
+
+// SpeechProvider convierte una línea de texto en voz.
+type SpeechProvider interface {
+	Name() model.Provider
+	Model() string
+	TextToSpeech(text string, voice VoiceSettings) (*SpeechAudio, error)
+}
+
+// SoundEffectProvider genera un efecto de sonido a partir de una descripción.
+// Un SpeechProvider puede implementarlo opcionalmente; si no, AudioOutput
+// recurre a ElevenLabs para las líneas SFX.
+type SoundEffectProvider interface {
+	Name() model.Provider
+	Model() string
+	SoundEffect(description string, duration time.Duration) (*SpeechAudio, error)
+}
+
+const defaultSpeechProvider = model.ProviderElevenlab
+
+// ParseSpeechProvider normaliza el nombre recibido y comprueba que sea un
+// proveedor capaz de generar voz. Un nombre vacío es válido y significa
+// "usar el valor por defecto".
+func ParseSpeechProvider(name string) (model.Provider, error) {
+	p := model.Provider(strings.ToUpper(strings.TrimSpace(name)))
+	switch p {
+	case "", model.ProviderElevenlab, model.ProviderOpenAI, model.ProviderOffline:
+		return p, nil
+	default:
+		return "", fmt.Errorf("proveedor de voz no soportado: %s", name)
+	}
+}
+
+// NewSpeechProvider instancia el proveedor indicado. Si name está vacío se usa
+// TTS_PROVIDER y, en su defecto, ElevenLabs.
+func NewSpeechProvider(name model.Provider) (SpeechProvider, error) {
+	if name == "" {
+		name = model.Provider(strings.ToUpper(os.Getenv("TTS_PROVIDER")))
+	}
+	if name == "" {
+		name = defaultSpeechProvider
+	}
+
+	switch name {
+	case model.ProviderElevenlab:
+		return &ElevenLabsProvider{}, nil
+	case model.ProviderOpenAI:
+		return &OpenAIProvider{}, nil
+	case model.ProviderOffline:
+		return &OfflineProvider{}, nil
+	default:
+		return nil, fmt.Errorf("proveedor de voz no soportado: %s", name)
+	}
+}
+
+// SoundEffectProviderFor devuelve el proveedor SFX asociado al de voz, o
+// ElevenLabs si éste no sabe generar efectos.
+func SoundEffectProviderFor(p SpeechProvider) SoundEffectProvider {
+	if sfx, ok := p.(SoundEffectProvider); ok {
+		return sfx
+	}
+	return &ElevenLabsProvider{}
+}
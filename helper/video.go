@@ -2,12 +2,12 @@ package helper
 
 import (
 	"bytes"
+	"context"
 	"fmt"
-	"io"
-	"net/http"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strings"
 	"time"
 )
 
@@ -16,8 +16,10 @@ import (
 // Si duration < len(images), mostrará sólo las primeras duration imágenes
 // a 1 s cada una. Además aplica crossfade de 1 s entre cada par.
 // Luego superpone el audio (audioURL) y recorta al menor de vídeo o audio.
+// Si subtitles trae un SRT, los subtítulos se queman en la imagen. Las
+// imágenes se descargan con su proveedor.
 
-func GenerateVideo(images []Image, audioURL string, duration float64) ([]byte, error) {
+func GenerateVideo(store BlobStore, providers ImageProviders, images []Image, audioURL string, duration float64, subtitles string) ([]byte, error) {
 	nImgs := len(images)
 	if nImgs == 0 {
 		return nil, fmt.Errorf("necesitas al menos una imagen, prueba con otras keywords")
@@ -30,10 +32,21 @@ func GenerateVideo(images []Image, audioURL string, duration float64) ([]byte, e
 	}
 	defer os.RemoveAll(tmpDir)
 
+	// El filtro subtitles toma la ruta relativa a tmpDir para no escapar
+	// caracteres especiales de la ruta absoluta.
+	subsFilter := ""
+	if subtitles != "" {
+		if err := os.WriteFile(filepath.Join(tmpDir, "subs.srt"), []byte(subtitles), 0o644); err != nil {
+			return nil, err
+		}
+		subsFilter = ",subtitles=subs.srt"
+	}
+
 	// 5. Descargar audio
-	client := http.Client{Timeout: 30 * time.Second}
 	audioPath := filepath.Join(tmpDir, "audio.mp3")
-	if err := downloadFile(client, audioURL, audioPath); err != nil {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+	if err := DownloadURL(ctx, store, audioURL, audioPath); err != nil {
 		return nil, err
 	}
 
@@ -44,19 +57,20 @@ func GenerateVideo(images []Image, audioURL string, duration float64) ([]byte, e
 
 	if useImgs < 2 {
 		imgPath := filepath.Join(tmpDir, "img.jpg")
-		if err := downloadFile(client, images[0].Url, imgPath); err != nil {
+		if err := providers.Download(ctx, images[0], imgPath); err != nil {
 			return nil, err
 		}
 		out := filepath.Join(tmpDir, "final.mp4")
 		cmd := exec.Command("ffmpeg", "-y",
 			"-loop", "1", "-i", imgPath,
 			"-i", audioPath,
-			"-vf", "scale=1080:608:force_original_aspect_ratio=decrease,pad=1080:608:(ow-iw)/2:(oh-ih)/2,format=yuv420p",
+			"-vf", "scale=1080:608:force_original_aspect_ratio=decrease,pad=1080:608:(ow-iw)/2:(oh-ih)/2,format=yuv420p"+subsFilter,
 			"-c:v", "libx264", "-t", fmt.Sprintf("%.2f", duration),
 			"-c:a", "aac", "-b:a", "192k",
 			"-map", "0:v", "-map", "1:a",
 			out,
 		)
+		cmd.Dir = tmpDir
 		if outp, err := cmd.CombinedOutput(); err != nil {
 			return nil, fmt.Errorf("ffmpeg estático: %s / %w", outp, err)
 		}
@@ -67,7 +81,7 @@ func GenerateVideo(images []Image, audioURL string, duration float64) ([]byte, e
 	imgPaths := make([]string, useImgs)
 	for i := range useImgs {
 		imgPaths[i] = filepath.Join(tmpDir, fmt.Sprintf("img-%02d.jpg", i))
-		if err := downloadFile(client, images[i].Url, imgPaths[i]); err != nil {
+		if err := providers.Download(ctx, images[i], imgPaths[i]); err != nil {
 			return nil, err
 		}
 	}
@@ -126,13 +140,17 @@ func GenerateVideo(images []Image, audioURL string, duration float64) ([]byte, e
 		return nil, fmt.Errorf("ffmpeg vídeo sin audio: %s / %w", out, err)
 	}
 
-	// 6. Superponer audio y recortar al menor
+	// 6. Superponer audio y recortar al menor. Con subtítulos hay que
+	// recodificar el vídeo; sin ellos basta con copiarlo.
 	finalVid := filepath.Join(tmpDir, "final.mp4")
-	mixCmd := exec.Command("ffmpeg",
-		"-y",
-		"-i", videoNoAudio,
-		"-i", audioPath,
-		"-c:v", "copy",
+	mixArgs := []string{"-y", "-i", videoNoAudio, "-i", audioPath}
+	if subsFilter != "" {
+		mixArgs = append(mixArgs, "-vf", strings.TrimPrefix(subsFilter, ","),
+			"-c:v", "libx264", "-pix_fmt", "yuv420p")
+	} else {
+		mixArgs = append(mixArgs, "-c:v", "copy")
+	}
+	mixArgs = append(mixArgs,
 		"-c:a", "aac",
 		"-b:a", "192k",
 		"-map", "0:v",
@@ -140,6 +158,8 @@ func GenerateVideo(images []Image, audioURL string, duration float64) ([]byte, e
 		"-t", fmt.Sprintf("%.2f", duration),
 		finalVid,
 	)
+	mixCmd := exec.Command("ffmpeg", mixArgs...)
+	mixCmd.Dir = tmpDir
 	if out, err := mixCmd.CombinedOutput(); err != nil {
 		return nil, fmt.Errorf("ffmpeg mezcla audio: %s / %w", out, err)
 	}
@@ -147,21 +167,3 @@ func GenerateVideo(images []Image, audioURL string, duration float64) ([]byte, e
 	// 7. Leer y devolver bytes
 	return os.ReadFile(finalVid)
 }
-
-func downloadFile(client http.Client, url, dest string) error {
-	resp, err := client.Get(url)
-	if err != nil {
-		return err
-	}
-	defer resp.Body.Close()
-	if resp.StatusCode != 200 {
-		return fmt.Errorf("código HTTP %d", resp.StatusCode)
-	}
-	f, err := os.Create(dest)
-	if err != nil {
-		return err
-	}
-	defer f.Close()
-	_, err = io.Copy(f, resp.Body)
-	return err
-}
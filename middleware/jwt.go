@@ -7,12 +7,54 @@ import (
 	"strings"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/websocket/v2"
 	"github.com/golang-jwt/jwt/v5"
 )
 
+// RevocationStore responde si el jti de un access token fue revocado (logout
+// o cambio de contraseña).
+type RevocationStore interface {
+	IsRevoked(jti string) (bool, error)
+}
+
+var revocations RevocationStore
+
+// UseRevocationStore configura dónde consulta JwtMiddleware los jti
+// revocados. Se llama una vez al armar el container; sin store no se consulta.
+func UseRevocationStore(store RevocationStore) {
+	revocations = store
+}
+
 func JwtMiddleware() fiber.Handler {
+	return verifyJwt(func(c *fiber.Ctx) string {
+		return c.Get("Authorization")
+	})
+}
+
+// WsJwtMiddleware autentica la apertura de un websocket. Los navegadores no
+// pueden mandar cabeceras al abrirlo, así que el token también se acepta en
+// ?token=.
+func WsJwtMiddleware() fiber.Handler {
+	verify := verifyJwt(func(c *fiber.Ctx) string {
+		if token := c.Get("Authorization"); token != "" {
+			return token
+		}
+		return c.Query("token")
+	})
+	return func(c *fiber.Ctx) error {
+		if !websocket.IsWebSocketUpgrade(c) {
+			return c.Status(http.StatusUpgradeRequired).JSON(fiber.Map{
+				"error": "Websocket upgrade required",
+			})
+		}
+		return verify(c)
+	}
+}
+
+// verifyJwt valida el token que devuelve tokenOf y deja sus claims en Locals.
+func verifyJwt(tokenOf func(c *fiber.Ctx) string) fiber.Handler {
 	return func(c *fiber.Ctx) error {
-		tokenString := c.Get("Authorization")
+		tokenString := tokenOf(c)
 		if tokenString == "" {
 			return c.Status(http.StatusUnauthorized).JSON(fiber.Map{
 				"error": "Authorization token is missing",
@@ -34,15 +76,39 @@ func JwtMiddleware() fiber.Handler {
 			})
 		}
 
-		if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
-			c.Locals("user_id", claims["sub"])
-			c.Locals("email", claims["email"])
-		} else {
+		claims, ok := token.Claims.(jwt.MapClaims)
+		if !ok || !token.Valid {
 			return c.Status(http.StatusUnauthorized).JSON(fiber.Map{
 				"error": "Invalid token claims",
 			})
 		}
 
+		// Sin jti el token no se puede revocar: se rechaza aunque siga vigente.
+		jti, _ := claims["jti"].(string)
+		if jti == "" {
+			return c.Status(http.StatusUnauthorized).JSON(fiber.Map{
+				"error": "Token without session id",
+			})
+		}
+		if revocations != nil {
+			revoked, err := revocations.IsRevoked(jti)
+			if err != nil {
+				return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
+					"error": "Could not verify token",
+				})
+			}
+			if revoked {
+				return c.Status(http.StatusUnauthorized).JSON(fiber.Map{
+					"error": "Token has been revoked",
+				})
+			}
+		}
+
+		c.Locals("user_id", claims["sub"])
+		c.Locals("email", claims["email"])
+		c.Locals("role", claims["role"])
+		c.Locals("jti", claims["jti"])
+
 		return c.Next()
 	}
 }
@@ -0,0 +1,32 @@
+package middleware
+
+import (
+	"net/http"
+	"slices"
+
+	"github.com/MetaDandy/cuent-ai-core/src/model"
+	"github.com/gofiber/fiber/v2"
+)
+
+// RequireRole deja pasar sólo a los usuarios cuyo rol del JWT sea uno de
+// roles. Debe ir después de JwtMiddleware, que es quien pone el rol en Locals.
+// Los tokens emitidos antes de existir los roles no traen el claim y cuentan
+// como RoleUser.
+func RequireRole(roles ...model.Role) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if !slices.Contains(roles, CurrentRole(c)) {
+			return c.Status(http.StatusForbidden).JSON(fiber.Map{
+				"error": "Insufficient role",
+			})
+		}
+		return c.Next()
+	}
+}
+
+// CurrentRole devuelve el rol del usuario autenticado.
+func CurrentRole(c *fiber.Ctx) model.Role {
+	if role, ok := c.Locals("role").(string); ok && role != "" {
+		return model.Role(role)
+	}
+	return model.RoleUser
+}
@@ -1,16 +1,49 @@
 package src
 
 import (
+	"context"
+	"log"
+
 	"github.com/MetaDandy/cuent-ai-core/config"
+	"github.com/MetaDandy/cuent-ai-core/helper"
+	"github.com/MetaDandy/cuent-ai-core/middleware"
+	"github.com/MetaDandy/cuent-ai-core/src/core/admin"
 	"github.com/MetaDandy/cuent-ai-core/src/core/subscription"
 	"github.com/MetaDandy/cuent-ai-core/src/core/user"
 	"github.com/MetaDandy/cuent-ai-core/src/modules/asset"
+	"github.com/MetaDandy/cuent-ai-core/src/modules/character"
 	generatejob "github.com/MetaDandy/cuent-ai-core/src/modules/generate_job"
+	"github.com/MetaDandy/cuent-ai-core/src/modules/image"
 	"github.com/MetaDandy/cuent-ai-core/src/modules/project"
 	"github.com/MetaDandy/cuent-ai-core/src/modules/script"
+	"github.com/MetaDandy/cuent-ai-core/src/modules/validation"
+	"github.com/MetaDandy/cuent-ai-core/src/modules/voice"
+	ws "github.com/MetaDandy/cuent-ai-core/src/modules/websocket"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
 )
 
 type Container struct {
+	// Websocket
+	Hub          *ws.Hub
+	ProjectRoom  ws.EventRoom
+	ScriptCollab *script.Collab
+
+	// Storage
+	Store helper.BlobStore
+
+	// Correo
+	Mailer helper.Mailer
+
+	// Imágenes
+	Images   helper.ImageProviders
+	ImageSvc *image.Service
+	ImageHdl *image.Handler
+
+	// Admin
+	AdminSvc *admin.Service
+	AdminHdl *admin.Handler
+
 	// User
 	UserRepo *user.Repository
 	UserSvc  *user.Service
@@ -30,39 +63,105 @@ type Container struct {
 	AssetRepo *asset.Repository
 	AssetSvc  *asset.Service
 	AssetHdl  *asset.Handler
+	AssetQ    *asset.Queue
 
 	// Generated Job
 	GeneratedJobRepo *generatejob.Repository
 
+	// Character
+	CharacterRepo *character.Repository
+	CharacterSvc  *character.Service
+	CharacterHdl  *character.Handler
+
+	// Voice
+	VoiceRepo *voice.Repository
+	VoiceSvc  *voice.Service
+	VoiceHdl  *voice.Handler
+
 	// Subscription
 	SubsRepo *subscription.Repository
 	SubsSvc  *subscription.Service
 	SubsHdl  *subscription.Handler
 }
 
-func SetupContainer() *Container {
+// SetupContainer arma las dependencias; los procesos de fondo, como el
+// anuncio de salas del Hub, paran al cancelar ctx.
+func SetupContainer(ctx context.Context) *Container {
+	// Websocket
+	backplane, err := ws.NewBackplaneFromEnv(config.DB)
+	if err != nil {
+		log.Fatalf("Error configurando el backplane de websocket: %v", err)
+	}
+	hub := ws.NewHub(ctx, 4, backplane, ws.ConfigFromEnv())
+
+	// Storage
+	store, err := helper.NewBlobStoreFromEnv()
+	if err != nil {
+		log.Fatalf("Error configurando el storage: %v", err)
+	}
+
+	// Correo
+	mailer, err := helper.NewMailerFromEnv()
+	if err != nil {
+		log.Fatalf("Error configurando el correo: %v", err)
+	}
+
+	// Imágenes
+	images, err := helper.NewImageProvidersFromEnv(store)
+	if err != nil {
+		log.Fatalf("Error configurando las imágenes: %v", err)
+	}
+	imageSvc := image.NewService(images, store)
+	imageHdl := image.NewHandler(imageSvc)
+
 	// User
 	userRepo := user.NewRepository(config.DB)
-	userSvc := user.NewService(userRepo)
+	userSvc := user.NewService(userRepo, mailer)
 	userHdl := user.NewHandler(userSvc)
+	middleware.UseRevocationStore(userRepo)
 
 	// Project
 	projectRepo := project.NewRepository(config.DB)
-	projectSvc := project.NewService(projectRepo, userRepo)
+	projectSvc := project.NewService(projectRepo, userRepo, store)
 	projectHdl := project.NewHandler(projectSvc)
 
 	// Generated Job
 	generatedJobRepo := generatejob.NewRepository(config.DB)
 
+	// Voice
+	voiceRepo := voice.NewRepository(config.DB)
+	voiceSvc := voice.NewService(voiceRepo)
+	voiceHdl := voice.NewHandler(voiceSvc)
+
+	// Character
+	characterRepo := character.NewRepository(config.DB)
+	characterSvc := character.NewService(characterRepo, projectRepo)
+	characterHdl := character.NewHandler(characterSvc)
+
 	// Asset
 	assetRepo := asset.NewRepository(config.DB)
-	assetSvc := asset.NewService(assetRepo, generatedJobRepo, userRepo)
+	assetSvc := asset.NewService(assetRepo, generatedJobRepo, userRepo, voiceRepo, characterRepo, store, images, hub)
 	assetHdl := asset.NewHandler(assetSvc)
+	assetQ := asset.NewQueueFromEnv(assetSvc, generatedJobRepo)
 
 	// Script
 	scriptRepo := script.NewRepository(config.DB)
-	scriptSvc := script.NewService(scriptRepo, projectRepo, assetRepo, userRepo)
-	scriptHdl := script.NewHandler(scriptSvc)
+	scriptSvc := script.NewService(scriptRepo, projectRepo, assetRepo, userRepo, characterRepo, store, images, hub)
+	scriptHdl := script.NewHandler(scriptSvc, validation.Validate)
+	scriptCollab := script.NewCollab(scriptSvc, validation.Validate)
+
+	// Las salas de proyecto sólo reciben los eventos de generación.
+	projectRoom := ws.EventRoom(func(userID, roomID string) error {
+		if _, err := uuid.Parse(roomID); err != nil {
+			return gorm.ErrRecordNotFound
+		}
+		_, err := projectRepo.FindById(roomID, userID)
+		return err
+	})
+
+	// Admin
+	adminSvc := admin.NewService(userSvc, userRepo, generatedJobRepo)
+	adminHdl := admin.NewHandler(adminSvc)
 
 	// Subscription
 	subsRepo := subscription.NewRepository(config.DB)
@@ -70,6 +169,26 @@ func SetupContainer() *Container {
 	subsHdl := subscription.NewHandler(subsSvc)
 
 	return &Container{
+		// Websocket
+		Hub:          hub,
+		ProjectRoom:  projectRoom,
+		ScriptCollab: scriptCollab,
+
+		// Storage
+		Store: store,
+
+		// Correo
+		Mailer: mailer,
+
+		// Imágenes
+		Images:   images,
+		ImageSvc: imageSvc,
+		ImageHdl: imageHdl,
+
+		// Admin
+		AdminSvc: adminSvc,
+		AdminHdl: adminHdl,
+
 		// User
 		UserRepo: userRepo,
 		UserSvc:  userSvc,
@@ -84,6 +203,7 @@ func SetupContainer() *Container {
 		AssetRepo: assetRepo,
 		AssetSvc:  assetSvc,
 		AssetHdl:  assetHdl,
+		AssetQ:    assetQ,
 
 		//Script
 		ScriptRepo: scriptRepo,
@@ -93,6 +213,16 @@ func SetupContainer() *Container {
 		//Generated Job
 		GeneratedJobRepo: generatedJobRepo,
 
+		// Character
+		CharacterRepo: characterRepo,
+		CharacterSvc:  characterSvc,
+		CharacterHdl:  characterHdl,
+
+		// Voice
+		VoiceRepo: voiceRepo,
+		VoiceSvc:  voiceSvc,
+		VoiceHdl:  voiceHdl,
+
 		// Subscription
 		SubsRepo: subsRepo,
 		SubsSvc:  subsSvc,
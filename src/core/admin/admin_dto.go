@@ -0,0 +1,30 @@
+package admin
+
+import (
+	"github.com/MetaDandy/cuent-ai-core/helper"
+	generatejob "github.com/MetaDandy/cuent-ai-core/src/modules/generate_job"
+)
+
+// AdjustTokens suma (amount > 0) o descuenta (amount < 0) cuentokens de la
+// suscripción vigente del usuario.
+type AdjustTokens struct {
+	Amount int    `json:"amount" validate:"required"`
+	Note   string `json:"note"`
+}
+
+// GrantSubscription activa un plan sin pago; Months por defecto es 1.
+type GrantSubscription struct {
+	SubscriptionID string `json:"subscription_id" validate:"required,uuid"`
+	Months         int    `json:"months" validate:"omitempty,min=1"`
+	Note           string `json:"note"`
+}
+
+type SetRole struct {
+	Role string `json:"role" validate:"required"`
+}
+
+// JobsResponse es el listado paginado de jobs con el gasto total del filtro.
+type JobsResponse struct {
+	helper.PaginatedResponse[generatejob.GeneratedJobResponse]
+	Totals generatejob.JobTotalsResponse `json:"totals"`
+}
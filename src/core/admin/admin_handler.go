@@ -0,0 +1,213 @@
+package admin
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/MetaDandy/cuent-ai-core/helper"
+	"github.com/MetaDandy/cuent-ai-core/middleware"
+	"github.com/MetaDandy/cuent-ai-core/src/model"
+	generatejob "github.com/MetaDandy/cuent-ai-core/src/modules/generate_job"
+	"github.com/gofiber/fiber/v2"
+)
+
+type Handler struct {
+	svc *Service
+}
+
+func NewHandler(s *Service) *Handler {
+	return &Handler{svc: s}
+}
+
+// RegisterRoutes monta el panel de admin. Support sólo puede consultar; los
+// cambios requieren admin.
+func (h *Handler) RegisterRoutes(router fiber.Router) {
+	read := middleware.RequireRole(model.RoleAdmin, model.RoleSupport)
+	write := middleware.RequireRole(model.RoleAdmin)
+
+	grp := router.Group("/admin", middleware.JwtMiddleware())
+	grp.Get("/users", read, h.FindUsers)
+	grp.Get("/users/:id", read, h.FindUser)
+	grp.Post("/users/:id/tokens", write, h.AdjustTokens)
+	grp.Post("/users/:id/subscriptions", write, h.GrantSubscription)
+	grp.Patch("/users/:id/role", write, h.SetRole)
+	grp.Delete("/users/:id", write, h.SoftDeleteUser)
+	grp.Post("/users/:id/restore", write, h.RestoreUser)
+	grp.Get("/jobs", read, h.FindJobs)
+}
+
+func (h *Handler) FindUsers(c *fiber.Ctx) error {
+	opts := helper.NewFindAllOptionsFromQuery(c)
+	users, err := h.svc.FindUsers(opts)
+	if err != nil {
+		return helper.JSONError(c, http.StatusInternalServerError,
+			"Error obteniendo usuarios", err.Error())
+	}
+	return c.JSON(users)
+}
+
+func (h *Handler) FindUser(c *fiber.Ctx) error {
+	dto, err := h.svc.FindUser(c.Params("id"))
+	if helper.IsNotFound(err) {
+		return helper.JSONError(c, http.StatusNotFound,
+			"Usuario no encontrado")
+	}
+	if err != nil {
+		return helper.JSONError(c, http.StatusInternalServerError,
+			"Error obteniendo usuario", err.Error())
+	}
+
+	return c.JSON(helper.Response{
+		Data:    dto,
+		Message: "Usuario obtenido",
+	})
+}
+
+func (h *Handler) AdjustTokens(c *fiber.Ctx) error {
+	actorID, ok := c.Locals("user_id").(string)
+	if !ok || actorID == "" {
+		return helper.JSONError(c, http.StatusUnauthorized,
+			"Token sin user_id", "")
+	}
+
+	var input AdjustTokens
+	if err := c.BodyParser(&input); err != nil {
+		return helper.JSONError(c, http.StatusBadRequest,
+			"Input inválido", err.Error())
+	}
+
+	dto, err := h.svc.AdjustTokens(c.Params("id"), actorID, &input)
+	if errors.Is(err, ErrZeroAmount) {
+		return helper.JSONError(c, http.StatusBadRequest,
+			"Input inválido", err.Error())
+	}
+	if helper.IsNotFound(err) {
+		return helper.JSONError(c, http.StatusNotFound,
+			"El usuario no tiene una suscripción vigente")
+	}
+	if err != nil {
+		return helper.JSONError(c, http.StatusInternalServerError,
+			"Error ajustando cuentokens", err.Error())
+	}
+
+	return c.JSON(helper.Response{
+		Data:    dto,
+		Message: "Cuentokens ajustados",
+	})
+}
+
+func (h *Handler) GrantSubscription(c *fiber.Ctx) error {
+	actorID, ok := c.Locals("user_id").(string)
+	if !ok || actorID == "" {
+		return helper.JSONError(c, http.StatusUnauthorized,
+			"Token sin user_id", "")
+	}
+
+	var input GrantSubscription
+	if err := c.BodyParser(&input); err != nil {
+		return helper.JSONError(c, http.StatusBadRequest,
+			"Input inválido", err.Error())
+	}
+
+	dto, err := h.svc.GrantSubscription(c.Params("id"), actorID, &input)
+	if helper.IsNotFound(err) {
+		return helper.JSONError(c, http.StatusNotFound,
+			"Usuario o suscripción no encontrados")
+	}
+	if err != nil {
+		return helper.JSONError(c, http.StatusInternalServerError,
+			"Error otorgando la suscripción", err.Error())
+	}
+
+	return c.Status(http.StatusCreated).JSON(helper.Response{
+		Data:    dto,
+		Message: "Suscripción otorgada",
+	})
+}
+
+func (h *Handler) SetRole(c *fiber.Ctx) error {
+	actorID, ok := c.Locals("user_id").(string)
+	if !ok || actorID == "" {
+		return helper.JSONError(c, http.StatusUnauthorized,
+			"Token sin user_id", "")
+	}
+
+	var input SetRole
+	if err := c.BodyParser(&input); err != nil {
+		return helper.JSONError(c, http.StatusBadRequest,
+			"Input inválido", err.Error())
+	}
+
+	dto, err := h.svc.SetRole(c.Params("id"), actorID, &input)
+	if helper.IsNotFound(err) {
+		return helper.JSONError(c, http.StatusNotFound,
+			"Usuario no encontrado")
+	}
+	if err != nil {
+		return helper.JSONError(c, http.StatusBadRequest,
+			"Error cambiando el rol", err.Error())
+	}
+
+	return c.JSON(helper.Response{
+		Data:    dto,
+		Message: "Rol actualizado",
+	})
+}
+
+func (h *Handler) SoftDeleteUser(c *fiber.Ctx) error {
+	actorID, ok := c.Locals("user_id").(string)
+	if !ok || actorID == "" {
+		return helper.JSONError(c, http.StatusUnauthorized,
+			"Token sin user_id", "")
+	}
+
+	err := h.svc.SoftDeleteUser(c.Params("id"), actorID)
+	if errors.Is(err, ErrSelfAction) {
+		return helper.JSONError(c, http.StatusBadRequest,
+			"Error eliminando usuario", err.Error())
+	}
+	if helper.IsNotFound(err) {
+		return helper.JSONError(c, http.StatusNotFound,
+			"Usuario no encontrado")
+	}
+	if err != nil {
+		return helper.JSONError(c, http.StatusInternalServerError,
+			"Error eliminando usuario", err.Error())
+	}
+	return c.SendStatus(http.StatusNoContent)
+}
+
+func (h *Handler) RestoreUser(c *fiber.Ctx) error {
+	dto, err := h.svc.RestoreUser(c.Params("id"))
+	if helper.IsNotFound(err) {
+		return helper.JSONError(c, http.StatusNotFound,
+			"Usuario no encontrado")
+	}
+	if err != nil {
+		return helper.JSONError(c, http.StatusInternalServerError,
+			"Error restaurando usuario", err.Error())
+	}
+
+	return c.JSON(helper.Response{
+		Data:    dto,
+		Message: "Usuario restaurado",
+	})
+}
+
+// FindJobs acepta user_id, state y provider como filtros además de la
+// paginación habitual.
+func (h *Handler) FindJobs(c *fiber.Ctx) error {
+	opts := helper.NewFindAllOptionsFromQuery(c)
+	filter := generatejob.JobFilter{
+		UserID:   c.Query("user_id"),
+		State:    c.Query("state"),
+		Provider: c.Query("provider"),
+	}
+
+	jobs, err := h.svc.FindJobs(filter, opts)
+	if err != nil {
+		return helper.JSONError(c, http.StatusInternalServerError,
+			"Error obteniendo jobs", err.Error())
+	}
+	return c.JSON(jobs)
+}
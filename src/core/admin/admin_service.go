@@ -0,0 +1,164 @@
+package admin
+
+import (
+	"errors"
+	"time"
+
+	"github.com/MetaDandy/cuent-ai-core/helper"
+	"github.com/MetaDandy/cuent-ai-core/src/core/user"
+	"github.com/MetaDandy/cuent-ai-core/src/model"
+	generatejob "github.com/MetaDandy/cuent-ai-core/src/modules/generate_job"
+	"github.com/google/uuid"
+)
+
+type Service struct {
+	userSvc  *user.Service
+	userRepo *user.Repository
+	jobRepo  *generatejob.Repository
+}
+
+func NewService(us *user.Service, ur *user.Repository, jr *generatejob.Repository) *Service {
+	return &Service{userSvc: us, userRepo: ur, jobRepo: jr}
+}
+
+var (
+	ErrZeroAmount = errors.New("amount no puede ser 0")
+	ErrSelfAction = errors.New("no puedes aplicar esta acción sobre tu propio usuario")
+)
+
+func (s *Service) FindUsers(opts *helper.FindAllOptions) (*helper.PaginatedResponse[user.UserResponse], error) {
+	return s.userSvc.FindAll(opts)
+}
+
+func (s *Service) FindUser(id string) (*user.UserResponse, error) {
+	return s.userSvc.FindById(id)
+}
+
+// AdjustTokens acredita o descuenta cuentokens a mano. El asiento del ledger
+// guarda qué admin lo hizo y la nota.
+func (s *Service) AdjustTokens(id, actorID string, in *AdjustTokens) (*user.UserSubscriptionResponse, error) {
+	if in.Amount == 0 {
+		return nil, ErrZeroAmount
+	}
+	actor, err := uuid.Parse(actorID)
+	if err != nil {
+		return nil, err
+	}
+
+	sub, err := s.userRepo.AdjustTokens(id, in.Amount, model.TokenLedger{
+		ActorID: &actor,
+		Note:    in.Note,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	dto := user.UserSubscriptionToDto(sub)
+	return &dto, nil
+}
+
+// GrantSubscription activa un plan al usuario sin cobro, reemplazando la
+// suscripción vigente.
+func (s *Service) GrantSubscription(id, actorID string, in *GrantSubscription) (*user.UserSubscriptionResponse, error) {
+	actor, err := uuid.Parse(actorID)
+	if err != nil {
+		return nil, err
+	}
+	u, err := s.userRepo.FindById(id)
+	if err != nil {
+		return nil, err
+	}
+	plan, err := s.userRepo.FindSubscriptionById(in.SubscriptionID)
+	if err != nil {
+		return nil, err
+	}
+
+	months := in.Months
+	if months < 1 {
+		months = 1
+	}
+	now := time.Now()
+	sub := &model.UserSubscribed{
+		ID:              uuid.New(),
+		UserID:          u.ID,
+		SubscriptionID:  plan.ID,
+		TokensRemaining: plan.Cuentokens,
+		StartDate:       now,
+		EndDate:         now.AddDate(0, months, 0),
+		Status:          model.StateActive,
+	}
+
+	if err := s.userRepo.GrantSubscription(sub, model.TokenLedger{
+		ActorID: &actor,
+		Note:    in.Note,
+	}); err != nil {
+		return nil, err
+	}
+
+	dto := user.UserSubscriptionToDto(sub)
+	return &dto, nil
+}
+
+// SetRole cambia el rol de un usuario y cierra sus sesiones, para que sus
+// tokens con el rol anterior dejen de valer. Un admin no puede cambiarse el
+// suyo, así siempre queda al menos uno.
+func (s *Service) SetRole(id, actorID string, in *SetRole) (*user.UserResponse, error) {
+	if id == actorID {
+		return nil, ErrSelfAction
+	}
+	role, err := model.ParseRole(in.Role)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.userRepo.UpdateRole(id, role); err != nil {
+		return nil, err
+	}
+	if err := s.userRepo.RevokeAllSessions(id); err != nil {
+		return nil, err
+	}
+	return s.userSvc.FindById(id)
+}
+
+// SoftDeleteUser elimina al usuario y cierra sus sesiones abiertas.
+func (s *Service) SoftDeleteUser(id, actorID string) error {
+	if id == actorID {
+		return ErrSelfAction
+	}
+	if _, err := s.userRepo.FindById(id); err != nil {
+		return err
+	}
+	if err := s.userRepo.SoftDelete(id); err != nil {
+		return err
+	}
+	return s.userRepo.RevokeAllSessions(id)
+}
+
+func (s *Service) RestoreUser(id string) (*user.UserResponse, error) {
+	if _, err := s.userRepo.FindByIdUnscoped(id); err != nil {
+		return nil, err
+	}
+	if err := s.userRepo.Restore(id); err != nil {
+		return nil, err
+	}
+	return s.userSvc.FindById(id)
+}
+
+// FindJobs lista los GeneratedJob de todos los usuarios con su costo.
+func (s *Service) FindJobs(filter generatejob.JobFilter, opts *helper.FindAllOptions) (*JobsResponse, error) {
+	jobs, total, totals, err := s.jobRepo.FindAllFiltered(filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	pages := uint((total + int64(opts.Limit) - 1) / int64(opts.Limit))
+
+	return &JobsResponse{
+		PaginatedResponse: helper.PaginatedResponse[generatejob.GeneratedJobResponse]{
+			Data:   generatejob.GeneratedJobToLisDTO(jobs),
+			Total:  total,
+			Limit:  opts.Limit,
+			Offset: opts.Offset,
+			Pages:  pages,
+		},
+		Totals: *totals,
+	}, nil
+}
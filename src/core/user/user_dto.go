@@ -18,6 +18,31 @@ type Signin struct {
 	Password string `json:"password"`
 }
 
+type Refresh struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// AuthTokens es el par que recibe el cliente al abrir o renovar una sesión:
+// un access token corto y el refresh token para pedir el siguiente.
+type AuthTokens struct {
+	AccessToken  string
+	RefreshToken string
+}
+
+type VerifyEmail struct {
+	Token string `json:"token"`
+}
+
+type ForgotPassword struct {
+	Email string `json:"email"`
+}
+
+type ResetPassword struct {
+	Token            string `json:"token"`
+	New_Password     string `json:"new_password"`
+	Confirm_Password string `json:"confirm_password"`
+}
+
 /* Change Passoword*/
 type ChangePassoword struct {
 	Old_Password     string `json:"old_password"`
@@ -28,6 +53,9 @@ type ChangePassoword struct {
 type Payment struct {
 	UserSuscribedID string `json:"user_suscribed_id"`
 	PriceID         string `json:"price_id"`
+	// Recurring crea una suscripción de Stripe que se renueva cada periodo
+	// en lugar de un pago único.
+	Recurring bool `json:"recurring"`
 }
 
 type PaymentResponse struct {
@@ -36,17 +64,22 @@ type PaymentResponse struct {
 }
 
 type PaymentDetail struct {
-	ID        string    `json:"id"`
-	Amount    int       `json:"amount"`
-	Currency  string    `json:"currency"`
-	Status    string    `json:"status"`
-	CreatedAt time.Time `json:"created_at"`
+	ID             string    `json:"id"`
+	Amount         int       `json:"amount"`
+	AmountRefunded int       `json:"amount_refunded,omitempty"`
+	Currency       string    `json:"currency"`
+	Status         string    `json:"status"`
+	FailureMessage string    `json:"failure_message,omitempty"`
+	CreatedAt      time.Time `json:"created_at"`
 }
 
 type UserResponse struct {
 	ID    string `json:"id"`
 	Name  string `json:"name"`
 	Email string `json:"email"`
+	Role  string `json:"role"`
+
+	EmailVerified bool `json:"email_verified"`
 
 	Subscriptions *[]UserSubscriptionResponse `json:"all_subscriptions,omitempty"`
 
@@ -72,6 +105,8 @@ func UserToDTO(u *model.User) UserResponse {
 		ID:            u.ID.String(),
 		Name:          u.Name,
 		Email:         u.Email,
+		Role:          string(u.Role),
+		EmailVerified: u.EmailVerifiedAt != nil,
 		Subscriptions: subsPtr,
 		CreatedAt:     u.CreatedAt,
 		UpdatedAt:     u.UpdatedAt,
@@ -93,6 +128,9 @@ type UserSubscriptionResponse struct {
 	Total_Cuentokens uint   `json:"total_Cuentokens"`
 	Start_Date       string `json:"start_date"`
 	End_Date         string `json:"end_date"`
+	Status           string `json:"status"`
+	Recurring        bool   `json:"recurring"`
+	CancelAtPeriod   bool   `json:"cancel_at_period_end"`
 
 	Subscription subscription.SubscriptionResponse
 	Payments     []PaymentDetail `json:"payments,omitempty"`
@@ -119,6 +157,9 @@ func UserSubscriptionToDto(u *model.UserSubscribed) UserSubscriptionResponse {
 		Total_Cuentokens: u.TokensRemaining,
 		Start_Date:       u.StartDate.Local().String(),
 		End_Date:         u.EndDate.Local().String(),
+		Status:           string(u.Status),
+		Recurring:        u.StripeSubscriptionID != "",
+		CancelAtPeriod:   u.CancelAtPeriodEnd,
 		Subscription:     subscription.SubscriptionToDTO(&u.Subscription),
 		Payments:         payments,
 		CreatedAt:        u.CreatedAt,
@@ -138,11 +179,13 @@ func UserSubscriptionToListDTO(list []model.UserSubscribed) []UserSubscriptionRe
 // PaymentToDTO convierte un model.Payment en PaymentDetail
 func PaymentToDTO(p *model.Payment) PaymentDetail {
 	return PaymentDetail{
-		ID:        p.ID.String(),
-		Amount:    p.Amount,
-		Currency:  p.Currency,
-		Status:    string(p.Status),
-		CreatedAt: p.CreatedAt,
+		ID:             p.ID.String(),
+		Amount:         p.Amount,
+		AmountRefunded: p.AmountRefunded,
+		Currency:       p.Currency,
+		Status:         string(p.Status),
+		FailureMessage: p.FailureMessage,
+		CreatedAt:      p.CreatedAt,
 	}
 }
 
@@ -153,3 +196,78 @@ func PaymentsToListDTO(list []model.Payment) []PaymentDetail {
 	}
 	return out
 }
+
+type LedgerEntryResponse struct {
+	ID             string `json:"id"`
+	Amount         int    `json:"amount"`
+	BalanceAfter   uint   `json:"balance_after"`
+	Reason         string `json:"reason"`
+	SubscriptionID string `json:"user_subscribed_id"`
+	ScriptID       string `json:"script_id,omitempty"`
+	AssetID        string `json:"asset_id,omitempty"`
+	JobID          string `json:"job_id,omitempty"`
+
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func LedgerEntryToDTO(u *model.TokenLedger) LedgerEntryResponse {
+	dto := LedgerEntryResponse{
+		ID:             u.ID.String(),
+		Amount:         u.Amount,
+		BalanceAfter:   u.BalanceAfter,
+		Reason:         string(u.Reason),
+		SubscriptionID: u.UserSubscribedID.String(),
+		CreatedAt:      u.CreatedAt,
+	}
+	if u.ScriptID != nil {
+		dto.ScriptID = u.ScriptID.String()
+	}
+	if u.AssetID != nil {
+		dto.AssetID = u.AssetID.String()
+	}
+	if u.JobID != nil {
+		dto.JobID = u.JobID.String()
+	}
+	return dto
+}
+
+func LedgerToListDTO(list []model.TokenLedger) []LedgerEntryResponse {
+	out := make([]LedgerEntryResponse, len(list))
+	for i := range list {
+		out[i] = LedgerEntryToDTO(&list[i])
+	}
+	return out
+}
+
+type StripeEventResponse struct {
+	ID          string     `json:"id"`
+	Type        string     `json:"type"`
+	Status      string     `json:"status"`
+	Attempts    int        `json:"attempts"`
+	Error       string     `json:"error,omitempty"`
+	ProcessedAt *time.Time `json:"processed_at,omitempty"`
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func StripeEventToDTO(e *model.StripeEvent) StripeEventResponse {
+	return StripeEventResponse{
+		ID:          e.ID,
+		Type:        e.Type,
+		Status:      string(e.Status),
+		Attempts:    e.Attempts,
+		Error:       e.Error,
+		ProcessedAt: e.ProcessedAt,
+		CreatedAt:   e.CreatedAt,
+		UpdatedAt:   e.UpdatedAt,
+	}
+}
+
+func StripeEventsToListDTO(list []model.StripeEvent) []StripeEventResponse {
+	out := make([]StripeEventResponse, len(list))
+	for i := range list {
+		out[i] = StripeEventToDTO(&list[i])
+	}
+	return out
+}
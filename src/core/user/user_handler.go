@@ -1,12 +1,14 @@
 package user
 
 import (
+	"errors"
 	"log"
 	"net/http"
 	"os"
 
 	"github.com/MetaDandy/cuent-ai-core/helper"
 	"github.com/MetaDandy/cuent-ai-core/middleware"
+	"github.com/MetaDandy/cuent-ai-core/src/model"
 	"github.com/gofiber/fiber/v2"
 	"github.com/stripe/stripe-go/v82/webhook"
 )
@@ -23,32 +25,46 @@ func (h *Handler) RegisterRoutes(router fiber.Router) {
 	grp := router.Group("/users")
 	grp.Post("/sign-up", h.SignUp)
 	grp.Post("/sign-in", h.SignIn)
+	grp.Post("/refresh", h.Refresh)
+	grp.Post("/verify-email", h.VerifyEmail)
+	grp.Post("/forgot-password", h.ForgotPassword)
+	grp.Post("/reset-password", h.ResetPassword)
 	grp.Post("/stripe-web-hook", h.StripeWebhook)
 
 	grp.Use(middleware.JwtMiddleware())
 
-	grp.Get("", h.FindAll)
+	grp.Post("/logout", h.Logout)
+	grp.Post("/verify-email/resend", h.ResendVerification)
 	grp.Get("/profile", h.GetProfile)
 	grp.Get("/subscription", h.GetActiveSubscription)
+	grp.Post("/subscription/cancel", h.CancelSubscription)
+	grp.Post("/subscription/resume", h.ResumeSubscription)
+	grp.Get("/ledger", h.FindLedger)
 	grp.Get("/:id", h.FindById)
 	grp.Post("/:id/add-subscription", h.AddSubscription)
 	grp.Post("/payment-subscription", h.PaymentSubscription)
 	grp.Patch("/change-password", h.ChangePassoword)
-}
 
-func (h *Handler) FindAll(c *fiber.Ctx) error {
-	opts := helper.NewFindAllOptionsFromQuery(c)
-	users, err := h.svc.FindAll(opts)
-	if err != nil {
-		return helper.JSONError(c, http.StatusInternalServerError,
-			"Error obteniendo usuarios", err.Error())
-	}
-	return c.JSON(users)
+	admin := router.Group("/admin/stripe-events", middleware.JwtMiddleware(), middleware.RequireRole(model.RoleAdmin))
+	admin.Get("", h.FindStripeEvents)
+	admin.Post("/:id/replay", h.ReplayStripeEvent)
 }
 
+// FindById devuelve un usuario. Cada uno sólo puede verse a sí mismo; admin
+// y support pueden ver a cualquiera.
 func (h *Handler) FindById(c *fiber.Ctx) error {
 	id := c.Params("id")
+	self, _ := c.Locals("user_id").(string)
+	if role := middleware.CurrentRole(c); id != self && role != model.RoleAdmin && role != model.RoleSupport {
+		return helper.JSONError(c, http.StatusNotFound,
+			"Usuario no encontrado")
+	}
+
 	user, err := h.svc.FindById(id)
+	if helper.IsNotFound(err) {
+		return helper.JSONError(c, http.StatusNotFound,
+			"Usuario no encontrado")
+	}
 	if err != nil {
 		return helper.JSONError(c, http.StatusInternalServerError,
 			"Error obteniendo usuario", err.Error())
@@ -86,15 +102,16 @@ func (h *Handler) SignUp(c *fiber.Ctx) error {
 			"Sign Up inválido", err.Error())
 	}
 
-	users, token, err := h.svc.SignUp(&singup)
+	users, tokens, err := h.svc.SignUp(&singup)
 	if err != nil {
 		return helper.JSONError(c, http.StatusInternalServerError,
 			"Error al registrar usuario", err.Error())
 	}
 	return c.Status(http.StatusCreated).JSON(helper.Response{
-		Data:    users,
-		Token:   token,
-		Message: "User registrado",
+		Data:         users,
+		Token:        tokens.AccessToken,
+		RefreshToken: tokens.RefreshToken,
+		Message:      "User registrado",
 	})
 }
 
@@ -105,15 +122,140 @@ func (h *Handler) SignIn(c *fiber.Ctx) error {
 			"Login inválido", err.Error())
 	}
 
-	users, token, err := h.svc.Signin(&signin)
+	users, tokens, err := h.svc.Signin(&signin)
 	if err != nil {
 		return helper.JSONError(c, http.StatusInternalServerError,
 			"Error al autenticar usuario", err.Error())
 	}
 	return c.Status(http.StatusCreated).JSON(helper.Response{
-		Data:    users,
-		Token:   token,
-		Message: "User autenticado",
+		Data:         users,
+		Token:        tokens.AccessToken,
+		RefreshToken: tokens.RefreshToken,
+		Message:      "User autenticado",
+	})
+}
+
+// Refresh canjea un refresh token por un access token nuevo y el siguiente
+// refresh token. Cada refresh token sirve una sola vez.
+func (h *Handler) Refresh(c *fiber.Ctx) error {
+	var refresh Refresh
+	if err := c.BodyParser(&refresh); err != nil {
+		return helper.JSONError(c, http.StatusBadRequest,
+			"Input inválido", err.Error())
+	}
+
+	users, tokens, err := h.svc.Refresh(&refresh)
+	if errors.Is(err, ErrRefreshInvalid) || errors.Is(err, ErrRefreshReused) {
+		return helper.JSONError(c, http.StatusUnauthorized,
+			"Refresh token inválido", err.Error())
+	}
+	if err != nil {
+		return helper.JSONError(c, http.StatusInternalServerError,
+			"Error renovando la sesión", err.Error())
+	}
+	return c.JSON(helper.Response{
+		Data:         users,
+		Token:        tokens.AccessToken,
+		RefreshToken: tokens.RefreshToken,
+		Message:      "Sesión renovada",
+	})
+}
+
+// Logout cierra la sesión del token con el que se llama: su refresh token deja
+// de servir y el access token se rechaza aunque no haya vencido.
+func (h *Handler) Logout(c *fiber.Ctx) error {
+	id, ok := c.Locals("user_id").(string)
+	if !ok || id == "" {
+		return helper.JSONError(c, http.StatusUnauthorized,
+			"Token sin user_id", "")
+	}
+	jti, _ := c.Locals("jti").(string)
+
+	if err := h.svc.Logout(id, jti); err != nil {
+		return helper.JSONError(c, http.StatusInternalServerError,
+			"Error cerrando la sesión", err.Error())
+	}
+	return c.SendStatus(http.StatusNoContent)
+}
+
+func (h *Handler) VerifyEmail(c *fiber.Ctx) error {
+	var input VerifyEmail
+	if err := c.BodyParser(&input); err != nil {
+		return helper.JSONError(c, http.StatusBadRequest,
+			"Input inválido", err.Error())
+	}
+
+	data, err := h.svc.VerifyEmail(&input)
+	if errors.Is(err, ErrLinkInvalid) {
+		return helper.JSONError(c, http.StatusBadRequest,
+			"Error verificando el email", err.Error())
+	}
+	if err != nil {
+		return helper.JSONError(c, http.StatusInternalServerError,
+			"Error verificando el email", err.Error())
+	}
+	return c.JSON(helper.Response{
+		Data:    data,
+		Message: "Email verificado",
+	})
+}
+
+func (h *Handler) ResendVerification(c *fiber.Ctx) error {
+	id, ok := c.Locals("user_id").(string)
+	if !ok || id == "" {
+		return helper.JSONError(c, http.StatusUnauthorized,
+			"Token sin user_id", "")
+	}
+
+	err := h.svc.ResendVerification(id)
+	if errors.Is(err, ErrAlreadyVerified) {
+		return helper.JSONError(c, http.StatusConflict,
+			"Error reenviando la verificación", err.Error())
+	}
+	if err != nil {
+		return helper.JSONError(c, http.StatusInternalServerError,
+			"Error reenviando la verificación", err.Error())
+	}
+	return c.Status(http.StatusAccepted).JSON(helper.Response{
+		Message: "Enlace de verificación enviado",
+	})
+}
+
+// ForgotPassword responde igual exista o no el email.
+func (h *Handler) ForgotPassword(c *fiber.Ctx) error {
+	var input ForgotPassword
+	if err := c.BodyParser(&input); err != nil {
+		return helper.JSONError(c, http.StatusBadRequest,
+			"Input inválido", err.Error())
+	}
+
+	if err := h.svc.ForgotPassword(&input); err != nil {
+		return helper.JSONError(c, http.StatusInternalServerError,
+			"Error enviando el enlace", err.Error())
+	}
+	return c.Status(http.StatusAccepted).JSON(helper.Response{
+		Message: "Si el email está registrado, recibirás un enlace para restablecer la contraseña",
+	})
+}
+
+func (h *Handler) ResetPassword(c *fiber.Ctx) error {
+	var input ResetPassword
+	if err := c.BodyParser(&input); err != nil {
+		return helper.JSONError(c, http.StatusBadRequest,
+			"Input inválido", err.Error())
+	}
+
+	err := h.svc.ResetPassword(&input)
+	if errors.Is(err, ErrLinkInvalid) || errors.Is(err, ErrWeakPassword) || errors.Is(err, ErrPasswordMismatch) {
+		return helper.JSONError(c, http.StatusBadRequest,
+			"Error restableciendo la contraseña", err.Error())
+	}
+	if err != nil {
+		return helper.JSONError(c, http.StatusInternalServerError,
+			"Error restableciendo la contraseña", err.Error())
+	}
+	return c.JSON(helper.Response{
+		Message: "Contraseña restablecida, inicia sesión de nuevo",
 	})
 }
 
@@ -130,14 +272,16 @@ func (h *Handler) ChangePassoword(c *fiber.Ctx) error {
 			"Token sin user_id", "")
 	}
 
-	data, err := h.svc.ChangePassword(id, &changepass)
+	data, tokens, err := h.svc.ChangePassword(id, &changepass)
 	if err != nil {
 		return helper.JSONError(c, http.StatusInternalServerError,
 			"Error  cambiando la contraseña", err.Error())
 	}
 	return c.Status(http.StatusCreated).JSON(helper.Response{
-		Data:    data,
-		Message: "Contraseña cambiada",
+		Data:         data,
+		Token:        tokens.AccessToken,
+		RefreshToken: tokens.RefreshToken,
+		Message:      "Contraseña cambiada",
 	})
 }
 
@@ -165,15 +309,16 @@ func (h *Handler) StripeWebhook(c *fiber.Ctx) error {
 	sigHeader := c.Get("Stripe-Signature")
 	secret := os.Getenv("STRIPE_WEBHOOK_SECRET")
 
-	log.Println(secret)
-
 	evt, err := webhook.ConstructEvent(payload, sigHeader, secret)
 	if err != nil {
 		return c.Status(fiber.StatusBadRequest).SendString("signature error")
 	}
 
 	// Procesa sólo lo que te interesa
-	if resp, err := h.svc.StripeWebhook(evt); err != nil {
+	if resp, err := h.svc.StripeWebhook(evt); errors.Is(err, ErrEventInProgress) {
+		// Otra entrega lo está procesando; Stripe reintentará más tarde.
+		return c.Status(fiber.StatusConflict).SendString("event in progress")
+	} else if err != nil {
 		log.Printf("[stripe] %v", err) // ⬅️ Log interno
 		return c.Status(fiber.StatusInternalServerError).SendString("internal error")
 	} else if resp != nil {
@@ -212,6 +357,22 @@ func (h *Handler) PaymentSubscription(c *fiber.Ctx) error {
 	})
 }
 
+func (h *Handler) FindLedger(c *fiber.Ctx) error {
+	id, ok := c.Locals("user_id").(string)
+	if !ok || id == "" {
+		return helper.JSONError(c, http.StatusUnauthorized,
+			"Token sin user_id", "")
+	}
+
+	opts := helper.NewFindAllOptionsFromQuery(c)
+	ledger, err := h.svc.FindLedger(id, opts)
+	if err != nil {
+		return helper.JSONError(c, http.StatusInternalServerError,
+			"Error obteniendo el historial de cuentokens", err.Error())
+	}
+	return c.JSON(ledger)
+}
+
 func (h *Handler) GetActiveSubscription(c *fiber.Ctx) error {
 	id, ok := c.Locals("user_id").(string)
 	if !ok || id == "" {
@@ -229,3 +390,56 @@ func (h *Handler) GetActiveSubscription(c *fiber.Ctx) error {
 		Message: "Suscripción actual",
 	})
 }
+
+// CancelSubscription programa la cancelación de la suscripción recurrente al
+// final del periodo pagado; los cuentokens siguen disponibles hasta entonces.
+func (h *Handler) CancelSubscription(c *fiber.Ctx) error {
+	return h.setCancelAtPeriodEnd(c, true, "Suscripción cancelada al final del periodo")
+}
+
+// ResumeSubscription deshace una cancelación programada.
+func (h *Handler) ResumeSubscription(c *fiber.Ctx) error {
+	return h.setCancelAtPeriodEnd(c, false, "Suscripción reanudada")
+}
+
+func (h *Handler) setCancelAtPeriodEnd(c *fiber.Ctx, cancel bool, message string) error {
+	id, ok := c.Locals("user_id").(string)
+	if !ok || id == "" {
+		return helper.JSONError(c, http.StatusUnauthorized,
+			"Token sin user_id", "")
+	}
+
+	data, err := h.svc.SetCancelAtPeriodEnd(id, cancel)
+	if err != nil {
+		return helper.JSONError(c, http.StatusBadRequest,
+			"Error actualizando la suscripción", err.Error())
+	}
+	return c.JSON(helper.Response{
+		Data:    data,
+		Message: message,
+	})
+}
+
+// FindStripeEvents lista los eventos de Stripe recibidos; ?search=ERROR
+// filtra los que fallaron.
+func (h *Handler) FindStripeEvents(c *fiber.Ctx) error {
+	opts := helper.NewFindAllOptionsFromQuery(c)
+	events, err := h.svc.FindStripeEvents(opts)
+	if err != nil {
+		return helper.JSONError(c, http.StatusInternalServerError,
+			"Error obteniendo los eventos de Stripe", err.Error())
+	}
+	return c.JSON(events)
+}
+
+func (h *Handler) ReplayStripeEvent(c *fiber.Ctx) error {
+	data, err := h.svc.ReplayStripeEvent(c.Params("id"))
+	if err != nil {
+		return helper.JSONError(c, http.StatusBadRequest,
+			"Error reprocesando el evento", err.Error())
+	}
+	return c.JSON(helper.Response{
+		Data:    data,
+		Message: "Evento reprocesado",
+	})
+}
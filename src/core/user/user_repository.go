@@ -1,12 +1,16 @@
 package user
 
 import (
+	"errors"
+	"fmt"
 	"strings"
 	"time"
 
 	"github.com/MetaDandy/cuent-ai-core/helper"
 	"github.com/MetaDandy/cuent-ai-core/src/model"
+	"github.com/google/uuid"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type Repository struct {
@@ -74,8 +78,10 @@ func (r *Repository) FindUserSuscribedByID(id string) (*model.UserSubscribed, er
 	return sub, err
 }
 
+// UpdateUserSuscribed guarda los datos de la suscripción salvo el saldo, que
+// sólo cambia con Debit y Credit para que quede reflejado en el ledger.
 func (r *Repository) UpdateUserSuscribed(u *model.UserSubscribed) error {
-	return r.db.Save(u).Error
+	return r.db.Omit("total_cuentokens").Save(u).Error
 }
 
 func (r *Repository) FindPaymentID(id string) (*model.Payment, error) {
@@ -91,12 +97,114 @@ func (r *Repository) UpdatePayment(u *model.Payment) error {
 	return r.db.Save(u).Error
 }
 
-func (r *Repository) ClosePreviousSubscriptions(userID string) error {
-	return r.db.
-		Model(&model.UserSubscribed{}).
-		Where("user_id = ? AND end_date >= ?", userID, time.Now()).
-		Update("end_date", time.Now()).
-		Error
+func (r *Repository) FindUserSubscribedByStripeID(stripeID string) (*model.UserSubscribed, error) {
+	var sub model.UserSubscribed
+	err := r.db.
+		Preload("Subscription").
+		First(&sub, "stripe_subscription_id = ?", stripeID).Error
+	if err != nil {
+		return nil, err
+	}
+	return &sub, nil
+}
+
+func (r *Repository) FindSubscriptionByPriceID(priceID string) (*model.Subscription, error) {
+	var sub model.Subscription
+	err := r.db.First(&sub, "stripe_price_id = ?", priceID).Error
+	if err != nil {
+		return nil, err
+	}
+	return &sub, nil
+}
+
+// Activate marca sub como ACTIVE y cierra las demás suscripciones vigentes
+// del usuario. La primera vez le acredita los cuentokens del plan: Stripe
+// puede avisar del mismo pago con más de un evento, así que el saldo se
+// otorga sólo si la suscripción aún no tiene su asiento de alta. Los demás
+// campos de sub (fechas, IDs de Stripe) se guardan tal como vienen.
+func (r *Repository) Activate(sub *model.UserSubscribed) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		var locked model.UserSubscribed
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			First(&locked, "id = ?", sub.ID).Error; err != nil {
+			return err
+		}
+
+		var granted int64
+		if err := tx.Model(&model.TokenLedger{}).
+			Where("user_subscribed_id = ? AND reason = ?", sub.ID, model.LedgerSubscriptionGrant).
+			Count(&granted).Error; err != nil {
+			return err
+		}
+		if granted == 0 {
+			if err := r.Credit(tx, &locked, sub.Subscription.Cuentokens, model.TokenLedger{
+				Reason: model.LedgerSubscriptionGrant,
+			}); err != nil {
+				return err
+			}
+		}
+
+		sub.Status = model.StateActive
+		sub.TokensRemaining = locked.TokensRemaining
+		if err := tx.Omit("total_cuentokens").Save(sub).Error; err != nil {
+			return err
+		}
+
+		return tx.Model(&model.UserSubscribed{}).
+			Where("user_id = ? AND id <> ? AND end_date >= ?", sub.UserID, sub.ID, time.Now()).
+			Update("end_date", time.Now()).Error
+	})
+}
+
+// Renew abre un nuevo periodo de facturación en sub: el saldo que quedaba
+// expira, se acreditan los cuentokens del plan y se registra el pago de la
+// factura. Si la factura ya fue aplicada no hace nada, porque Stripe puede
+// reenviar el mismo evento.
+func (r *Repository) Renew(sub *model.UserSubscribed, start, end time.Time, invoiceID string, payment *model.Payment) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		var locked model.UserSubscribed
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			First(&locked, "id = ?", sub.ID).Error; err != nil {
+			return err
+		}
+		if locked.StripeLatestInvoiceID == invoiceID {
+			*sub = locked
+			return nil
+		}
+
+		if err := r.Debit(tx, &locked, locked.TokensRemaining, model.TokenLedger{
+			Reason: model.LedgerSubscriptionExpire,
+		}); err != nil {
+			return err
+		}
+		if err := r.Credit(tx, &locked, sub.Subscription.Cuentokens, model.TokenLedger{
+			Reason: model.LedgerSubscriptionRenewal,
+		}); err != nil {
+			return err
+		}
+
+		locked.StartDate = start
+		locked.EndDate = end
+		locked.Status = model.StateActive
+		locked.StripeLatestInvoiceID = invoiceID
+		if err := tx.Model(&locked).Updates(map[string]any{
+			"start_date":               locked.StartDate,
+			"end_date":                 locked.EndDate,
+			"status":                   locked.Status,
+			"stripe_latest_invoice_id": locked.StripeLatestInvoiceID,
+		}).Error; err != nil {
+			return err
+		}
+
+		payment.UserSuscribedID = locked.ID.String()
+		if err := tx.Create(payment).Error; err != nil {
+			return err
+		}
+
+		locked.Subscription = sub.Subscription
+		*sub = locked
+		return nil
+	})
 }
 
 func (r *Repository) CreatePayment(u *model.Payment) error {
@@ -127,7 +235,7 @@ func (r *Repository) GetActiveSubscription(userID string) (*model.UserSubscribed
 	err := r.db.
 		Preload("Subscription").
 		Preload("Payments").
-		Where("user_id = ? AND end_date >= ?", userID, time.Now()).
+		Where("user_id = ? AND status = ? AND end_date >= ?", userID, model.StateActive, time.Now()).
 		First(&us).Error
 	return &us, err
 }
@@ -157,3 +265,588 @@ func (r *Repository) Restore(id string) error {
 		Where("id = ?", id).
 		Update("deleted_at", nil).Error
 }
+
+// FindLedgerByUserID pagina los asientos de cuentokens de un usuario.
+func (r *Repository) FindLedgerByUserID(userID string, opts *helper.FindAllOptions) ([]model.TokenLedger, int64, error) {
+	var finded []model.TokenLedger
+	query := r.db.Model(model.TokenLedger{}).Where("user_id = ?", userID)
+
+	// El ledger no tiene columna name: search filtra por motivo.
+	if opts != nil && opts.Search != "" {
+		query = query.Where("reason = ?", strings.ToUpper(opts.Search))
+		o := *opts
+		o.Search = ""
+		opts = &o
+	}
+
+	var total int64
+	query, total = helper.ApplyFindAllOptions(query, opts)
+
+	err := query.Find(&finded).Error
+	return finded, total, err
+}
+
+// Debit descuenta amount cuentokens de sub y registra el asiento en el ledger.
+// sub debe estar bloqueada dentro de tx. Si el saldo no alcanza queda en 0 y
+// el asiento refleja lo realmente descontado.
+func (r *Repository) Debit(tx *gorm.DB, sub *model.UserSubscribed, amount uint, entry model.TokenLedger) error {
+	amount = min(amount, sub.TokensRemaining)
+	if amount == 0 {
+		return nil
+	}
+
+	sub.TokensRemaining -= amount
+	if err := updateBalance(tx, sub); err != nil {
+		return err
+	}
+	return appendLedger(tx, sub, -int(amount), entry)
+}
+
+// Credit suma amount cuentokens a sub y registra el asiento en el ledger.
+func (r *Repository) Credit(tx *gorm.DB, sub *model.UserSubscribed, amount uint, entry model.TokenLedger) error {
+	if amount == 0 {
+		return nil
+	}
+
+	sub.TokensRemaining += amount
+	if err := updateBalance(tx, sub); err != nil {
+		return err
+	}
+	return appendLedger(tx, sub, int(amount), entry)
+}
+
+// Grant registra el saldo inicial de una suscripción recién creada en tx.
+func (r *Repository) Grant(tx *gorm.DB, sub *model.UserSubscribed) error {
+	if sub.TokensRemaining == 0 {
+		return nil
+	}
+	return appendLedger(tx, sub, int(sub.TokensRemaining), model.TokenLedger{
+		Reason: model.LedgerSubscriptionGrant,
+	})
+}
+
+func updateBalance(tx *gorm.DB, sub *model.UserSubscribed) error {
+	return tx.Model(&model.UserSubscribed{}).
+		Where("id = ?", sub.ID).
+		Update("total_cuentokens", sub.TokensRemaining).Error
+}
+
+func appendLedger(tx *gorm.DB, sub *model.UserSubscribed, amount int, entry model.TokenLedger) error {
+	entry.ID = uuid.New()
+	entry.UserID = sub.UserID
+	entry.UserSubscribedID = sub.ID
+	entry.Amount = amount
+	entry.BalanceAfter = sub.TokensRemaining
+	return tx.Create(&entry).Error
+}
+
+// Reserve bloquea la suscripción activa del usuario, comprueba que alcance el
+// saldo y descuenta amount dejándolo retenido hasta que se llame a Capture o
+// Release. Al hacerlo todo bajo el lock, dos requests concurrentes no pueden
+// gastar el mismo saldo.
+func (r *Repository) Reserve(userID string, amount uint, entry model.TokenLedger) (*model.TokenReservation, error) {
+	res := &model.TokenReservation{
+		ID:       uuid.New(),
+		Amount:   amount,
+		State:    model.ReservationHeld,
+		Reason:   entry.Reason,
+		ScriptID: entry.ScriptID,
+		AssetID:  entry.AssetID,
+		JobID:    entry.JobID,
+	}
+
+	if err := r.db.Transaction(func(tx *gorm.DB) error {
+		var sub model.UserSubscribed
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("user_id = ? AND status = ? AND end_date >= ?", userID, model.StateActive, time.Now()).
+			First(&sub).Error; err != nil {
+			return err
+		}
+
+		if sub.TokensRemaining < amount {
+			return fmt.Errorf(
+				"fondos insuficientes: se necesitan aprox. %d cuentokens, tienes %d",
+				amount, sub.TokensRemaining,
+			)
+		}
+
+		res.UserID = sub.UserID
+		res.UserSubscribedID = sub.ID
+		if err := tx.Create(res).Error; err != nil {
+			return err
+		}
+
+		entry.ReservationID = &res.ID
+		return r.Debit(tx, &sub, amount, entry)
+	}); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// HeldReservation devuelve la reserva aún retenida de un job, la que dejó un
+// worker que murió a mitad de la generación; gorm.ErrRecordNotFound si no
+// tiene.
+func (r *Repository) HeldReservation(jobID uuid.UUID) (*model.TokenReservation, error) {
+	var res model.TokenReservation
+	err := r.db.
+		Where("job_id = ? AND state = ?", jobID, model.ReservationHeld).
+		Order("created_at DESC").
+		First(&res).Error
+	if err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// Capture cierra la reserva cobrando actual cuentokens: devuelve la diferencia
+// si se reservó de más o descuenta el extra (hasta agotar el saldo) si se
+// reservó de menos. Debe llamarse dentro de la transacción que persiste el
+// resultado de la operación.
+func (r *Repository) Capture(tx *gorm.DB, res *model.TokenReservation, actual uint) error {
+	sub, err := lockReservation(tx, res)
+	if err != nil {
+		return err
+	}
+	if res.State != model.ReservationHeld {
+		return fmt.Errorf("la reserva %s ya no está retenida (%s)", res.ID, res.State)
+	}
+
+	entry := reservationEntry(res, model.LedgerReservationAdjust)
+	captured := res.Amount
+	switch {
+	case actual < res.Amount:
+		err = r.Credit(tx, sub, res.Amount-actual, entry)
+		captured = actual
+	case actual > res.Amount:
+		extra := min(actual-res.Amount, sub.TokensRemaining)
+		err = r.Debit(tx, sub, extra, entry)
+		captured += extra
+	}
+	if err != nil {
+		return err
+	}
+
+	res.State = model.ReservationCaptured
+	res.Captured = captured
+	return tx.Save(res).Error
+}
+
+// Release devuelve todo lo reservado. Es idempotente: una reserva ya
+// capturada o liberada no se toca.
+func (r *Repository) Release(res *model.TokenReservation) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		sub, err := lockReservation(tx, res)
+		if err != nil {
+			return err
+		}
+		if res.State != model.ReservationHeld {
+			return nil
+		}
+
+		if err := r.Credit(tx, sub, res.Amount, reservationEntry(res, model.LedgerReservationRelease)); err != nil {
+			return err
+		}
+
+		res.State = model.ReservationReleased
+		return tx.Save(res).Error
+	})
+}
+
+// ReleaseStale libera las reservas retenidas hace más de olderThan, que
+// quedaron colgadas si el proceso murió a mitad de una generación.
+func (r *Repository) ReleaseStale(olderThan time.Duration) (int, error) {
+	var stale []model.TokenReservation
+	if err := r.db.
+		Where("state = ? AND created_at < ?", model.ReservationHeld, time.Now().Add(-olderThan)).
+		Find(&stale).Error; err != nil {
+		return 0, err
+	}
+
+	for i := range stale {
+		if err := r.Release(&stale[i]); err != nil {
+			return i, err
+		}
+	}
+	return len(stale), nil
+}
+
+// lockReservation recarga y bloquea la reserva y su suscripción dentro de tx.
+func lockReservation(tx *gorm.DB, res *model.TokenReservation) (*model.UserSubscribed, error) {
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		First(res, "id = ?", res.ID).Error; err != nil {
+		return nil, err
+	}
+
+	var sub model.UserSubscribed
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		First(&sub, "id = ?", res.UserSubscribedID).Error; err != nil {
+		return nil, err
+	}
+	return &sub, nil
+}
+
+func reservationEntry(res *model.TokenReservation, reason model.LedgerReason) model.TokenLedger {
+	return model.TokenLedger{
+		Reason:        reason,
+		ScriptID:      res.ScriptID,
+		AssetID:       res.AssetID,
+		JobID:         res.JobID,
+		ReservationID: &res.ID,
+	}
+}
+
+// AdjustTokens suma (amount > 0) o descuenta (amount < 0) cuentokens de la
+// suscripción vigente del usuario bajo lock. Un descuento mayor que el saldo
+// lo deja en 0; el asiento refleja lo realmente descontado.
+func (r *Repository) AdjustTokens(userID string, amount int, entry model.TokenLedger) (*model.UserSubscribed, error) {
+	var sub model.UserSubscribed
+	if err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("user_id = ? AND status = ? AND end_date >= ?", userID, model.StateActive, time.Now()).
+			First(&sub).Error; err != nil {
+			return err
+		}
+
+		entry.Reason = model.LedgerAdminAdjust
+		if amount < 0 {
+			return r.Debit(tx, &sub, uint(-amount), entry)
+		}
+		return r.Credit(tx, &sub, uint(amount), entry)
+	}); err != nil {
+		return nil, err
+	}
+	return &sub, nil
+}
+
+// GrantSubscription activa sub sin pasar por Stripe: cierra las suscripciones
+// vigentes del usuario y registra el saldo inicial con entry como asiento.
+func (r *Repository) GrantSubscription(sub *model.UserSubscribed, entry model.TokenLedger) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&model.UserSubscribed{}).
+			Where("user_id = ? AND end_date >= ?", sub.UserID, time.Now()).
+			Update("end_date", time.Now()).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Create(sub).Error; err != nil {
+			return err
+		}
+
+		if sub.TokensRemaining > 0 {
+			entry.Reason = model.LedgerSubscriptionGrant
+			if err := appendLedger(tx, sub, int(sub.TokensRemaining), entry); err != nil {
+				return err
+			}
+		}
+
+		return tx.Preload("Subscription").First(sub, "id = ?", sub.ID).Error
+	})
+}
+
+// UpdateRole cambia el rol del usuario.
+func (r *Repository) UpdateRole(id string, role model.Role) error {
+	res := r.db.Model(&model.User{}).Where("id = ?", id).Update("role", role)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// CreateRefreshToken guarda el refresh token de una sesión nueva y, de paso,
+// borra los del usuario que ya vencieron.
+func (r *Repository) CreateRefreshToken(tok *model.RefreshToken) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ? AND expires_at < ?", tok.UserID, time.Now()).
+			Delete(&model.RefreshToken{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(tok).Error
+	})
+}
+
+// RotateRefreshToken revoca el refresh token con ese hash y guarda next en su
+// misma sesión. Si el token ya había sido rotado, alguien está reusando uno
+// viejo (posible robo): se revoca la sesión entera y se devuelve
+// ErrRefreshReused. Devuelve el token consumido.
+func (r *Repository) RotateRefreshToken(hash string, next *model.RefreshToken) (*model.RefreshToken, error) {
+	var current model.RefreshToken
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			First(&current, "token_hash = ?", hash).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrRefreshInvalid
+			}
+			return err
+		}
+		if current.RevokedAt != nil {
+			return ErrRefreshReused
+		}
+		if current.ExpiresAt.Before(time.Now()) {
+			return ErrRefreshInvalid
+		}
+
+		now := time.Now()
+		if err := tx.Model(&current).Update("revoked_at", now).Error; err != nil {
+			return err
+		}
+		current.RevokedAt = &now
+
+		next.UserID = current.UserID
+		next.SessionID = current.SessionID
+		return tx.Create(next).Error
+	})
+	if errors.Is(err, ErrRefreshReused) {
+		if revokeErr := r.RevokeSession(current.UserID.String(), current.SessionID.String()); revokeErr != nil {
+			return nil, revokeErr
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &current, nil
+}
+
+// RevokeSession cierra una sesión: revoca su refresh token y su jti, así el
+// access token que siga vivo deja de aceptarse.
+func (r *Repository) RevokeSession(userID, sessionID string) error {
+	uid, err := uuid.Parse(userID)
+	if err != nil {
+		return err
+	}
+	sid, err := uuid.Parse(sessionID)
+	if err != nil {
+		return err
+	}
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		return revokeSessions(tx, uid, []uuid.UUID{sid})
+	})
+}
+
+// RevokeAllSessions cierra todas las sesiones abiertas del usuario.
+func (r *Repository) RevokeAllSessions(userID string) error {
+	uid, err := uuid.Parse(userID)
+	if err != nil {
+		return err
+	}
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		var sessions []uuid.UUID
+		if err := tx.Model(&model.RefreshToken{}).
+			Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", uid, time.Now()).
+			Distinct().
+			Pluck("session_id", &sessions).Error; err != nil {
+			return err
+		}
+		return revokeSessions(tx, uid, sessions)
+	})
+}
+
+// IsRevoked indica si el jti de un access token pertenece a una sesión
+// cerrada. Un jti que no es un UUID no lo emitimos nosotros.
+func (r *Repository) IsRevoked(jti string) (bool, error) {
+	if _, err := uuid.Parse(jti); err != nil {
+		return true, nil
+	}
+	var count int64
+	err := r.db.Model(&model.RevokedToken{}).
+		Where("jti = ? AND expires_at > ?", jti, time.Now()).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// revokeSessions revoca los refresh tokens de las sesiones y guarda sus jti
+// hasta que vence el último access token que pudieron emitir. Aprovecha para
+// borrar los jti que ya no hacen falta.
+func revokeSessions(tx *gorm.DB, userID uuid.UUID, sessions []uuid.UUID) error {
+	now := time.Now()
+	if err := tx.Where("expires_at < ?", now).Delete(&model.RevokedToken{}).Error; err != nil {
+		return err
+	}
+	if len(sessions) == 0 {
+		return nil
+	}
+
+	if err := tx.Model(&model.RefreshToken{}).
+		Where("session_id IN ? AND revoked_at IS NULL", sessions).
+		Update("revoked_at", now).Error; err != nil {
+		return err
+	}
+
+	revoked := make([]model.RevokedToken, len(sessions))
+	for i, sid := range sessions {
+		revoked[i] = model.RevokedToken{
+			JTI:       sid,
+			UserID:    userID,
+			ExpiresAt: now.Add(helper.AccessTokenTTL()),
+		}
+	}
+	return tx.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "jti"}},
+		DoUpdates: clause.AssignmentColumns([]string{"expires_at"}),
+	}).Create(&revoked).Error
+}
+
+// CreateUserToken guarda el token de un enlace nuevo. Los enlaces anteriores
+// del mismo tipo que no se usaron se borran: sólo vale el último enviado.
+func (r *Repository) CreateUserToken(tok *model.UserToken) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ? AND purpose = ? AND used_at IS NULL", tok.UserID, tok.Purpose).
+			Delete(&model.UserToken{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(tok).Error
+	})
+}
+
+// VerifyEmail consume el token de verificación y marca el email del usuario
+// como verificado.
+func (r *Repository) VerifyEmail(hash string) (*model.User, error) {
+	var user model.User
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		tok, err := consumeUserToken(tx, hash, model.PurposeVerifyEmail)
+		if err != nil {
+			return err
+		}
+		if err := tx.Model(&model.User{}).
+			Where("id = ? AND email_verified_at IS NULL", tok.UserID).
+			Update("email_verified_at", time.Now()).Error; err != nil {
+			return err
+		}
+		return tx.First(&user, "id = ?", tok.UserID).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// ResetPassword consume el token de recuperación y guarda el nuevo hash de la
+// contraseña. Haber recibido el enlace prueba que el email es suyo, así que
+// también queda verificado.
+func (r *Repository) ResetPassword(hash, passwordHash string) (*model.User, error) {
+	var user model.User
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		tok, err := consumeUserToken(tx, hash, model.PurposeResetPassword)
+		if err != nil {
+			return err
+		}
+		if err := tx.Model(&model.User{}).
+			Where("id = ?", tok.UserID).
+			Updates(map[string]any{
+				"password":          passwordHash,
+				"email_verified_at": gorm.Expr("COALESCE(email_verified_at, ?)", time.Now()),
+			}).Error; err != nil {
+			return err
+		}
+		return tx.First(&user, "id = ?", tok.UserID).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// consumeUserToken marca el token como usado si existe, es del tipo pedido,
+// no se usó y no venció; si no, devuelve ErrLinkInvalid.
+func consumeUserToken(tx *gorm.DB, hash string, purpose model.TokenPurpose) (*model.UserToken, error) {
+	var tok model.UserToken
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		First(&tok, "token_hash = ? AND purpose = ?", hash, purpose).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrLinkInvalid
+		}
+		return nil, err
+	}
+	if tok.UsedAt != nil || tok.ExpiresAt.Before(time.Now()) {
+		return nil, ErrLinkInvalid
+	}
+
+	now := time.Now()
+	if err := tx.Model(&tok).Update("used_at", now).Error; err != nil {
+		return nil, err
+	}
+	tok.UsedAt = &now
+	return &tok, nil
+}
+
+// Tiempo tras el cual un evento que quedó ACTIVE (el proceso murió a mitad)
+// puede volver a tomarse.
+const stripeEventStale = 10 * time.Minute
+
+// RecordStripeEvent guarda el evento si es la primera vez que llega. Los
+// reintentos de Stripe con el mismo ID no lo modifican.
+func (r *Repository) RecordStripeEvent(evt *model.StripeEvent) error {
+	return r.db.Clauses(clause.OnConflict{DoNothing: true}).Create(evt).Error
+}
+
+// ClaimStripeEvent marca el evento como en proceso si está pendiente, falló
+// o quedó colgado. Devuelve false si ya fue procesado o lo procesa otra
+// petición, así dos entregas simultáneas no lo aplican dos veces.
+func (r *Repository) ClaimStripeEvent(id string) (bool, error) {
+	res := r.db.Model(&model.StripeEvent{}).
+		Where("id = ?", id).
+		Where("status IN ? OR (status = ? AND updated_at < ?)",
+			[]model.State{model.StatePending, model.StateError},
+			model.StateActive, time.Now().Add(-stripeEventStale)).
+		Updates(map[string]any{
+			"status":     model.StateActive,
+			"attempts":   gorm.Expr("attempts + 1"),
+			"updated_at": time.Now(),
+		})
+	return res.RowsAffected == 1, res.Error
+}
+
+// FinishStripeEvent deja el evento FINISHED o, si procErr no es nil, en ERROR
+// con el motivo para poder reprocesarlo.
+func (r *Repository) FinishStripeEvent(id string, procErr error) error {
+	updates := map[string]any{
+		"status":       model.StateFinished,
+		"error":        "",
+		"processed_at": time.Now(),
+	}
+	if procErr != nil {
+		updates["status"] = model.StateError
+		updates["error"] = procErr.Error()
+		updates["processed_at"] = nil
+	}
+	return r.db.Model(&model.StripeEvent{}).Where("id = ?", id).Updates(updates).Error
+}
+
+func (r *Repository) FindStripeEventByID(id string) (*model.StripeEvent, error) {
+	var evt model.StripeEvent
+	if err := r.db.First(&evt, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+	return &evt, nil
+}
+
+// FindStripeEvents pagina los eventos recibidos; search filtra por estado.
+func (r *Repository) FindStripeEvents(opts *helper.FindAllOptions) ([]model.StripeEvent, int64, error) {
+	var finded []model.StripeEvent
+	query := r.db.Model(model.StripeEvent{}).Omit("payload")
+
+	if opts != nil && opts.Search != "" {
+		query = query.Where("status = ?", strings.ToUpper(opts.Search))
+		o := *opts
+		o.Search = ""
+		opts = &o
+	}
+
+	query, total := helper.ApplyFindAllOptions(query, opts)
+
+	err := query.Find(&finded).Error
+	return finded, total, err
+}
+
+// FindPaymentByIntentID busca el pago asociado a un PaymentIntent de Stripe.
+func (r *Repository) FindPaymentByIntentID(intentID string) (*model.Payment, error) {
+	var pay model.Payment
+	if err := r.db.First(&pay, "stripe_payment_intent_id = ?", intentID).Error; err != nil {
+		return nil, err
+	}
+	return &pay, nil
+}
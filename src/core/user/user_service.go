@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"log"
 	"os"
 	"regexp"
 	"strings"
@@ -14,23 +15,39 @@ import (
 	"github.com/MetaDandy/cuent-ai-core/src/model"
 	"github.com/google/uuid"
 	stripe "github.com/stripe/stripe-go/v82"
-	"github.com/stripe/stripe-go/v82/invoice"
 	"github.com/stripe/stripe-go/v82/paymentintent"
 	"gorm.io/gorm"
 )
 
 type Service struct {
-	repo *Repository
+	repo   *Repository
+	mailer helper.Mailer
 }
 
-func NewService(r *Repository) *Service {
-	return &Service{repo: r}
+func NewService(r *Repository, m helper.Mailer) *Service {
+	return &Service{repo: r, mailer: m}
 }
 
+// Vigencia de los enlaces que se envían por correo.
+const (
+	verifyEmailTTL   = 48 * time.Hour
+	resetPasswordTTL = time.Hour
+)
+
 var (
 	ErrInvalidEmail = errors.New("email no tiene un formato válido")
 	ErrWeakPassword = errors.New("la contraseña debe tener al menos 8 caracteres")
 	ErrEmailTaken   = errors.New("ya existe un usuario con ese email")
+
+	ErrPasswordMismatch = errors.New("la nueva contraseña no coincide con la confirmación")
+
+	ErrEventInProgress = errors.New("el evento se está procesando")
+
+	ErrRefreshInvalid = errors.New("refresh token inválido o vencido")
+	ErrRefreshReused  = errors.New("refresh token ya usado, se cerró la sesión")
+
+	ErrLinkInvalid     = errors.New("el enlace no es válido o ya venció")
+	ErrAlreadyVerified = errors.New("el email ya está verificado")
 )
 
 /* -------- regex simple RFC 5322 -------- */
@@ -53,6 +70,25 @@ func (s *Service) FindAll(opts *helper.FindAllOptions) (*helper.PaginatedRespons
 	}, nil
 }
 
+// FindLedger devuelve el historial de débitos y créditos de cuentokens del
+// usuario.
+func (s *Service) FindLedger(userID string, opts *helper.FindAllOptions) (*helper.PaginatedResponse[LedgerEntryResponse], error) {
+	entries, total, err := s.repo.FindLedgerByUserID(userID, opts)
+	if err != nil {
+		return nil, err
+	}
+	dtos := LedgerToListDTO(entries)
+	pages := uint((total + int64(opts.Limit) - 1) / int64(opts.Limit))
+
+	return &helper.PaginatedResponse[LedgerEntryResponse]{
+		Data:   dtos,
+		Total:  total,
+		Limit:  opts.Limit,
+		Offset: opts.Offset,
+		Pages:  pages,
+	}, nil
+}
+
 func (s *Service) FindById(id string) (*UserResponse, error) {
 	user, err := s.repo.FindById(id)
 	if err != nil {
@@ -63,26 +99,26 @@ func (s *Service) FindById(id string) (*UserResponse, error) {
 	return &dto, nil
 }
 
-func (s *Service) SignUp(in *Singup) (*UserResponse, string, error) {
+func (s *Service) SignUp(in *Singup) (*UserResponse, *AuthTokens, error) {
 	name := strings.TrimSpace(in.Name)
 	email := strings.TrimSpace(strings.ToLower(in.Email))
 
 	if !emailRx.MatchString(email) {
-		return nil, "", ErrInvalidEmail
+		return nil, nil, ErrInvalidEmail
 	}
 	if len(in.Password) < 8 {
-		return nil, "", ErrWeakPassword
+		return nil, nil, ErrWeakPassword
 	}
 
 	if _, err := s.repo.FindByEmail(email); err == nil {
-		return nil, "", ErrEmailTaken
+		return nil, nil, ErrEmailTaken
 	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
-		return nil, "", err
+		return nil, nil, err
 	}
 
 	hash, err := helper.HashPassword(in.Password)
 	if err != nil {
-		return nil, "", err
+		return nil, nil, err
 	}
 
 	user := &model.User{
@@ -90,11 +126,12 @@ func (s *Service) SignUp(in *Singup) (*UserResponse, string, error) {
 		Name:     name,
 		Email:    email,
 		Password: string(hash),
+		Role:     model.RoleUser,
 	}
 
 	free, err := s.repo.FindSubscriptionByName("Free")
 	if err != nil {
-		return nil, "", err
+		return nil, nil, err
 	}
 
 	sub := &model.UserSubscribed{
@@ -104,6 +141,7 @@ func (s *Service) SignUp(in *Singup) (*UserResponse, string, error) {
 		StartDate:       time.Now(),
 		EndDate:         time.Now().AddDate(0, 1, 0),
 		TokensRemaining: free.Cuentokens,
+		Status:          model.StateActive,
 	}
 
 	if err := s.repo.db.Transaction(func(tx *gorm.DB) error {
@@ -111,69 +149,305 @@ func (s *Service) SignUp(in *Singup) (*UserResponse, string, error) {
 			return err
 		}
 
-		return tx.Create(sub).Error
+		if err := tx.Create(sub).Error; err != nil {
+			return err
+		}
+
+		return s.repo.Grant(tx, sub)
 	}); err != nil {
-		return nil, "", err
+		return nil, nil, err
+	}
+
+	if err := s.sendVerification(user); err != nil {
+		log.Printf("[mail] verificación de %s: %v", user.Email, err)
 	}
 
 	dto := UserToDTO(user)
-	token, err := helper.GenerateJwt(user.ID.String(), user.Email)
+	tokens, err := s.newSession(user)
 	if err != nil {
-		return nil, "", err
+		return nil, nil, err
 	}
 
-	return &dto, token, nil
+	return &dto, tokens, nil
 }
 
-func (s *Service) Signin(in *Signin) (*UserResponse, string, error) {
+func (s *Service) Signin(in *Signin) (*UserResponse, *AuthTokens, error) {
 	user, err := s.repo.FindByEmail(in.Email)
 	if err != nil {
-		return nil, "", err
+		return nil, nil, err
 	}
 
 	if !helper.CheckPasswordHash(in.Password, user.Password) {
-		return nil, "", errors.New("la contraseña no coincide")
+		return nil, nil, errors.New("la contraseña no coincide")
 	}
 
-	token, err := helper.GenerateJwt(user.ID.String(), user.Email)
+	tokens, err := s.newSession(user)
 	if err != nil {
-		return nil, "", err
+		return nil, nil, err
 	}
 	dto := UserToDTO(user)
 
-	return &dto, token, nil
+	return &dto, tokens, nil
 }
 
-func (s *Service) ChangePassword(id string, in *ChangePassoword) (*UserResponse, error) {
-	user, err := s.repo.FindById(id)
+// Refresh rota el refresh token y emite un access token nuevo para la misma
+// sesión. El rol se vuelve a leer de la BD, así los cambios se aplican aquí.
+func (s *Service) Refresh(in *Refresh) (*UserResponse, *AuthTokens, error) {
+	if in.RefreshToken == "" {
+		return nil, nil, ErrRefreshInvalid
+	}
+
+	raw, hash, err := helper.NewOpaqueToken()
+	if err != nil {
+		return nil, nil, err
+	}
+	next := &model.RefreshToken{
+		ID:        uuid.New(),
+		TokenHash: hash,
+		ExpiresAt: time.Now().Add(helper.RefreshTokenTTL()),
+	}
+	used, err := s.repo.RotateRefreshToken(helper.HashOpaqueToken(in.RefreshToken), next)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	user, err := s.repo.FindById(used.UserID.String())
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		// El usuario fue eliminado después de iniciar sesión.
+		if err := s.repo.RevokeSession(used.UserID.String(), used.SessionID.String()); err != nil {
+			return nil, nil, err
+		}
+		return nil, nil, ErrRefreshInvalid
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	access, err := helper.GenerateJwtWithID(next.SessionID.String(), user.ID.String(), user.Email, string(user.Role))
+	if err != nil {
+		return nil, nil, err
+	}
+	dto := UserToDTO(user)
+
+	return &dto, &AuthTokens{AccessToken: access, RefreshToken: raw}, nil
+}
+
+// Logout cierra la sesión del access token. Los tokens emitidos antes de las
+// sesiones no traen jti y simplemente vencen solos.
+func (s *Service) Logout(userID, jti string) error {
+	if jti == "" {
+		return nil
+	}
+	return s.repo.RevokeSession(userID, jti)
+}
+
+// newSession abre una sesión: guarda su primer refresh token y emite el
+// access token con el ID de la sesión como jti.
+func (s *Service) newSession(user *model.User) (*AuthTokens, error) {
+	raw, hash, err := helper.NewOpaqueToken()
+	if err != nil {
+		return nil, err
+	}
+
+	tok := &model.RefreshToken{
+		ID:        uuid.New(),
+		UserID:    user.ID,
+		SessionID: uuid.New(),
+		TokenHash: hash,
+		ExpiresAt: time.Now().Add(helper.RefreshTokenTTL()),
+	}
+	if err := s.repo.CreateRefreshToken(tok); err != nil {
+		return nil, err
+	}
+
+	access, err := helper.GenerateJwtWithID(tok.SessionID.String(), user.ID.String(), user.Email, string(user.Role))
 	if err != nil {
 		return nil, err
 	}
+	return &AuthTokens{AccessToken: access, RefreshToken: raw}, nil
+}
+
+func (s *Service) ChangePassword(id string, in *ChangePassoword) (*UserResponse, *AuthTokens, error) {
+	user, err := s.repo.FindById(id)
+	if err != nil {
+		return nil, nil, err
+	}
 
 	if !helper.CheckPasswordHash(in.Old_Password, user.Password) {
-		return nil, errors.New("la contraseña no coincide")
+		return nil, nil, errors.New("la contraseña no coincide")
 	}
 
 	if in.New_Password != in.Confirm_Password {
-		return nil, errors.New("la nueva contraseña no coincide con la confirmación")
+		return nil, nil, ErrPasswordMismatch
 	}
 
 	hash, err := helper.HashPassword(in.New_Password)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	user.Password = string(hash)
 
 	if err := s.repo.Update(user); err != nil {
-		return nil, err
+		return nil, nil, err
+	}
+
+	// Cambiar la contraseña cierra todas las sesiones; quien la cambió
+	// recibe una nueva.
+	if err := s.repo.RevokeAllSessions(id); err != nil {
+		return nil, nil, err
+	}
+	tokens, err := s.newSession(user)
+	if err != nil {
+		return nil, nil, err
 	}
 
 	dto := UserToDTO(user)
 
+	return &dto, tokens, nil
+}
+
+// ResendVerification vuelve a enviar el enlace de verificación; el anterior
+// deja de servir.
+func (s *Service) ResendVerification(id string) error {
+	user, err := s.repo.FindById(id)
+	if err != nil {
+		return err
+	}
+	if user.EmailVerifiedAt != nil {
+		return ErrAlreadyVerified
+	}
+	return s.sendVerification(user)
+}
+
+func (s *Service) VerifyEmail(in *VerifyEmail) (*UserResponse, error) {
+	if in.Token == "" {
+		return nil, ErrLinkInvalid
+	}
+	user, err := s.repo.VerifyEmail(helper.HashOpaqueToken(in.Token))
+	if err != nil {
+		return nil, err
+	}
+	dto := UserToDTO(user)
 	return &dto, nil
 }
 
+// ForgotPassword envía el enlace para restablecer la contraseña. Si el email
+// no existe no hace nada y tampoco lo dice, para no revelar qué cuentas hay.
+func (s *Service) ForgotPassword(in *ForgotPassword) error {
+	email := strings.TrimSpace(strings.ToLower(in.Email))
+	user, err := s.repo.FindByEmail(email)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	raw, err := s.newUserToken(user, model.PurposeResetPassword, resetPasswordTTL)
+	if err != nil {
+		return err
+	}
+	s.deliver(helper.Mail{
+		To:      user.Email,
+		Subject: "Restablece tu contraseña de Cuent AI",
+		Body: fmt.Sprintf("Hola %s,\n\n"+
+			"Para elegir una nueva contraseña abre este enlace:\n%s/reset-password?token=%s\n\n"+
+			"El enlace vence en una hora. Si no lo pediste, ignora este correo.\n",
+			user.Name, frontendURL(), raw),
+	})
+	return nil
+}
+
+// ResetPassword cambia la contraseña con el token del correo y cierra todas
+// las sesiones abiertas.
+func (s *Service) ResetPassword(in *ResetPassword) error {
+	if in.Token == "" {
+		return ErrLinkInvalid
+	}
+	if len(in.New_Password) < 8 {
+		return ErrWeakPassword
+	}
+	if in.New_Password != in.Confirm_Password {
+		return ErrPasswordMismatch
+	}
+
+	hash, err := helper.HashPassword(in.New_Password)
+	if err != nil {
+		return err
+	}
+	user, err := s.repo.ResetPassword(helper.HashOpaqueToken(in.Token), hash)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		// El usuario fue eliminado después de pedir el enlace.
+		return ErrLinkInvalid
+	}
+	if err != nil {
+		return err
+	}
+
+	return s.repo.RevokeAllSessions(user.ID.String())
+}
+
+func (s *Service) sendVerification(user *model.User) error {
+	raw, err := s.newUserToken(user, model.PurposeVerifyEmail, verifyEmailTTL)
+	if err != nil {
+		return err
+	}
+	s.deliver(helper.Mail{
+		To:      user.Email,
+		Subject: "Verifica tu email en Cuent AI",
+		Body: fmt.Sprintf("Hola %s,\n\n"+
+			"Confirma tu email abriendo este enlace:\n%s/verify-email?token=%s\n\n"+
+			"El enlace vence en 48 horas.\n",
+			user.Name, frontendURL(), raw),
+	})
+	return nil
+}
+
+// newUserToken guarda un token de un solo uso y devuelve el valor que va en
+// el enlace.
+func (s *Service) newUserToken(user *model.User, purpose model.TokenPurpose, ttl time.Duration) (string, error) {
+	raw, hash, err := helper.NewOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+	if err := s.repo.CreateUserToken(&model.UserToken{
+		ID:        uuid.New(),
+		UserID:    user.ID,
+		Purpose:   purpose,
+		TokenHash: hash,
+		ExpiresAt: time.Now().Add(ttl),
+	}); err != nil {
+		return "", err
+	}
+	return raw, nil
+}
+
+// deliver envía el correo en segundo plano para no hacer esperar la petición
+// (ni delatar, por el tiempo de respuesta, si un email existe). Los fallos
+// sólo quedan en el log.
+func (s *Service) deliver(m helper.Mail) {
+	if s.mailer == nil {
+		return
+	}
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		if err := s.mailer.Send(ctx, m); err != nil {
+			log.Printf("[mail] enviando %q a %s: %v", m.Subject, m.To, err)
+		}
+	}()
+}
+
+// frontendURL es la URL base de la app web, usada en los enlaces que se
+// envían al usuario.
+func frontendURL() string {
+	if url := os.Getenv("FRONTEND_URL"); url != "" {
+		return strings.TrimRight(url, "/")
+	}
+	return "http://localhost:3000"
+}
+
 // Crea una suscripción con status de pendiente
 func (s *Service) AddSubscription(userID, subsID string) (*UserSubscriptionResponse, error) {
 	user, err := s.repo.FindById(userID)
@@ -182,7 +456,7 @@ func (s *Service) AddSubscription(userID, subsID string) (*UserSubscriptionRespo
 	}
 
 	subUserActual, err := s.repo.GetActiveSubscription(user.ID.String())
-	if err != nil {
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
 		return nil, err
 	}
 
@@ -197,19 +471,28 @@ func (s *Service) AddSubscription(userID, subsID string) (*UserSubscriptionRespo
 	}
 
 	subUser := &model.UserSubscribed{
-		ID:              uuid.New(),
-		UserID:          user.ID,
-		SubscriptionID:  sub.ID,
-		TokensRemaining: sub.Cuentokens,
-		StartDate:       time.Now(),
-		EndDate:         time.Now().AddDate(0, 1, 0),
+		ID:             uuid.New(),
+		UserID:         user.ID,
+		SubscriptionID: sub.ID,
+		StartDate:      time.Now(),
+		EndDate:        time.Now().AddDate(0, 1, 0),
+		Status:         model.StatePending,
 	}
 
+	// Un plan de pago queda PENDING y sin saldo hasta que Stripe confirma el
+	// pago (ver Activate); el gratuito se activa en el acto.
 	if sub.Name == "Free" {
 		subUser.Status = model.StateActive
+		subUser.TokensRemaining = sub.Cuentokens
 	}
 
-	if err := s.repo.CreateUserSubscription(subUser); err != nil {
+	if err := s.repo.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(subUser).Error; err != nil {
+			return err
+		}
+
+		return s.repo.Grant(tx, subUser)
+	}); err != nil {
 		return nil, err
 	}
 
@@ -220,10 +503,6 @@ func (s *Service) AddSubscription(userID, subsID string) (*UserSubscriptionRespo
 
 // Crea el pago y lo vincula a la suscripción creada previamente
 func (s *Service) PaySubscription(userID string, pay Payment) (*PaymentResponse, error) {
-	if pay.PriceID == "" {
-		return nil, errors.New("priceID vacío")
-	}
-
 	user, err := s.repo.FindById(userID)
 	if err != nil {
 		return nil, err
@@ -234,6 +513,14 @@ func (s *Service) PaySubscription(userID string, pay Payment) (*PaymentResponse,
 		return nil, err
 	}
 
+	// Para los pagos recurrentes el plan puede traer su propio precio.
+	if pay.PriceID == "" && pay.Recurring {
+		pay.PriceID = sub.Subscription.StripePriceID
+	}
+	if pay.PriceID == "" {
+		return nil, errors.New("priceID vacío")
+	}
+
 	stripeClient := helper.NewStripeClient()
 	ctx := context.Background()
 
@@ -248,13 +535,8 @@ func (s *Service) PaySubscription(userID string, pay Payment) (*PaymentResponse,
 		}
 	}
 
-	frontendURL := os.Getenv("FRONTEND_URL")
-	if frontendURL == "" {
-		frontendURL = "http://localhost:3000"
-	}
-
-	successURL := fmt.Sprintf("%s/payment/success?session_id={CHECKOUT_SESSION_ID}", frontendURL)
-	cancelURL := fmt.Sprintf("%s/payment/cancel", frontendURL)
+	successURL := fmt.Sprintf("%s/payment/success?session_id={CHECKOUT_SESSION_ID}", frontendURL())
+	cancelURL := fmt.Sprintf("%s/payment/cancel", frontendURL())
 
 	if customSuccessURL := os.Getenv("STRIPE_SUCCESS_URL"); customSuccessURL != "" {
 		successURL = customSuccessURL
@@ -264,17 +546,34 @@ func (s *Service) PaySubscription(userID string, pay Payment) (*PaymentResponse,
 	}
 
 	payment_id := uuid.New()
-	sess, err := stripeClient.CreateOneTimeSession(
-		ctx,
-		user.StripeCustomerID,
-		pay.PriceID,
-		successURL,
-		cancelURL,
-		map[string]string{
-			"subs_user_id": sub.ID.String(),
-			"payment_id":   payment_id.String(),
-		},
-	)
+	metadata := map[string]string{
+		"subs_user_id": sub.ID.String(),
+		"payment_id":   payment_id.String(),
+	}
+
+	var sess *stripe.CheckoutSession
+	if pay.Recurring {
+		// La metadata viaja en la suscripción de Stripe, así cada factura
+		// futura puede enlazarse con este UserSubscribed.
+		sess, err = stripeClient.CreateSubscriptionSession(
+			ctx,
+			user.StripeCustomerID,
+			pay.PriceID,
+			successURL,
+			cancelURL,
+			metadata,
+			true,
+		)
+	} else {
+		sess, err = stripeClient.CreateOneTimeSession(
+			ctx,
+			user.StripeCustomerID,
+			pay.PriceID,
+			successURL,
+			cancelURL,
+			metadata,
+		)
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -297,9 +596,94 @@ func (s *Service) PaySubscription(userID string, pay Payment) (*PaymentResponse,
 	return &paymentR, nil
 }
 
-// Webhook que verifica si el pago fue correcto o no
+// StripeWebhook registra el evento en stripe_events y lo aplica una sola
+// vez: las entregas repetidas de un evento ya procesado se ignoran. Si falla
+// queda en ERROR y Stripe (o un admin) puede volver a intentarlo.
 func (s *Service) StripeWebhook(event stripe.Event) (*UserSubscriptionResponse, error) {
-	stripeClient := helper.NewStripeClient()
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.repo.RecordStripeEvent(&model.StripeEvent{
+		ID:      event.ID,
+		Type:    string(event.Type),
+		Payload: payload,
+		Status:  model.StatePending,
+	}); err != nil {
+		return nil, err
+	}
+
+	return s.processStripeEvent(event)
+}
+
+// ReplayStripeEvent vuelve a aplicar un evento guardado que falló.
+func (s *Service) ReplayStripeEvent(id string) (*StripeEventResponse, error) {
+	stored, err := s.repo.FindStripeEventByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if stored.Status == model.StateFinished {
+		return nil, errors.New("el evento ya fue procesado")
+	}
+
+	var event stripe.Event
+	if err := json.Unmarshal(stored.Payload, &event); err != nil {
+		return nil, err
+	}
+
+	// Si vuelve a fallar, el motivo queda guardado en el propio evento.
+	if _, err := s.processStripeEvent(event); errors.Is(err, ErrEventInProgress) {
+		return nil, err
+	}
+
+	stored, err = s.repo.FindStripeEventByID(id)
+	if err != nil {
+		return nil, err
+	}
+	dto := StripeEventToDTO(stored)
+	return &dto, nil
+}
+
+func (s *Service) FindStripeEvents(opts *helper.FindAllOptions) (*helper.PaginatedResponse[StripeEventResponse], error) {
+	events, total, err := s.repo.FindStripeEvents(opts)
+	if err != nil {
+		return nil, err
+	}
+	dtos := StripeEventsToListDTO(events)
+	pages := uint((total + int64(opts.Limit) - 1) / int64(opts.Limit))
+
+	return &helper.PaginatedResponse[StripeEventResponse]{
+		Data:   dtos,
+		Total:  total,
+		Limit:  opts.Limit,
+		Offset: opts.Offset,
+		Pages:  pages,
+	}, nil
+}
+
+// processStripeEvent toma el evento y guarda el resultado de aplicarlo.
+func (s *Service) processStripeEvent(event stripe.Event) (*UserSubscriptionResponse, error) {
+	claimed, err := s.repo.ClaimStripeEvent(event.ID)
+	if err != nil {
+		return nil, err
+	}
+	if !claimed {
+		stored, err := s.repo.FindStripeEventByID(event.ID)
+		if err == nil && stored.Status == model.StateFinished {
+			return nil, nil // reintento de un evento ya aplicado
+		}
+		return nil, ErrEventInProgress
+	}
+
+	resp, procErr := s.applyStripeEvent(event)
+	if err := s.repo.FinishStripeEvent(event.ID, procErr); err != nil {
+		return nil, err
+	}
+	return resp, procErr
+}
+
+// applyStripeEvent actualiza pagos y suscripciones según el evento.
+func (s *Service) applyStripeEvent(event stripe.Event) (*UserSubscriptionResponse, error) {
 	switch event.Type {
 	case "checkout.session.completed":
 		var sess stripe.CheckoutSession
@@ -331,6 +715,27 @@ func (s *Service) StripeWebhook(event stripe.Event) (*UserSubscriptionResponse,
 			return nil, err
 		}
 
+		// En modo suscripción no hay PaymentIntent: el periodo y las
+		// renovaciones llegan después con invoice.paid.
+		if sess.Mode == stripe.CheckoutSessionModeSubscription {
+			payment.Status = model.StateActive
+			payment.Amount = int(sess.AmountTotal)
+			payment.Currency = string(sess.Currency)
+			if err := s.repo.UpdatePayment(payment); err != nil {
+				return nil, err
+			}
+
+			if sess.Subscription != nil {
+				sub.StripeSubscriptionID = sess.Subscription.ID
+			}
+			if err := s.repo.Activate(sub); err != nil {
+				return nil, err
+			}
+
+			dto := UserSubscriptionToDto(sub)
+			return &dto, nil
+		}
+
 		pi, err := paymentintent.Get(sess.PaymentIntent.ID, nil)
 		if err != nil {
 			return nil, err
@@ -344,13 +749,11 @@ func (s *Service) StripeWebhook(event stripe.Event) (*UserSubscriptionResponse,
 			return nil, err
 		}
 
-		sub.Status = model.StateActive
 		sub.StartDate = time.Now()
 		sub.EndDate = time.Now().AddDate(0, 1, 0)
-		if err := s.repo.UpdateUserSuscribed(sub); err != nil {
+		if err := s.repo.Activate(sub); err != nil {
 			return nil, err
 		}
-		s.repo.ClosePreviousSubscriptions(sub.ID.String())
 
 		// _, err = subscription.Update(
 		// 	subObj.ID, // ID de Stripe
@@ -366,33 +769,147 @@ func (s *Service) StripeWebhook(event stripe.Event) (*UserSubscriptionResponse,
 		dto := UserSubscriptionToDto(sub)
 		return &dto, nil
 
-	case "invoice.payment_failed":
-		// 1️⃣ Parseamos el invoice con el SDK
-		var inv *stripe.Invoice
-		if err := json.Unmarshal(event.Data.Raw, &inv); err != nil {
+	case "customer.subscription.created", "customer.subscription.updated":
+		var stripeSub stripe.Subscription
+		if err := json.Unmarshal(event.Data.Raw, &stripeSub); err != nil {
+			return nil, err
+		}
+
+		sub, err := s.stripeSubscribed(stripeSub.ID, stripeSub.Metadata)
+		if err != nil {
 			return nil, err
 		}
 
-		// 2️⃣ Extraemos el ID de la suscripción desde el JSON crudo
-		var aux struct {
-			Subscription string `json:"subscription"`
+		// Las fechas las fija invoice.paid; aquí sólo se sincroniza el estado,
+		// la cancelación programada y un posible cambio de plan.
+		sub.StripeSubscriptionID = stripeSub.ID
+		sub.CancelAtPeriodEnd = stripeSub.CancelAtPeriodEnd
+		sub.Status = subscriptionState(stripeSub.Status, sub.Status)
+		if plan, err := s.repo.FindSubscriptionByPriceID(helper.SubscriptionPriceID(&stripeSub)); err == nil {
+			sub.SubscriptionID = plan.ID
+			sub.Subscription = *plan
+		}
+		if err := s.repo.UpdateUserSuscribed(sub); err != nil {
+			return nil, err
+		}
+
+		dto := UserSubscriptionToDto(sub)
+		return &dto, nil
+
+	case "customer.subscription.deleted":
+		var stripeSub stripe.Subscription
+		if err := json.Unmarshal(event.Data.Raw, &stripeSub); err != nil {
+			return nil, err
 		}
-		_ = json.Unmarshal(event.Data.Raw, &aux) // ignoramos error; ya parseó arriba
 
-		// 3️⃣ Leemos la Subscription para acceder a los metadatos
-		subObj, err := stripeClient.GetSubscription(context.Background(), aux.Subscription)
+		sub, err := s.stripeSubscribed(stripeSub.ID, stripeSub.Metadata)
 		if err != nil {
 			return nil, err
 		}
 
-		// 2️⃣ De esa su	scripción obtener la invoice
-		inv, err = invoice.Get(subObj.LatestInvoice.ID, nil)
+		sub.Status = model.StateFinished
+		sub.CancelAtPeriodEnd = false
+		sub.EndDate = time.Now()
+		if err := s.repo.UpdateUserSuscribed(sub); err != nil {
+			return nil, err
+		}
+
+		dto := UserSubscriptionToDto(sub)
+		return &dto, nil
+
+	case "invoice.paid":
+		var inv stripe.Invoice
+		if err := json.Unmarshal(event.Data.Raw, &inv); err != nil {
+			return nil, err
+		}
+
+		stripeSubID, metadata := helper.InvoiceSubscription(&inv)
+		if stripeSubID == "" {
+			return nil, nil // pago único, lo resuelve checkout.session.completed
+		}
+
+		sub, err := s.stripeSubscribed(stripeSubID, metadata)
 		if err != nil {
 			return nil, err
 		}
+		if sub.StripeLatestInvoiceID == inv.ID {
+			dto := UserSubscriptionToDto(sub)
+			return &dto, nil
+		}
 
-		paymentID := subObj.Metadata["payment_id"]
-		payment, err := s.repo.FindPaymentID(paymentID)
+		start, end := helper.InvoicePeriod(&inv)
+
+		// Cada ciclo nuevo renueva el saldo del plan.
+		if inv.BillingReason == stripe.InvoiceBillingReasonSubscriptionCycle {
+			payment := &model.Payment{
+				ID:       uuid.New(),
+				UserID:   sub.UserID.String(),
+				Amount:   int(inv.AmountPaid),
+				Currency: string(inv.Currency),
+				Status:   model.StateActive,
+			}
+			if err := s.repo.Renew(sub, start, end, inv.ID, payment); err != nil {
+				return nil, err
+			}
+
+			dto := UserSubscriptionToDto(sub)
+			return &dto, nil
+		}
+
+		// Primera factura (o cambio de plan): se activa el periodo y, si
+		// checkout.session.completed no lo hizo antes, se otorga el saldo.
+		sub.StripeSubscriptionID = stripeSubID
+		sub.StripeLatestInvoiceID = inv.ID
+		sub.StartDate = start
+		sub.EndDate = end
+		if err := s.repo.Activate(sub); err != nil {
+			return nil, err
+		}
+
+		if paymentID := metadata["payment_id"]; paymentID != "" {
+			if payment, err := s.repo.FindPaymentID(paymentID); err == nil && payment.Status != model.StateActive {
+				payment.Status = model.StateActive
+				payment.Amount = int(inv.AmountPaid)
+				payment.Currency = string(inv.Currency)
+				if err := s.repo.UpdatePayment(payment); err != nil {
+					return nil, err
+				}
+			}
+		}
+
+		dto := UserSubscriptionToDto(sub)
+		return &dto, nil
+
+	case "invoice.payment_failed":
+		var inv stripe.Invoice
+		if err := json.Unmarshal(event.Data.Raw, &inv); err != nil {
+			return nil, err
+		}
+
+		stripeSubID, metadata := helper.InvoiceSubscription(&inv)
+		if stripeSubID == "" {
+			return nil, nil // los pagos únicos llegan por payment_intent.payment_failed
+		}
+
+		// Una renovación fallida deja su propio pago en ERROR; el estado de
+		// la suscripción lo actualiza customer.subscription.updated.
+		if inv.BillingReason == stripe.InvoiceBillingReasonSubscriptionCycle {
+			sub, err := s.stripeSubscribed(stripeSubID, metadata)
+			if err != nil {
+				return nil, err
+			}
+			payment := &model.Payment{
+				ID:              uuid.New(),
+				UserID:          sub.UserID.String(),
+				UserSuscribedID: sub.ID.String(),
+				Amount:          int(inv.AmountDue),
+				Currency:        string(inv.Currency),
+				Status:          model.StateError,
+			}
+			return nil, s.repo.CreatePayment(payment)
+		}
+
+		payment, err := s.repo.FindPaymentID(metadata["payment_id"])
 		if err != nil {
 			return nil, err
 		}
@@ -400,17 +917,118 @@ func (s *Service) StripeWebhook(event stripe.Event) (*UserSubscriptionResponse,
 		payment.Status = model.StateError
 		payment.Amount = int(inv.AmountDue)
 		payment.Currency = string(inv.Currency)
-		if err := s.repo.UpdatePayment(payment); err != nil {
+		return nil, s.repo.UpdatePayment(payment)
+
+	case "payment_intent.payment_failed":
+		var pi stripe.PaymentIntent
+		if err := json.Unmarshal(event.Data.Raw, &pi); err != nil {
+			return nil, err
+		}
+
+		payment, err := s.intentPayment(&pi)
+		if err != nil {
+			return nil, err
+		}
+
+		payment.Status = model.StateError
+		payment.StripePaymentIntentID = pi.ID
+		payment.Amount = int(pi.Amount)
+		payment.Currency = string(pi.Currency)
+		if pi.LastPaymentError != nil {
+			payment.FailureMessage = pi.LastPaymentError.Msg
+		}
+		return nil, s.repo.UpdatePayment(payment)
+
+	case "charge.refunded":
+		var ch stripe.Charge
+		if err := json.Unmarshal(event.Data.Raw, &ch); err != nil {
+			return nil, err
+		}
+		if ch.PaymentIntent == nil {
+			return nil, nil
+		}
+
+		payment, err := s.intentPayment(ch.PaymentIntent)
+		if err != nil {
 			return nil, err
 		}
 
-		return nil, errors.New("pago fallido")
+		// Un reembolso parcial sólo suma lo devuelto; el total cierra el pago.
+		payment.AmountRefunded = int(ch.AmountRefunded)
+		if ch.Refunded {
+			payment.Status = model.StateRefunded
+		}
+		return nil, s.repo.UpdatePayment(payment)
 
 	default: // No procesamos otras respuestas
 		return nil, nil
 	}
 }
 
+// intentPayment busca el pago de un PaymentIntent, por la metadata puesta al
+// crear la sesión o por el ID del intent ya guardado.
+func (s *Service) intentPayment(pi *stripe.PaymentIntent) (*model.Payment, error) {
+	if paymentID := pi.Metadata["payment_id"]; paymentID != "" {
+		return s.repo.FindPaymentID(paymentID)
+	}
+	return s.repo.FindPaymentByIntentID(pi.ID)
+}
+
+// stripeSubscribed busca el UserSubscribed enlazado a una suscripción de
+// Stripe. Los eventos pueden llegar antes que checkout.session.completed, así
+// que si aún no está enlazada se usa la metadata puesta al crear la sesión.
+func (s *Service) stripeSubscribed(stripeID string, metadata map[string]string) (*model.UserSubscribed, error) {
+	sub, err := s.repo.FindUserSubscribedByStripeID(stripeID)
+	if err == nil {
+		return sub, nil
+	}
+	if subsUserID := metadata["subs_user_id"]; subsUserID != "" {
+		return s.repo.FindUserSuscribedByID(subsUserID)
+	}
+	return nil, err
+}
+
+// subscriptionState traduce el estado de Stripe al de la suscripción local.
+// Los estados desconocidos conservan el actual.
+func subscriptionState(status stripe.SubscriptionStatus, current model.State) model.State {
+	switch status {
+	case stripe.SubscriptionStatusActive, stripe.SubscriptionStatusTrialing:
+		return model.StateActive
+	case stripe.SubscriptionStatusCanceled, stripe.SubscriptionStatusIncompleteExpired:
+		return model.StateFinished
+	case stripe.SubscriptionStatusPastDue, stripe.SubscriptionStatusUnpaid,
+		stripe.SubscriptionStatusIncomplete, stripe.SubscriptionStatusPaused:
+		return model.StatePending
+	default:
+		return current
+	}
+}
+
+// SetCancelAtPeriodEnd programa la cancelación de la suscripción recurrente
+// vigente al final del periodo pagado, o la reanuda si cancel es false.
+func (s *Service) SetCancelAtPeriodEnd(userID string, cancel bool) (*UserSubscriptionResponse, error) {
+	sub, err := s.repo.GetActiveSubscription(userID)
+	if err != nil {
+		return nil, err
+	}
+	if sub.StripeSubscriptionID == "" {
+		return nil, errors.New("la suscripción actual no es recurrente")
+	}
+
+	stripeClient := helper.NewStripeClient()
+	if _, err := stripeClient.SetCancelAtPeriodEnd(context.Background(), sub.StripeSubscriptionID, cancel); err != nil {
+		return nil, err
+	}
+
+	sub.CancelAtPeriodEnd = cancel
+	if err := s.repo.UpdateUserSuscribed(sub); err != nil {
+		return nil, err
+	}
+
+	dto := UserSubscriptionToDto(sub)
+	return &dto, nil
+}
+
 func (s *Service) GetActiveSubscription(id string) (*UserSubscriptionResponse, error) {
 	sub, err := s.repo.GetActiveSubscription(id)
 	if err != nil {
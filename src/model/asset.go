@@ -19,10 +19,27 @@ type Asset struct {
 	VideoState State   `gorm:"type:state;default:'PENDING'"`
 	Duration   float64 `gorm:"not null"`
 	Position   int     `gorm:"not null"`
+	// Secuencia del script en la última edición de la línea.
+	Seq int64 `gorm:"not null;default:0"`
+	// Duración pedida para un SFX en segundos; 0 usa la por defecto.
+	SfxDuration float64
+	// Silencio en segundos tras la línea al mezclar.
+	Pause float64
+	// Imágenes elegidas para el video, en orden.
+	Images []AssetImage `gorm:"type:jsonb;serializer:json"`
 
 	ScriptID uuid.UUID
 	Script   Script
 
+	// Personaje que dice la línea; vacío para narración y SFX.
+	Speaker     string
+	CharacterID *uuid.UUID `gorm:"type:uuid"`
+	Character   *Character
+
+	// Voz propia de la línea; si es nil se usa la del personaje o la del proyecto.
+	VoiceID *uuid.UUID `gorm:"type:uuid"`
+	Voice   *Voice
+
 	GeneratedJobs []GeneratedJob `gorm:"foreignKey:AssetID;constraint:OnUpdate:CASCADE,OnDelete:SET NULL;"`
 
 	CreatedAt time.Time
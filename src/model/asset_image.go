@@ -0,0 +1,20 @@
+package model
+
+// ImageSource es el proveedor del que sale una imagen.
+type ImageSource string
+
+const (
+	ImageUnsplash ImageSource = "UNSPLASH"
+	ImageLibrary  ImageSource = "LIBRARY" // carpeta local de stock
+	ImageUpload   ImageSource = "UPLOAD"  // subida por el usuario
+)
+
+// AssetImage es una imagen elegida para el video de un asset. Se guarda en el
+// asset para que volver a renderizar use las mismas. ID es el identificador
+// dentro del proveedor; URL es pública (Unsplash, biblioteca) o una
+// referencia del storage (subidas).
+type AssetImage struct {
+	Source ImageSource `json:"source"`
+	ID     string      `json:"id"`
+	URL    string      `json:"url"`
+}
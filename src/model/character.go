@@ -0,0 +1,26 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Character es un personaje de un proyecto; las líneas de diálogo con su
+// nombre como speaker se leen con su voz.
+type Character struct {
+	ID          uuid.UUID `gorm:"type:uuid;primaryKey;"`
+	Name        string    `gorm:"not null;uniqueIndex:idx_character_project_name"`
+	Description string
+
+	ProjectID uuid.UUID `gorm:"type:uuid;not null;uniqueIndex:idx_character_project_name"`
+	Project   Project
+
+	VoiceID *uuid.UUID `gorm:"type:uuid"`
+	Voice   *Voice
+
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	DeletedAt gorm.DeletedAt `gorm:"index"`
+}
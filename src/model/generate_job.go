@@ -2,6 +2,7 @@ package model
 
 import (
 	"database/sql/driver"
+	"fmt"
 	"time"
 
 	"github.com/google/uuid"
@@ -22,6 +23,16 @@ type GeneratedJob struct {
 	AssetID uuid.UUID
 	Asset   Asset
 
+	// Usuario al que se le cobra la generación y lote al que pertenece
+	// cuando se encola desde generate_all.
+	UserID  uuid.UUID  `gorm:"type:uuid"`
+	BatchID *uuid.UUID `gorm:"type:uuid;index"`
+	// Voz usada; nil si se usó la voz por defecto del proveedor.
+	VoiceID *uuid.UUID `gorm:"type:uuid"`
+	// Último latido del worker que tiene el job ACTIVE. Si envejece más que
+	// el lease, el worker se da por muerto y el job vuelve a la cola.
+	ClaimedAt *time.Time
+
 	CreatedAt time.Time
 	UpdatedAt time.Time
 	DeletedAt gorm.DeletedAt `gorm:"index"`
@@ -33,7 +44,28 @@ const (
 	ProviderOpenAI    Provider = "OPENAI"
 	ProviderGemini    Provider = "GEMINI"
 	ProviderElevenlab Provider = "ELEVENLAB"
+	ProviderOffline   Provider = "OFFLINE"
 )
 
-func (p *Provider) Scan(v interface{}) error    { *p = Provider(v.(string)); return nil }
-func (p Provider) Value() (driver.Value, error) { return string(p), nil }
+func (p *Provider) Scan(v interface{}) error {
+	if v == nil {
+		*p = ""
+		return nil
+	}
+	switch s := v.(type) {
+	case string:
+		*p = Provider(s)
+	case []byte:
+		*p = Provider(string(s))
+	default:
+		return fmt.Errorf("no se puede convertir %T a Provider", v)
+	}
+	return nil
+}
+
+func (p Provider) Value() (driver.Value, error) {
+	if p == "" {
+		return nil, nil
+	}
+	return string(p), nil
+}
@@ -0,0 +1,92 @@
+package model
+
+import (
+	"fmt"
+	"math"
+)
+
+// MixSettings son los parámetros con los que se mezcla el audio de un script.
+// Se guardan en el script para que volver a mezclar dé el mismo resultado.
+type MixSettings struct {
+	// Silencio en segundos entre líneas de narración cuando el asset no trae
+	// su propio Pause.
+	Gap float64 `json:"gap"`
+	// Solapamiento en segundos entre líneas de narración consecutivas, con
+	// fundido cruzado.
+	Crossfade float64 `json:"crossfade"`
+
+	// Música de fondo como referencia "bucket/clave"; vacío = sin música.
+	Music string `json:"music,omitempty"`
+	// Volumen de la música en dB (por defecto -18).
+	MusicGain *float64 `json:"music_gain,omitempty"`
+	// Baja la música mientras hay voz (por defecto sí).
+	Ducking *bool `json:"ducking,omitempty"`
+
+	// Sonoridad objetivo de la mezcla final en LUFS (EBU R128, por defecto -16).
+	Loudness *float64 `json:"loudness,omitempty"`
+
+	// Ajustes por asset, indexados por su ID.
+	Tracks map[string]TrackSettings `json:"tracks,omitempty"`
+}
+
+// TrackSettings ajusta un asset dentro de la línea de tiempo.
+type TrackSettings struct {
+	// Desplazamiento en segundos respecto a donde caería (negativo = antes).
+	Offset  float64 `json:"offset"`
+	Gain    float64 `json:"gain"` // dB
+	FadeIn  float64 `json:"fade_in"`
+	FadeOut float64 `json:"fade_out"`
+}
+
+const (
+	DefaultMusicGain = -18.0
+	DefaultLoudness  = -16.0
+)
+
+func (m MixSettings) MusicGainDB() float64 {
+	if m.MusicGain == nil {
+		return DefaultMusicGain
+	}
+	return *m.MusicGain
+}
+
+func (m MixSettings) DuckingEnabled() bool {
+	return m.Ducking == nil || *m.Ducking
+}
+
+func (m MixSettings) LoudnessLUFS() float64 {
+	if m.Loudness == nil {
+		return DefaultLoudness
+	}
+	return *m.Loudness
+}
+
+// Validate revisa que los valores estén en rangos que ffmpeg acepta y que
+// tengan sentido para una mezcla.
+func (m MixSettings) Validate() error {
+	switch {
+	case !inRange(m.Gap, 0, 10):
+		return fmt.Errorf("gap debe estar entre 0 y 10 segundos")
+	case !inRange(m.Crossfade, 0, 5):
+		return fmt.Errorf("crossfade debe estar entre 0 y 5 segundos")
+	case m.MusicGain != nil && !inRange(*m.MusicGain, -60, 0):
+		return fmt.Errorf("music_gain debe estar entre -60 y 0 dB")
+	case m.Loudness != nil && !inRange(*m.Loudness, -70, -5):
+		return fmt.Errorf("loudness debe estar entre -70 y -5 LUFS")
+	}
+	for id, t := range m.Tracks {
+		switch {
+		case !inRange(t.Offset, -30, 30):
+			return fmt.Errorf("tracks[%s].offset debe estar entre -30 y 30 segundos", id)
+		case !inRange(t.Gain, -60, 20):
+			return fmt.Errorf("tracks[%s].gain debe estar entre -60 y 20 dB", id)
+		case !inRange(t.FadeIn, 0, 30), !inRange(t.FadeOut, 0, 30):
+			return fmt.Errorf("tracks[%s]: los fundidos deben estar entre 0 y 30 segundos", id)
+		}
+	}
+	return nil
+}
+
+func inRange(v, min, max float64) bool {
+	return !math.IsNaN(v) && v >= min && v <= max
+}
@@ -12,8 +12,10 @@ type Payment struct {
 	StripeSessionID       string
 	StripePaymentIntentID string
 	Amount                int
+	AmountRefunded        int
 	Currency              string
 	Status                State `gorm:"type:state;default:'PENDING'"`
+	FailureMessage        string
 
 	UserSuscribed   UserSubscribed
 	UserSuscribedID string
@@ -14,11 +14,18 @@ type Project struct {
 	Description string
 	Cuentokens  string `gorm:"not null"`
 	State       State  `gorm:"type:state;default:'PENDING'"`
+	// Proveedor de voz por defecto; vacío usa TTS_PROVIDER o ElevenLabs.
+	Provider Provider `gorm:"type:provider"`
+
+	// Voz por defecto de las líneas TTS del proyecto.
+	VoiceID *uuid.UUID `gorm:"type:uuid"`
+	Voice   *Voice
 
 	UserID uuid.UUID
 	User   User
 
-	Scripts []Script `gorm:"foreignKey:ProjectID;constraint:OnUpdate:CASCADE,OnDelete:SET NULL;"`
+	Scripts    []Script    `gorm:"foreignKey:ProjectID;constraint:OnUpdate:CASCADE,OnDelete:SET NULL;"`
+	Characters []Character `gorm:"foreignKey:ProjectID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
 
 	CreatedAt time.Time
 	UpdatedAt time.Time
@@ -33,6 +40,7 @@ const (
 	StateFinished    State = "FINISHED"
 	StateRegenerated State = "REGENERATED"
 	StateError       State = "ERROR"
+	StateRefunded    State = "REFUNDED" // sólo pagos devueltos por completo
 )
 
 func (s *State) Scan(v interface{}) error    { *s = State(v.(string)); return nil }
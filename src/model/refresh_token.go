@@ -0,0 +1,30 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// RefreshToken es un refresh token emitido a una sesión. Cada uso lo rota:
+// se revoca y se emite otro con el mismo SessionID. Sólo se guarda el hash.
+type RefreshToken struct {
+	ID        uuid.UUID  `gorm:"type:uuid;primaryKey;"`
+	UserID    uuid.UUID  `gorm:"type:uuid;not null;index"`
+	SessionID uuid.UUID  `gorm:"type:uuid;not null;index"`
+	TokenHash string     `gorm:"type:char(64);uniqueIndex;not null"`
+	ExpiresAt time.Time  `gorm:"not null;index"`
+	RevokedAt *time.Time `gorm:"index"`
+
+	CreatedAt time.Time
+}
+
+// RevokedToken marca como revocado el jti de una sesión. Basta con guardarlo
+// hasta que vence el último access token que pudo emitirse con él.
+type RevokedToken struct {
+	JTI       uuid.UUID `gorm:"column:jti;type:uuid;primaryKey;"`
+	UserID    uuid.UUID `gorm:"type:uuid;not null"`
+	ExpiresAt time.Time `gorm:"not null;index"`
+
+	CreatedAt time.Time
+}
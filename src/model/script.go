@@ -18,6 +18,14 @@ type Script struct {
 	Total_Cuentoken   uint      `gorm:"not null"`
 	Mixed_Audio       string
 	Mixed_Media       string
+	Mix               MixSettings `gorm:"type:jsonb;serializer:json"`
+	// Número de la versión actual; 0 en scripts anteriores al versionado.
+	Version int `gorm:"not null;default:0"`
+	// Secuencia de la última edición de las líneas; los clientes
+	// colaborativos la usan para ordenar los cambios.
+	Seq int64 `gorm:"not null;default:0"`
+	// Motivo del fallo cuando State es ERROR.
+	Error string
 
 	ProjectID uuid.UUID
 	Project   Project
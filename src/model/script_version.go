@@ -0,0 +1,87 @@
+package model
+
+import (
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ScriptVersion es una foto del script: el texto procesado, las líneas con
+// el audio que tenían y lo que costó generarla. Regenerar o restaurar crea
+// una versión nueva sin tocar las anteriores.
+type ScriptVersion struct {
+	ID     uuid.UUID `gorm:"type:uuid;primaryKey;"`
+	Number int       `gorm:"not null;uniqueIndex:idx_script_version_number"`
+
+	Processed_Text    string
+	Prompt_Tokens     uint32
+	Completion_Tokens uint32
+	Total_Tokens      uint32
+	// Cuentokens cobrados al crear la versión.
+	Cuentoken uint
+	// Versión de la que se restauró, si no salió del formateador.
+	RestoredFrom *int
+
+	Lines []VersionLine `gorm:"type:jsonb;serializer:json"`
+
+	ScriptID uuid.UUID `gorm:"type:uuid;not null;uniqueIndex:idx_script_version_number"`
+	Script   Script
+
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// VersionLine es un asset tal como estaba en la versión. AssetID permite
+// volver a usar la misma fila (y su audio) al restaurar.
+type VersionLine struct {
+	AssetID     uuid.UUID    `json:"asset_id"`
+	Type        AudioLine    `json:"type"`
+	Line        string       `json:"line"`
+	Speaker     string       `json:"speaker,omitempty"`
+	SfxDuration float64      `json:"sfx_duration,omitempty"`
+	Pause       float64      `json:"pause,omitempty"`
+	VoiceID     *uuid.UUID   `json:"voice_id,omitempty"`
+	Audio_URL   string       `json:"audio_url,omitempty"`
+	AudioState  State        `json:"audio_state"`
+	Duration    float64      `json:"duration,omitempty"`
+	Video_URL   string       `json:"video_url,omitempty"`
+	VideoState  State        `json:"video_state"`
+	Images      []AssetImage `json:"images,omitempty"`
+}
+
+// VersionLineOf copia el asset a una línea de versión.
+func VersionLineOf(a *Asset) VersionLine {
+	return VersionLine{
+		AssetID:     a.ID,
+		Type:        a.Type,
+		Line:        a.Line,
+		Speaker:     a.Speaker,
+		SfxDuration: a.SfxDuration,
+		Pause:       a.Pause,
+		VoiceID:     a.VoiceID,
+		Audio_URL:   a.Audio_URL,
+		AudioState:  a.AudioState,
+		Duration:    a.Duration,
+		Video_URL:   a.Video_URL,
+		VideoState:  a.VideoState,
+		Images:      a.Images,
+	}
+}
+
+// SameContent indica si dos líneas producen el mismo audio: mismo tipo,
+// texto, speaker, voz y duración de SFX. La pausa no cuenta.
+func (l VersionLine) SameContent(o VersionLine) bool {
+	return l.Type == o.Type &&
+		l.Line == o.Line &&
+		strings.EqualFold(l.Speaker, o.Speaker) &&
+		l.SfxDuration == o.SfxDuration &&
+		sameVoice(l.VoiceID, o.VoiceID)
+}
+
+func sameVoice(a, b *uuid.UUID) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
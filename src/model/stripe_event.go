@@ -0,0 +1,24 @@
+package model
+
+import (
+	"time"
+)
+
+// StripeEvent guarda cada evento de webhook recibido, con su ID de Stripe
+// como clave. Sirve para ignorar los reintentos de un evento ya procesado y
+// para reprocesar a mano los que fallaron.
+//
+// Status: PENDING recibido, ACTIVE procesándose, FINISHED procesado y ERROR
+// falló (Error guarda el motivo).
+type StripeEvent struct {
+	ID          string `gorm:"primaryKey"`
+	Type        string `gorm:"index"`
+	Payload     []byte `gorm:"type:jsonb"`
+	Status      State  `gorm:"type:state;default:'PENDING';index"`
+	Attempts    int
+	Error       string
+	ProcessedAt *time.Time
+
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
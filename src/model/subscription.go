@@ -13,6 +13,8 @@ type Subscription struct {
 	Cuentokens uint
 	Duration   time.Time
 	Price      float64
+	// Precio recurrente de Stripe del plan; vacío si sólo se vende por pago único.
+	StripePriceID string `gorm:"index"`
 
 	// Poner un precio luego de la monetización
 
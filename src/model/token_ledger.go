@@ -0,0 +1,56 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type LedgerReason string
+
+const (
+	LedgerSubscriptionGrant LedgerReason = "SUBSCRIPTION_GRANT"
+	// Al renovar, el saldo sobrante expira y se acredita el del nuevo periodo.
+	LedgerSubscriptionExpire  LedgerReason = "SUBSCRIPTION_EXPIRE"
+	LedgerSubscriptionRenewal LedgerReason = "SUBSCRIPTION_RENEWAL"
+	LedgerScriptCreate        LedgerReason = "SCRIPT_CREATE"
+	LedgerScriptRegenerate    LedgerReason = "SCRIPT_REGENERATE"
+	LedgerScriptMix           LedgerReason = "SCRIPT_MIX"
+	LedgerScriptVideo         LedgerReason = "SCRIPT_VIDEO"
+	LedgerAssetAudio          LedgerReason = "ASSET_AUDIO"
+	LedgerAssetVideo          LedgerReason = "ASSET_VIDEO"
+
+	// Ajuste manual hecho por un admin desde /admin.
+	LedgerAdminAdjust LedgerReason = "ADMIN_ADJUST"
+
+	// Devoluciones y ajustes de una TokenReservation.
+	LedgerReservationRelease LedgerReason = "RESERVATION_RELEASE"
+	LedgerReservationAdjust  LedgerReason = "RESERVATION_ADJUST"
+)
+
+// TokenLedger es un asiento inmutable del saldo de cuentokens de un usuario.
+// Amount es negativo en los débitos y positivo en los créditos; BalanceAfter
+// es el saldo de la suscripción tras aplicarlo. Se escribe en la misma
+// transacción que actualiza UserSubscribed.TokensRemaining.
+type TokenLedger struct {
+	ID               uuid.UUID    `gorm:"type:uuid;primaryKey;"`
+	UserID           uuid.UUID    `gorm:"type:uuid;not null;index"`
+	UserSubscribedID uuid.UUID    `gorm:"type:uuid;not null;index"`
+	Amount           int          `gorm:"not null"`
+	BalanceAfter     uint         `gorm:"not null"`
+	Reason           LedgerReason `gorm:"not null"`
+
+	ScriptID *uuid.UUID `gorm:"type:uuid;index"`
+	AssetID  *uuid.UUID `gorm:"type:uuid;index"`
+	JobID    *uuid.UUID `gorm:"type:uuid"`
+
+	ReservationID *uuid.UUID `gorm:"type:uuid;index"`
+
+	// Admin que hizo el movimiento, en los ajustes y altas manuales.
+	ActorID *uuid.UUID `gorm:"type:uuid"`
+	Note    string
+
+	CreatedAt time.Time `gorm:"index"`
+}
+
+func (TokenLedger) TableName() string { return "token_ledger" }
@@ -0,0 +1,36 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type ReservationState string
+
+const (
+	ReservationHeld     ReservationState = "HELD"
+	ReservationCaptured ReservationState = "CAPTURED"
+	ReservationReleased ReservationState = "RELEASED"
+)
+
+// TokenReservation retiene cuentokens mientras se llama a un proveedor
+// externo. El monto se descuenta del saldo al reservar; al terminar se
+// captura el costo real (devolviendo o cobrando la diferencia) o se libera
+// completo si la operación falló.
+type TokenReservation struct {
+	ID               uuid.UUID        `gorm:"type:uuid;primaryKey;"`
+	UserID           uuid.UUID        `gorm:"type:uuid;not null;index"`
+	UserSubscribedID uuid.UUID        `gorm:"type:uuid;not null"`
+	Amount           uint             `gorm:"not null"`
+	Captured         uint             `gorm:"not null;default:0"`
+	State            ReservationState `gorm:"not null;default:'HELD';index"`
+	Reason           LedgerReason     `gorm:"not null"`
+
+	ScriptID *uuid.UUID `gorm:"type:uuid"`
+	AssetID  *uuid.UUID `gorm:"type:uuid"`
+	JobID    *uuid.UUID `gorm:"type:uuid"`
+
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
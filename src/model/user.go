@@ -1,6 +1,8 @@
 package model
 
 import (
+	"fmt"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
@@ -13,6 +15,8 @@ type User struct {
 	Email            string    `gorm:"type:varchar(100);uniqueIndex;not null"`
 	Password         string    `gorm:"type:varchar(100)"`
 	StripeCustomerID string
+	Role             Role `gorm:"type:varchar(20);not null;default:'USER'"`
+	EmailVerifiedAt  *time.Time
 
 	Projects           []Project        `gorm:"foreignKey:UserID;constraint:OnUpdate:CASCADE,OnDelete:SET NULL;"`
 	UsersSubscriptions []UserSubscribed `gorm:"foreignKey:UserID;constraint:OnUpdate:CASCADE,OnDelete:SET NULL;"`
@@ -21,3 +25,25 @@ type User struct {
 	UpdatedAt time.Time
 	DeletedAt gorm.DeletedAt `gorm:"index"`
 }
+
+// Role define qué puede hacer un usuario. Viaja en el JWT, así que un cambio
+// de rol se aplica cuando el usuario renueva el access token.
+type Role string
+
+const (
+	RoleUser  Role = "USER"
+	RoleAdmin Role = "ADMIN"
+	// Support puede consultar usuarios y jobs, pero no modificarlos.
+	RoleSupport Role = "SUPPORT"
+)
+
+// ParseRole normaliza el nombre recibido y comprueba que sea un rol válido.
+func ParseRole(name string) (Role, error) {
+	r := Role(strings.ToUpper(strings.TrimSpace(name)))
+	switch r {
+	case RoleUser, RoleAdmin, RoleSupport:
+		return r, nil
+	default:
+		return "", fmt.Errorf("rol no soportado: %s", name)
+	}
+}
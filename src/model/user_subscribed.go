@@ -15,6 +15,12 @@ type UserSubscribed struct {
 
 	Status State `gorm:"type:state;default:'PENDING'"`
 
+	// Suscripción recurrente de Stripe que renueva este periodo; vacío en los
+	// planes gratuitos o de pago único.
+	StripeSubscriptionID  string `gorm:"index"`
+	StripeLatestInvoiceID string
+	CancelAtPeriodEnd     bool
+
 	UserID         uuid.UUID
 	User           User
 	SubscriptionID uuid.UUID
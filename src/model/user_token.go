@@ -0,0 +1,28 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type TokenPurpose string
+
+const (
+	PurposeVerifyEmail   TokenPurpose = "VERIFY_EMAIL"
+	PurposeResetPassword TokenPurpose = "RESET_PASSWORD"
+)
+
+// UserToken es el token de un enlace enviado por correo (verificar el email o
+// restablecer la contraseña). Sirve una sola vez y vence; sólo se guarda el
+// hash.
+type UserToken struct {
+	ID        uuid.UUID    `gorm:"type:uuid;primaryKey;"`
+	UserID    uuid.UUID    `gorm:"type:uuid;not null;index"`
+	Purpose   TokenPurpose `gorm:"type:varchar(20);not null"`
+	TokenHash string       `gorm:"type:char(64);uniqueIndex;not null"`
+	ExpiresAt time.Time    `gorm:"not null"`
+	UsedAt    *time.Time
+
+	CreatedAt time.Time
+}
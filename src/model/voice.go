@@ -0,0 +1,24 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Voice es una voz del catálogo; ProviderVoiceID es el identificador que
+// espera la API del proveedor (voice_id de ElevenLabs, "alloy" en OpenAI…).
+type Voice struct {
+	ID              uuid.UUID `gorm:"type:uuid;primaryKey;"`
+	Name            string    `gorm:"not null"`
+	Provider        Provider  `gorm:"type:provider;not null"`
+	ProviderVoiceID string    `gorm:"not null"`
+	Language        string
+	Stability       float64 `gorm:"default:0.5"`
+	Similarity      float64 `gorm:"default:0.75"`
+
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	DeletedAt gorm.DeletedAt `gorm:"index"`
+}
@@ -0,0 +1,15 @@
+package model
+
+import (
+	"time"
+)
+
+// WsMessage guarda un envelope del backplane de websocket que no entra en
+// un NOTIFY de Postgres (8000 bytes); la notificación sólo lleva su ID. Se
+// borran a los pocos minutos.
+type WsMessage struct {
+	ID      uint64 `gorm:"primaryKey;autoIncrement"`
+	Payload []byte `gorm:"type:jsonb;not null"`
+
+	CreatedAt time.Time `gorm:"index"`
+}
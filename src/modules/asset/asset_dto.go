@@ -1,27 +1,63 @@
 package asset
 
 import (
+	"context"
 	"time"
 
+	"github.com/MetaDandy/cuent-ai-core/helper"
 	"github.com/MetaDandy/cuent-ai-core/src/model"
 	generatejob "github.com/MetaDandy/cuent-ai-core/src/modules/generate_job"
 )
 
 type GenerateVideo struct {
 	KeyWords string `json:"key_words"`
+	// Source es el proveedor donde buscar con KeyWords si el asset aún no
+	// tiene imágenes elegidas; vacío usa el por defecto.
+	Source string `json:"source"`
+	// Subtitles quema la línea del asset como subtítulo en el video.
+	Subtitles bool `json:"subtitles"`
+}
+
+// ImageChoice identifica una imagen de un proveedor, tal como la devuelve
+// la búsqueda de /images.
+type ImageChoice struct {
+	Source string `json:"source" validate:"required"`
+	ID     string `json:"id" validate:"required"`
+}
+
+// AssetImages fija las imágenes del video del asset, en orden. Una lista
+// vacía las quita y la próxima generación vuelve a buscar.
+type AssetImages struct {
+	Images []ImageChoice `json:"images" validate:"max=10,dive"`
+}
+
+type AssetVoice struct {
+	VoiceID string `json:"voice_id"`
+}
+
+type GenerationBatchResponse struct {
+	BatchID string                             `json:"batch_id"`
+	Jobs    []generatejob.GeneratedJobResponse `json:"jobs"`
 }
 
 type AssetResponse struct {
-	ID         string  `json:"id"`
-	Type       string  `json:"type"`
-	Video_URL  string  `json:"video_url"`
-	Audio_URL  string  `json:"audio_url"`
-	Line       string  `json:"line"`
-	AudioState string  `json:"audio_state"`
-	VideoState string  `json:"video_state"`
-	Duration   float64 `json:"duration"`
-	Position   int     `json:"position"`
+	ID          string  `json:"id"`
+	Type        string  `json:"type"`
+	Video_URL   string  `json:"video_url"`
+	Audio_URL   string  `json:"audio_url"`
+	Line        string  `json:"line"`
+	AudioState  string  `json:"audio_state"`
+	VideoState  string  `json:"video_state"`
+	Duration    float64 `json:"duration"`
+	Position    int     `json:"position"`
+	Seq         int64   `json:"seq"`
+	SfxDuration float64 `json:"sfx_duration,omitempty"`
+	Pause       float64 `json:"pause,omitempty"`
+	Speaker     string  `json:"speaker,omitempty"`
+	CharacterID string  `json:"character_id,omitempty"`
+	VoiceID     string  `json:"voice_id,omitempty"`
 
+	Images    []model.AssetImage                 `json:"images,omitempty"`
 	Generated []generatejob.GeneratedJobResponse `json:"meta_data,omitempty"`
 
 	CreatedAt time.Time  `json:"created_at"`
@@ -42,17 +78,34 @@ func AssetToDto(u *model.Asset) AssetResponse {
 		generated = generatejob.GeneratedJobToLisDTO(u.GeneratedJobs)
 	}
 
+	var voiceID string
+	if u.VoiceID != nil {
+		voiceID = u.VoiceID.String()
+	}
+
+	var characterID string
+	if u.CharacterID != nil {
+		characterID = u.CharacterID.String()
+	}
+
 	return AssetResponse{
-		ID:         u.ID.String(),
-		Type:       string(u.Type),
-		Video_URL:  u.Video_URL,
-		Audio_URL:  u.Audio_URL,
-		Line:       u.Line,
-		AudioState: string(u.AudioState),
-		VideoState: string(u.VideoState),
-		Duration:   u.Duration,
-		Position:   u.Position,
+		ID:          u.ID.String(),
+		Type:        string(u.Type),
+		Video_URL:   u.Video_URL,
+		Audio_URL:   u.Audio_URL,
+		Line:        u.Line,
+		AudioState:  string(u.AudioState),
+		VideoState:  string(u.VideoState),
+		Duration:    u.Duration,
+		Position:    u.Position,
+		Seq:         u.Seq,
+		SfxDuration: u.SfxDuration,
+		Pause:       u.Pause,
+		Speaker:     u.Speaker,
+		CharacterID: characterID,
+		VoiceID:     voiceID,
 
+		Images:    append([]model.AssetImage(nil), u.Images...),
 		Generated: generated,
 
 		CreatedAt: u.CreatedAt,
@@ -68,3 +121,17 @@ func AssetsToListDTO(list []model.Asset) []AssetResponse {
 	}
 	return out
 }
+
+// PresignAsset cambia las referencias del storage por URLs firmadas de corta
+// duración. Se llama en cada respuesta, así las URLs nunca quedan viejas.
+func PresignAsset(store helper.BlobStore, dto *AssetResponse) {
+	dto.Audio_URL = helper.PresignRef(context.TODO(), store, dto.Audio_URL)
+	dto.Video_URL = helper.PresignRef(context.TODO(), store, dto.Video_URL)
+	helper.PresignImages(store, dto.Images)
+}
+
+func PresignAssets(store helper.BlobStore, list []AssetResponse) {
+	for i := range list {
+		PresignAsset(store, &list[i])
+	}
+}
@@ -1,11 +1,13 @@
 package asset
 
 import (
+	"errors"
 	"net/http"
 
 	"github.com/MetaDandy/cuent-ai-core/helper"
 	"github.com/MetaDandy/cuent-ai-core/middleware"
 	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/adaptor"
 )
 
 type Handler struct {
@@ -19,17 +21,28 @@ func NewHandler(s *Service) *Handler {
 func (h *Handler) RegisterRoutes(router fiber.Router) {
 	grp := router.Group("/assets").Use(middleware.JwtMiddleware())
 	grp.Get("", h.FindAll)
+	grp.Get("/jobs/:id", h.FindJob)
+	grp.Get("/batches/:id", h.FindBatch)
 	grp.Get("/:id", h.FindById)
+	grp.Get("/:id/audio", h.StreamAudio)
 	grp.Get("/:id/script", h.FindByScriptID)
 	grp.Post("/:id", h.GenerateOne)
 	grp.Post("/:id/generate_all", h.GenerateAll)
 	grp.Post("/:id/regenerate_all", h.RegenerateAll)
 	grp.Post("/:id/generate_video", h.GenerateOneVideo)
+	grp.Patch("/:id/voice", h.SetVoice)
+	grp.Put("/:id/images", h.SetImages)
 }
 
 func (h *Handler) FindAll(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(string)
+	if !ok || userID == "" {
+		return helper.JSONError(c, http.StatusUnauthorized,
+			"Token sin user_id", "")
+	}
+
 	opts := helper.NewFindAllOptionsFromQuery(c)
-	project, err := h.svc.FindAll(opts)
+	project, err := h.svc.FindAll(userID, opts)
 	if err != nil {
 		return helper.JSONError(c, http.StatusInternalServerError,
 			"Error obteniendo assets", err.Error())
@@ -38,7 +51,17 @@ func (h *Handler) FindAll(c *fiber.Ctx) error {
 }
 
 func (h *Handler) FindById(c *fiber.Ctx) error {
-	dto, err := h.svc.FindByID(c.Params("id"))
+	userID, ok := c.Locals("user_id").(string)
+	if !ok || userID == "" {
+		return helper.JSONError(c, http.StatusUnauthorized,
+			"Token sin user_id", "")
+	}
+
+	dto, err := h.svc.FindByID(c.Params("id"), userID)
+	if helper.IsNotFound(err) {
+		return helper.JSONError(c, http.StatusNotFound,
+			"asset no encontrado")
+	}
 	if err != nil {
 		return helper.JSONError(c, http.StatusInternalServerError,
 			"Error obteniendo asset", err.Error())
@@ -55,7 +78,17 @@ func (h *Handler) FindById(c *fiber.Ctx) error {
 }
 
 func (h *Handler) FindByScriptID(c *fiber.Ctx) error {
-	dto, err := h.svc.FindByScriptID(c.Params("id"))
+	userID, ok := c.Locals("user_id").(string)
+	if !ok || userID == "" {
+		return helper.JSONError(c, http.StatusUnauthorized,
+			"Token sin user_id", "")
+	}
+
+	dto, err := h.svc.FindByScriptID(c.Params("id"), userID)
+	if helper.IsNotFound(err) {
+		return helper.JSONError(c, http.StatusNotFound,
+			"script no encontrado")
+	}
 	if err != nil {
 		return helper.JSONError(c, http.StatusInternalServerError,
 			"Error obteniendo asset", err.Error())
@@ -78,15 +111,23 @@ func (h *Handler) GenerateOne(c *fiber.Ctx) error {
 			"Token sin user_id", "")
 	}
 
-	dto, err := h.svc.GenerateOne(c.Params("id"), id)
+	dto, err := h.svc.GenerateOne(c.Params("id"), id, c.Query("provider"))
+	if helper.IsNotFound(err) {
+		return helper.JSONError(c, http.StatusNotFound,
+			"asset no encontrado")
+	}
+	if errors.Is(err, ErrJobOpen) {
+		return helper.JSONError(c, http.StatusConflict,
+			"El asset ya está en cola", err.Error())
+	}
 	if err != nil {
 		return helper.JSONError(c, http.StatusInternalServerError,
-			"Error generando el asset", err.Error())
+			"Error encolando la generación", err.Error())
 	}
 
-	return c.JSON(helper.Response{
+	return c.Status(http.StatusAccepted).JSON(helper.Response{
 		Data:    dto,
-		Message: "asset generado",
+		Message: "generación del asset encolada",
 	})
 }
 
@@ -97,17 +138,19 @@ func (h *Handler) GenerateAll(c *fiber.Ctx) error {
 			"Token sin user_id", "")
 	}
 
-	dto, err := h.svc.GenerateAll(c.Params("id"), id, false)
+	dto, err := h.svc.GenerateAll(c.Params("id"), id, false, c.Query("provider"))
+	if helper.IsNotFound(err) {
+		return helper.JSONError(c, http.StatusNotFound,
+			"script no encontrado")
+	}
 	if err != nil {
-		return c.JSON(helper.Response{
-			Data:    dto,
-			Message: err.Error(),
-		})
+		return helper.JSONError(c, http.StatusInternalServerError,
+			"Error encolando la generación", err.Error())
 	}
 
-	return c.JSON(helper.Response{
+	return c.Status(http.StatusAccepted).JSON(helper.Response{
 		Data:    dto,
-		Message: "assets generados",
+		Message: "generación de assets encolada",
 	})
 }
 
@@ -118,17 +161,19 @@ func (h *Handler) RegenerateAll(c *fiber.Ctx) error {
 			"Token sin user_id", "")
 	}
 
-	dto, err := h.svc.GenerateAll(c.Params("id"), id, true)
+	dto, err := h.svc.GenerateAll(c.Params("id"), id, true, c.Query("provider"))
+	if helper.IsNotFound(err) {
+		return helper.JSONError(c, http.StatusNotFound,
+			"script no encontrado")
+	}
 	if err != nil {
-		return c.JSON(helper.Response{
-			Data:    dto,
-			Message: err.Error(),
-		})
+		return helper.JSONError(c, http.StatusInternalServerError,
+			"Error encolando la generación", err.Error())
 	}
 
-	return c.JSON(helper.Response{
+	return c.Status(http.StatusAccepted).JSON(helper.Response{
 		Data:    dto,
-		Message: "assets regenerados",
+		Message: "regeneración de assets encolada",
 	})
 }
 
@@ -146,6 +191,14 @@ func (h *Handler) GenerateOneVideo(c *fiber.Ctx) error {
 	}
 
 	dto, err := h.svc.GenerateVideo(c.Params("id"), id, key_words)
+	if helper.IsNotFound(err) {
+		return helper.JSONError(c, http.StatusNotFound,
+			"asset no encontrado")
+	}
+	if errors.Is(err, ErrNoImages) || errors.Is(err, helper.ErrImageSource) {
+		return helper.JSONError(c, http.StatusBadRequest,
+			"Input inválido", err.Error())
+	}
 	if err != nil {
 		return helper.JSONError(c, http.StatusInternalServerError,
 			"Error generando el asset video", err.Error())
@@ -156,3 +209,138 @@ func (h *Handler) GenerateOneVideo(c *fiber.Ctx) error {
 		Message: "video generado",
 	})
 }
+
+func (h *Handler) FindJob(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(string)
+	if !ok || userID == "" {
+		return helper.JSONError(c, http.StatusUnauthorized,
+			"Token sin user_id", "")
+	}
+
+	dto, err := h.svc.FindJob(c.Params("id"), userID)
+	if err != nil {
+		return helper.JSONError(c, http.StatusNotFound,
+			"job no encontrado", err.Error())
+	}
+
+	return c.JSON(helper.Response{
+		Data:    dto,
+		Message: "job obtenido",
+	})
+}
+
+func (h *Handler) FindBatch(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(string)
+	if !ok || userID == "" {
+		return helper.JSONError(c, http.StatusUnauthorized,
+			"Token sin user_id", "")
+	}
+
+	dto, err := h.svc.FindBatch(c.Params("id"), userID)
+	if err != nil {
+		return helper.JSONError(c, http.StatusInternalServerError,
+			"Error obteniendo el lote", err.Error())
+	}
+	if dto == nil {
+		return helper.JSONError(c, http.StatusNotFound,
+			"lote no encontrado")
+	}
+
+	return c.JSON(helper.Response{
+		Data:    dto,
+		Message: "lote obtenido",
+	})
+}
+
+func (h *Handler) SetVoice(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(string)
+	if !ok || userID == "" {
+		return helper.JSONError(c, http.StatusUnauthorized,
+			"Token sin user_id", "")
+	}
+
+	var input AssetVoice
+	if err := c.BodyParser(&input); err != nil {
+		return helper.JSONError(c, http.StatusBadRequest,
+			"Input inválido", err.Error())
+	}
+
+	dto, err := h.svc.SetVoice(c.Params("id"), userID, &input)
+	if helper.IsNotFound(err) {
+		return helper.JSONError(c, http.StatusNotFound,
+			"asset no encontrado")
+	}
+	if err != nil {
+		return helper.JSONError(c, http.StatusInternalServerError,
+			"Error asignando la voz", err.Error())
+	}
+
+	return c.JSON(helper.Response{
+		Data:    dto,
+		Message: "voz asignada",
+	})
+}
+
+// SetImages fija las imágenes del video del asset, elegidas de la búsqueda
+// de /images.
+func (h *Handler) SetImages(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(string)
+	if !ok || userID == "" {
+		return helper.JSONError(c, http.StatusUnauthorized,
+			"Token sin user_id", "")
+	}
+
+	var input AssetImages
+	if err := c.BodyParser(&input); err != nil {
+		return helper.JSONError(c, http.StatusBadRequest,
+			"Input inválido", err.Error())
+	}
+
+	dto, err := h.svc.SetImages(c.Params("id"), userID, &input)
+	if helper.IsNotFound(err) {
+		return helper.JSONError(c, http.StatusNotFound,
+			"asset no encontrado")
+	}
+	if errors.Is(err, helper.ErrImageSource) || errors.Is(err, helper.ErrImageNotFound) || errors.Is(err, ErrTooManyImages) {
+		return helper.JSONError(c, http.StatusBadRequest,
+			"Input inválido", err.Error())
+	}
+	if err != nil {
+		return helper.JSONError(c, http.StatusInternalServerError,
+			"Error guardando las imágenes", err.Error())
+	}
+
+	return c.JSON(helper.Response{
+		Data:    dto,
+		Message: "imágenes guardadas",
+	})
+}
+
+// StreamAudio sirve el audio de un asset del usuario sin exponer la URL del
+// storage. Soporta Range, así el reproductor del navegador puede saltar, y al
+// storage sólo se le pide desde el punto del salto.
+func (h *Handler) StreamAudio(c *fiber.Ctx) error {
+	id, ok := c.Locals("user_id").(string)
+	if !ok || id == "" {
+		return helper.JSONError(c, http.StatusUnauthorized,
+			"Token sin user_id", "")
+	}
+
+	audio, err := h.svc.OpenAudio(c.Params("id"), id)
+	if helper.IsNotFound(err) || errors.Is(err, helper.ErrObjectNotFound) {
+		return helper.JSONError(c, http.StatusNotFound,
+			"audio no encontrado")
+	}
+	if err != nil {
+		return helper.JSONError(c, http.StatusInternalServerError,
+			"Error obteniendo el audio", err.Error())
+	}
+
+	defer audio.Body.Close()
+
+	return adaptor.HTTPHandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", audio.Mime)
+		w.Header().Set("Cache-Control", "private, max-age=300")
+		http.ServeContent(w, r, audio.Name, audio.ModTime, audio.Body)
+	})(c)
+}
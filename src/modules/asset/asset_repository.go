@@ -18,13 +18,45 @@ func (r *Repository) Create(asset *model.Asset) error {
 	return r.db.Create(asset).Error
 }
 
+// Update guarda el asset salvo Seq, que sólo cambia al editar la línea.
 func (r *Repository) Update(asset *model.Asset) error {
-	return r.db.Save(asset).Error
+	return r.db.Omit("seq").Save(asset).Error
 }
 
-func (r *Repository) FindAll(opts *helper.FindAllOptions) ([]model.Asset, int64, error) {
+// UpdateAudio guarda sólo el audio del asset y UpdateVideo sólo su video:
+// el worker no pisa la línea si se editó o movió mientras se generaba, ni
+// revive una que se borró.
+func (r *Repository) UpdateAudio(asset *model.Asset) error {
+	return updateAudio(r.db, asset)
+}
+
+func (r *Repository) UpdateVideo(asset *model.Asset) error {
+	return updateVideo(r.db, asset)
+}
+
+func updateAudio(db *gorm.DB, asset *model.Asset) error {
+	return db.Model(asset).
+		Where("deleted_at IS NULL").
+		Select("Audio_URL", "AudioState", "Duration").
+		Updates(asset).Error
+}
+
+func updateVideo(db *gorm.DB, asset *model.Asset) error {
+	return db.Model(asset).
+		Where("deleted_at IS NULL").
+		Select("Video_URL", "VideoState").
+		Updates(asset).Error
+}
+
+// UpdateImages guarda sólo las imágenes elegidas y el estado del video, sin
+// pisar el resto del asset que pueda estar generándose en paralelo.
+func (r *Repository) UpdateImages(asset *model.Asset) error {
+	return r.db.Model(asset).Select("Images", "VideoState").Updates(asset).Error
+}
+
+func (r *Repository) FindAll(userID string, opts *helper.FindAllOptions) ([]model.Asset, int64, error) {
 	var finded []model.Asset
-	query := r.db.Model(model.Asset{})
+	query := r.db.Model(model.Asset{}).Scopes(helper.OwnedAssets(userID))
 	var total int64
 	query, total = helper.ApplyFindAllOptions(query, opts)
 
@@ -32,9 +64,9 @@ func (r *Repository) FindAll(opts *helper.FindAllOptions) ([]model.Asset, int64,
 	return finded, total, err
 }
 
-func (r *Repository) FindById(id string) (*model.Asset, error) {
+func (r *Repository) FindById(id, userID string) (*model.Asset, error) {
 	var asset model.Asset
-	err := r.db.First(&asset, "id = ?", id).Error
+	err := r.db.Scopes(helper.OwnedAssets(userID)).First(&asset, "id = ?", id).Error
 	if err != nil {
 		return nil, err
 	}
@@ -42,9 +74,10 @@ func (r *Repository) FindById(id string) (*model.Asset, error) {
 	return &asset, nil
 }
 
-func (r *Repository) FindByIdWithGeneratedJobs(id string) (*model.Asset, error) {
+func (r *Repository) FindByIdWithGeneratedJobs(id, userID string) (*model.Asset, error) {
 	var asset model.Asset
-	err := r.db.Preload("GeneratedJobs").First(&asset, "id = ?", id).Error
+	err := r.db.Scopes(helper.OwnedAssets(userID)).
+		Preload("GeneratedJobs").First(&asset, "id = ?", id).Error
 	if err != nil {
 		return nil, err
 	}
@@ -81,6 +114,28 @@ func (r *Repository) FindByScriptIDWithGeneratedJobs(scriptID string) ([]model.A
 	return assets, err
 }
 
+// FindOwnedScript devuelve el script si pertenece a un proyecto de userID.
+func (r *Repository) FindOwnedScript(scriptID, userID string) (*model.Script, error) {
+	var script model.Script
+	err := r.db.Scopes(helper.OwnedScripts(userID)).First(&script, "id = ?", scriptID).Error
+	if err != nil {
+		return nil, err
+	}
+	return &script, nil
+}
+
+func (r *Repository) FindProjectByScriptID(scriptID string) (*model.Project, error) {
+	var project model.Project
+	err := r.db.
+		Joins("JOIN scripts ON scripts.project_id = projects.id").
+		Where("scripts.id = ?", scriptID).
+		First(&project).Error
+	if err != nil {
+		return nil, err
+	}
+	return &project, nil
+}
+
 func (r *Repository) SoftDelete(id string) error {
 	return r.db.Delete(&model.Asset{}, "id = ?", id).Error
 }
@@ -5,35 +5,48 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"mime"
+	"path"
 	"path/filepath"
 	"strconv"
+	"strings"
+	"time"
 	"unicode/utf8"
 
 	"github.com/MetaDandy/cuent-ai-core/helper"
 	"github.com/MetaDandy/cuent-ai-core/src/core/user"
 	"github.com/MetaDandy/cuent-ai-core/src/model"
+	"github.com/MetaDandy/cuent-ai-core/src/modules/character"
 	generatejob "github.com/MetaDandy/cuent-ai-core/src/modules/generate_job"
+	"github.com/MetaDandy/cuent-ai-core/src/modules/voice"
+	ws "github.com/MetaDandy/cuent-ai-core/src/modules/websocket"
 	"github.com/google/uuid"
 	"gorm.io/gorm"
-	"gorm.io/gorm/clause"
 )
 
 type Service struct {
-	repo     *Repository
-	genRepo  *generatejob.Repository
-	userRepo *user.Repository
+	repo      *Repository
+	genRepo   *generatejob.Repository
+	userRepo  *user.Repository
+	voiceRepo *voice.Repository
+	charRepo  *character.Repository
+	store     helper.BlobStore
+	images    helper.ImageProviders
+	queue     *Queue
+	hub       *ws.Hub
 }
 
-func NewService(r *Repository, gnr *generatejob.Repository, ur *user.Repository) *Service {
-	return &Service{repo: r, genRepo: gnr, userRepo: ur}
+func NewService(r *Repository, gnr *generatejob.Repository, ur *user.Repository, vr *voice.Repository, cr *character.Repository, store helper.BlobStore, images helper.ImageProviders, hub *ws.Hub) *Service {
+	return &Service{repo: r, genRepo: gnr, userRepo: ur, voiceRepo: vr, charRepo: cr, store: store, images: images, hub: hub}
 }
 
-func (s *Service) FindAll(opts *helper.FindAllOptions) (*helper.PaginatedResponse[AssetResponse], error) {
-	finded, total, err := s.repo.FindAll(opts)
+func (s *Service) FindAll(userID string, opts *helper.FindAllOptions) (*helper.PaginatedResponse[AssetResponse], error) {
+	finded, total, err := s.repo.FindAll(userID, opts)
 	if err != nil {
 		return nil, err
 	}
 	dtos := AssetsToListDTO(finded)
+	PresignAssets(s.store, dtos)
 	pages := uint((total + int64(opts.Limit) - 1) / int64(opts.Limit))
 
 	return &helper.PaginatedResponse[AssetResponse]{
@@ -45,8 +58,8 @@ func (s *Service) FindAll(opts *helper.FindAllOptions) (*helper.PaginatedRespons
 	}, nil
 }
 
-func (s *Service) FindByID(id string) (*AssetResponse, error) {
-	finded, err := s.repo.FindByIdWithGeneratedJobs(id)
+func (s *Service) FindByID(id, userID string) (*AssetResponse, error) {
+	finded, err := s.repo.FindByIdWithGeneratedJobs(id, userID)
 	if err != nil {
 		return nil, err
 	}
@@ -54,171 +67,582 @@ func (s *Service) FindByID(id string) (*AssetResponse, error) {
 		return nil, nil
 	}
 	dto := AssetToDto(finded)
+	PresignAsset(s.store, &dto)
 	return &dto, nil
 }
 
-func (s *Service) FindByScriptID(id string) (*[]AssetResponse, error) {
+func (s *Service) FindByScriptID(id, userID string) (*[]AssetResponse, error) {
+	if _, err := s.repo.FindOwnedScript(id, userID); err != nil {
+		return nil, err
+	}
 	assets, err := s.repo.FindByScriptID(id)
 	if err != nil {
 		return nil, err
 	}
 
 	dto := AssetsToListDTO(assets)
+	PresignAssets(s.store, dto)
 
 	return &dto, nil
 }
 
-func (s *Service) GenerateOne(id, userID string) (*AssetResponse, error) {
-	_, err := s.generate(id, userID)
+// GenerateOne encola la generación del audio de un asset; la procesa el
+// worker como cualquier otro job, respetando el límite de su proveedor.
+func (s *Service) GenerateOne(id, userID, provider string) (*AssetResponse, error) {
+	asset, err := s.repo.FindById(id, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	open, err := s.genRepo.FindOpenByScriptID(asset.ScriptID.String())
+	if err != nil {
+		return nil, err
+	}
+	for _, j := range open {
+		if j.AssetID == asset.ID {
+			return nil, ErrJobOpen
+		}
+	}
+
+	job, err := s.newJob(asset, userID, provider, nil)
 	if err != nil {
 		return nil, err
 	}
 
-	reload, _ := s.repo.FindByIdWithGeneratedJobs(id)
+	sub, err := s.userRepo.GetActiveSubscription(userID)
+	if err != nil {
+		return nil, err
+	}
+	if needed := audioCost(asset); sub.TokensRemaining < needed {
+		return nil, fmt.Errorf(
+			"fondos insuficientes: se necesitan aprox. %d cuentokens, tienes %d",
+			needed, sub.TokensRemaining,
+		)
+	}
+
+	if err := s.genRepo.Create(job); err != nil {
+		return nil, err
+	}
+	if s.queue != nil {
+		s.queue.Wake()
+	}
+
+	reload, _ := s.repo.FindByIdWithGeneratedJobs(id, userID)
 	dto := AssetToDto(reload)
+	PresignAsset(s.store, &dto)
 	return &dto, nil
 }
 
-func (s *Service) GenerateAll(id, userID string, regenerate bool) (*[]AssetResponse, error) {
+// GenerateAll encola un GeneratedJob por cada asset del script que necesite
+// audio y devuelve el lote sin esperar a que se procese. Con regenerate se
+// encolan todos los assets, no sólo los PENDING/ERROR.
+func (s *Service) GenerateAll(id, userID string, regenerate bool, provider string) (*GenerationBatchResponse, error) {
+	if _, err := s.repo.FindOwnedScript(id, userID); err != nil {
+		return nil, err
+	}
 	assets, err := s.repo.FindByScriptID(id)
 	if err != nil {
 		return nil, err
 	}
-	if len(assets) == 0 {
-		empty := make([]AssetResponse, 0)
-		return &empty, nil
+
+	open, err := s.genRepo.FindOpenByScriptID(id)
+	if err != nil {
+		return nil, err
+	}
+	inQueue := make(map[uuid.UUID]bool, len(open))
+	for _, j := range open {
+		inQueue[j.AssetID] = true
 	}
 
-	var errs []error
+	batchID := uuid.New()
+	jobs := make([]model.GeneratedJob, 0, len(assets))
+	var needed uint
+	for i := range assets {
+		a := &assets[i]
+		if inQueue[a.ID] {
+			continue
+		}
+		if !regenerate && a.AudioState != model.StatePending && a.AudioState != model.StateError {
+			continue
+		}
 
-	// * No usar go rutine por el tema de los rate limits estrictos de eleven labs
-	for _, a := range assets {
-		assetID := a.ID.String()
-		var err error
-		if regenerate {
-			_, err = s.generate(assetID, userID)
-		} else {
-			if a.AudioState == model.StatePending || a.AudioState == model.StateError {
-				_, err = s.generate(assetID, userID)
-			}
+		job, err := s.newJob(a, userID, provider, &batchID)
+		if err != nil {
+			return nil, err
 		}
+		jobs = append(jobs, *job)
+		needed += audioCost(a)
+	}
+
+	if len(jobs) > 0 {
+		sub, err := s.userRepo.GetActiveSubscription(userID)
 		if err != nil {
-			errs = append(errs, err)
+			return nil, err
+		}
+		if sub.TokensRemaining < needed {
+			return nil, fmt.Errorf(
+				"fondos insuficientes: se necesitan aprox. %d cuentokens, tienes %d",
+				needed, sub.TokensRemaining,
+			)
+		}
+
+		if err := s.genRepo.CreateMany(jobs); err != nil {
+			return nil, err
+		}
+		if s.queue != nil {
+			s.queue.Wake()
 		}
 	}
 
-	reloaded, err := s.repo.FindByScriptIDWithGeneratedJobs(id)
+	dto := GenerationBatchResponse{
+		BatchID: batchID.String(),
+		Jobs:    generatejob.GeneratedJobToLisDTO(jobs),
+	}
+	return &dto, nil
+}
+
+func (s *Service) FindBatch(batchID, userID string) (*GenerationBatchResponse, error) {
+	jobs, err := s.genRepo.FindByBatchID(batchID, userID)
 	if err != nil {
 		return nil, err
 	}
-	dto := AssetsToListDTO(reloaded)
+	if len(jobs) == 0 {
+		return nil, nil
+	}
 
-	if len(errs) > 0 {
-		return &dto, errors.Join(errs...)
+	dto := GenerationBatchResponse{
+		BatchID: batchID,
+		Jobs:    generatejob.GeneratedJobToLisDTO(jobs),
 	}
+	return &dto, nil
+}
 
+func (s *Service) FindJob(id, userID string) (*generatejob.GeneratedJobResponse, error) {
+	job, err := s.genRepo.FindById(id, userID)
+	if err != nil {
+		return nil, err
+	}
+	dto := generatejob.GeneratedJobToDto(job)
 	return &dto, nil
 }
 
-func (s *Service) generate(id, userID string) (*model.Asset, error) {
-	asset, err := s.repo.FindById(id)
+// speechProvider resuelve el proveedor y la voz de un asset. La voz es la del
+// asset, luego la de su personaje y, si no hay, la por defecto del proyecto. El proveedor pedido en la
+// request tiene prioridad, luego el de la voz y por último el del proyecto.
+// Si la voz no es del proveedor resultante se usa la voz por defecto de éste.
+func (s *Service) speechProvider(asset *model.Asset, requested string) (helper.SpeechProvider, *model.Voice, error) {
+	name, err := helper.ParseSpeechProvider(requested)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	project, err := s.repo.FindProjectByScriptID(asset.ScriptID.String())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	voiceID := asset.VoiceID
+	if voiceID == nil && asset.CharacterID != nil {
+		char, err := s.charRepo.FindById(asset.CharacterID.String(), project.UserID.String())
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, err
+		}
+		if char != nil {
+			voiceID = char.VoiceID
+		}
+	}
+	if voiceID == nil {
+		voiceID = project.VoiceID
+	}
+
+	var voice *model.Voice
+	if voiceID != nil {
+		if voice, err = s.voiceRepo.FindById(voiceID.String()); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if name == "" && voice != nil {
+		name = voice.Provider
+	}
+	if name == "" {
+		name = project.Provider
+	}
+
+	provider, err := helper.NewSpeechProvider(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	if voice != nil && voice.Provider != provider.Name() {
+		voice = nil
+	}
+	return provider, voice, nil
+}
+
+// newJob arma (sin guardar) el job PENDING que respalda la generación del
+// audio de un asset. El proveedor guardado es el que realmente se usará, para
+// que la cola pueda aplicar su límite de concurrencia.
+func (s *Service) newJob(asset *model.Asset, userID, requested string, batchID *uuid.UUID) (*model.GeneratedJob, error) {
+	uid, err := uuid.Parse(userID)
 	if err != nil {
 		return nil, err
 	}
 
-	sub, err := s.userRepo.GetActiveSubscription(userID)
+	provider, voice, err := s.speechProvider(asset, requested)
 	if err != nil {
 		return nil, err
 	}
+	name, mdl := provider.Name(), provider.Model()
+	if asset.Type == model.AudioSFX {
+		sfx := helper.SoundEffectProviderFor(provider)
+		name, mdl = sfx.Name(), sfx.Model()
+		voice = nil
+	}
 
-	var tokens uint
-	if asset.Type == "SFX" {
-		tokens = 40
-	} else {
-		tokens = uint(utf8.RuneCountInString(asset.Line))
+	job := &model.GeneratedJob{
+		ID:       uuid.New(),
+		Provider: name,
+		Model:    mdl,
+		State:    model.StatePending,
+		AssetID:  asset.ID,
+		UserID:   uid,
+		BatchID:  batchID,
+	}
+	if voice != nil {
+		job.VoiceID = &voice.ID
 	}
+	return job, nil
+}
 
-	if sub.TokensRemaining < tokens {
-		return nil, fmt.Errorf(
-			"fondos insuficientes: se necesitan aprox. %d cuentokens, tienes %d",
-			tokens, sub.TokensRemaining,
-		)
+// voiceSettings carga la voz registrada en el job; sin voz se usa la del
+// proveedor por defecto.
+func (s *Service) voiceSettings(job *model.GeneratedJob) (helper.VoiceSettings, error) {
+	if job.VoiceID == nil {
+		return helper.VoiceSettings{}, nil
 	}
 
-	bucket := "audio"
-	dirPath := filepath.Join(asset.ScriptID.String())
+	voice, err := s.voiceRepo.FindById(job.VoiceID.String())
+	if err != nil {
+		return helper.VoiceSettings{}, err
+	}
+	return helper.VoiceSettings{
+		ID:         voice.ProviderVoiceID,
+		Stability:  voice.Stability,
+		Similarity: voice.Similarity,
+	}, nil
+}
 
-	if err := s.repo.db.Transaction(func(tx *gorm.DB) error {
-		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
-			Where("id = ?", sub.ID).
-			Take(&sub).Error; err != nil {
-			return err
-		}
+// SetVoice asigna (o quita, con voiceID vacío) la voz propia de un asset. Si
+// el asset ya tenía audio vuelve a PENDING para que se regenere con la nueva voz.
+func (s *Service) SetVoice(id, userID string, input *AssetVoice) (*AssetResponse, error) {
+	asset, err := s.repo.FindById(id, userID)
+	if err != nil {
+		return nil, err
+	}
 
-		url, historyID, duration, err := helper.AudioOutput(asset.Line, asset.ID.String(), bucket, dirPath, string(asset.Type))
+	var voiceID *uuid.UUID
+	if input.VoiceID != "" {
+		voice, err := s.voiceRepo.FindById(input.VoiceID)
 		if err != nil {
-			return err
+			return nil, err
 		}
+		voiceID = &voice.ID
+	}
 
-		chars, err := helper.CharactersUsed(historyID)
-		if err != nil {
-			chars = 0
-		}
+	asset.VoiceID = voiceID
+	if asset.AudioState == model.StateFinished {
+		asset.AudioState = model.StatePending
+	}
+	if err := s.repo.Update(asset); err != nil {
+		return nil, err
+	}
 
-		asset.Audio_URL = url
-		asset.AudioState = model.StateFinished
-		asset.Duration = duration.Seconds()
-		if err := tx.Save(asset).Error; err != nil {
-			return err
-		}
+	dto := AssetToDto(asset)
+	PresignAsset(s.store, &dto)
+	return &dto, nil
+}
 
-		job := model.GeneratedJob{
-			ID:              uuid.New(),
-			Provider:        model.ProviderElevenlab,
-			Model:           "eleven_monolingual_v1",
-			Chars_Used:      uint(chars),
-			Cuentoken_Spent: tokens,
-			Token_Spent:     strconv.Itoa(chars),
-			State:           model.StateFinished,
-			Cost:            float64(chars) / 1000 * 0.30, // tarifa por 1 K caracteres
-			AssetID:         asset.ID,
-		}
-		if err := tx.Create(&job).Error; err != nil {
+// AudioFile es el audio de un asset en el storage, listo para servirlo. Body
+// se lee por partes; quien lo recibe debe cerrarlo.
+type AudioFile struct {
+	Name    string
+	Mime    string
+	Body    *helper.Object
+	ModTime time.Time
+}
+
+// OpenAudio abre el audio de un asset del storage. Si el asset no existe, no
+// tiene audio o su proyecto es de otro usuario devuelve
+// gorm.ErrRecordNotFound, para no revelar qué IDs existen.
+func (s *Service) OpenAudio(id, userID string) (*AudioFile, error) {
+	asset, err := s.repo.FindById(id, userID)
+	if err != nil {
+		return nil, err
+	}
+	if asset.Audio_URL == "" {
+		return nil, gorm.ErrRecordNotFound
+	}
+
+	body, err := helper.OpenObject(context.TODO(), s.store, asset.Audio_URL)
+	if err != nil {
+		return nil, err
+	}
+
+	name := path.Base(asset.Audio_URL)
+	contentType := mime.TypeByExtension(path.Ext(name))
+	if contentType == "" {
+		contentType = "audio/mpeg"
+	}
+	return &AudioFile{
+		Name:    name,
+		Mime:    contentType,
+		Body:    body,
+		ModTime: asset.UpdatedAt,
+	}, nil
+}
+
+// audioCost devuelve los cuentokens que cuesta generar el audio de un asset.
+func audioCost(asset *model.Asset) uint {
+	if asset.Type == model.AudioSFX {
+		return 40
+	}
+	return uint(utf8.RuneCountInString(asset.Line))
+}
+
+// generate procesa un job ACTIVE: genera el audio, lo sube y cobra los
+// cuentokens. El job queda FINISHED o ERROR.
+func (s *Service) generate(job *model.GeneratedJob) (*model.Asset, error) {
+	asset, err := s.repo.FindById(job.AssetID.String(), job.UserID.String())
+	if err != nil {
+		return nil, s.failJob(job, nil, err)
+	}
+
+	provider, err := helper.NewSpeechProvider(job.Provider)
+	if err != nil {
+		return nil, s.failJob(job, nil, err)
+	}
+
+	voice, err := s.voiceSettings(job)
+	if err != nil {
+		return nil, s.failJob(job, nil, err)
+	}
+
+	tokens := audioCost(asset)
+	res, err := s.reserveJob(job, asset, tokens)
+	if err != nil {
+		err := s.failJob(job, nil, err)
+		s.notify(ws.EventAudio, asset, model.StateError, "", err)
+		return nil, err
+	}
+
+	asset.AudioState = model.StateActive
+	if err := s.repo.UpdateAudio(asset); err != nil {
+		return nil, s.release(res, s.failJob(job, nil, err))
+	}
+	s.notify(ws.EventAudio, asset, model.StateActive, "", nil)
+
+	bucket := "audio"
+	dirPath := filepath.Join(asset.ScriptID.String())
+
+	// La llamada al proveedor va fuera de la transacción: el saldo ya está
+	// reservado y no hace falta mantener bloqueada la suscripción.
+	// Cada job escribe su propio archivo: las versiones anteriores del script
+	// pueden seguir apuntando al audio que había antes.
+	sfxDuration := time.Duration(asset.SfxDuration * float64(time.Second))
+	fileID := asset.ID.String() + "_" + job.ID.String()
+	out, err := helper.AudioOutput(s.store, provider, voice, asset.Line, fileID, bucket, dirPath, string(asset.Type), sfxDuration)
+	if err != nil {
+		return nil, s.release(res, s.failJob(job, asset, err))
+	}
+
+	if err := s.repo.db.Transaction(func(tx *gorm.DB) error {
+		asset.Audio_URL = out.Ref
+		asset.AudioState = model.StateFinished
+		asset.Duration = out.Duration.Seconds()
+		if err := updateAudio(tx, asset); err != nil {
 			return err
 		}
 
-		sub.TokensRemaining -= tokens
-		if err := tx.Save(sub).Error; err != nil {
+		job.Provider = out.Provider
+		job.Model = out.Model
+		job.Chars_Used = uint(out.Chars)
+		job.Cuentoken_Spent = tokens
+		job.Token_Spent = strconv.Itoa(out.Chars)
+		job.State = model.StateFinished
+		job.Cost = out.Cost
+		if err := tx.Save(job).Error; err != nil {
 			return err
 		}
 
-		return nil
+		return s.userRepo.Capture(tx, res, tokens)
 	}); err != nil {
 		// ! Ver si es factible cobrar la mitad si ocurre un error
+		return nil, s.release(res, s.failJob(job, asset, err))
+	}
+
+	s.notify(ws.EventAudio, asset, model.StateFinished, asset.Audio_URL, nil)
+	return asset, nil
+}
+
+// reserveJob retiene los cuentokens del job. Un job que vuelve a la cola
+// porque su worker murió reusa la reserva que dejó retenida: reservar otra
+// vez le retendría el saldo dos veces al usuario. Capture ajusta la
+// diferencia si el costo cambió.
+func (s *Service) reserveJob(job *model.GeneratedJob, asset *model.Asset, tokens uint) (*model.TokenReservation, error) {
+	res, err := s.userRepo.HeldReservation(job.ID)
+	if err == nil {
+		return res, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	return s.userRepo.Reserve(job.UserID.String(), tokens, model.TokenLedger{
+		Reason:   model.LedgerAssetAudio,
+		ScriptID: &asset.ScriptID,
+		AssetID:  &asset.ID,
+		JobID:    &job.ID,
+	})
+}
+
+// release devuelve los cuentokens reservados tras un fallo y añade al error
+// original el de la devolución, si lo hay.
+func (s *Service) release(res *model.TokenReservation, err error) error {
+	if e := s.userRepo.Release(res); e != nil {
+		err = errors.Join(err, e)
+	}
+	return err
+}
+
+// failJob marca el job como ERROR y, si se indica, deja el asset en ERROR.
+// Devuelve el error original unido a los que ocurran al persistir.
+func (s *Service) failJob(job *model.GeneratedJob, asset *model.Asset, err error) error {
+	if asset != nil {
 		asset.AudioState = model.StateError
 		asset.Audio_URL = ""
 		asset.Duration = 0
-		badJob := model.GeneratedJob{
-			ID:            uuid.New(),
-			Error_Message: err.Error(),
-			AssetID:       asset.ID,
-			State:         model.StateError,
+		if e := s.repo.UpdateAudio(asset); e != nil {
+			err = errors.Join(err, e) // Go 1.20+
 		}
+		s.notify(ws.EventAudio, asset, model.StateError, "", err)
+	}
 
-		if e := s.repo.Update(asset); e != nil {
-			err = errors.Join(err, e) // Go 1.20+
+	job.State = model.StateError
+	job.Error_Message = err.Error()
+	if e := s.genRepo.Update(job); e != nil {
+		err = errors.Join(err, e)
+	}
+	return err
+}
+
+// notify publica el cambio de estado del asset en las salas de su script y
+// de su proyecto.
+func (s *Service) notify(typ ws.EventType, asset *model.Asset, state model.State, url string, err error) {
+	if s.hub == nil {
+		return
+	}
+
+	evt := ws.Event{
+		Type:     typ,
+		AssetID:  asset.ID.String(),
+		ScriptID: asset.ScriptID.String(),
+		State:    string(state),
+		URL:      helper.PresignRef(context.TODO(), s.store, url),
+	}
+	if err != nil {
+		evt.Error = err.Error()
+	}
+
+	var projectID string
+	if project, e := s.repo.FindProjectByScriptID(asset.ScriptID.String()); e == nil {
+		projectID = project.ID.String()
+	}
+	s.hub.Publish(evt, evt.ScriptID, projectID)
+}
+
+var (
+	// ErrNoImages se devuelve cuando no hay imágenes para el video del asset.
+	ErrNoImages      = errors.New("no hay imágenes para el video; elija algunas o indique key_words")
+	ErrTooManyImages = errors.New("demasiadas imágenes para un asset")
+	// ErrJobOpen se devuelve al encolar un asset que ya tiene un job
+	// PENDING o ACTIVE.
+	ErrJobOpen = errors.New("el asset ya tiene una generación en curso")
+)
+
+// maxAssetImages limita las imágenes elegidas por asset.
+const maxAssetImages = 10
+
+// SetImages fija las imágenes del video del asset. Cada imagen se resuelve
+// con su proveedor, que comprueba que exista y que el usuario pueda usarla.
+func (s *Service) SetImages(id, userID string, input *AssetImages) (*AssetResponse, error) {
+	if len(input.Images) > maxAssetImages {
+		return nil, fmt.Errorf("%w: como máximo %d", ErrTooManyImages, maxAssetImages)
+	}
+	asset, err := s.repo.FindById(id, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	images := make([]model.AssetImage, 0, len(input.Images))
+	for _, choice := range input.Images {
+		provider, err := s.images.Get(choice.Source)
+		if err != nil {
+			return nil, err
 		}
-		if e := s.genRepo.Create(&badJob); e != nil {
-			err = errors.Join(err, e)
+		img, err := provider.Lookup(context.TODO(), userID, choice.ID)
+		if err != nil {
+			return nil, fmt.Errorf("imagen %s de %s: %w", choice.ID, choice.Source, err)
 		}
+		images = append(images, *img)
+	}
+
+	// El video ya generado deja de reflejar las imágenes elegidas.
+	asset.Images = images
+	if asset.VideoState == model.StateFinished {
+		asset.VideoState = model.StatePending
+	}
+	if err := s.repo.UpdateImages(asset); err != nil {
 		return nil, err
 	}
 
-	return asset, nil
+	dto := AssetToDto(asset)
+	PresignAsset(s.store, &dto)
+	return &dto, nil
 }
 
-func (s *Service) GenerateVideo(id, userID string, key_words GenerateVideo) (*model.Asset, error) {
-	asset, err := s.repo.FindById(id)
+// videoImages devuelve las imágenes elegidas del asset o, si no tiene, las
+// busca con KeyWords y las guarda para que el próximo video use las mismas.
+func (s *Service) videoImages(asset *model.Asset, userID string, in GenerateVideo) ([]helper.Image, error) {
+	if len(asset.Images) > 0 {
+		return asset.Images, nil
+	}
+	if strings.TrimSpace(in.KeyWords) == "" {
+		return nil, ErrNoImages
+	}
+
+	provider, err := s.images.Get(in.Source)
+	if err != nil {
+		return nil, err
+	}
+	images, err := provider.Search(context.TODO(), helper.ImageQuery{Text: in.KeyWords, UserID: userID})
+	if err != nil {
+		return nil, err
+	}
+	if len(images) == 0 {
+		return nil, fmt.Errorf("%w: sin resultados para %q", ErrNoImages, in.KeyWords)
+	}
+	if len(images) > maxAssetImages {
+		images = images[:maxAssetImages]
+	}
+
+	asset.Images = images
+	if err := s.repo.UpdateImages(asset); err != nil {
+		return nil, err
+	}
+	return images, nil
+}
+
+func (s *Service) GenerateVideo(id, userID string, key_words GenerateVideo) (*AssetResponse, error) {
+	asset, err := s.repo.FindById(id, userID)
 	if err != nil {
 		return nil, err
 	}
@@ -227,90 +651,102 @@ func (s *Service) GenerateVideo(id, userID string, key_words GenerateVideo) (*mo
 		return nil, errors.New("para generar un video, primero debe haber generado el audio")
 	}
 
-	sub, err := s.userRepo.GetActiveSubscription(userID)
+	uid, err := uuid.Parse(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	images, err := s.videoImages(asset, userID, key_words)
 	if err != nil {
 		return nil, err
 	}
 
 	tokens := uint(asset.Duration) * 50
+	jobID := uuid.New()
+	res, err := s.userRepo.Reserve(userID, tokens, model.TokenLedger{
+		Reason:   model.LedgerAssetVideo,
+		ScriptID: &asset.ScriptID,
+		AssetID:  &asset.ID,
+		JobID:    &jobID,
+	})
+	if err != nil {
+		return nil, err
+	}
 
-	if sub.TokensRemaining < tokens {
-		return nil, fmt.Errorf(
-			"fondos insuficientes: se necesitan aprox. %d cuentokens, tienes %d",
-			tokens, sub.TokensRemaining,
-		)
+	asset.VideoState = model.StateActive
+	if err := s.repo.UpdateVideo(asset); err != nil {
+		return nil, s.release(res, err)
 	}
+	s.notify(ws.EventVideo, asset, model.StateActive, "", nil)
 
 	bucket := "video"
 	dirPath := filepath.Join(asset.ScriptID.String())
 
-	if err := s.repo.db.Transaction(func(tx *gorm.DB) error {
-		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
-			Where("id = ?", sub.ID).
-			Take(&sub).Error; err != nil {
-			return err
-		}
-
-		images, err := helper.SearchImage(key_words.KeyWords)
-		if err != nil {
-			return err
+	if err := func() error {
+		subtitles := ""
+		if key_words.Subtitles {
+			cues := helper.BuildCues([]model.Asset{*asset}, []float64{asset.Duration}, model.MixSettings{}, helper.SFXBracket)
+			subtitles = helper.FormatSubtitles(cues, helper.SubtitleSRT)
 		}
 
-		rawVideo, err := helper.GenerateVideo(images, asset.Audio_URL, asset.Duration)
+		rawVideo, err := helper.GenerateVideo(s.store, s.images, images, asset.Audio_URL, asset.Duration, subtitles)
 		if err != nil {
 			return err
 		}
 
 		video := bytes.NewReader(rawVideo)
-		fileName := asset.ID.String() + ".mp4"
+		key := path.Join(dirPath, asset.ID.String()+".mp4")
 
-		url, err := helper.Upload(context.TODO(), bucket, dirPath, fileName, video, "video/mp4", true)
-		if err != nil {
-			return err
-		}
-
-		asset.Video_URL = url
-		asset.VideoState = model.StateFinished
-		if err := tx.Save(asset).Error; err != nil {
+		if _, err := s.store.Put(context.TODO(), bucket, key, video, "video/mp4"); err != nil {
 			return err
 		}
 
-		job := model.GeneratedJob{
-			ID:              uuid.New(),
-			Provider:        model.ProviderGemini,
-			Model:           "veo_2",
-			Cuentoken_Spent: tokens,
-			State:           model.StateFinished,
-			AssetID:         asset.ID,
-		}
-		if err := tx.Create(&job).Error; err != nil {
-			return err
-		}
+		return s.repo.db.Transaction(func(tx *gorm.DB) error {
+			asset.Video_URL = helper.ObjectRef(bucket, key)
+			asset.VideoState = model.StateFinished
+			if err := updateVideo(tx, asset); err != nil {
+				return err
+			}
 
-		sub.TokensRemaining -= tokens
-		if err := tx.Save(sub).Error; err != nil {
-			return err
-		}
+			job := model.GeneratedJob{
+				ID:              jobID,
+				Provider:        model.ProviderGemini,
+				Model:           "veo_2",
+				Cuentoken_Spent: tokens,
+				State:           model.StateFinished,
+				AssetID:         asset.ID,
+				UserID:          uid,
+			}
+			if err := tx.Create(&job).Error; err != nil {
+				return err
+			}
 
-		return nil
-	}); err != nil {
+			return s.userRepo.Capture(tx, res, tokens)
+		})
+	}(); err != nil {
+		err = s.release(res, err)
 		asset.VideoState = model.StateError
 		asset.Video_URL = ""
 		badJob := model.GeneratedJob{
-			ID:            uuid.New(),
+			ID:            jobID,
 			Error_Message: err.Error(),
 			AssetID:       asset.ID,
+			UserID:        uid,
 			State:         model.StateError,
 		}
 
-		if e := s.repo.Update(asset); e != nil {
+		if e := s.repo.UpdateVideo(asset); e != nil {
 			err = errors.Join(err, e)
 		}
 		if e := s.genRepo.Create(&badJob); e != nil {
 			err = errors.Join(err, e)
 		}
+		s.notify(ws.EventVideo, asset, model.StateError, "", err)
 		return nil, err
 	}
 
-	return asset, nil
+	s.notify(ws.EventVideo, asset, model.StateFinished, asset.Video_URL, nil)
+	dto := AssetToDto(asset)
+	PresignAsset(s.store, &dto)
+	return &dto, nil
 }
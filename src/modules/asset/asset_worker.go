@@ -0,0 +1,255 @@
+package asset
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/MetaDandy/cuent-ai-core/src/model"
+	generatejob "github.com/MetaDandy/cuent-ai-core/src/modules/generate_job"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Límites por defecto de jobs simultáneos por proveedor. ElevenLabs tiene rate
+// limits estrictos, por eso va de a uno; 0 significa "sin límite propio".
+var defaultProviderLimits = map[model.Provider]int{
+	model.ProviderElevenlab: 1,
+	model.ProviderOpenAI:    2,
+	model.ProviderOffline:   0,
+}
+
+// Antigüedad a partir de la cual una reserva de cuentokens retenida se
+// considera colgada (el proceso murió antes de capturarla o liberarla).
+const staleReservation = time.Hour
+
+// Un worker renueva el lease de su job cada jobHeartbeat; si pasa jobLease
+// sin renovarlo, el job vuelve a la cola para que lo tome otra réplica.
+const (
+	jobHeartbeat = 30 * time.Second
+	jobLease     = 4 * jobHeartbeat
+)
+
+// Queue procesa en segundo plano los GeneratedJob PENDING con un pool de
+// workers acotado y un límite de concurrencia por proveedor. La tabla
+// generated_jobs es la cola, así que un reinicio no pierde trabajo.
+type Queue struct {
+	svc     *Service
+	genRepo *generatejob.Repository
+
+	slots *ProviderSlots
+	poll  time.Duration
+
+	wake chan struct{}
+}
+
+// NewQueue crea la cola y la asocia al servicio para que GenerateAll la
+// despierte al encolar.
+func NewQueue(svc *Service, genRepo *generatejob.Repository, workers int, limits map[model.Provider]int) *Queue {
+	q := &Queue{
+		svc:     svc,
+		genRepo: genRepo,
+		slots:   NewProviderSlots(workers, limits),
+		poll:    5 * time.Second,
+		wake:    make(chan struct{}, 1),
+	}
+	svc.queue = q
+	return q
+}
+
+// NewQueueFromEnv lee GENERATION_WORKERS y GENERATION_LIMIT_<PROVIDER>.
+func NewQueueFromEnv(svc *Service, genRepo *generatejob.Repository) *Queue {
+	workers := envInt("GENERATION_WORKERS", 4)
+
+	limits := make(map[model.Provider]int, len(defaultProviderLimits))
+	for p, def := range defaultProviderLimits {
+		limits[p] = envInt("GENERATION_LIMIT_"+string(p), def)
+	}
+
+	return NewQueue(svc, genRepo, workers, limits)
+}
+
+// Start reencola los jobs ACTIVE cuyo lease venció, devuelve las reservas
+// de cuentokens colgadas y lanza el dispatcher hasta que ctx se cancele.
+func (q *Queue) Start(ctx context.Context) error {
+	if err := q.requeueExpired(); err != nil {
+		return err
+	}
+
+	released, err := q.svc.userRepo.ReleaseStale(staleReservation)
+	if err != nil {
+		return err
+	}
+	if released > 0 {
+		log.Printf("[queue] %d reservas de cuentokens liberadas tras reinicio", released)
+	}
+
+	go q.dispatch(ctx)
+	return nil
+}
+
+// Wake avisa al dispatcher de que hay trabajo nuevo sin esperar al polling.
+func (q *Queue) Wake() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// requeueExpired devuelve a la cola los jobs de workers muertos, de esta
+// réplica o de otra.
+func (q *Queue) requeueExpired() error {
+	n, err := q.genRepo.RequeueExpired(jobLease)
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		log.Printf("[queue] %d jobs con lease vencido reencolados", n)
+	}
+	return nil
+}
+
+func (q *Queue) dispatch(ctx context.Context) {
+	ticker := time.NewTicker(q.poll)
+	defer ticker.Stop()
+	leases := time.NewTicker(jobLease)
+	defer leases.Stop()
+
+	for {
+		for q.claim() {
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-q.wake:
+		case <-ticker.C:
+		case <-leases.C:
+			if err := q.requeueExpired(); err != nil {
+				log.Printf("[queue] error reencolando jobs: %v", err)
+			}
+		}
+	}
+}
+
+// claim toma un job de algún proveedor con cupo libre y lo lanza en un
+// worker. Devuelve false cuando no hay cupo o no hay jobs pendientes.
+func (q *Queue) claim() bool {
+	free := q.slots.Free()
+	if len(free) == 0 {
+		return false
+	}
+
+	job, err := q.genRepo.ClaimNext(free)
+	if err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			log.Printf("[queue] error tomando job: %v", err)
+		}
+		return false
+	}
+
+	q.slots.Acquire(job.Provider)
+	go func() {
+		defer q.release(job.Provider)
+		stop := q.heartbeat(job.ID)
+		defer stop()
+		if _, err := q.svc.generate(job); err != nil {
+			log.Printf("[queue] job %s falló: %v", job.ID, err)
+		}
+	}()
+	return true
+}
+
+// heartbeat renueva el lease del job hasta que se llame a la función que
+// devuelve.
+func (q *Queue) heartbeat(id uuid.UUID) func() {
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(jobHeartbeat)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if err := q.genRepo.Heartbeat(id); err != nil {
+					log.Printf("[queue] error renovando el lease del job %s: %v", id, err)
+				}
+			}
+		}
+	}()
+	return func() { close(done) }
+}
+
+// release libera el cupo del job y despierta al dispatcher por si había
+// jobs esperando ese proveedor.
+func (q *Queue) release(p model.Provider) {
+	q.slots.Release(p)
+	q.Wake()
+}
+
+// ProviderSlots cuenta los jobs en curso del pool de workers y de cada
+// proveedor.
+type ProviderSlots struct {
+	mu      sync.Mutex
+	workers int
+	limits  map[model.Provider]int
+	running int
+	active  map[model.Provider]int
+}
+
+// NewProviderSlots crea los cupos para un pool de al menos un worker.
+func NewProviderSlots(workers int, limits map[model.Provider]int) *ProviderSlots {
+	if workers < 1 {
+		workers = 1
+	}
+	return &ProviderSlots{
+		workers: workers,
+		limits:  limits,
+		active:  make(map[model.Provider]int),
+	}
+}
+
+// Free devuelve los proveedores que aún admiten otro job, o nada si el pool
+// de workers está lleno.
+func (s *ProviderSlots) Free() []model.Provider {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.running >= s.workers {
+		return nil
+	}
+
+	free := make([]model.Provider, 0, len(s.limits))
+	for p, limit := range s.limits {
+		if limit <= 0 || s.active[p] < limit {
+			free = append(free, p)
+		}
+	}
+	return free
+}
+
+func (s *ProviderSlots) Acquire(p model.Provider) {
+	s.mu.Lock()
+	s.running++
+	s.active[p]++
+	s.mu.Unlock()
+}
+
+func (s *ProviderSlots) Release(p model.Provider) {
+	s.mu.Lock()
+	s.running--
+	s.active[p]--
+	s.mu.Unlock()
+}
+
+func envInt(key string, def int) int {
+	if v, err := strconv.Atoi(os.Getenv(key)); err == nil {
+		return v
+	}
+	return def
+}
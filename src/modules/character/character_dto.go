@@ -0,0 +1,65 @@
+package character
+
+import (
+	"time"
+
+	"github.com/MetaDandy/cuent-ai-core/src/model"
+)
+
+type CharacterCreate struct {
+	ProjectID   string `json:"project_id" validate:"required,uuid"`
+	Name        string `json:"name" validate:"required"`
+	Description string `json:"description"`
+	VoiceID     string `json:"voice_id" validate:"omitempty,uuid"`
+}
+
+type CharacterUpdate struct {
+	Name        *string `json:"name"`
+	Description *string `json:"description"`
+	// Un string vacío quita la voz y el personaje vuelve a la del proyecto.
+	VoiceID *string `json:"voice_id"`
+}
+
+type CharacterResponse struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	ProjectID   string `json:"project_id"`
+	VoiceID     string `json:"voice_id,omitempty"`
+
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+}
+
+func CharacterToDTO(u *model.Character) CharacterResponse {
+	var deletedAt *time.Time
+	if u.DeletedAt.Valid {
+		t := u.DeletedAt.Time
+		deletedAt = &t
+	}
+
+	var voiceID string
+	if u.VoiceID != nil {
+		voiceID = u.VoiceID.String()
+	}
+
+	return CharacterResponse{
+		ID:          u.ID.String(),
+		Name:        u.Name,
+		Description: u.Description,
+		ProjectID:   u.ProjectID.String(),
+		VoiceID:     voiceID,
+		CreatedAt:   u.CreatedAt,
+		UpdatedAt:   u.UpdatedAt,
+		DeletedAt:   deletedAt,
+	}
+}
+
+func CharactersToListDTO(list []model.Character) []CharacterResponse {
+	out := make([]CharacterResponse, len(list))
+	for i := range list {
+		out[i] = CharacterToDTO(&list[i])
+	}
+	return out
+}
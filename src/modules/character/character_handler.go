@@ -0,0 +1,156 @@
+package character
+
+import (
+	"net/http"
+
+	"github.com/MetaDandy/cuent-ai-core/helper"
+	"github.com/MetaDandy/cuent-ai-core/middleware"
+	"github.com/gofiber/fiber/v2"
+)
+
+type Handler struct {
+	svc *Service
+}
+
+func NewHandler(s *Service) *Handler {
+	return &Handler{svc: s}
+}
+
+func (h *Handler) RegisterRoutes(router fiber.Router) {
+	grp := router.Group("/characters").Use(middleware.JwtMiddleware())
+	grp.Get("", h.FindAll)
+	grp.Get("/:id", h.FindById)
+	grp.Get("/:id/project", h.FindByProjectID)
+	grp.Post("", h.Create)
+	grp.Patch("/:id", h.Update)
+	grp.Delete("/:id", h.SoftDelete)
+}
+
+func (h *Handler) FindAll(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(string)
+	if !ok || userID == "" {
+		return helper.JSONError(c, http.StatusUnauthorized,
+			"Token sin user_id", "")
+	}
+
+	opts := helper.NewFindAllOptionsFromQuery(c)
+	characters, err := h.svc.FindAll(userID, opts)
+	if err != nil {
+		return helper.JSONError(c, http.StatusInternalServerError,
+			"Error obteniendo personajes", err.Error())
+	}
+	return c.JSON(characters)
+}
+
+func (h *Handler) FindById(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(string)
+	if !ok || userID == "" {
+		return helper.JSONError(c, http.StatusUnauthorized,
+			"Token sin user_id", "")
+	}
+
+	dto, err := h.svc.FindByID(c.Params("id"), userID)
+	if err != nil {
+		return helper.JSONError(c, http.StatusNotFound,
+			"Personaje no encontrado", err.Error())
+	}
+
+	return c.JSON(helper.Response{
+		Data:    dto,
+		Message: "Personaje obtenido",
+	})
+}
+
+func (h *Handler) FindByProjectID(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(string)
+	if !ok || userID == "" {
+		return helper.JSONError(c, http.StatusUnauthorized,
+			"Token sin user_id", "")
+	}
+
+	dto, err := h.svc.FindByProjectID(c.Params("id"), userID)
+	if err != nil {
+		return helper.JSONError(c, http.StatusInternalServerError,
+			"Error obteniendo personajes", err.Error())
+	}
+
+	return c.JSON(helper.Response{
+		Data:    dto,
+		Message: "Personajes del proyecto obtenidos",
+	})
+}
+
+func (h *Handler) Create(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(string)
+	if !ok || userID == "" {
+		return helper.JSONError(c, http.StatusUnauthorized,
+			"Token sin user_id", "")
+	}
+
+	var input CharacterCreate
+	if err := c.BodyParser(&input); err != nil {
+		return helper.JSONError(c, http.StatusBadRequest,
+			"Input inválido", err.Error())
+	}
+
+	character, err := h.svc.Create(userID, &input)
+	if helper.IsNotFound(err) {
+		return helper.JSONError(c, http.StatusNotFound,
+			"Proyecto no encontrado")
+	}
+	if err != nil {
+		return helper.JSONError(c, http.StatusInternalServerError,
+			"Error creando personaje", err.Error())
+	}
+	return c.Status(http.StatusCreated).JSON(helper.Response{
+		Data:    character,
+		Message: "Personaje creado",
+	})
+}
+
+func (h *Handler) Update(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(string)
+	if !ok || userID == "" {
+		return helper.JSONError(c, http.StatusUnauthorized,
+			"Token sin user_id", "")
+	}
+
+	var input CharacterUpdate
+	if err := c.BodyParser(&input); err != nil {
+		return helper.JSONError(c, http.StatusBadRequest,
+			"Cuerpo inválido", err.Error())
+	}
+
+	character, err := h.svc.Update(c.Params("id"), userID, &input)
+	if helper.IsNotFound(err) {
+		return helper.JSONError(c, http.StatusNotFound,
+			"Personaje no encontrado")
+	}
+	if err != nil {
+		return helper.JSONError(c, http.StatusInternalServerError,
+			"Error actualizando personaje", err.Error())
+	}
+	return c.JSON(helper.Response{
+		Data:    character,
+		Message: "Personaje actualizado",
+	})
+}
+
+func (h *Handler) SoftDelete(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(string)
+	if !ok || userID == "" {
+		return helper.JSONError(c, http.StatusUnauthorized,
+			"Token sin user_id", "")
+	}
+
+	err := h.svc.SoftDelete(c.Params("id"), userID)
+	if helper.IsNotFound(err) {
+		return helper.JSONError(c, http.StatusNotFound,
+			"Personaje no encontrado")
+	}
+	if err != nil {
+		return helper.JSONError(c, http.StatusInternalServerError,
+			"Error eliminando personaje", err.Error())
+	}
+	return c.SendStatus(http.StatusNoContent)
+}
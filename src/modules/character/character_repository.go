@@ -0,0 +1,65 @@
+package character
+
+import (
+	"github.com/MetaDandy/cuent-ai-core/helper"
+	"github.com/MetaDandy/cuent-ai-core/src/model"
+	"gorm.io/gorm"
+)
+
+type Repository struct {
+	db *gorm.DB
+}
+
+func NewRepository(db *gorm.DB) *Repository {
+	return &Repository{db: db}
+}
+
+func (r *Repository) Create(character *model.Character) error {
+	return r.db.Create(character).Error
+}
+
+func (r *Repository) Update(character *model.Character) error {
+	return r.db.Save(character).Error
+}
+
+func (r *Repository) FindAll(userID string, opts *helper.FindAllOptions) ([]model.Character, int64, error) {
+	var finded []model.Character
+	query := r.db.Model(model.Character{}).Scopes(helper.OwnedCharacters(userID))
+	var total int64
+	query, total = helper.ApplyFindAllOptions(query, opts)
+
+	err := query.Find(&finded).Error
+	return finded, total, err
+}
+
+func (r *Repository) FindById(id, userID string) (*model.Character, error) {
+	var character model.Character
+	err := r.db.Scopes(helper.OwnedCharacters(userID)).First(&character, "id = ?", id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &character, nil
+}
+
+func (r *Repository) FindByProjectID(projectID, userID string) ([]model.Character, error) {
+	var characters []model.Character
+	err := r.db.
+		Scopes(helper.OwnedCharacters(userID)).
+		Where("project_id = ?", projectID).
+		Order("name").
+		Find(&characters).Error
+	return characters, err
+}
+
+// SoftDelete borra el personaje y desliga sus assets, que pasan a leerse con
+// la voz del proyecto.
+func (r *Repository) SoftDelete(id string) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&model.Asset{}).
+			Where("character_id = ?", id).
+			Update("character_id", nil).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&model.Character{}, "id = ?", id).Error
+	})
+}
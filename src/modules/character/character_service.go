@@ -0,0 +1,132 @@
+package character
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/MetaDandy/cuent-ai-core/helper"
+	"github.com/MetaDandy/cuent-ai-core/src/model"
+	"github.com/MetaDandy/cuent-ai-core/src/modules/project"
+	"github.com/google/uuid"
+)
+
+type Service struct {
+	repo        *Repository
+	projectRepo project.Repository
+}
+
+func NewService(r *Repository, pr project.Repository) *Service {
+	return &Service{repo: r, projectRepo: pr}
+}
+
+func (s *Service) FindAll(userID string, opts *helper.FindAllOptions) (*helper.PaginatedResponse[CharacterResponse], error) {
+	characters, total, err := s.repo.FindAll(userID, opts)
+	if err != nil {
+		return nil, err
+	}
+	dtos := CharactersToListDTO(characters)
+	pages := uint((total + int64(opts.Limit) - 1) / int64(opts.Limit))
+
+	return &helper.PaginatedResponse[CharacterResponse]{
+		Data:   dtos,
+		Total:  total,
+		Limit:  opts.Limit,
+		Offset: opts.Offset,
+		Pages:  pages,
+	}, nil
+}
+
+func (s *Service) FindByID(id, userID string) (*CharacterResponse, error) {
+	character, err := s.repo.FindById(id, userID)
+	if err != nil {
+		return nil, err
+	}
+	dto := CharacterToDTO(character)
+	return &dto, nil
+}
+
+func (s *Service) FindByProjectID(projectID, userID string) (*[]CharacterResponse, error) {
+	characters, err := s.repo.FindByProjectID(projectID, userID)
+	if err != nil {
+		return nil, err
+	}
+	dto := CharactersToListDTO(characters)
+	return &dto, nil
+}
+
+func (s *Service) Create(userID string, input *CharacterCreate) (*CharacterResponse, error) {
+	project, err := s.projectRepo.FindById(input.ProjectID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	name := strings.TrimSpace(input.Name)
+	if name == "" {
+		return nil, errors.New("el nombre del personaje es obligatorio")
+	}
+
+	character := model.Character{
+		ID:          uuid.New(),
+		Name:        name,
+		Description: input.Description,
+		ProjectID:   project.ID,
+	}
+	if character.VoiceID, err = parseVoiceID(input.VoiceID); err != nil {
+		return nil, err
+	}
+
+	if err := s.repo.Create(&character); err != nil {
+		return nil, err
+	}
+
+	dto := CharacterToDTO(&character)
+	return &dto, nil
+}
+
+func (s *Service) Update(id, userID string, input *CharacterUpdate) (*CharacterResponse, error) {
+	character, err := s.repo.FindById(id, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if input.Name != nil {
+		name := strings.TrimSpace(*input.Name)
+		if name == "" {
+			return nil, errors.New("el nombre del personaje es obligatorio")
+		}
+		character.Name = name
+	}
+	if input.Description != nil {
+		character.Description = *input.Description
+	}
+	if input.VoiceID != nil {
+		if character.VoiceID, err = parseVoiceID(*input.VoiceID); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := s.repo.Update(character); err != nil {
+		return nil, err
+	}
+
+	dto := CharacterToDTO(character)
+	return &dto, nil
+}
+
+func (s *Service) SoftDelete(id, userID string) error {
+	if _, err := s.repo.FindById(id, userID); err != nil {
+		return err
+	}
+	return s.repo.SoftDelete(id)
+}
+
+func parseVoiceID(raw string) (*uuid.UUID, error) {
+	if raw == "" {
+		return nil, nil
+	}
+	id, err := uuid.Parse(raw)
+	if err != nil {
+		return nil, errors.New("voice_id inválido")
+	}
+	return &id, nil
+}
@@ -16,6 +16,10 @@ type GeneratedJobResponse struct {
 	State           string  `json:"state"`
 	Error_Message   string  `json:"error_message"`
 	Cost            float64 `json:"cost"`
+	AssetID         string  `json:"asset_id"`
+	UserID          string  `json:"user_id"`
+	BatchID         string  `json:"batch_id,omitempty"`
+	VoiceID         string  `json:"voice_id,omitempty"`
 
 	CreatedAt time.Time  `json:"created_at"`
 	UpdatedAt time.Time  `json:"updated_at"`
@@ -29,6 +33,16 @@ func GeneratedJobToDto(u *model.GeneratedJob) GeneratedJobResponse {
 		deletedAt = &t
 	}
 
+	var batchID string
+	if u.BatchID != nil {
+		batchID = u.BatchID.String()
+	}
+
+	var voiceID string
+	if u.VoiceID != nil {
+		voiceID = u.VoiceID.String()
+	}
+
 	return GeneratedJobResponse{
 		ID:              u.ID.String(),
 		Provider:        string(u.Provider),
@@ -39,6 +53,10 @@ func GeneratedJobToDto(u *model.GeneratedJob) GeneratedJobResponse {
 		State:           string(u.State),
 		Error_Message:   u.Error_Message,
 		Cost:            u.Cost,
+		AssetID:         u.AssetID.String(),
+		UserID:          u.UserID.String(),
+		BatchID:         batchID,
+		VoiceID:         voiceID,
 
 		CreatedAt: u.CreatedAt,
 		UpdatedAt: u.UpdatedAt,
@@ -46,6 +64,14 @@ func GeneratedJobToDto(u *model.GeneratedJob) GeneratedJobResponse {
 	}
 }
 
+// JobTotalsResponse resume el gasto de los jobs listados.
+type JobTotalsResponse struct {
+	Jobs       int64   `json:"jobs"`
+	Cost       float64 `json:"cost"`
+	Cuentokens uint    `json:"cuentokens"`
+	Chars      uint    `json:"chars"`
+}
+
 func GeneratedJobToLisDTO(list []model.GeneratedJob) []GeneratedJobResponse {
 	out := make([]GeneratedJobResponse, len(list))
 	for i := range list {
@@ -1,9 +1,14 @@
 package generatejob
 
 import (
+	"strings"
+	"time"
+
 	"github.com/MetaDandy/cuent-ai-core/helper"
 	"github.com/MetaDandy/cuent-ai-core/src/model"
+	"github.com/google/uuid"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type Repository struct {
@@ -32,9 +37,58 @@ func (r *Repository) FindAll(opts *helper.FindAllOptions) ([]model.GeneratedJob,
 	return finded, total, err
 }
 
-func (r *Repository) FindById(id string) (*model.GeneratedJob, error) {
+// JobFilter acota el listado de jobs del panel de admin. Los campos vacíos no
+// filtran.
+type JobFilter struct {
+	UserID   string
+	State    string
+	Provider string
+}
+
+func (f JobFilter) apply(db *gorm.DB) *gorm.DB {
+	if f.UserID != "" {
+		db = db.Where("user_id = ?", f.UserID)
+	}
+	if f.State != "" {
+		db = db.Where("state = ?", strings.ToUpper(f.State))
+	}
+	if f.Provider != "" {
+		db = db.Where("provider = ?", strings.ToUpper(f.Provider))
+	}
+	return db
+}
+
+// FindAllFiltered pagina los jobs de todos los usuarios y devuelve además los
+// totales de costo y consumo de los que cumplen el filtro.
+func (r *Repository) FindAllFiltered(filter JobFilter, opts *helper.FindAllOptions) ([]model.GeneratedJob, int64, *JobTotalsResponse, error) {
+	var totals JobTotalsResponse
+	if err := r.db.Model(model.GeneratedJob{}).
+		Scopes(filter.apply).
+		Select(`COUNT(*) AS jobs, COALESCE(SUM(cost), 0) AS cost,
+			COALESCE(SUM(cuentoken_spent), 0) AS cuentokens, COALESCE(SUM(chars_used), 0) AS chars`).
+		Scan(&totals).Error; err != nil {
+		return nil, 0, nil, err
+	}
+
+	// Los jobs no tienen columna name, así que search no aplica.
+	if opts != nil && opts.Search != "" {
+		o := *opts
+		o.Search = ""
+		opts = &o
+	}
+
+	var finded []model.GeneratedJob
+	query := r.db.Model(model.GeneratedJob{}).Scopes(filter.apply)
+	var total int64
+	query, total = helper.ApplyFindAllOptions(query, opts)
+
+	err := query.Find(&finded).Error
+	return finded, total, &totals, err
+}
+
+func (r *Repository) FindById(id, userID string) (*model.GeneratedJob, error) {
 	var generatedJob model.GeneratedJob
-	err := r.db.First(&generatedJob, "id = ?", id).Error
+	err := r.db.Scopes(helper.OwnedJobs(userID)).First(&generatedJob, "id = ?", id).Error
 	if err != nil {
 		return nil, err
 	}
@@ -50,6 +104,77 @@ func (r *Repository) FindByIdUnscoped(id string) (*model.GeneratedJob, error) {
 	return &generatedJob, nil
 }
 
+func (r *Repository) CreateMany(jobs []model.GeneratedJob) error {
+	return r.db.Create(&jobs).Error
+}
+
+func (r *Repository) FindByBatchID(batchID, userID string) ([]model.GeneratedJob, error) {
+	var jobs []model.GeneratedJob
+	err := r.db.
+		Scopes(helper.OwnedJobs(userID)).
+		Where("batch_id = ?", batchID).
+		Order("created_at").
+		Find(&jobs).Error
+	return jobs, err
+}
+
+// FindOpenByScriptID devuelve los jobs PENDING/ACTIVE de los assets del script.
+func (r *Repository) FindOpenByScriptID(scriptID string) ([]model.GeneratedJob, error) {
+	var jobs []model.GeneratedJob
+	err := r.db.
+		Joins("JOIN assets ON assets.id = generated_jobs.asset_id").
+		Where("assets.script_id = ? AND generated_jobs.state IN ?",
+			scriptID, []model.State{model.StatePending, model.StateActive}).
+		Find(&jobs).Error
+	return jobs, err
+}
+
+// ClaimNext toma el job PENDING más antiguo de alguno de los proveedores
+// indicados y lo marca ACTIVE con claimed_at. SKIP LOCKED permite varios
+// workers (o réplicas) sin que dos tomen el mismo job.
+func (r *Repository) ClaimNext(providers []model.Provider) (*model.GeneratedJob, error) {
+	var job model.GeneratedJob
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("state = ? AND provider IN ?", model.StatePending, providers).
+			Order("created_at").
+			Take(&job).Error; err != nil {
+			return err
+		}
+
+		job.State = model.StateActive
+		return tx.Model(&job).Updates(map[string]any{
+			"state":      model.StateActive,
+			"claimed_at": gorm.Expr("NOW()"),
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// Heartbeat renueva el lease de un job ACTIVE.
+func (r *Repository) Heartbeat(id uuid.UUID) error {
+	return r.db.
+		Model(&model.GeneratedJob{}).
+		Where("id = ? AND state = ?", id, model.StateActive).
+		Update("claimed_at", gorm.Expr("NOW()")).Error
+}
+
+// RequeueExpired devuelve a PENDING los jobs ACTIVE cuyo worker no renovó el
+// lease en el plazo indicado: el proceso que los tenía se detuvo a mitad de
+// la generación. Los que otra réplica sigue procesando no se tocan. Se usa
+// la hora de la base para no depender del reloj de cada réplica.
+func (r *Repository) RequeueExpired(lease time.Duration) (int64, error) {
+	res := r.db.
+		Model(&model.GeneratedJob{}).
+		Where("state = ?", model.StateActive).
+		Where("claimed_at IS NULL OR claimed_at < NOW() - make_interval(secs => ?)", lease.Seconds()).
+		Updates(map[string]any{"state": model.StatePending, "claimed_at": nil})
+	return res.RowsAffected, res.Error
+}
+
 func (r *Repository) SoftDelete(id string) error {
 	return r.db.Delete(&model.GeneratedJob{}, "id = ?", id).Error
 }
@@ -0,0 +1,37 @@
+package image
+
+import (
+	"context"
+
+	"github.com/MetaDandy/cuent-ai-core/helper"
+	"github.com/MetaDandy/cuent-ai-core/src/model"
+)
+
+type ImageResponse struct {
+	Source string `json:"source"`
+	ID     string `json:"id"`
+	URL    string `json:"url"`
+}
+
+func ImageToDTO(img *model.AssetImage) ImageResponse {
+	return ImageResponse{
+		Source: string(img.Source),
+		ID:     img.ID,
+		URL:    img.URL,
+	}
+}
+
+func ImagesToListDTO(list []model.AssetImage) []ImageResponse {
+	out := make([]ImageResponse, len(list))
+	for i := range list {
+		out[i] = ImageToDTO(&list[i])
+	}
+	return out
+}
+
+// PresignImages firma las URLs de las imágenes subidas para esta respuesta.
+func PresignImages(store helper.BlobStore, list []ImageResponse) {
+	for i := range list {
+		list[i].URL = helper.PresignRef(context.TODO(), store, list[i].URL)
+	}
+}
@@ -0,0 +1,92 @@
+package image
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/MetaDandy/cuent-ai-core/helper"
+	"github.com/MetaDandy/cuent-ai-core/middleware"
+	"github.com/gofiber/fiber/v2"
+)
+
+type Handler struct {
+	svc *Service
+}
+
+func NewHandler(s *Service) *Handler {
+	return &Handler{svc: s}
+}
+
+func (h *Handler) RegisterRoutes(router fiber.Router) {
+	grp := router.Group("/images").Use(middleware.JwtMiddleware())
+	grp.Get("/sources", h.Sources)
+	grp.Get("/search", h.Search)
+	grp.Post("", h.Upload)
+}
+
+func (h *Handler) Sources(c *fiber.Ctx) error {
+	return c.JSON(helper.Response{
+		Data:    h.svc.Sources(),
+		Message: "Fuentes de imágenes",
+	})
+}
+
+// Search busca con ?source=UNSPLASH|LIBRARY|UPLOAD&q=<palabras>.
+func (h *Handler) Search(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(string)
+	if !ok || userID == "" {
+		return helper.JSONError(c, http.StatusUnauthorized,
+			"Token sin user_id", "")
+	}
+
+	images, err := h.svc.Search(userID, c.Query("source"), c.Query("q"))
+	if errors.Is(err, helper.ErrImageSource) {
+		return helper.JSONError(c, http.StatusBadRequest,
+			"Input inválido", err.Error())
+	}
+	if err != nil {
+		return helper.JSONError(c, http.StatusInternalServerError,
+			"Error buscando imágenes", err.Error())
+	}
+
+	return c.JSON(helper.Response{
+		Data:    images,
+		Message: "Imágenes encontradas",
+	})
+}
+
+// Upload recibe la imagen como multipart en el campo "file".
+func (h *Handler) Upload(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(string)
+	if !ok || userID == "" {
+		return helper.JSONError(c, http.StatusUnauthorized,
+			"Token sin user_id", "")
+	}
+
+	file, err := c.FormFile("file")
+	if err != nil {
+		return helper.JSONError(c, http.StatusBadRequest,
+			"Falta la imagen", err.Error())
+	}
+	body, err := file.Open()
+	if err != nil {
+		return helper.JSONError(c, http.StatusBadRequest,
+			"Archivo inválido", err.Error())
+	}
+	defer body.Close()
+
+	dto, err := h.svc.Upload(userID, body, file.Filename)
+	if errors.Is(err, helper.ErrInvalidImage) {
+		return helper.JSONError(c, http.StatusBadRequest,
+			"Archivo inválido", err.Error())
+	}
+	if err != nil {
+		return helper.JSONError(c, http.StatusInternalServerError,
+			"Error subiendo la imagen", err.Error())
+	}
+
+	return c.Status(http.StatusCreated).JSON(helper.Response{
+		Data:    dto,
+		Message: "Imagen subida",
+	})
+}
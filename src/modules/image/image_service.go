@@ -0,0 +1,61 @@
+package image
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/MetaDandy/cuent-ai-core/helper"
+	"github.com/MetaDandy/cuent-ai-core/src/model"
+)
+
+type Service struct {
+	providers helper.ImageProviders
+	store     helper.BlobStore
+}
+
+func NewService(providers helper.ImageProviders, store helper.BlobStore) *Service {
+	return &Service{providers: providers, store: store}
+}
+
+// Sources devuelve las fuentes de imágenes configuradas.
+func (s *Service) Sources() []string {
+	out := make([]string, 0, len(s.providers))
+	for source := range s.providers {
+		out = append(out, string(source))
+	}
+	sort.Strings(out)
+	return out
+}
+
+// Search busca imágenes en la fuente indicada; las subidas sólo devuelven
+// las del usuario.
+func (s *Service) Search(userID, source, query string) ([]ImageResponse, error) {
+	provider, err := s.providers.Get(source)
+	if err != nil {
+		return nil, err
+	}
+	images, err := provider.Search(context.TODO(), helper.ImageQuery{Text: query, UserID: userID})
+	if err != nil {
+		return nil, err
+	}
+	dtos := ImagesToListDTO(images)
+	PresignImages(s.store, dtos)
+	return dtos, nil
+}
+
+// Upload guarda una imagen del usuario para usarla en sus videos.
+func (s *Service) Upload(userID string, body io.Reader, filename string) (*ImageResponse, error) {
+	uploads, ok := s.providers[model.ImageUpload].(*helper.UploadImages)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", helper.ErrImageSource, model.ImageUpload)
+	}
+	img, err := uploads.Upload(context.TODO(), userID, filename, body)
+	if err != nil {
+		return nil, err
+	}
+	dto := ImageToDTO(img)
+	dto.URL = helper.PresignRef(context.TODO(), s.store, dto.URL)
+	return &dto, nil
+}
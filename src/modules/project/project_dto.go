@@ -1,20 +1,25 @@
 package project
 
 import (
+	"context"
 	"time"
 
+	"github.com/MetaDandy/cuent-ai-core/helper"
 	"github.com/MetaDandy/cuent-ai-core/src/model"
 )
 
 type ProjectCreate struct {
 	Name        string `json:"name" validate:"required"`
 	Description string `json:"description" validate:"required"`
-	UserId      string `json:"user_id" validate:"required"`
+	Provider    string `json:"provider"`
+	VoiceID     string `json:"voice_id" validate:"omitempty,uuid"`
 }
 
 type ProjectUpdate struct {
 	Name        *string `json:"name"`
 	Description *string `json:"description"`
+	Provider    *string `json:"provider"`
+	VoiceID     *string `json:"voice_id"`
 }
 
 type ProjectResponse struct {
@@ -23,6 +28,8 @@ type ProjectResponse struct {
 	Description string `json:"description"`
 	Cuentokens  string `json:"cuentokens"`
 	State       string `json:"state"`
+	Provider    string `json:"provider"`
+	VoiceID     string `json:"voice_id,omitempty"`
 
 	// Poner user cuando se cree si amerita
 	Script []ScriptReponse `json:"scripts,omitempty"`
@@ -47,12 +54,19 @@ func ProjectToDTO(u *model.Project) ProjectResponse {
 		}
 	}
 
+	var voiceID string
+	if u.VoiceID != nil {
+		voiceID = u.VoiceID.String()
+	}
+
 	return ProjectResponse{
 		ID:          u.ID.String(),
 		Name:        u.Name,
 		Description: u.Description,
 		Cuentokens:  u.Cuentokens,
 		State:       string(u.State),
+		Provider:    string(u.Provider),
+		VoiceID:     voiceID,
 		Script:      scripts,
 		CreatedAt:   u.CreatedAt,
 		UpdatedAt:   u.UpdatedAt,
@@ -109,3 +123,11 @@ func ScriptToDTO(u *model.Script) ScriptReponse {
 		DeletedAt: deletedAt,
 	}
 }
+
+// PresignProject firma las mezclas de los scripts del proyecto.
+func PresignProject(store helper.BlobStore, dto *ProjectResponse) {
+	for i := range dto.Script {
+		dto.Script[i].Mixed_Audio = helper.PresignRef(context.TODO(), store, dto.Script[i].Mixed_Audio)
+		dto.Script[i].Mixed_Media = helper.PresignRef(context.TODO(), store, dto.Script[i].Mixed_Media)
+	}
+}
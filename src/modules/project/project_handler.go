@@ -27,8 +27,14 @@ func (h *Handler) RegisterRoutes(router fiber.Router) {
 }
 
 func (h *Handler) FindAll(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(string)
+	if !ok || userID == "" {
+		return helper.JSONError(c, http.StatusUnauthorized,
+			"Token sin user_id", "")
+	}
+
 	opts := helper.NewFindAllOptionsFromQuery(c)
-	project, err := h.svc.FindAll(opts)
+	project, err := h.svc.FindAll(userID, opts)
 	if err != nil {
 		return helper.JSONError(c, http.StatusInternalServerError,
 			"Error obteniendo projectos", err.Error())
@@ -37,7 +43,17 @@ func (h *Handler) FindAll(c *fiber.Ctx) error {
 }
 
 func (h *Handler) FindById(c *fiber.Ctx) error {
-	dto, err := h.svc.FindByID(c.Params("id"))
+	userID, ok := c.Locals("user_id").(string)
+	if !ok || userID == "" {
+		return helper.JSONError(c, http.StatusUnauthorized,
+			"Token sin user_id", "")
+	}
+
+	dto, err := h.svc.FindByID(c.Params("id"), userID)
+	if helper.IsNotFound(err) {
+		return helper.JSONError(c, http.StatusNotFound,
+			"Projecto no encontrado")
+	}
 	if err != nil {
 		return helper.JSONError(c, http.StatusInternalServerError,
 			"Error obteniendo projecto", err.Error())
@@ -54,12 +70,18 @@ func (h *Handler) FindById(c *fiber.Ctx) error {
 }
 
 func (h *Handler) Create(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(string)
+	if !ok || userID == "" {
+		return helper.JSONError(c, http.StatusUnauthorized,
+			"Token sin user_id", "")
+	}
+
 	var input ProjectCreate
 	if err := c.BodyParser(&input); err != nil {
 		return helper.JSONError(c, http.StatusBadRequest,
 			"Input inválido", err.Error())
 	}
-	project, err := h.svc.Create(&input)
+	project, err := h.svc.Create(userID, &input)
 	if err != nil {
 		return helper.JSONError(c, http.StatusInternalServerError,
 			"Error creando projecto", err.Error())
@@ -71,12 +93,22 @@ func (h *Handler) Create(c *fiber.Ctx) error {
 }
 
 func (h *Handler) Update(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(string)
+	if !ok || userID == "" {
+		return helper.JSONError(c, http.StatusUnauthorized,
+			"Token sin user_id", "")
+	}
+
 	var input ProjectUpdate
 	if err := c.BodyParser(&input); err != nil {
 		return helper.JSONError(c, http.StatusBadRequest,
 			"Cuerpo inválido", err.Error())
 	}
-	project, err := h.svc.Update(c.Params("id"), &input)
+	project, err := h.svc.Update(c.Params("id"), userID, &input)
+	if helper.IsNotFound(err) {
+		return helper.JSONError(c, http.StatusNotFound,
+			"Proyecto no encontrado")
+	}
 	if err != nil {
 		return helper.JSONError(c, http.StatusInternalServerError,
 			"Error actualizando proejcto", err.Error())
@@ -92,19 +124,38 @@ func (h *Handler) Update(c *fiber.Ctx) error {
 }
 
 func (h *Handler) SoftDelete(c *fiber.Ctx) error {
-	ok, err := h.svc.SoftDelete(c.Params("id"))
+	userID, ok := c.Locals("user_id").(string)
+	if !ok || userID == "" {
+		return helper.JSONError(c, http.StatusUnauthorized,
+			"Token sin user_id", "")
+	}
+
+	deleted, err := h.svc.SoftDelete(c.Params("id"), userID)
+	if helper.IsNotFound(err) {
+		return helper.JSONError(c, http.StatusNotFound, "Projecto no encontrado")
+	}
 	if err != nil {
 		return helper.JSONError(c, http.StatusInternalServerError,
 			"Error eliminando proyecto", err.Error())
 	}
-	if !ok {
+	if !deleted {
 		return helper.JSONError(c, http.StatusNotFound, "Projecto no encontrado")
 	}
 	return c.SendStatus(http.StatusNoContent)
 }
 
 func (h *Handler) Restore(c *fiber.Ctx) error {
-	project, err := h.svc.Restore(c.Params("id"))
+	userID, ok := c.Locals("user_id").(string)
+	if !ok || userID == "" {
+		return helper.JSONError(c, http.StatusUnauthorized,
+			"Token sin user_id", "")
+	}
+
+	project, err := h.svc.Restore(c.Params("id"), userID)
+	if helper.IsNotFound(err) {
+		return helper.JSONError(c, http.StatusNotFound,
+			"Proyecto no encontrado")
+	}
 	if err != nil {
 		return helper.JSONError(c, http.StatusInternalServerError,
 			"Error restaurando projecto", err.Error())
@@ -9,9 +9,9 @@ import (
 type Repository interface {
 	Create(project *model.Project) error
 	Update(project *model.Project) error
-	FindAll(opts *helper.FindAllOptions) ([]model.Project, int64, error)
-	FindById(id string) (*model.Project, error)
-	FindByIdUnscoped(id string) (*model.Project, error)
+	FindAll(userID string, opts *helper.FindAllOptions) ([]model.Project, int64, error)
+	FindById(id, userID string) (*model.Project, error)
+	FindByIdUnscoped(id, userID string) (*model.Project, error)
 	SoftDelete(id string) error
 	Restore(id string) error
 }
@@ -32,9 +32,9 @@ func (r *PostgresRepository) Update(project *model.Project) error {
 	return r.db.Save(project).Error
 }
 
-func (r *PostgresRepository) FindAll(opts *helper.FindAllOptions) ([]model.Project, int64, error) {
+func (r *PostgresRepository) FindAll(userID string, opts *helper.FindAllOptions) ([]model.Project, int64, error) {
 	var finded []model.Project
-	query := r.db.Model(model.Project{})
+	query := r.db.Model(model.Project{}).Scopes(helper.OwnedProjects(userID))
 	var total int64
 	query, total = helper.ApplyFindAllOptions(query, opts)
 
@@ -42,18 +42,20 @@ func (r *PostgresRepository) FindAll(opts *helper.FindAllOptions) ([]model.Proje
 	return finded, total, err
 }
 
-func (r *PostgresRepository) FindById(id string) (*model.Project, error) {
+func (r *PostgresRepository) FindById(id, userID string) (*model.Project, error) {
 	var project model.Project
-	err := r.db.Preload("Scripts").First(&project, "id = ?", id).Error
+	err := r.db.Scopes(helper.OwnedProjects(userID)).
+		Preload("Scripts").First(&project, "id = ?", id).Error
 	if err != nil {
 		return nil, err
 	}
 	return &project, nil
 }
 
-func (r *PostgresRepository) FindByIdUnscoped(id string) (*model.Project, error) {
+func (r *PostgresRepository) FindByIdUnscoped(id, userID string) (*model.Project, error) {
 	var project model.Project
-	err := r.db.Unscoped().First(&project, "id = ?", id).Error
+	err := r.db.Unscoped().Scopes(helper.OwnedProjects(userID)).
+		First(&project, "id = ?", id).Error
 	if err != nil {
 		return nil, err
 	}
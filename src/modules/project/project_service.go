@@ -12,18 +12,22 @@ import (
 type Service struct {
 	repo     Repository
 	userRepo *user.Repository
+	store    helper.BlobStore
 }
 
-func NewService(r Repository, u *user.Repository) *Service {
-	return &Service{repo: r, userRepo: u}
+func NewService(r Repository, u *user.Repository, store helper.BlobStore) *Service {
+	return &Service{repo: r, userRepo: u, store: store}
 }
 
-func (s *Service) FindAll(opts *helper.FindAllOptions) (*helper.PaginatedResponse[ProjectResponse], error) {
-	projects, total, err := s.repo.FindAll(opts)
+func (s *Service) FindAll(userID string, opts *helper.FindAllOptions) (*helper.PaginatedResponse[ProjectResponse], error) {
+	projects, total, err := s.repo.FindAll(userID, opts)
 	if err != nil {
 		return nil, err
 	}
 	dtos := ProjectsToListDTO(projects)
+	for i := range dtos {
+		PresignProject(s.store, &dtos[i])
+	}
 	pages := uint((total + int64(opts.Limit) - 1) / int64(opts.Limit))
 
 	return &helper.PaginatedResponse[ProjectResponse]{
@@ -35,8 +39,8 @@ func (s *Service) FindAll(opts *helper.FindAllOptions) (*helper.PaginatedRespons
 	}, nil
 }
 
-func (s *Service) FindByID(id string) (*ProjectResponse, error) {
-	project, err := s.repo.FindById(id)
+func (s *Service) FindByID(id, userID string) (*ProjectResponse, error) {
+	project, err := s.repo.FindById(id, userID)
 	if err != nil {
 		return nil, err
 	}
@@ -44,11 +48,23 @@ func (s *Service) FindByID(id string) (*ProjectResponse, error) {
 		return nil, nil
 	}
 	dto := ProjectToDTO(project)
+	PresignProject(s.store, &dto)
 	return &dto, nil
 }
 
-func (s *Service) Create(input *ProjectCreate) (*ProjectResponse, error) {
-	user, err := s.userRepo.FindById(input.UserId)
+// Create crea el proyecto a nombre de userID, el dueño que viene del token.
+func (s *Service) Create(userID string, input *ProjectCreate) (*ProjectResponse, error) {
+	user, err := s.userRepo.FindById(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	provider, err := helper.ParseSpeechProvider(input.Provider)
+	if err != nil {
+		return nil, err
+	}
+
+	voiceID, err := parseVoiceID(input.VoiceID)
 	if err != nil {
 		return nil, err
 	}
@@ -58,6 +74,8 @@ func (s *Service) Create(input *ProjectCreate) (*ProjectResponse, error) {
 		Name:        input.Name,
 		Description: input.Description,
 		State:       model.StatePending,
+		Provider:    provider,
+		VoiceID:     voiceID,
 		UserID:      user.ID,
 	}
 
@@ -65,13 +83,14 @@ func (s *Service) Create(input *ProjectCreate) (*ProjectResponse, error) {
 		return nil, err
 	}
 
-	reload, _ := s.repo.FindById(project.ID.String())
+	reload, _ := s.repo.FindById(project.ID.String(), userID)
 	dto := ProjectToDTO(reload)
+	PresignProject(s.store, &dto)
 	return &dto, nil
 }
 
-func (s *Service) Update(id string, input *ProjectUpdate) (*ProjectResponse, error) {
-	project, err := s.repo.FindById(id)
+func (s *Service) Update(id, userID string, input *ProjectUpdate) (*ProjectResponse, error) {
+	project, err := s.repo.FindById(id, userID)
 	if err != nil {
 		return nil, err
 	}
@@ -85,18 +104,33 @@ func (s *Service) Update(id string, input *ProjectUpdate) (*ProjectResponse, err
 	if input.Description != nil {
 		project.Description = *input.Description
 	}
+	if input.Provider != nil {
+		provider, err := helper.ParseSpeechProvider(*input.Provider)
+		if err != nil {
+			return nil, err
+		}
+		project.Provider = provider
+	}
+	if input.VoiceID != nil {
+		voiceID, err := parseVoiceID(*input.VoiceID)
+		if err != nil {
+			return nil, err
+		}
+		project.VoiceID = voiceID
+	}
 
 	if err := s.repo.Update(project); err != nil {
 		return nil, err
 	}
 
-	reloaded, _ := s.repo.FindById(id)
+	reloaded, _ := s.repo.FindById(id, userID)
 	dto := ProjectToDTO(reloaded)
+	PresignProject(s.store, &dto)
 	return &dto, nil
 }
 
-func (s *Service) SoftDelete(id string) (bool, error) {
-	project, err := s.repo.FindById(id)
+func (s *Service) SoftDelete(id, userID string) (bool, error) {
+	project, err := s.repo.FindById(id, userID)
 	if err != nil {
 		return false, err
 	}
@@ -111,8 +145,8 @@ func (s *Service) SoftDelete(id string) (bool, error) {
 	return true, nil
 }
 
-func (s *Service) Restore(id string) (*ProjectResponse, error) {
-	project, err := s.repo.FindByIdUnscoped(id)
+func (s *Service) Restore(id, userID string) (*ProjectResponse, error) {
+	project, err := s.repo.FindByIdUnscoped(id, userID)
 	if err != nil {
 		return nil, err
 	}
@@ -124,5 +158,18 @@ func (s *Service) Restore(id string) (*ProjectResponse, error) {
 		return nil, err
 	}
 	dto := ProjectToDTO(project)
+	PresignProject(s.store, &dto)
 	return &dto, nil
 }
+
+// parseVoiceID convierte el voice_id opcional del body; vacío significa sin voz.
+func parseVoiceID(id string) (*uuid.UUID, error) {
+	if id == "" {
+		return nil, nil
+	}
+	parsed, err := uuid.Parse(id)
+	if err != nil {
+		return nil, errors.New("voice_id inválido")
+	}
+	return &parsed, nil
+}
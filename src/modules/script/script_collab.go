@@ -0,0 +1,191 @@
+package script
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"sync"
+
+	"github.com/MetaDandy/cuent-ai-core/helper"
+	ws "github.com/MetaDandy/cuent-ai-core/src/modules/websocket"
+	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Collab es la sala de edición colaborativa de un script (/ws/scripts/:id).
+// Al entrar el cliente recibe un snapshot; después manda ediciones de líneas
+// que se guardan en los assets y se difunden a toda la sala con su seq, y su
+// cursor, que sólo se difunde.
+type Collab struct {
+	svc      *Service
+	validate *validator.Validate
+
+	mu      sync.Mutex
+	cursors map[string]*Cursor // por client_id
+}
+
+func NewCollab(s *Service, v *validator.Validate) *Collab {
+	return &Collab{svc: s, validate: v, cursors: map[string]*Cursor{}}
+}
+
+// Authorize sólo deja entrar al dueño del script.
+func (r *Collab) Authorize(userID, roomID string) error {
+	if _, err := uuid.Parse(roomID); err != nil {
+		return gorm.ErrRecordNotFound
+	}
+	_, err := r.svc.repo.FindById(roomID, userID)
+	return err
+}
+
+// Join manda el snapshot al cliente y avisa a la sala de su llegada. El
+// snapshot se lee con las ediciones bloqueadas, la seq junto con las líneas:
+// cualquier cambio con una seq menor o igual a la suya ya está incluido y
+// los siguientes le llegan por la sala.
+func (r *Collab) Join(h *ws.Hub, c *ws.Client) {
+	scriptID, err := uuid.Parse(c.RoomID())
+	if err != nil {
+		r.fail(c, 0, gorm.ErrRecordNotFound)
+		return
+	}
+
+	// El bloqueo dura hasta encolar el snapshot, para que ninguna edición
+	// posterior le llegue al cliente antes que él.
+	unlock := r.svc.lockScript(scriptID)
+	msg, err := r.svc.snapshotMessage(scriptID)
+	if err != nil {
+		unlock()
+		r.fail(c, 0, err)
+		return
+	}
+	msg.ClientID = c.ID()
+	msg.UserID = c.UserID()
+	msg.Presence = r.presence(h, c.RoomID())
+	c.SendJSON(msg)
+	unlock()
+
+	r.publishPresence(h, c.RoomID())
+}
+
+// Message procesa una petición del cliente. Los errores sólo le llegan a él.
+func (r *Collab) Message(h *ws.Hub, c *ws.Client, raw []byte) {
+	var req CollabRequest
+	if err := json.Unmarshal(raw, &req); err != nil {
+		r.fail(c, 0, errInvalid(err))
+		return
+	}
+	if err := r.handle(h, c, &req); err != nil {
+		r.fail(c, req.ClientSeq, err)
+	}
+}
+
+func (r *Collab) handle(h *ws.Hub, c *ws.Client, req *CollabRequest) error {
+	if req.Type == CollabCursor {
+		if req.Cursor == nil {
+			return errInvalid(errors.New("falta cursor"))
+		}
+		r.mu.Lock()
+		r.cursors[c.ID()] = req.Cursor
+		r.mu.Unlock()
+		h.PublishJSON(CollabMessage{
+			Type:     CollabCursor,
+			ClientID: c.ID(),
+			UserID:   c.UserID(),
+			Cursor:   req.Cursor,
+		}, c.RoomID())
+		return nil
+	}
+
+	script, err := r.svc.repo.FindById(c.RoomID(), c.UserID())
+	if err != nil {
+		return err
+	}
+	by := editor{
+		userID:    c.UserID(),
+		clientID:  c.ID(),
+		clientSeq: req.ClientSeq,
+		baseSeq:   req.BaseSeq,
+	}
+
+	switch req.Type {
+	case CollabInsert:
+		if req.Line == nil {
+			return errInvalid(errors.New("falta line"))
+		}
+		in := LineInsert{Line: *req.Line, Position: req.Position}
+		if err := r.validate.Struct(&in); err != nil {
+			return errInvalid(err)
+		}
+		return r.svc.insertLine(script, by, &in)
+	case CollabUpdate:
+		if req.Line == nil {
+			return errInvalid(errors.New("falta line"))
+		}
+		if err := r.validate.Struct(req.Line); err != nil {
+			return errInvalid(err)
+		}
+		return r.svc.updateLine(script, by, req.AssetID, req.Line)
+	case CollabDelete:
+		return r.svc.deleteLine(script, by, req.AssetID)
+	case CollabMove:
+		if req.Position == nil || *req.Position < 0 {
+			return errInvalid(errors.New("position debe ser mayor o igual a 0"))
+		}
+		return r.svc.moveLine(script, by, req.AssetID, *req.Position)
+	}
+	return errInvalid(errors.New("tipo de mensaje desconocido"))
+}
+
+// Leave olvida el cursor del cliente y avisa a la sala.
+func (r *Collab) Leave(h *ws.Hub, c *ws.Client) {
+	r.mu.Lock()
+	delete(r.cursors, c.ID())
+	r.mu.Unlock()
+
+	r.publishPresence(h, c.RoomID())
+}
+
+// presence lista los clientes de la sala, también los de otras réplicas,
+// con su último cursor. El cursor de un cliente de otra réplica sólo llega
+// con sus mensajes cursor.
+func (r *Collab) presence(h *ws.Hub, roomID string) []Presence {
+	members := h.Members(roomID)
+	out := make([]Presence, 0, len(members))
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, m := range members {
+		out = append(out, Presence{ClientID: m.ClientID, UserID: m.UserID, Cursor: r.cursors[m.ClientID]})
+	}
+	return out
+}
+
+func (r *Collab) publishPresence(h *ws.Hub, roomID string) {
+	h.PublishJSON(CollabMessage{Type: CollabPresence, Presence: r.presence(h, roomID)}, roomID)
+}
+
+// collabInvalid marca los errores de formato o validación de una petición.
+type collabInvalid struct{ err error }
+
+func (e collabInvalid) Error() string { return e.err.Error() }
+
+func errInvalid(err error) error { return collabInvalid{err} }
+
+// fail le responde al cliente con el código del error.
+func (r *Collab) fail(c *ws.Client, clientSeq int64, err error) {
+	code := "internal"
+	var invalid collabInvalid
+	switch {
+	case errors.As(err, &invalid), errors.Is(err, ErrInvalidVoice):
+		code = "invalid"
+	case helper.IsNotFound(err):
+		code = "not_found"
+	case errors.Is(err, ErrLineConflict):
+		code = "conflict"
+	case errors.Is(err, ErrLineBusy):
+		code = "busy"
+	default:
+		log.Printf("[script] sala %s: %v", c.RoomID(), err)
+	}
+	c.SendJSON(CollabMessage{Type: CollabError, ClientSeq: clientSeq, Code: code, Error: err.Error()})
+}
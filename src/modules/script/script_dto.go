@@ -1,8 +1,10 @@
 package script
 
 import (
+	"context"
 	"time"
 
+	"github.com/MetaDandy/cuent-ai-core/helper"
 	"github.com/MetaDandy/cuent-ai-core/src/model"
 	"github.com/MetaDandy/cuent-ai-core/src/modules/asset"
 )
@@ -13,8 +15,26 @@ type ScriptCreate struct {
 }
 
 type Line struct {
-	Text string          `json:"text" validate:"required"`
-	Type model.AudioLine `json:"type" validate:"required,oneof=TTS SFX"`
+	Text    string          `json:"text" validate:"required"`
+	Type    model.AudioLine `json:"type" validate:"required,oneof=TTS SFX"`
+	Speaker string          `json:"speaker,omitempty"`
+	VoiceID string          `json:"voice_id,omitempty" validate:"omitempty,uuid"`
+	// Duración del SFX y silencio posterior, en segundos.
+	Duration float64 `json:"duration,omitempty" validate:"omitempty,gte=0.5,lte=22"`
+	Pause    float64 `json:"pause,omitempty" validate:"gte=0,lte=10"`
+}
+
+// LineInsert agrega una línea al script en Position; sin Position (o más
+// allá del final) va al final.
+type LineInsert struct {
+	Line
+	Position *int `json:"position" validate:"omitempty,gte=0"`
+}
+
+// LineOrder es el nuevo orden de las líneas: todos los assets del script,
+// cada uno una vez.
+type LineOrder struct {
+	AssetIDs []string `json:"asset_ids" validate:"required,dive,uuid"`
 }
 
 type ScriptManualCreate struct {
@@ -22,6 +42,30 @@ type ScriptManualCreate struct {
 	ProjectID string `json:"project_id" validate:"required,uuid"`
 }
 
+// MixUpdate reemplaza los parámetros de mezcla del script. La música no se
+// fija aquí sino subiéndola a /scripts/:id/music.
+type MixUpdate struct {
+	Gap       float64                        `json:"gap"`
+	Crossfade float64                        `json:"crossfade"`
+	MusicGain *float64                       `json:"music_gain"`
+	Ducking   *bool                          `json:"ducking"`
+	Loudness  *float64                       `json:"loudness"`
+	Tracks    map[string]model.TrackSettings `json:"tracks"`
+}
+
+// RenderVideo configura el video completo del script. Las líneas sin video
+// ni imágenes propias usan las que se encuentren con KeyWords en Source.
+type RenderVideo struct {
+	KeyWords           string  `json:"key_words"`
+	Source             string  `json:"source"`
+	Aspect             string  `json:"aspect"`
+	Resolution         int     `json:"resolution"`
+	Transition         string  `json:"transition"`
+	TransitionDuration float64 `json:"transition_duration"`
+	Subtitles          bool    `json:"subtitles"`
+	SFX                string  `json:"sfx"`
+}
+
 type ScriptUpdate struct {
 	TextEntry *string `json:"text_entry"`
 }
@@ -37,6 +81,11 @@ type ScriptReponse struct {
 	Processed_Text    string `json:"processed_text"`
 	Mixed_Audio       string `json:"mixed_audio"`
 	Mixed_Media       string `json:"mixed_media"`
+	Error             string `json:"error,omitempty"`
+	Version           int    `json:"version"`
+	Seq               int64  `json:"seq"`
+
+	Mix model.MixSettings `json:"mix"`
 
 	Assets []asset.AssetResponse `json:"assets,omitempty"`
 
@@ -71,6 +120,10 @@ func ScriptToDTO(u *model.Script) ScriptReponse {
 		Processed_Text:    u.Processed_Text,
 		Mixed_Audio:       u.Mixed_Audio,
 		Mixed_Media:       u.Mixed_Media,
+		Error:             u.Error,
+		Version:           u.Version,
+		Seq:               u.Seq,
+		Mix:               u.Mix,
 		Assets:            assets,
 
 		CreatedAt: u.CreatedAt,
@@ -86,3 +139,167 @@ func ScriptToListDTO(list []model.Script) []ScriptReponse {
 	}
 	return out
 }
+
+// PresignScript firma la mezcla y los assets del script para esta respuesta.
+func PresignScript(store helper.BlobStore, dto *ScriptReponse) {
+	dto.Mixed_Audio = helper.PresignRef(context.TODO(), store, dto.Mixed_Audio)
+	dto.Mixed_Media = helper.PresignRef(context.TODO(), store, dto.Mixed_Media)
+	dto.Mix.Music = helper.PresignRef(context.TODO(), store, dto.Mix.Music)
+	asset.PresignAssets(store, dto.Assets)
+}
+
+type VersionResponse struct {
+	Number            int                 `json:"number"`
+	Current           bool                `json:"current"`
+	Processed_Text    string              `json:"processed_text"`
+	Prompt_Tokens     uint32              `json:"promt_tokens"`
+	Completion_Tokens uint32              `json:"completion_tokens"`
+	Total_Token       uint32              `json:"total_token"`
+	Cuentoken         uint                `json:"cuentoken"`
+	RestoredFrom      *int                `json:"restored_from,omitempty"`
+	LineCount         int                 `json:"line_count"`
+	Lines             []model.VersionLine `json:"lines,omitempty"`
+
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func VersionToDTO(v *model.ScriptVersion, current int) VersionResponse {
+	return VersionResponse{
+		Number:            v.Number,
+		Current:           v.Number == current,
+		Processed_Text:    v.Processed_Text,
+		Prompt_Tokens:     v.Prompt_Tokens,
+		Completion_Tokens: v.Completion_Tokens,
+		Total_Token:       v.Total_Tokens,
+		Cuentoken:         v.Cuentoken,
+		RestoredFrom:      v.RestoredFrom,
+		LineCount:         len(v.Lines),
+		Lines:             v.Lines,
+		CreatedAt:         v.CreatedAt,
+	}
+}
+
+// VersionDiffLine es una línea del diff; From y To son su posición en cada
+// versión y faltan cuando la línea no está en ella.
+type VersionDiffLine struct {
+	Op   helper.DiffOp     `json:"op"`
+	From *int              `json:"from,omitempty"`
+	To   *int              `json:"to,omitempty"`
+	Line model.VersionLine `json:"line"`
+}
+
+type VersionDiff struct {
+	From      int               `json:"from"`
+	To        int               `json:"to"`
+	Inserted  int               `json:"inserted"`
+	Deleted   int               `json:"deleted"`
+	Unchanged int               `json:"unchanged"`
+	Lines     []VersionDiffLine `json:"lines"`
+}
+
+func VersionDiffToDTO(from, to *model.ScriptVersion, ops []helper.LineDiff) VersionDiff {
+	diff := VersionDiff{
+		From:  from.Number,
+		To:    to.Number,
+		Lines: make([]VersionDiffLine, len(ops)),
+	}
+	for i, op := range ops {
+		l := VersionDiffLine{Op: op.Op}
+		if op.From >= 0 {
+			l.From = &op.From
+			l.Line = from.Lines[op.From]
+		}
+		if op.To >= 0 {
+			l.To = &op.To
+			l.Line = to.Lines[op.To]
+		}
+		switch op.Op {
+		case helper.DiffInsert:
+			diff.Inserted++
+		case helper.DiffDelete:
+			diff.Deleted++
+		default:
+			diff.Unchanged++
+		}
+		diff.Lines[i] = l
+	}
+	return diff
+}
+
+// PresignLines firma el audio, el video y las imágenes de las líneas de una
+// versión.
+func PresignLines(store helper.BlobStore, lines []model.VersionLine) {
+	for i := range lines {
+		presignLine(store, &lines[i])
+	}
+}
+
+func presignLine(store helper.BlobStore, l *model.VersionLine) {
+	l.Audio_URL = helper.PresignRef(context.TODO(), store, l.Audio_URL)
+	l.Video_URL = helper.PresignRef(context.TODO(), store, l.Video_URL)
+	if len(l.Images) > 0 {
+		l.Images = append([]model.AssetImage(nil), l.Images...)
+		helper.PresignImages(store, l.Images)
+	}
+}
+
+// CollabType es el tipo de un mensaje de la sala de edición de un script.
+type CollabType string
+
+const (
+	CollabSnapshot CollabType = "snapshot"
+	CollabInsert   CollabType = "line.insert"
+	CollabUpdate   CollabType = "line.update"
+	CollabDelete   CollabType = "line.delete"
+	CollabMove     CollabType = "line.move"
+	CollabReorder  CollabType = "line.reorder"
+	CollabPresence CollabType = "presence"
+	CollabCursor   CollabType = "cursor"
+	CollabError    CollabType = "error"
+)
+
+// CollabRequest es lo que un cliente manda a la sala. ClientSeq lo numera el
+// cliente y vuelve en la difusión (o en el error) para que reconozca su
+// edición. BaseSeq es la seq de la línea que editó; si ya no coincide la
+// edición se rechaza con conflict.
+type CollabRequest struct {
+	Type      CollabType `json:"type"`
+	ClientSeq int64      `json:"client_seq,omitempty"`
+	BaseSeq   *int64     `json:"base_seq,omitempty"`
+	AssetID   string     `json:"asset_id,omitempty"`
+	Position  *int       `json:"position,omitempty"`
+	Line      *Line      `json:"line,omitempty"`
+	Cursor    *Cursor    `json:"cursor,omitempty"`
+}
+
+// Cursor es dónde está editando un cliente: la línea y el offset en su texto.
+type Cursor struct {
+	AssetID string `json:"asset_id"`
+	Offset  int    `json:"offset"`
+}
+
+// Presence es un cliente conectado a la sala.
+type Presence struct {
+	ClientID string  `json:"client_id"`
+	UserID   string  `json:"user_id"`
+	Cursor   *Cursor `json:"cursor,omitempty"`
+}
+
+// CollabMessage es lo que la sala manda a los clientes. Seq es la secuencia
+// del script tras el cambio: llegan en orden y sin huecos, así que un cliente
+// que ve un salto debe pedir un snapshot reconectándose.
+type CollabMessage struct {
+	Type      CollabType           `json:"type"`
+	Seq       int64                `json:"seq,omitempty"`
+	UserID    string               `json:"user_id,omitempty"`
+	ClientID  string               `json:"client_id,omitempty"`
+	ClientSeq int64                `json:"client_seq,omitempty"`
+	AssetID   string               `json:"asset_id,omitempty"`
+	Asset     *asset.AssetResponse `json:"asset,omitempty"`
+	AssetIDs  []string             `json:"asset_ids,omitempty"`
+	Script    *ScriptReponse       `json:"script,omitempty"`
+	Presence  []Presence           `json:"presence,omitempty"`
+	Cursor    *Cursor              `json:"cursor,omitempty"`
+	Code      string               `json:"code,omitempty"`
+	Error     string               `json:"error,omitempty"`
+}
@@ -1,34 +1,59 @@
 package script
 
 import (
+	"errors"
 	"net/http"
 
 	"github.com/MetaDandy/cuent-ai-core/helper"
 	"github.com/MetaDandy/cuent-ai-core/middleware"
+	"github.com/go-playground/validator/v10"
 	"github.com/gofiber/fiber/v2"
 )
 
 type Handler struct {
-	svc *Service
+	svc      *Service
+	validate *validator.Validate
 }
 
-func NewHandler(s *Service) *Handler {
-	return &Handler{svc: s}
+// NewHandler recibe el validador del paquete validation, que registra las
+// reglas de Line (como el límite de caracteres de TTS); ese paquete importa
+// éste, así que no puede hacerse al revés.
+func NewHandler(s *Service, v *validator.Validate) *Handler {
+	return &Handler{svc: s, validate: v}
 }
 
 func (h *Handler) RegisterRoutes(router fiber.Router) {
 	grp := router.Group("/scripts").Use(middleware.JwtMiddleware())
 	grp.Get("", h.FindAll)
 	grp.Get("/:id", h.FindById)
+	grp.Get("/:id/subtitles", h.Subtitles)
+	grp.Get("/:id/versions", h.Versions)
+	grp.Get("/:id/versions/diff", h.DiffVersions)
+	grp.Get("/:id/versions/:v", h.Version)
+	grp.Post("/:id/versions/:v/restore", h.RestoreVersion)
 	grp.Post("", h.Create)
 	grp.Post("/manual-create", h.ManualCreate)
 	grp.Post("/:id/mixed", h.MixAudio)
+	grp.Post("/:id/render-video", h.RenderVideo)
+	grp.Put("/:id/mix", h.UpdateMix)
+	grp.Put("/:id/music", h.SetMusic)
+	grp.Delete("/:id/music", h.RemoveMusic)
 	grp.Patch("/:id/regenerate", h.Regenerate)
+	grp.Post("/:id/lines", h.InsertLine)
+	grp.Put("/:id/lines/order", h.ReorderLines)
+	grp.Put("/:id/lines/:assetId", h.UpdateLine)
+	grp.Delete("/:id/lines/:assetId", h.DeleteLine)
 }
 
 func (h *Handler) FindAll(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(string)
+	if !ok || userID == "" {
+		return helper.JSONError(c, http.StatusUnauthorized,
+			"Token sin user_id", "")
+	}
+
 	opts := helper.NewFindAllOptionsFromQuery(c)
-	project, err := h.svc.FindAll(opts)
+	project, err := h.svc.FindAll(userID, opts)
 	if err != nil {
 		return helper.JSONError(c, http.StatusInternalServerError,
 			"Error obteniendo scripts", err.Error())
@@ -37,7 +62,17 @@ func (h *Handler) FindAll(c *fiber.Ctx) error {
 }
 
 func (h *Handler) FindById(c *fiber.Ctx) error {
-	dto, err := h.svc.FindByID(c.Params("id"))
+	userID, ok := c.Locals("user_id").(string)
+	if !ok || userID == "" {
+		return helper.JSONError(c, http.StatusUnauthorized,
+			"Token sin user_id", "")
+	}
+
+	dto, err := h.svc.FindByID(c.Params("id"), userID)
+	if helper.IsNotFound(err) {
+		return helper.JSONError(c, http.StatusNotFound,
+			"Script no encontrado")
+	}
 	if err != nil {
 		return helper.JSONError(c, http.StatusInternalServerError,
 			"Error obteniendo script", err.Error())
@@ -67,7 +102,15 @@ func (h *Handler) Create(c *fiber.Ctx) error {
 	}
 
 	project, err := h.svc.Create(id, &input)
+	if helper.IsNotFound(err) {
+		return helper.JSONError(c, http.StatusNotFound,
+			"Proyecto no encontrado")
+	}
 	if err != nil {
+		if project != nil {
+			return helper.JSONError(c, http.StatusUnprocessableEntity,
+				err.Error(), project)
+		}
 		return helper.JSONError(c, http.StatusInternalServerError,
 			"Error creando script", err.Error())
 	}
@@ -78,13 +121,23 @@ func (h *Handler) Create(c *fiber.Ctx) error {
 }
 
 func (h *Handler) ManualCreate(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(string)
+	if !ok || userID == "" {
+		return helper.JSONError(c, http.StatusUnauthorized,
+			"Token sin user_id", "")
+	}
+
 	var input ScriptManualCreate
 	if err := c.BodyParser(&input); err != nil {
 		return helper.JSONError(c, fiber.StatusBadRequest,
 			"Input inválido", err.Error())
 	}
 
-	script, err := h.svc.ManualCreate(&input)
+	script, err := h.svc.ManualCreate(userID, &input)
+	if helper.IsNotFound(err) {
+		return helper.JSONError(c, http.StatusNotFound,
+			"Proyecto no encontrado")
+	}
 	if err != nil {
 		return helper.JSONError(c, fiber.StatusInternalServerError,
 			"Error creando script", err.Error())
@@ -104,7 +157,19 @@ func (h *Handler) Regenerate(c *fiber.Ctx) error {
 	}
 
 	project, err := h.svc.Regenerate(id, c.Params("id"))
+	if helper.IsNotFound(err) {
+		return helper.JSONError(c, http.StatusNotFound,
+			"Script no encontrado")
+	}
+	if errors.Is(err, ErrLineBusy) {
+		return helper.JSONError(c, http.StatusConflict,
+			"Línea ocupada", err.Error())
+	}
 	if err != nil {
+		if project != nil {
+			return helper.JSONError(c, http.StatusUnprocessableEntity,
+				err.Error(), project)
+		}
 		return helper.JSONError(c, http.StatusInternalServerError,
 			"Error creando script", err.Error())
 	}
@@ -114,6 +179,178 @@ func (h *Handler) Regenerate(c *fiber.Ctx) error {
 	})
 }
 
+// Subtitles devuelve los subtítulos del script como archivo: ?format=srt|vtt
+// y ?sfx=skip|bracket para omitir o mostrar entre corchetes los efectos.
+func (h *Handler) Subtitles(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(string)
+	if !ok || userID == "" {
+		return helper.JSONError(c, http.StatusUnauthorized,
+			"Token sin user_id", "")
+	}
+
+	format, err := helper.ParseSubtitleFormat(c.Query("format"))
+	if err != nil {
+		return helper.JSONError(c, http.StatusBadRequest,
+			"Input inválido", err.Error())
+	}
+	sfx, err := helper.ParseSFXMode(c.Query("sfx"))
+	if err != nil {
+		return helper.JSONError(c, http.StatusBadRequest,
+			"Input inválido", err.Error())
+	}
+
+	subs, err := h.svc.Subtitles(c.Params("id"), userID, format, sfx)
+	if helper.IsNotFound(err) {
+		return helper.JSONError(c, http.StatusNotFound,
+			"Script no encontrado")
+	}
+	if errors.Is(err, helper.ErrNoDuration) {
+		return helper.JSONError(c, http.StatusConflict,
+			"El script aún no tiene audio", err.Error())
+	}
+	if err != nil {
+		return helper.JSONError(c, http.StatusInternalServerError,
+			"Error generando los subtítulos", err.Error())
+	}
+
+	contentType := "application/x-subrip; charset=utf-8"
+	if format == helper.SubtitleVTT {
+		contentType = "text/vtt; charset=utf-8"
+	}
+	c.Attachment(c.Params("id") + "." + string(format))
+	c.Set(fiber.HeaderContentType, contentType)
+	return c.SendString(subs)
+}
+
+func (h *Handler) UpdateMix(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(string)
+	if !ok || userID == "" {
+		return helper.JSONError(c, http.StatusUnauthorized,
+			"Token sin user_id", "")
+	}
+
+	var input MixUpdate
+	if err := c.BodyParser(&input); err != nil {
+		return helper.JSONError(c, http.StatusBadRequest,
+			"Input inválido", err.Error())
+	}
+
+	dto, err := h.svc.UpdateMix(c.Params("id"), userID, &input)
+	if helper.IsNotFound(err) {
+		return helper.JSONError(c, http.StatusNotFound,
+			"Script no encontrado")
+	}
+	if err != nil {
+		return helper.JSONError(c, http.StatusBadRequest,
+			"Error guardando la mezcla", err.Error())
+	}
+
+	return c.JSON(helper.Response{
+		Data:    dto,
+		Message: "Parámetros de mezcla guardados",
+	})
+}
+
+// SetMusic recibe la música de fondo como multipart en el campo "file".
+func (h *Handler) SetMusic(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(string)
+	if !ok || userID == "" {
+		return helper.JSONError(c, http.StatusUnauthorized,
+			"Token sin user_id", "")
+	}
+
+	file, err := c.FormFile("file")
+	if err != nil {
+		return helper.JSONError(c, http.StatusBadRequest,
+			"Falta el archivo de música", err.Error())
+	}
+	body, err := file.Open()
+	if err != nil {
+		return helper.JSONError(c, http.StatusBadRequest,
+			"Archivo inválido", err.Error())
+	}
+	defer body.Close()
+
+	dto, err := h.svc.SetMusic(c.Params("id"), userID, body, file.Filename, file.Header.Get("Content-Type"))
+	if helper.IsNotFound(err) {
+		return helper.JSONError(c, http.StatusNotFound,
+			"Script no encontrado")
+	}
+	if errors.Is(err, ErrInvalidMusic) {
+		return helper.JSONError(c, http.StatusBadRequest,
+			"Archivo inválido", err.Error())
+	}
+	if err != nil {
+		return helper.JSONError(c, http.StatusInternalServerError,
+			"Error subiendo la música", err.Error())
+	}
+
+	return c.JSON(helper.Response{
+		Data:    dto,
+		Message: "Música de fondo guardada",
+	})
+}
+
+func (h *Handler) RemoveMusic(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(string)
+	if !ok || userID == "" {
+		return helper.JSONError(c, http.StatusUnauthorized,
+			"Token sin user_id", "")
+	}
+
+	dto, err := h.svc.RemoveMusic(c.Params("id"), userID)
+	if helper.IsNotFound(err) {
+		return helper.JSONError(c, http.StatusNotFound,
+			"Script no encontrado")
+	}
+	if err != nil {
+		return helper.JSONError(c, http.StatusInternalServerError,
+			"Error quitando la música", err.Error())
+	}
+
+	return c.JSON(helper.Response{
+		Data:    dto,
+		Message: "Música de fondo eliminada",
+	})
+}
+
+func (h *Handler) RenderVideo(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(string)
+	if !ok || userID == "" {
+		return helper.JSONError(c, http.StatusUnauthorized,
+			"Token sin user_id", "")
+	}
+
+	var input RenderVideo
+	if err := c.BodyParser(&input); err != nil {
+		return helper.JSONError(c, http.StatusBadRequest,
+			"Input inválido", err.Error())
+	}
+
+	dto, err := h.svc.RenderVideo(c.Params("id"), userID, &input)
+	if helper.IsNotFound(err) {
+		return helper.JSONError(c, http.StatusNotFound,
+			"Script no encontrado")
+	}
+	if errors.Is(err, helper.ErrRenderOptions) || errors.Is(err, ErrNoVisual) || errors.Is(err, helper.ErrImageSource) {
+		return helper.JSONError(c, http.StatusBadRequest,
+			"Input inválido", err.Error())
+	}
+	if errors.Is(err, ErrNotMixed) || errors.Is(err, helper.ErrNoDuration) {
+		return helper.JSONError(c, http.StatusConflict,
+			"El script aún no está listo para el video", err.Error())
+	}
+	if err != nil {
+		return helper.JSONError(c, http.StatusInternalServerError,
+			"Error generando el video del script", err.Error())
+	}
+
+	return c.JSON(helper.Response{
+		Data:    dto,
+		Message: "Video del script generado",
+	})
+}
+
 func (h *Handler) MixAudio(c *fiber.Ctx) error {
 	id, ok := c.Locals("user_id").(string)
 	if !ok || id == "" {
@@ -122,6 +359,14 @@ func (h *Handler) MixAudio(c *fiber.Ctx) error {
 	}
 
 	dto, err := h.svc.MixAudio(c.Params("id"), id)
+	if helper.IsNotFound(err) {
+		return helper.JSONError(c, http.StatusNotFound,
+			"Script no encontrado")
+	}
+	if errors.Is(err, ErrNotGenerated) {
+		return helper.JSONError(c, http.StatusConflict,
+			"El script aún no está listo para mezclar", err.Error())
+	}
 	if err != nil {
 		return helper.JSONError(c, http.StatusInternalServerError,
 			"Error al mixear assets", err.Error())
@@ -136,3 +381,240 @@ func (h *Handler) MixAudio(c *fiber.Ctx) error {
 		Message: "Mixeo de audio de assets generado",
 	})
 }
+
+func (h *Handler) Versions(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(string)
+	if !ok || userID == "" {
+		return helper.JSONError(c, http.StatusUnauthorized,
+			"Token sin user_id", "")
+	}
+
+	versions, err := h.svc.Versions(c.Params("id"), userID)
+	if helper.IsNotFound(err) {
+		return helper.JSONError(c, http.StatusNotFound,
+			"Script no encontrado")
+	}
+	if err != nil {
+		return helper.JSONError(c, http.StatusInternalServerError,
+			"Error obteniendo las versiones", err.Error())
+	}
+
+	return c.JSON(helper.Response{
+		Data:    versions,
+		Message: "Versiones obtenidas",
+	})
+}
+
+func (h *Handler) Version(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(string)
+	if !ok || userID == "" {
+		return helper.JSONError(c, http.StatusUnauthorized,
+			"Token sin user_id", "")
+	}
+
+	number, err := c.ParamsInt("v")
+	if err != nil {
+		return helper.JSONError(c, http.StatusBadRequest,
+			"Versión inválida", err.Error())
+	}
+
+	version, err := h.svc.Version(c.Params("id"), userID, number)
+	if helper.IsNotFound(err) {
+		return helper.JSONError(c, http.StatusNotFound,
+			"Versión no encontrada")
+	}
+	if err != nil {
+		return helper.JSONError(c, http.StatusInternalServerError,
+			"Error obteniendo la versión", err.Error())
+	}
+
+	return c.JSON(helper.Response{
+		Data:    version,
+		Message: "Versión obtenida",
+	})
+}
+
+// DiffVersions compara dos versiones: ?from=&to=. Sin to compara con la
+// actual y sin from con la anterior a to.
+func (h *Handler) DiffVersions(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(string)
+	if !ok || userID == "" {
+		return helper.JSONError(c, http.StatusUnauthorized,
+			"Token sin user_id", "")
+	}
+
+	diff, err := h.svc.DiffVersions(c.Params("id"), userID, c.QueryInt("from"), c.QueryInt("to"))
+	if helper.IsNotFound(err) {
+		return helper.JSONError(c, http.StatusNotFound,
+			"Versión no encontrada")
+	}
+	if errors.Is(err, ErrVersionRange) {
+		return helper.JSONError(c, http.StatusBadRequest,
+			"Versión inválida", err.Error())
+	}
+	if err != nil {
+		return helper.JSONError(c, http.StatusInternalServerError,
+			"Error comparando las versiones", err.Error())
+	}
+
+	return c.JSON(helper.Response{
+		Data:    diff,
+		Message: "Diferencias entre versiones",
+	})
+}
+
+func (h *Handler) RestoreVersion(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(string)
+	if !ok || userID == "" {
+		return helper.JSONError(c, http.StatusUnauthorized,
+			"Token sin user_id", "")
+	}
+
+	number, err := c.ParamsInt("v")
+	if err != nil {
+		return helper.JSONError(c, http.StatusBadRequest,
+			"Versión inválida", err.Error())
+	}
+
+	dto, err := h.svc.RestoreVersion(c.Params("id"), userID, number)
+	if helper.IsNotFound(err) {
+		return helper.JSONError(c, http.StatusNotFound,
+			"Versión no encontrada")
+	}
+	if errors.Is(err, ErrCurrentVersion) {
+		return helper.JSONError(c, http.StatusConflict,
+			"Versión inválida", err.Error())
+	}
+	if errors.Is(err, ErrLineBusy) {
+		return helper.JSONError(c, http.StatusConflict,
+			"Línea ocupada", err.Error())
+	}
+	if err != nil {
+		return helper.JSONError(c, http.StatusInternalServerError,
+			"Error restaurando la versión", err.Error())
+	}
+
+	return c.JSON(helper.Response{
+		Data:    dto,
+		Message: "Versión restaurada",
+	})
+}
+
+// lineError traduce los errores de edición de líneas.
+func lineError(c *fiber.Ctx, err error) error {
+	switch {
+	case helper.IsNotFound(err):
+		return helper.JSONError(c, http.StatusNotFound,
+			"Línea no encontrada")
+	case errors.Is(err, ErrInvalidVoice), errors.Is(err, ErrLineOrder):
+		return helper.JSONError(c, http.StatusBadRequest,
+			"Input inválido", err.Error())
+	case errors.Is(err, ErrLineBusy):
+		return helper.JSONError(c, http.StatusConflict,
+			"Línea ocupada", err.Error())
+	}
+	return helper.JSONError(c, http.StatusInternalServerError,
+		"Error editando las líneas", err.Error())
+}
+
+func (h *Handler) InsertLine(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(string)
+	if !ok || userID == "" {
+		return helper.JSONError(c, http.StatusUnauthorized,
+			"Token sin user_id", "")
+	}
+
+	var input LineInsert
+	if err := c.BodyParser(&input); err != nil {
+		return helper.JSONError(c, http.StatusBadRequest,
+			"Input inválido", err.Error())
+	}
+	if err := h.validate.Struct(&input); err != nil {
+		return helper.JSONError(c, http.StatusBadRequest,
+			"Input inválido", err.Error())
+	}
+
+	dto, err := h.svc.InsertLine(c.Params("id"), userID, &input)
+	if err != nil {
+		return lineError(c, err)
+	}
+
+	return c.Status(http.StatusCreated).JSON(helper.Response{
+		Data:    dto,
+		Message: "Línea agregada",
+	})
+}
+
+func (h *Handler) UpdateLine(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(string)
+	if !ok || userID == "" {
+		return helper.JSONError(c, http.StatusUnauthorized,
+			"Token sin user_id", "")
+	}
+
+	var input Line
+	if err := c.BodyParser(&input); err != nil {
+		return helper.JSONError(c, http.StatusBadRequest,
+			"Input inválido", err.Error())
+	}
+	if err := h.validate.Struct(&input); err != nil {
+		return helper.JSONError(c, http.StatusBadRequest,
+			"Input inválido", err.Error())
+	}
+
+	dto, err := h.svc.UpdateLine(c.Params("id"), c.Params("assetId"), userID, &input)
+	if err != nil {
+		return lineError(c, err)
+	}
+
+	return c.JSON(helper.Response{
+		Data:    dto,
+		Message: "Línea actualizada",
+	})
+}
+
+func (h *Handler) DeleteLine(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(string)
+	if !ok || userID == "" {
+		return helper.JSONError(c, http.StatusUnauthorized,
+			"Token sin user_id", "")
+	}
+
+	dto, err := h.svc.DeleteLine(c.Params("id"), c.Params("assetId"), userID)
+	if err != nil {
+		return lineError(c, err)
+	}
+
+	return c.JSON(helper.Response{
+		Data:    dto,
+		Message: "Línea eliminada",
+	})
+}
+
+func (h *Handler) ReorderLines(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(string)
+	if !ok || userID == "" {
+		return helper.JSONError(c, http.StatusUnauthorized,
+			"Token sin user_id", "")
+	}
+
+	var input LineOrder
+	if err := c.BodyParser(&input); err != nil {
+		return helper.JSONError(c, http.StatusBadRequest,
+			"Input inválido", err.Error())
+	}
+	if err := h.validate.Struct(&input); err != nil {
+		return helper.JSONError(c, http.StatusBadRequest,
+			"Input inválido", err.Error())
+	}
+
+	dto, err := h.svc.ReorderLines(c.Params("id"), userID, &input)
+	if err != nil {
+		return lineError(c, err)
+	}
+
+	return c.JSON(helper.Response{
+		Data:    dto,
+		Message: "Líneas reordenadas",
+	})
+}
@@ -3,7 +3,9 @@ package script
 import (
 	"github.com/MetaDandy/cuent-ai-core/helper"
 	"github.com/MetaDandy/cuent-ai-core/src/model"
+	"github.com/google/uuid"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type Repository struct {
@@ -18,13 +20,20 @@ func (r *Repository) Create(script *model.Script) error {
 	return r.db.Create(script).Error
 }
 
+// Update guarda el script salvo Seq, que sólo avanza con las ediciones de
+// líneas.
 func (r *Repository) Update(script *model.Script) error {
-	return r.db.Save(script).Error
+	return r.db.Omit("seq").Save(script).Error
 }
 
-func (r *Repository) FindAll(opts *helper.FindAllOptions) ([]model.Script, int64, error) {
+// UpdateMix guarda sólo los parámetros de mezcla del script.
+func (r *Repository) UpdateMix(script *model.Script) error {
+	return r.db.Model(script).Select("Mix").Updates(script).Error
+}
+
+func (r *Repository) FindAll(userID string, opts *helper.FindAllOptions) ([]model.Script, int64, error) {
 	var finded []model.Script
-	query := r.db.Model(model.Script{})
+	query := r.db.Model(model.Script{}).Scopes(helper.OwnedScripts(userID))
 	var total int64
 	query, total = helper.ApplyFindAllOptions(query, opts)
 
@@ -32,18 +41,19 @@ func (r *Repository) FindAll(opts *helper.FindAllOptions) ([]model.Script, int64
 	return finded, total, err
 }
 
-func (r *Repository) FindById(id string) (*model.Script, error) {
+func (r *Repository) FindById(id, userID string) (*model.Script, error) {
 	var script model.Script
-	err := r.db.First(&script, "id = ?", id).Error
+	err := r.db.Scopes(helper.OwnedScripts(userID)).First(&script, "id = ?", id).Error
 	if err != nil {
 		return nil, err
 	}
 	return &script, nil
 }
 
-func (r *Repository) FindByIdWithAssets(id string) (*model.Script, error) {
+func (r *Repository) FindByIdWithAssets(id, userID string) (*model.Script, error) {
 	var script model.Script
-	err := r.db.Preload("Assets").First(&script, "id = ?", id).Error
+	err := r.db.Scopes(helper.OwnedScripts(userID)).
+		Preload("Assets").First(&script, "id = ?", id).Error
 	if err != nil {
 		return nil, err
 	}
@@ -59,6 +69,108 @@ func (r *Repository) FindByIDWithAssetsPosition(scriptID string) ([]model.Asset,
 	return assets, err
 }
 
+// EditLines aplica fn a los assets del script, en orden, dentro de una
+// transacción con el script bloqueado para que dos ediciones no se pisen. fn
+// recibe la secuencia que le toca a la edición y la lista que devuelve es el
+// nuevo orden: Position se reescribe 0..n-1 en los que cambian. Devuelve la
+// secuencia usada.
+func (r *Repository) EditLines(scriptID uuid.UUID, fn func(tx *gorm.DB, seq int64, assets []model.Asset) ([]model.Asset, error)) (int64, error) {
+	var seq int64
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if seq, err = nextSeq(tx, scriptID); err != nil {
+			return err
+		}
+
+		assets, err := findLines(tx, scriptID)
+		if err != nil {
+			return err
+		}
+
+		assets, err = fn(tx, seq, assets)
+		if err != nil {
+			return err
+		}
+		for i := range assets {
+			if assets[i].Position == i {
+				continue
+			}
+			assets[i].Position = i
+			if err := tx.Model(&assets[i]).Update("position", i).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return seq, err
+}
+
+// Snapshot lee el script con sus líneas en orden en una sola transacción.
+// El script se bloquea para lectura, así que ninguna edición, tampoco de
+// otra réplica, puede avanzar la secuencia entre una lectura y la otra: las
+// líneas son exactamente las de esa seq.
+func (r *Repository) Snapshot(scriptID uuid.UUID) (*model.Script, error) {
+	var script model.Script
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "SHARE"}).
+			First(&script, "id = ?", scriptID).Error; err != nil {
+			return err
+		}
+		var err error
+		script.Assets, err = findLines(tx, scriptID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &script, nil
+}
+
+// findLines devuelve los assets vigentes del script en orden.
+func findLines(tx *gorm.DB, scriptID uuid.UUID) ([]model.Asset, error) {
+	var assets []model.Asset
+	err := tx.
+		Where("script_id = ?", scriptID).
+		Order("position").
+		Find(&assets).Error
+	return assets, err
+}
+
+// nextSeq bloquea el script hasta el final de la transacción y avanza su
+// secuencia de edición.
+func nextSeq(tx *gorm.DB, scriptID uuid.UUID) (int64, error) {
+	var script model.Script
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Select("id", "seq").
+		First(&script, "id = ?", scriptID).Error; err != nil {
+		return 0, err
+	}
+	script.Seq++
+	return script.Seq, tx.Model(&script).UpdateColumn("seq", script.Seq).Error
+}
+
+// FindVersions devuelve las versiones del script, de la más nueva a la más
+// vieja.
+func (r *Repository) FindVersions(scriptID string) ([]model.ScriptVersion, error) {
+	var versions []model.ScriptVersion
+	err := r.db.
+		Where("script_id = ?", scriptID).
+		Order("number DESC").
+		Find(&versions).Error
+	return versions, err
+}
+
+func (r *Repository) FindVersion(scriptID string, number int) (*model.ScriptVersion, error) {
+	var version model.ScriptVersion
+	err := r.db.
+		Where("script_id = ? AND number = ?", scriptID, number).
+		First(&version).Error
+	if err != nil {
+		return nil, err
+	}
+	return &version, nil
+}
+
 func (r *Repository) FindByIdUnscoped(id string) (*model.Script, error) {
 	var script model.Script
 	err := r.db.Unscoped().First(&script, "id = ?", id).Error
@@ -1,18 +1,26 @@
 package script
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"log"
+	"path"
 	"path/filepath"
+	"slices"
+	"sort"
 	"strings"
+	"sync"
 
 	"github.com/MetaDandy/cuent-ai-core/helper"
 	"github.com/MetaDandy/cuent-ai-core/src/core/user"
 	"github.com/MetaDandy/cuent-ai-core/src/model"
 	"github.com/MetaDandy/cuent-ai-core/src/modules/asset"
+	"github.com/MetaDandy/cuent-ai-core/src/modules/character"
 	"github.com/MetaDandy/cuent-ai-core/src/modules/project"
+	ws "github.com/MetaDandy/cuent-ai-core/src/modules/websocket"
 	"github.com/google/uuid"
 	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
@@ -23,48 +31,65 @@ type Service struct {
 	projectRepo project.Repository
 	assetRepo   *asset.Repository
 	userRepo    *user.Repository
+	charRepo    *character.Repository
+	store       helper.BlobStore
+	images      helper.ImageProviders
+	hub         *ws.Hub
+
+	locks [32]sync.Mutex
 }
 
-func NewService(r *Repository, pr project.Repository, ar *asset.Repository, ur *user.Repository) *Service {
-	return &Service{repo: r, projectRepo: pr, assetRepo: ar, userRepo: ur}
+func NewService(r *Repository, pr project.Repository, ar *asset.Repository, ur *user.Repository, cr *character.Repository, store helper.BlobStore, images helper.ImageProviders, hub *ws.Hub) *Service {
+	return &Service{repo: r, projectRepo: pr, assetRepo: ar, userRepo: ur, charRepo: cr, store: store, images: images, hub: hub}
 }
 
 func (s *Service) Create(userID string, input *ScriptCreate) (*ScriptReponse, error) {
-	project, err := s.projectRepo.FindById(input.ProjectID)
+	project, err := s.projectRepo.FindById(input.ProjectID, userID)
 	if err != nil {
 		return nil, err
 	}
 
-	var script model.Script
-	if err := s.repo.db.Transaction(func(tx *gorm.DB) error {
-		sub, err := s.userRepo.GetActiveSubscription(userID)
-		if err != nil {
-			return err
-		}
-		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
-			Where("id = ?", sub.ID).
-			Take(&sub).Error; err != nil {
-			return err
-		}
+	scriptID := uuid.New()
+	res, err := s.userRepo.Reserve(userID, helper.EstimateCuentokens(input.TextEntry), model.TokenLedger{
+		Reason:   model.LedgerScriptCreate,
+		ScriptID: &scriptID,
+	})
+	if err != nil {
+		return nil, err
+	}
 
-		needed := helper.EstimateCuentokens(input.TextEntry)
-		if sub.TokensRemaining < needed {
-			return fmt.Errorf(
-				"fondos insuficientes: se necesitan aprox. %d cuentokens, tienes %d",
-				needed, sub.TokensRemaining,
-			)
-		}
+	speakers, err := s.speakers(project.ID, userID)
+	if err != nil {
+		return nil, s.release(res, err)
+	}
 
-		aiResponse, err := helper.AIFormatter(input.TextEntry)
-		if err != nil {
-			return err
+	aiResponse, err := helper.AIFormatter(input.TextEntry, speakers)
+	if err != nil {
+		formatErr := s.release(res, err)
+
+		// El texto se guarda igual, en ERROR, para que el usuario vea el
+		// motivo y pueda regenerarlo.
+		script := model.Script{
+			ID:         scriptID,
+			Text_Entry: input.TextEntry,
+			ProjectID:  project.ID,
+			State:      model.StateError,
+			Error:      err.Error(),
 		}
+		if err := s.repo.Create(&script); err != nil {
+			return nil, errors.Join(formatErr, err)
+		}
+		dto := ScriptToDTO(&script)
+		PresignScript(s.store, &dto)
+		return &dto, formatErr
+	}
 
-		// Cobrar 1 cuentoken por linea
-		lines := len(aiResponse.Processed_Text_Array)
+	// Cobrar 1 cuentoken por linea
+	lines := len(aiResponse.Lines)
 
-		script = model.Script{
-			ID:                uuid.New(),
+	if err := s.repo.db.Transaction(func(tx *gorm.DB) error {
+		script := model.Script{
+			ID:                scriptID,
 			Text_Entry:        input.TextEntry,
 			ProjectID:         project.ID,
 			Prompt_Tokens:     aiResponse.Prompt_Tokens,
@@ -78,49 +103,27 @@ func (s *Service) Create(userID string, input *ScriptCreate) (*ScriptReponse, er
 			return err
 		}
 
-		if sub.TokensRemaining < uint(lines) {
-			sub.TokensRemaining = 0
-		} else {
-			sub.TokensRemaining = sub.TokensRemaining - uint(lines)
-		}
-
-		if err := tx.Save(sub).Error; err != nil {
+		assets := formattedAssets(script.ID, aiResponse.Lines)
+		if err := createAssets(tx, project.ID, assets); err != nil {
 			return err
 		}
-
-		assets := make([]model.Asset, 0, lines)
-		for i, line := range aiResponse.Processed_Text_Array {
-			var typeAudio string
-			if strings.HasPrefix(line, "*") {
-				typeAudio = string(model.AudioSFX)
-			} else {
-				typeAudio = string(model.AudioTTS)
-			}
-
-			assets = append(assets, model.Asset{
-				ID:       uuid.New(),
-				Type:     model.AudioLine(typeAudio), // ! Hacer que sea un enum entre tts y sfx
-				Line:     line,
-				ScriptID: script.ID,
-				Position: i,
-			})
-		}
-		if err := tx.Create(&assets).Error; err != nil {
+		if err := addVersion(tx, &script, assets, uint(lines), nil); err != nil {
 			return err
 		}
 
-		return nil
+		return s.userRepo.Capture(tx, res, uint(lines))
 	}); err != nil {
-		return nil, err
+		return nil, s.release(res, err)
 	}
 
-	reload, _ := s.repo.FindByIdWithAssets(script.ID.String())
+	reload, _ := s.repo.FindByIdWithAssets(scriptID.String(), userID)
 	dto := ScriptToDTO(reload)
+	PresignScript(s.store, &dto)
 	return &dto, nil
 }
 
-func (s *Service) ManualCreate(manual *ScriptManualCreate) (*ScriptReponse, error) {
-	project, err := s.projectRepo.FindById(manual.ProjectID)
+func (s *Service) ManualCreate(userID string, manual *ScriptManualCreate) (*ScriptReponse, error) {
+	project, err := s.projectRepo.FindById(manual.ProjectID, userID)
 	if err != nil {
 		return nil, err
 	}
@@ -148,117 +151,913 @@ func (s *Service) ManualCreate(manual *ScriptManualCreate) (*ScriptReponse, erro
 
 		assets := make([]model.Asset, 0, len(manual.Lines))
 		for i, line := range manual.Lines {
-			assets = append(assets, model.Asset{
+			a := model.Asset{
 				ID:       uuid.New(),
-				Type:     line.Type,
-				Line:     line.Text,
 				ScriptID: script.ID,
 				Position: i,
-			})
+			}
+			if err := applyLine(&a, &line); err != nil {
+				return fmt.Errorf("voice_id inválido en la línea %d", i)
+			}
+			assets = append(assets, a)
 		}
-		if err := tx.Create(&assets).Error; err != nil {
+
+		if err := createAssets(tx, project.ID, assets); err != nil {
 			return err
 		}
-
-		return nil
+		return addVersion(tx, &script, assets, 0, nil)
 	}); err != nil {
 		return nil, err
 	}
 
-	reload, _ := s.repo.FindByIdWithAssets(script.ID.String())
+	reload, _ := s.repo.FindByIdWithAssets(script.ID.String(), userID)
 	dto := ScriptToDTO(reload)
+	PresignScript(s.store, &dto)
 	return &dto, nil
 }
 
 func (s *Service) Regenerate(userID, scriptID string) (*ScriptReponse, error) {
-	script, err := s.repo.FindById(scriptID)
+	script, err := s.repo.FindById(scriptID, userID)
 	if err != nil {
 		return nil, err
 	}
+	// Se rechaza antes de llamar a la IA para no cobrarla; dentro de la
+	// transacción se vuelve a comprobar con el script bloqueado.
+	assets, err := s.repo.FindByIDWithAssetsPosition(scriptID)
+	if err != nil {
+		return nil, err
+	}
+	if err := linesIdle(assets); err != nil {
+		return nil, err
+	}
 
+	res, err := s.userRepo.Reserve(userID, helper.EstimateCuentokens(script.Text_Entry), model.TokenLedger{
+		Reason:   model.LedgerScriptRegenerate,
+		ScriptID: &script.ID,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	speakers, err := s.speakers(script.ProjectID, userID)
+	if err != nil {
+		return nil, s.release(res, err)
+	}
+
+	aiResponse, err := helper.AIFormatter(script.Text_Entry, speakers)
+	if err != nil {
+		formatErr := s.release(res, err)
+
+		// Los assets anteriores siguen intactos; sólo se marca el fallo.
+		script.State = model.StateError
+		script.Error = err.Error()
+		if err := s.repo.Update(script); err != nil {
+			return nil, errors.Join(formatErr, err)
+		}
+		dto := ScriptToDTO(script)
+		PresignScript(s.store, &dto)
+		return &dto, formatErr
+	}
+
+	// Las líneas que no cambian conservan su asset, con su audio, y las que
+	// sobran sólo se borran de la versión actual: las anteriores las siguen
+	// teniendo. Sólo se cobran las líneas nuevas.
+	unlock := s.lockScript(script.ID)
+	defer unlock()
 	if err := s.repo.db.Transaction(func(tx *gorm.DB) error {
-		sub, err := s.userRepo.GetActiveSubscription(userID)
+		// Las líneas se leen con el script ya bloqueado para no perder una
+		// edición que llegue mientras tanto.
+		if script.Seq, err = nextSeq(tx, script.ID); err != nil {
+			return err
+		}
+		current, err := findLines(tx, script.ID)
 		if err != nil {
 			return err
 		}
-		tx.Clauses(clause.Locking{Strength: "UPDATE"}).
-			First(&sub, "id = ?", sub.ID)
-
-		needed := 2 * helper.EstimateCuentokens(script.Text_Entry)
-		if sub.TokensRemaining < needed {
-			return fmt.Errorf(
-				"fondos insuficientes: se necesitan aprox. %d cuentokens, tienes %d",
-				needed, sub.TokensRemaining,
-			)
+		if err := linesIdle(current); err != nil {
+			return err
 		}
-
-		aiResponse, err := helper.AIFormatter(script.Text_Entry)
-		if err != nil {
+		if err := snapshot(tx, script, current); err != nil {
 			return err
 		}
 
-		lines := 2 * len(aiResponse.Processed_Text_Array)
+		kept, fresh, stale := reuseAssets(script.ID, current, aiResponse.Lines)
+		lines := uint(len(fresh))
+		for i := range fresh {
+			fresh[i].Seq = script.Seq
+		}
+		if err := deleteAssets(tx, stale); err != nil {
+			return err
+		}
+		for i := range kept {
+			if err := tx.Model(&kept[i]).Select("Position", "Pause").Updates(&kept[i]).Error; err != nil {
+				return err
+			}
+		}
+		if err := createAssets(tx, script.ProjectID, fresh); err != nil {
+			return err
+		}
 
+		script.State = model.StateFinished
+		script.Error = ""
 		script.Prompt_Tokens = aiResponse.Prompt_Tokens
 		script.Completion_Tokens = aiResponse.Completion_Tokens
 		script.Total_Tokens = aiResponse.Total_Tokens
 		script.Processed_Text = aiResponse.Processed_Text
-		script.Total_Cuentoken += uint(lines)
-		if err := tx.Save(&script).Error; err != nil {
+		script.Total_Cuentoken += lines
+		if err := addVersion(tx, script, byPosition(kept, fresh), lines, nil); err != nil {
+			return err
+		}
+		if err := tx.Omit("seq").Save(script).Error; err != nil {
 			return err
 		}
 
-		if sub.TokensRemaining < uint(lines) {
-			sub.TokensRemaining = 0
-		} else {
-			sub.TokensRemaining = sub.TokensRemaining - uint(lines)
+		return s.userRepo.Capture(tx, res, lines)
+	}); err != nil {
+		return nil, s.release(res, err)
+	}
+	s.publishSnapshot(script)
+
+	reload, _ := s.repo.FindByIdWithAssets(script.ID.String(), userID)
+	dto := ScriptToDTO(reload)
+	PresignScript(s.store, &dto)
+	return &dto, nil
+}
+
+// applyLine copia al asset el contenido de una línea. Un SFX no tiene
+// speaker y una línea TTS no tiene duración propia.
+func applyLine(a *model.Asset, line *Line) error {
+	a.Type = line.Type
+	a.Line = line.Text
+	a.Speaker = strings.TrimSpace(line.Speaker)
+	a.SfxDuration = line.Duration
+	a.Pause = line.Pause
+	a.CharacterID = nil
+	a.VoiceID = nil
+	if a.Type == model.AudioSFX {
+		a.Speaker = ""
+	} else {
+		a.SfxDuration = 0
+	}
+	if line.VoiceID != "" {
+		voiceID, err := uuid.Parse(line.VoiceID)
+		if err != nil {
+			return ErrInvalidVoice
 		}
+		a.VoiceID = &voiceID
+	}
+	return nil
+}
 
-		if err := tx.Save(&sub).Error; err != nil {
-			return err
+// release devuelve los cuentokens reservados tras un fallo y añade al error
+// original el de la devolución, si lo hay.
+func (s *Service) release(res *model.TokenReservation, err error) error {
+	if e := s.userRepo.Release(res); e != nil {
+		err = errors.Join(err, e)
+	}
+	return err
+}
+
+// speakers devuelve los nombres de los personajes del proyecto, que se le
+// pasan al formateador para que no invente variantes de los mismos.
+func (s *Service) speakers(projectID uuid.UUID, userID string) ([]string, error) {
+	characters, err := s.charRepo.FindByProjectID(projectID.String(), userID)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, len(characters))
+	for i := range characters {
+		names[i] = characters[i].Name
+	}
+	return names, nil
+}
+
+// formattedAssets arma los assets de un script a partir de las líneas que
+// devolvió el formateador.
+func formattedAssets(scriptID uuid.UUID, lines []helper.FormattedLine) []model.Asset {
+	assets := make([]model.Asset, 0, len(lines))
+	for i, line := range lines {
+		assets = append(assets, model.Asset{
+			ID:          uuid.New(),
+			Type:        model.AudioLine(line.Type),
+			Line:        line.Text,
+			Speaker:     line.Speaker,
+			SfxDuration: line.Duration,
+			Pause:       line.Pause,
+			ScriptID:    scriptID,
+			Position:    i,
+		})
+	}
+	return assets
+}
+
+// createAssets guarda los assets enlazando cada speaker con su personaje del
+// proyecto.
+func createAssets(tx *gorm.DB, projectID uuid.UUID, assets []model.Asset) error {
+	if len(assets) == 0 {
+		return nil
+	}
+	if err := linkCharacters(tx, projectID, assets); err != nil {
+		return err
+	}
+	return tx.Create(&assets).Error
+}
+
+// linkCharacters enlaza cada speaker con su personaje del proyecto. Los
+// speakers nuevos se dan de alta como personajes sin voz, que el usuario
+// puede asignar después; los que se habían borrado se restauran.
+func linkCharacters(tx *gorm.DB, projectID uuid.UUID, assets []model.Asset) error {
+
+	var characters []model.Character
+	if err := tx.Unscoped().
+		Where("project_id = ?", projectID).
+		Find(&characters).Error; err != nil {
+		return err
+	}
+	byName := make(map[string]*model.Character, len(characters))
+	for i := range characters {
+		byName[strings.ToLower(characters[i].Name)] = &characters[i]
+	}
+
+	for i := range assets {
+		a := &assets[i]
+		if a.Speaker == "" {
+			continue
 		}
 
-		if err := tx.
-			Where("script_id = ?", script.ID).
-			Delete(&model.Asset{}).Error; err != nil {
+		key := strings.ToLower(a.Speaker)
+		c, ok := byName[key]
+		switch {
+		case !ok:
+			c = &model.Character{ID: uuid.New(), Name: a.Speaker, ProjectID: projectID}
+			if err := tx.Create(c).Error; err != nil {
+				return err
+			}
+			byName[key] = c
+		case c.DeletedAt.Valid:
+			if err := tx.Unscoped().Model(c).Update("deleted_at", nil).Error; err != nil {
+				return err
+			}
+			c.DeletedAt = gorm.DeletedAt{}
+		}
+
+		a.Speaker = c.Name
+		a.CharacterID = &c.ID
+	}
+	return nil
+}
+
+// snapshot guarda las líneas actuales en la versión vigente antes de dejarla,
+// con el audio que se haya generado desde que se creó. Los scripts anteriores
+// al versionado estrenan aquí su versión 1.
+func snapshot(tx *gorm.DB, script *model.Script, assets []model.Asset) error {
+	if script.Version == 0 {
+		return addVersion(tx, script, assets, script.Total_Cuentoken, nil)
+	}
+	return tx.Model(&model.ScriptVersion{}).
+		Where("script_id = ? AND number = ?", script.ID, script.Version).
+		Select("Lines").
+		Updates(&model.ScriptVersion{Lines: versionLines(assets)}).Error
+}
+
+// addVersion crea la siguiente versión del script con sus assets, ya en
+// orden, y la deja como actual.
+func addVersion(tx *gorm.DB, script *model.Script, assets []model.Asset, cuentoken uint, restoredFrom *int) error {
+	version := model.ScriptVersion{
+		ID:                uuid.New(),
+		ScriptID:          script.ID,
+		Number:            script.Version + 1,
+		Processed_Text:    script.Processed_Text,
+		Prompt_Tokens:     script.Prompt_Tokens,
+		Completion_Tokens: script.Completion_Tokens,
+		Total_Tokens:      script.Total_Tokens,
+		Cuentoken:         cuentoken,
+		RestoredFrom:      restoredFrom,
+		Lines:             versionLines(assets),
+	}
+	if err := tx.Omit(clause.Associations).Create(&version).Error; err != nil {
+		return err
+	}
+	script.Version = version.Number
+	return tx.Model(script).Update("version", script.Version).Error
+}
+
+func versionLines(assets []model.Asset) []model.VersionLine {
+	lines := make([]model.VersionLine, len(assets))
+	for i := range assets {
+		lines[i] = model.VersionLineOf(&assets[i])
+	}
+	return lines
+}
+
+// lineKey identifica el audio de una línea regenerada. La voz no entra: el
+// formateador no la elige y el asset reutilizado conserva la que tenía.
+func lineKey(typ model.AudioLine, text, speaker string, sfxDuration float64) string {
+	return fmt.Sprintf("%s|%s|%g|%s", typ, strings.ToLower(speaker), sfxDuration, text)
+}
+
+// reuseAssets reparte las líneas del formateador entre los assets actuales:
+// kept son los que siguen (con su nueva posición y pausa), fresh los que hay
+// que crear y stale los que ya no aparecen.
+func reuseAssets(scriptID uuid.UUID, current []model.Asset, lines []helper.FormattedLine) (kept, fresh, stale []model.Asset) {
+	pool := make(map[string][]int, len(current))
+	for i := range current {
+		a := &current[i]
+		key := lineKey(a.Type, a.Line, a.Speaker, a.SfxDuration)
+		pool[key] = append(pool[key], i)
+	}
+
+	used := make([]bool, len(current))
+	for _, a := range formattedAssets(scriptID, lines) {
+		key := lineKey(a.Type, a.Line, a.Speaker, a.SfxDuration)
+		if idx := pool[key]; len(idx) > 0 {
+			pool[key] = idx[1:]
+			used[idx[0]] = true
+			old := current[idx[0]]
+			old.Position = a.Position
+			old.Pause = a.Pause
+			kept = append(kept, old)
+			continue
+		}
+		fresh = append(fresh, a)
+	}
+
+	for i := range current {
+		if !used[i] {
+			stale = append(stale, current[i])
+		}
+	}
+	return kept, fresh, stale
+}
+
+// deleteAssets hace un borrado lógico para que restaurar una versión pueda
+// recuperar la fila.
+func deleteAssets(tx *gorm.DB, assets []model.Asset) error {
+	if len(assets) == 0 {
+		return nil
+	}
+	ids := make([]uuid.UUID, len(assets))
+	for i := range assets {
+		ids[i] = assets[i].ID
+	}
+	return tx.Where("id IN ?", ids).Delete(&model.Asset{}).Error
+}
+
+// byPosition junta varias listas de assets ordenadas por posición.
+func byPosition(lists ...[]model.Asset) []model.Asset {
+	var all []model.Asset
+	for _, l := range lists {
+		all = append(all, l...)
+	}
+	sort.SliceStable(all, func(i, j int) bool { return all[i].Position < all[j].Position })
+	return all
+}
+
+var (
+	// ErrCurrentVersion se devuelve al restaurar la versión que ya es la actual.
+	ErrCurrentVersion = errors.New("la versión ya es la actual")
+	// ErrVersionRange se devuelve al comparar versiones inexistentes.
+	ErrVersionRange = errors.New("versiones inválidas")
+)
+
+// Versions lista las versiones del script sin sus líneas.
+func (s *Service) Versions(id, userID string) ([]VersionResponse, error) {
+	script, err := s.repo.FindById(id, userID)
+	if err != nil {
+		return nil, err
+	}
+	versions, err := s.repo.FindVersions(script.ID.String())
+	if err != nil {
+		return nil, err
+	}
+
+	dtos := make([]VersionResponse, len(versions))
+	for i := range versions {
+		dtos[i] = VersionToDTO(&versions[i], script.Version)
+		dtos[i].Lines = nil
+	}
+	return dtos, nil
+}
+
+// Version devuelve una versión con sus líneas. La actual se arma con los
+// assets vigentes, que pueden tener audio más nuevo que la foto guardada.
+func (s *Service) Version(id, userID string, number int) (*VersionResponse, error) {
+	script, version, err := s.findVersion(id, userID, number)
+	if err != nil {
+		return nil, err
+	}
+	dto := VersionToDTO(version, script.Version)
+	PresignLines(s.store, dto.Lines)
+	return &dto, nil
+}
+
+// DiffVersions compara las líneas de dos versiones. to vacío (0) es la
+// actual y from vacío la anterior a to.
+func (s *Service) DiffVersions(id, userID string, from, to int) (*VersionDiff, error) {
+	script, err := s.repo.FindById(id, userID)
+	if err != nil {
+		return nil, err
+	}
+	if to == 0 {
+		to = script.Version
+	}
+	if from == 0 {
+		from = to - 1
+	}
+	if from < 1 || to < 1 {
+		return nil, fmt.Errorf("%w: el script no tiene versiones que comparar", ErrVersionRange)
+	}
+
+	_, a, err := s.findVersion(id, userID, from)
+	if err != nil {
+		return nil, err
+	}
+	_, b, err := s.findVersion(id, userID, to)
+	if err != nil {
+		return nil, err
+	}
+
+	diff := VersionDiffToDTO(a, b, helper.DiffLines(a.Lines, b.Lines, model.VersionLine.SameContent))
+	for i := range diff.Lines {
+		presignLine(s.store, &diff.Lines[i].Line)
+	}
+	return &diff, nil
+}
+
+// findVersion busca la versión de un script del usuario. La actual se
+// completa con los assets vigentes.
+func (s *Service) findVersion(id, userID string, number int) (*model.Script, *model.ScriptVersion, error) {
+	script, err := s.repo.FindById(id, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	version, err := s.repo.FindVersion(script.ID.String(), number)
+	if err != nil {
+		return nil, nil, err
+	}
+	if number == script.Version {
+		assets, err := s.repo.FindByIDWithAssetsPosition(script.ID.String())
+		if err != nil {
+			return nil, nil, err
+		}
+		version.Lines = versionLines(assets)
+	}
+	return script, version, nil
+}
+
+// RestoreVersion vuelve a las líneas de una versión anterior creando una
+// versión nueva, así que no se pierde ninguna. Las líneas recuperan su asset
+// y su audio; no se cobra nada.
+func (s *Service) RestoreVersion(id, userID string, number int) (*ScriptReponse, error) {
+	script, err := s.repo.FindById(id, userID)
+	if err != nil {
+		return nil, err
+	}
+	if number == script.Version {
+		return nil, ErrCurrentVersion
+	}
+	version, err := s.repo.FindVersion(script.ID.String(), number)
+	if err != nil {
+		return nil, err
+	}
+	unlock := s.lockScript(script.ID)
+	defer unlock()
+	if err := s.repo.db.Transaction(func(tx *gorm.DB) error {
+		if script.Seq, err = nextSeq(tx, script.ID); err != nil {
+			return err
+		}
+		current, err := findLines(tx, script.ID)
+		if err != nil {
+			return err
+		}
+		if err := linesIdle(current); err != nil {
+			return err
+		}
+		if err := snapshot(tx, script, current); err != nil {
 			return err
 		}
 
-		dirPath := filepath.Join(script.ID.String())
-		if err := helper.DeleteFolder(context.TODO(), "audio", dirPath); err != nil {
-			log.Printf("error borrando carpeta Supabase: %v", err)
+		live := make(map[uuid.UUID]model.Asset, len(current))
+		for _, a := range current {
+			live[a.ID] = a
 		}
 
-		assets := make([]model.Asset, 0, lines)
-		for i, line := range aiResponse.Processed_Text_Array {
-			assets = append(assets, model.Asset{
-				ID:       uuid.New(),
-				Type:     "LINE", // ! Hacer que sea un enum entre tts y sfx
-				Line:     line,
-				ScriptID: script.ID,
-				Position: i,
-			})
+		// Un asset vigente con el mismo contenido se queda como está, por si
+		// su audio es más nuevo; el resto vuelve tal como estaba.
+		assets := make([]model.Asset, len(version.Lines))
+		for i, l := range version.Lines {
+			a, ok := live[l.AssetID]
+			if !ok || !model.VersionLineOf(&a).SameContent(l) {
+				a = assetFromLine(script.ID, l)
+			}
+			a.Position = i
+			a.Pause = l.Pause
+			a.Seq = script.Seq
+			assets[i] = a
+			delete(live, l.AssetID)
 		}
-		if err := tx.Create(&assets).Error; err != nil {
+
+		stale := make([]model.Asset, 0, len(live))
+		for _, a := range live {
+			stale = append(stale, a)
+		}
+		if err := deleteAssets(tx, stale); err != nil {
+			return err
+		}
+		if err := linkCharacters(tx, script.ProjectID, assets); err != nil {
 			return err
 		}
+		for i := range assets {
+			if err := restoreAsset(tx, &assets[i]); err != nil {
+				return err
+			}
+		}
 
-		return nil
+		script.Processed_Text = version.Processed_Text
+		script.Prompt_Tokens = version.Prompt_Tokens
+		script.Completion_Tokens = version.Completion_Tokens
+		script.Total_Tokens = version.Total_Tokens
+		if err := addVersion(tx, script, assets, 0, &number); err != nil {
+			return err
+		}
+		return tx.Omit("seq").Save(script).Error
 	}); err != nil {
 		return nil, err
 	}
+	s.publishSnapshot(script)
 
-	reload, _ := s.repo.FindByIdWithAssets(script.ID.String())
+	reload, _ := s.repo.FindByIdWithAssets(script.ID.String(), userID)
 	dto := ScriptToDTO(reload)
+	PresignScript(s.store, &dto)
 	return &dto, nil
 }
 
-func (s *Service) FindAll(opts *helper.FindAllOptions) (*helper.PaginatedResponse[ScriptReponse], error) {
-	finded, total, err := s.repo.FindAll(opts)
+// linesIdle devuelve ErrLineBusy si el audio de alguna línea se está
+// generando: el worker lo guardaría sobre una línea que ya cambió.
+func linesIdle(assets []model.Asset) error {
+	for i := range assets {
+		if assets[i].AudioState == model.StateActive {
+			return ErrLineBusy
+		}
+	}
+	return nil
+}
+
+// restoreAsset guarda el asset sobre su fila, aunque estuviera borrada, o
+// la crea si ya no existe.
+func restoreAsset(tx *gorm.DB, a *model.Asset) error {
+	res := tx.Unscoped().Model(a).
+		Select("Type", "Line", "Speaker", "CharacterID", "SfxDuration", "Pause", "VoiceID",
+			"Audio_URL", "AudioState", "Duration", "Video_URL", "VideoState", "Images",
+			"Position", "Seq", "DeletedAt").
+		Updates(a)
+	if res.Error != nil || res.RowsAffected > 0 {
+		return res.Error
+	}
+	return tx.Omit(clause.Associations).Create(a).Error
+}
+
+// assetFromLine rehace el asset de una línea de versión con su mismo ID, de
+// modo que al guardarlo se recupera la fila aunque estuviera borrada.
+func assetFromLine(scriptID uuid.UUID, l model.VersionLine) model.Asset {
+	return model.Asset{
+		ID:          l.AssetID,
+		Type:        l.Type,
+		Line:        l.Line,
+		Speaker:     l.Speaker,
+		SfxDuration: l.SfxDuration,
+		Pause:       l.Pause,
+		VoiceID:     l.VoiceID,
+		Audio_URL:   l.Audio_URL,
+		AudioState:  l.AudioState,
+		Duration:    l.Duration,
+		Video_URL:   l.Video_URL,
+		VideoState:  l.VideoState,
+		Images:      l.Images,
+		ScriptID:    scriptID,
+	}
+}
+
+var (
+	// ErrInvalidVoice se devuelve cuando voice_id no es un UUID.
+	ErrInvalidVoice = errors.New("voice_id inválido")
+	// ErrLineBusy se devuelve al editar una línea cuyo audio se está generando.
+	ErrLineBusy = errors.New("el audio de la línea se está generando")
+	// ErrLineOrder se devuelve cuando el nuevo orden no incluye cada línea
+	// del script exactamente una vez.
+	ErrLineOrder = errors.New("el orden debe incluir cada línea del script una vez")
+	// ErrLineConflict se devuelve cuando la línea cambió desde la secuencia
+	// que vio el cliente.
+	ErrLineConflict = errors.New("la línea cambió desde base_seq; aplique los cambios recibidos y reintente")
+)
+
+// editor es quien hace una edición de líneas. Las ediciones por REST no
+// traen conexión ni baseSeq.
+type editor struct {
+	userID    string
+	clientID  string
+	clientSeq int64
+	// baseSeq es la secuencia de la línea que vio el cliente; si la línea
+	// cambió desde entonces la edición se rechaza.
+	baseSeq *int64
+}
+
+func (by editor) check(a *model.Asset) error {
+	if by.baseSeq != nil && *by.baseSeq != a.Seq {
+		return ErrLineConflict
+	}
+	return nil
+}
+
+// lockScript serializa, dentro de este proceso, las ediciones de un script
+// con su difusión, para que la sala reciba las secuencias en orden.
+func (s *Service) lockScript(id uuid.UUID) func() {
+	mu := &s.locks[int(id[0])%len(s.locks)]
+	mu.Lock()
+	return mu.Unlock
+}
+
+// edit aplica una edición de líneas y la difunde en la sala del script con
+// su secuencia. fn devuelve el nuevo orden y la línea afectada.
+func (s *Service) edit(script *model.Script, by editor, typ CollabType, fn func(tx *gorm.DB, seq int64, assets []model.Asset) ([]model.Asset, *model.Asset, error)) error {
+	unlock := s.lockScript(script.ID)
+	defer unlock()
+
+	var (
+		line  *model.Asset
+		order []string
+	)
+	seq, err := s.repo.EditLines(script.ID, func(tx *gorm.DB, seq int64, assets []model.Asset) ([]model.Asset, error) {
+		assets, a, err := fn(tx, seq, assets)
+		if err != nil {
+			return nil, err
+		}
+		line = a
+		if typ == CollabReorder {
+			order = make([]string, len(assets))
+			for i := range assets {
+				order[i] = assets[i].ID.String()
+			}
+		}
+		return assets, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	msg := CollabMessage{
+		Type:      typ,
+		Seq:       seq,
+		UserID:    by.userID,
+		ClientID:  by.clientID,
+		ClientSeq: by.clientSeq,
+		AssetIDs:  order,
+	}
+	if line != nil {
+		msg.AssetID = line.ID.String()
+		if typ != CollabDelete {
+			dto := asset.AssetToDto(line)
+			asset.PresignAsset(s.store, &dto)
+			msg.Asset = &dto
+		}
+	}
+	s.hub.PublishJSON(msg, script.ID.String())
+	return nil
+}
+
+// InsertLine agrega una línea al script; el audio queda PENDING.
+func (s *Service) InsertLine(id, userID string, in *LineInsert) (*ScriptReponse, error) {
+	script, err := s.repo.FindById(id, userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.insertLine(script, editor{userID: userID}, in); err != nil {
+		return nil, err
+	}
+	return s.withAssets(id, userID)
+}
+
+func (s *Service) insertLine(script *model.Script, by editor, in *LineInsert) error {
+	a := model.Asset{ID: uuid.New(), ScriptID: script.ID}
+	if err := applyLine(&a, &in.Line); err != nil {
+		return err
+	}
+
+	return s.edit(script, by, CollabInsert, func(tx *gorm.DB, seq int64, assets []model.Asset) ([]model.Asset, *model.Asset, error) {
+		pos := len(assets)
+		if in.Position != nil && *in.Position < pos {
+			pos = *in.Position
+		}
+		a.Position = pos
+		a.Seq = seq
+		created := []model.Asset{a}
+		if err := createAssets(tx, script.ProjectID, created); err != nil {
+			return nil, nil, err
+		}
+		assets = slices.Insert(assets, pos, created[0])
+		return assets, &assets[pos], nil
+	})
+}
+
+// UpdateLine reemplaza el contenido de una línea, incluido su tipo (TTS o
+// SFX). Si cambia lo que se oye el audio vuelve a PENDING para regenerar
+// sólo esa línea; cambiar la pausa no lo toca.
+func (s *Service) UpdateLine(id, assetID, userID string, in *Line) (*ScriptReponse, error) {
+	script, err := s.repo.FindById(id, userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.updateLine(script, editor{userID: userID}, assetID, in); err != nil {
+		return nil, err
+	}
+	return s.withAssets(id, userID)
+}
+
+func (s *Service) updateLine(script *model.Script, by editor, assetID string, in *Line) error {
+	return s.edit(script, by, CollabUpdate, func(tx *gorm.DB, seq int64, assets []model.Asset) ([]model.Asset, *model.Asset, error) {
+		i, err := lineIndex(assets, assetID)
+		if err != nil {
+			return nil, nil, err
+		}
+		a := &assets[i]
+		if err := by.check(a); err != nil {
+			return nil, nil, err
+		}
+		if a.AudioState == model.StateActive {
+			return nil, nil, ErrLineBusy
+		}
+
+		before := model.VersionLineOf(a)
+		if err := applyLine(a, in); err != nil {
+			return nil, nil, err
+		}
+		if err := linkCharacters(tx, script.ProjectID, assets[i:i+1]); err != nil {
+			return nil, nil, err
+		}
+		if !before.SameContent(model.VersionLineOf(a)) {
+			a.AudioState = model.StatePending
+		}
+		a.Seq = seq
+
+		return assets, a, tx.Model(a).
+			Select("Type", "Line", "Speaker", "CharacterID", "SfxDuration", "Pause", "VoiceID", "AudioState", "Seq").
+			Updates(a).Error
+	})
+}
+
+// DeleteLine quita una línea del script. El borrado es lógico: la línea
+// sigue en las versiones anteriores y se puede restaurar.
+func (s *Service) DeleteLine(id, assetID, userID string) (*ScriptReponse, error) {
+	script, err := s.repo.FindById(id, userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.deleteLine(script, editor{userID: userID}, assetID); err != nil {
+		return nil, err
+	}
+	return s.withAssets(id, userID)
+}
+
+func (s *Service) deleteLine(script *model.Script, by editor, assetID string) error {
+	return s.edit(script, by, CollabDelete, func(tx *gorm.DB, seq int64, assets []model.Asset) ([]model.Asset, *model.Asset, error) {
+		i, err := lineIndex(assets, assetID)
+		if err != nil {
+			return nil, nil, err
+		}
+		deleted := assets[i]
+		if err := by.check(&deleted); err != nil {
+			return nil, nil, err
+		}
+		if deleted.AudioState == model.StateActive {
+			return nil, nil, ErrLineBusy
+		}
+		if err := deleteAssets(tx, assets[i:i+1]); err != nil {
+			return nil, nil, err
+		}
+		return slices.Delete(assets, i, i+1), &deleted, nil
+	})
+}
+
+// moveLine lleva una línea a otra posición; más allá del final va al final.
+func (s *Service) moveLine(script *model.Script, by editor, assetID string, position int) error {
+	return s.edit(script, by, CollabMove, func(tx *gorm.DB, seq int64, assets []model.Asset) ([]model.Asset, *model.Asset, error) {
+		i, err := lineIndex(assets, assetID)
+		if err != nil {
+			return nil, nil, err
+		}
+		moved := assets[i]
+		if err := by.check(&moved); err != nil {
+			return nil, nil, err
+		}
+		if moved.AudioState == model.StateActive {
+			return nil, nil, ErrLineBusy
+		}
+		moved.Seq = seq
+		if err := tx.Model(&moved).UpdateColumn("seq", seq).Error; err != nil {
+			return nil, nil, err
+		}
+
+		assets = slices.Delete(assets, i, i+1)
+		position = min(position, len(assets))
+		assets = slices.Insert(assets, position, moved)
+		return assets, &assets[position], nil
+	})
+}
+
+// ReorderLines cambia el orden de las líneas. Mover una línea no toca su
+// audio, pero las que se están generando tienen que quedar donde están.
+func (s *Service) ReorderLines(id, userID string, in *LineOrder) (*ScriptReponse, error) {
+	script, err := s.repo.FindById(id, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.edit(script, editor{userID: userID}, CollabReorder, func(tx *gorm.DB, seq int64, assets []model.Asset) ([]model.Asset, *model.Asset, error) {
+		if len(in.AssetIDs) != len(assets) {
+			return nil, nil, ErrLineOrder
+		}
+		byID := make(map[string]model.Asset, len(assets))
+		for _, a := range assets {
+			byID[a.ID.String()] = a
+		}
+
+		ordered := make([]model.Asset, 0, len(assets))
+		for _, assetID := range in.AssetIDs {
+			a, ok := byID[strings.ToLower(assetID)]
+			if !ok {
+				return nil, nil, ErrLineOrder
+			}
+			if a.AudioState == model.StateActive && a.Position != len(ordered) {
+				return nil, nil, ErrLineBusy
+			}
+			delete(byID, a.ID.String())
+			ordered = append(ordered, a)
+		}
+		return ordered, nil, nil
+	}); err != nil {
+		return nil, err
+	}
+
+	return s.withAssets(id, userID)
+}
+
+// lineIndex busca el asset entre las líneas del script; si no está devuelve
+// gorm.ErrRecordNotFound.
+func lineIndex(assets []model.Asset, assetID string) (int, error) {
+	for i := range assets {
+		if assets[i].ID.String() == strings.ToLower(assetID) {
+			return i, nil
+		}
+	}
+	return -1, gorm.ErrRecordNotFound
+}
+
+// snapshotMessage arma el estado completo del script para la sala: sus
+// datos y sus líneas en orden, con la secuencia a la que corresponden.
+func (s *Service) snapshotMessage(scriptID uuid.UUID) (*CollabMessage, error) {
+	script, err := s.repo.Snapshot(scriptID)
+	if err != nil {
+		return nil, err
+	}
+	dto := ScriptToDTO(script)
+	PresignScript(s.store, &dto)
+	return &CollabMessage{Type: CollabSnapshot, Seq: script.Seq, Script: &dto}, nil
+}
+
+// publishSnapshot manda el estado completo a la sala tras un cambio que
+// reemplaza las líneas de golpe (regenerar, restaurar).
+func (s *Service) publishSnapshot(script *model.Script) {
+	msg, err := s.snapshotMessage(script.ID)
+	if err != nil {
+		log.Printf("[script] snapshot de %s: %v", script.ID, err)
+		return
+	}
+	s.hub.PublishJSON(msg, script.ID.String())
+}
+
+// withAssets devuelve el script con sus assets en orden, ya firmados.
+func (s *Service) withAssets(id, userID string) (*ScriptReponse, error) {
+	script, err := s.repo.FindById(id, userID)
+	if err != nil {
+		return nil, err
+	}
+	if script.Assets, err = s.repo.FindByIDWithAssetsPosition(id); err != nil {
+		return nil, err
+	}
+	dto := ScriptToDTO(script)
+	PresignScript(s.store, &dto)
+	return &dto, nil
+}
+
+func (s *Service) FindAll(userID string, opts *helper.FindAllOptions) (*helper.PaginatedResponse[ScriptReponse], error) {
+	finded, total, err := s.repo.FindAll(userID, opts)
 	if err != nil {
 		return nil, err
 	}
 	dtos := ScriptToListDTO(finded)
+	for i := range dtos {
+		PresignScript(s.store, &dtos[i])
+	}
 	pages := uint((total + int64(opts.Limit) - 1) / int64(opts.Limit))
 
 	return &helper.PaginatedResponse[ScriptReponse]{
@@ -270,8 +1069,8 @@ func (s *Service) FindAll(opts *helper.FindAllOptions) (*helper.PaginatedRespons
 	}, nil
 }
 
-func (s *Service) FindByID(id string) (*ScriptReponse, error) {
-	finded, err := s.repo.FindByIdWithAssets(id)
+func (s *Service) FindByID(id, userID string) (*ScriptReponse, error) {
+	finded, err := s.repo.FindByIdWithAssets(id, userID)
 	if err != nil {
 		return nil, err
 	}
@@ -279,11 +1078,12 @@ func (s *Service) FindByID(id string) (*ScriptReponse, error) {
 		return nil, errors.New("no se encontró lo solicitado")
 	}
 	dto := ScriptToDTO(finded)
+	PresignScript(s.store, &dto)
 	return &dto, nil
 }
 
 func (s *Service) MixAudio(id, userID string) (*ScriptReponse, error) {
-	script, err := s.repo.FindById(id)
+	script, err := s.repo.FindById(id, userID)
 	if err != nil {
 		return nil, err
 	}
@@ -291,46 +1091,344 @@ func (s *Service) MixAudio(id, userID string) (*ScriptReponse, error) {
 	if err != nil {
 		return nil, err
 	}
+	// Se rechaza antes de reservar: sin el audio de cada línea la mezcla
+	// fallaría después de retener los cuentokens.
+	for _, a := range assets {
+		if a.AudioState != model.StateFinished || a.Audio_URL == "" {
+			return nil, ErrNotGenerated
+		}
+	}
+
+	needed := uint(len(assets))
+	res, err := s.userRepo.Reserve(userID, needed, model.TokenLedger{
+		Reason:   model.LedgerScriptMix,
+		ScriptID: &script.ID,
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.notify(ws.EventMix, script, model.StateActive, nil)
 
-	if err := s.repo.db.Transaction(func(tx *gorm.DB) error {
-		sub, err := s.userRepo.GetActiveSubscription(userID)
+	if err := func() error {
+		url, err := helper.MixAudio(s.store, id, assets, script.Mix)
 		if err != nil {
 			return err
 		}
-		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
-			Where("id = ?", sub.ID).
-			Take(&sub).Error; err != nil {
-			return err
-		}
 
-		needed := uint(len(assets))
-		if sub.TokensRemaining < needed {
-			return fmt.Errorf(
-				"fondos insuficientes: se necesitan aprox. %d cuentokens, tienes %d",
-				needed, sub.TokensRemaining,
-			)
+		// Sólo se tocan la mezcla y el total: guardar el script entero
+		// pisaría lo que se editó mientras se mezclaba.
+		return s.repo.db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Model(&model.Script{}).
+				Where("id = ?", script.ID).
+				Updates(map[string]any{
+					"mixed_audio":     url,
+					"total_cuentoken": gorm.Expr("total_cuentoken + ?", needed),
+				}).Error; err != nil {
+				return err
+			}
+			script.Total_Cuentoken += needed
+			script.Mixed_Audio = url
+
+			return s.userRepo.Capture(tx, res, needed)
+		})
+	}(); err != nil {
+		err = s.release(res, err)
+		s.notify(ws.EventMix, script, model.StateError, err)
+		return nil, err
+	}
+
+	s.notify(ws.EventMix, script, model.StateFinished, nil)
+	dto := ScriptToDTO(script)
+	PresignScript(s.store, &dto)
+	return &dto, nil
+}
+
+// Subtitles arma los subtítulos del script con la misma línea de tiempo que
+// la mezcla, a partir de la duración guardada de cada asset.
+func (s *Service) Subtitles(id, userID string, format helper.SubtitleFormat, sfx helper.SFXMode) (string, error) {
+	script, err := s.repo.FindById(id, userID)
+	if err != nil {
+		return "", err
+	}
+	assets, err := s.repo.FindByIDWithAssetsPosition(id)
+	if err != nil {
+		return "", err
+	}
+
+	durations, err := helper.AssetDurations(assets)
+	if err != nil {
+		return "", err
+	}
+	cues := helper.BuildCues(assets, durations, script.Mix, sfx)
+	return helper.FormatSubtitles(cues, format), nil
+}
+
+var (
+	// ErrNotGenerated se devuelve al mezclar un script con líneas sin audio.
+	ErrNotGenerated = errors.New("primero debe generar el audio de todas las líneas")
+	// ErrNotMixed se devuelve al renderizar un script sin mezcla de audio.
+	ErrNotMixed = errors.New("primero debe mezclar el audio del script")
+	// ErrNoVisual se devuelve cuando una línea no tiene video ni imágenes
+	// propias y no se indicaron key_words para buscarle.
+	ErrNoVisual = errors.New("hay líneas sin video ni imágenes; elija imágenes o indique key_words")
+)
+
+// RenderVideo arma un único video del script sobre la línea de tiempo de la
+// mezcla: cada línea de narración muestra el video ya generado de su asset,
+// su imagen elegida o, si no tiene, una buscada con KeyWords. El resultado
+// queda en Mixed_Media.
+func (s *Service) RenderVideo(id, userID string, in *RenderVideo) (*ScriptReponse, error) {
+	opts := helper.RenderOptions{
+		Aspect:             in.Aspect,
+		Resolution:         in.Resolution,
+		Transition:         in.Transition,
+		TransitionDuration: in.TransitionDuration,
+		Subtitles:          in.Subtitles,
+		SFX:                helper.SFXMode(in.SFX),
+	}
+	if err := opts.Normalize(); err != nil {
+		return nil, err
+	}
+
+	script, err := s.repo.FindById(id, userID)
+	if err != nil {
+		return nil, err
+	}
+	if script.Mixed_Audio == "" {
+		return nil, ErrNotMixed
+	}
+	assets, err := s.repo.FindByIDWithAssetsPosition(id)
+	if err != nil {
+		return nil, err
+	}
+	durations, err := helper.AssetDurations(assets)
+	if err != nil {
+		return nil, err
+	}
+	clips, total := helper.BuildTimeline(assets, durations, script.Mix)
+	segs := helper.VideoSegments(clips, total)
+	if len(segs) == 0 {
+		return nil, ErrNotMixed
+	}
+
+	visuals, err := s.visuals(assets, segs, userID, in)
+	if err != nil {
+		return nil, err
+	}
+
+	tokens := uint(total) * 50
+	res, err := s.userRepo.Reserve(userID, tokens, model.TokenLedger{
+		Reason:   model.LedgerScriptVideo,
+		ScriptID: &script.ID,
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.notify(ws.EventRender, script, model.StateActive, nil)
+
+	if err := func() error {
+		srt := ""
+		if opts.Subtitles {
+			cues := helper.BuildCues(assets, durations, script.Mix, opts.SFX)
+			srt = helper.FormatSubtitles(cues, helper.SubtitleSRT)
 		}
 
-		url, err := helper.MixAudio(id, assets)
+		raw, err := helper.RenderVideo(s.store, s.images, segs, visuals, script.Mixed_Audio, total, opts, srt)
 		if err != nil {
 			return err
 		}
 
-		script.Total_Cuentoken += needed
-		script.Mixed_Audio = url
-		if err := tx.Save(&script).Error; err != nil {
+		bucket := "video"
+		key := path.Join(script.ID.String(), fmt.Sprintf("script_%s.mp4", script.ID))
+		if _, err := s.store.Put(context.TODO(), bucket, key, bytes.NewReader(raw), "video/mp4"); err != nil {
 			return err
 		}
 
-		sub.TokensRemaining -= needed
-		if err := tx.Save(sub).Error; err != nil {
-			return err
+		// Como en MixAudio, sólo el video y el total.
+		media := helper.ObjectRef(bucket, key)
+		return s.repo.db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Model(&model.Script{}).
+				Where("id = ?", script.ID).
+				Updates(map[string]any{
+					"mixed_media":     media,
+					"total_cuentoken": gorm.Expr("total_cuentoken + ?", tokens),
+				}).Error; err != nil {
+				return err
+			}
+			script.Total_Cuentoken += tokens
+			script.Mixed_Media = media
+
+			return s.userRepo.Capture(tx, res, tokens)
+		})
+	}(); err != nil {
+		err = s.release(res, err)
+		s.notify(ws.EventRender, script, model.StateError, err)
+		return nil, err
+	}
+
+	s.notify(ws.EventRender, script, model.StateFinished, nil)
+	dto := ScriptToDTO(script)
+	PresignScript(s.store, &dto)
+	return &dto, nil
+}
+
+// visuals elige qué se ve en cada segmento. Las líneas sin video ni
+// imágenes reparten en orden las que se encuentren con KeyWords, y la
+// elegida se guarda en el asset para que el próximo render la reutilice.
+func (s *Service) visuals(assets []model.Asset, segs []helper.VideoSegment, userID string, in *RenderVideo) ([]helper.Visual, error) {
+	visuals := make([]helper.Visual, len(segs))
+	var (
+		found []helper.Image
+		next  int
+	)
+	for i, seg := range segs {
+		a := &assets[seg.Asset]
+		switch {
+		case a.VideoState == model.StateFinished && a.Video_URL != "":
+			visuals[i].VideoRef = a.Video_URL
+			continue
+		case len(a.Images) > 0:
+			visuals[i].Image = a.Images[0]
+			continue
 		}
-		return nil
-	}); err != nil {
+
+		if found == nil {
+			if strings.TrimSpace(in.KeyWords) == "" {
+				return nil, ErrNoVisual
+			}
+			provider, err := s.images.Get(in.Source)
+			if err != nil {
+				return nil, err
+			}
+			found, err = provider.Search(context.TODO(), helper.ImageQuery{Text: in.KeyWords, UserID: userID})
+			if err != nil {
+				return nil, err
+			}
+			if len(found) == 0 {
+				return nil, fmt.Errorf("%w: no se encontraron imágenes para %q", ErrNoVisual, in.KeyWords)
+			}
+		}
+
+		visuals[i].Image = found[next%len(found)]
+		next++
+		a.Images = []model.AssetImage{visuals[i].Image}
+		if err := s.assetRepo.UpdateImages(a); err != nil {
+			return nil, err
+		}
+	}
+	return visuals, nil
+}
+
+// ErrInvalidMusic se devuelve cuando el archivo subido como música no es audio.
+var ErrInvalidMusic = errors.New("la música debe ser un archivo de audio")
+
+// UpdateMix reemplaza los parámetros de mezcla; se aplican en la próxima
+// mezcla. La música ya subida se conserva.
+func (s *Service) UpdateMix(id, userID string, in *MixUpdate) (*ScriptReponse, error) {
+	script, err := s.repo.FindById(id, userID)
+	if err != nil {
 		return nil, err
 	}
 
+	mix := model.MixSettings{
+		Gap:       in.Gap,
+		Crossfade: in.Crossfade,
+		Music:     script.Mix.Music,
+		MusicGain: in.MusicGain,
+		Ducking:   in.Ducking,
+		Loudness:  in.Loudness,
+		Tracks:    in.Tracks,
+	}
+	if err := mix.Validate(); err != nil {
+		return nil, err
+	}
+
+	script.Mix = mix
+	if err := s.repo.UpdateMix(script); err != nil {
+		return nil, err
+	}
 	dto := ScriptToDTO(script)
+	PresignScript(s.store, &dto)
 	return &dto, nil
 }
+
+// SetMusic sube la música de fondo del script y reemplaza la anterior.
+func (s *Service) SetMusic(id, userID string, body io.Reader, filename, mime string) (*ScriptReponse, error) {
+	if !strings.HasPrefix(mime, "audio/") {
+		return nil, ErrInvalidMusic
+	}
+	script, err := s.repo.FindById(id, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	key := fmt.Sprintf("%s/music_%s%s", script.ID, uuid.NewString(), strings.ToLower(filepath.Ext(filename)))
+	if _, err := s.store.Put(context.TODO(), "audio", key, body, mime); err != nil {
+		return nil, err
+	}
+
+	previous := script.Mix.Music
+	script.Mix.Music = helper.ObjectRef("audio", key)
+	if err := s.repo.UpdateMix(script); err != nil {
+		return nil, err
+	}
+	s.deleteRef(previous)
+
+	dto := ScriptToDTO(script)
+	PresignScript(s.store, &dto)
+	return &dto, nil
+}
+
+// RemoveMusic quita la música de fondo del script.
+func (s *Service) RemoveMusic(id, userID string) (*ScriptReponse, error) {
+	script, err := s.repo.FindById(id, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	previous := script.Mix.Music
+	script.Mix.Music = ""
+	if err := s.repo.UpdateMix(script); err != nil {
+		return nil, err
+	}
+	s.deleteRef(previous)
+
+	dto := ScriptToDTO(script)
+	PresignScript(s.store, &dto)
+	return &dto, nil
+}
+
+// deleteRef borra un objeto que ya no se usa; si falla sólo queda en el log.
+func (s *Service) deleteRef(ref string) {
+	if ref == "" {
+		return
+	}
+	bucket, key, ok := helper.SplitObjectRef(s.store, ref)
+	if !ok {
+		return
+	}
+	if err := s.store.Delete(context.TODO(), bucket, key); err != nil {
+		log.Printf("[script] borrando %s: %v", ref, err)
+	}
+}
+
+// notify publica el estado del mix o del video en las salas del script y su
+// proyecto; al terminar incluye la URL firmada del resultado.
+func (s *Service) notify(typ ws.EventType, script *model.Script, state model.State, err error) {
+	evt := ws.Event{
+		Type:     typ,
+		ScriptID: script.ID.String(),
+		State:    string(state),
+	}
+	if state == model.StateFinished {
+		ref := script.Mixed_Audio
+		if typ == ws.EventRender {
+			ref = script.Mixed_Media
+		}
+		evt.URL = helper.PresignRef(context.TODO(), s.store, ref)
+	}
+	if err != nil {
+		evt.Error = err.Error()
+	}
+	s.hub.Publish(evt, evt.ScriptID, script.ProjectID.String())
+}
@@ -4,13 +4,12 @@ import (
 	"strconv"
 	"unicode/utf8"
 
+	"github.com/MetaDandy/cuent-ai-core/helper"
 	"github.com/MetaDandy/cuent-ai-core/src/model"
 	"github.com/MetaDandy/cuent-ai-core/src/modules/script"
 	"github.com/go-playground/validator/v10"
 )
 
-const maxTTSChars = 200
-
 var Validate *validator.Validate
 
 func init() {
@@ -23,12 +22,12 @@ func lineStructValidation(sl validator.StructLevel) {
 
 	// Sólo aplica el límite si la línea es TTS
 	if line.Type == model.AudioTTS &&
-		utf8.RuneCountInString(line.Text) > maxTTSChars {
+		utf8.RuneCountInString(line.Text) > helper.MaxTTSChars {
 
 		sl.ReportError(line.Text,
-			"Text",                    // nombre Go del campo
-			"text",                    // nombre JSON
-			"maxCharsTTS",             // etiqueta de error
-			strconv.Itoa(maxTTSChars)) // parámetro extra
+			"Text",                           // nombre Go del campo
+			"text",                           // nombre JSON
+			"maxCharsTTS",                    // etiqueta de error
+			strconv.Itoa(helper.MaxTTSChars)) // parámetro extra
 	}
 }
@@ -0,0 +1,67 @@
+package voice
+
+import (
+	"time"
+
+	"github.com/MetaDandy/cuent-ai-core/src/model"
+)
+
+type VoiceCreate struct {
+	Name            string  `json:"name" validate:"required"`
+	Provider        string  `json:"provider" validate:"required"`
+	ProviderVoiceID string  `json:"provider_voice_id" validate:"required"`
+	Language        string  `json:"language"`
+	Stability       float64 `json:"stability" validate:"gte=0,lte=1"`
+	Similarity      float64 `json:"similarity" validate:"gte=0,lte=1"`
+}
+
+type VoiceUpdate struct {
+	Name            *string  `json:"name"`
+	ProviderVoiceID *string  `json:"provider_voice_id"`
+	Language        *string  `json:"language"`
+	Stability       *float64 `json:"stability"`
+	Similarity      *float64 `json:"similarity"`
+}
+
+type VoiceResponse struct {
+	ID              string  `json:"id"`
+	Name            string  `json:"name"`
+	Provider        string  `json:"provider"`
+	ProviderVoiceID string  `json:"provider_voice_id"`
+	Language        string  `json:"language"`
+	Stability       float64 `json:"stability"`
+	Similarity      float64 `json:"similarity"`
+
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+}
+
+func VoiceToDTO(u *model.Voice) VoiceResponse {
+	var deletedAt *time.Time
+	if u.DeletedAt.Valid {
+		t := u.DeletedAt.Time
+		deletedAt = &t
+	}
+
+	return VoiceResponse{
+		ID:              u.ID.String(),
+		Name:            u.Name,
+		Provider:        string(u.Provider),
+		ProviderVoiceID: u.ProviderVoiceID,
+		Language:        u.Language,
+		Stability:       u.Stability,
+		Similarity:      u.Similarity,
+		CreatedAt:       u.CreatedAt,
+		UpdatedAt:       u.UpdatedAt,
+		DeletedAt:       deletedAt,
+	}
+}
+
+func VoicesToListDTO(list []model.Voice) []VoiceResponse {
+	out := make([]VoiceResponse, len(list))
+	for i := range list {
+		out[i] = VoiceToDTO(&list[i])
+	}
+	return out
+}
@@ -0,0 +1,98 @@
+package voice
+
+import (
+	"net/http"
+
+	"github.com/MetaDandy/cuent-ai-core/helper"
+	"github.com/MetaDandy/cuent-ai-core/middleware"
+	"github.com/MetaDandy/cuent-ai-core/src/model"
+	"github.com/gofiber/fiber/v2"
+)
+
+type Handler struct {
+	svc *Service
+}
+
+func NewHandler(s *Service) *Handler {
+	return &Handler{svc: s}
+}
+
+// RegisterRoutes monta el catálogo de voces. Cualquier usuario puede
+// consultarlo; los cambios requieren admin.
+func (h *Handler) RegisterRoutes(router fiber.Router) {
+	write := middleware.RequireRole(model.RoleAdmin)
+
+	grp := router.Group("/voices", middleware.JwtMiddleware())
+	grp.Get("", h.FindAll)
+	grp.Get("/:id", h.FindById)
+	grp.Post("", write, h.Create)
+	grp.Patch("/:id", write, h.Update)
+	grp.Delete("/:id", write, h.SoftDelete)
+}
+
+func (h *Handler) FindAll(c *fiber.Ctx) error {
+	opts := helper.NewFindAllOptionsFromQuery(c)
+	voices, err := h.svc.FindAll(opts)
+	if err != nil {
+		return helper.JSONError(c, http.StatusInternalServerError,
+			"Error obteniendo voces", err.Error())
+	}
+	return c.JSON(voices)
+}
+
+func (h *Handler) FindById(c *fiber.Ctx) error {
+	dto, err := h.svc.FindByID(c.Params("id"))
+	if err != nil {
+		return helper.JSONError(c, http.StatusNotFound,
+			"Voz no encontrada", err.Error())
+	}
+
+	return c.JSON(helper.Response{
+		Data:    dto,
+		Message: "Voz obtenida",
+	})
+}
+
+func (h *Handler) Create(c *fiber.Ctx) error {
+	var input VoiceCreate
+	if err := c.BodyParser(&input); err != nil {
+		return helper.JSONError(c, http.StatusBadRequest,
+			"Input inválido", err.Error())
+	}
+
+	voice, err := h.svc.Create(&input)
+	if err != nil {
+		return helper.JSONError(c, http.StatusInternalServerError,
+			"Error creando voz", err.Error())
+	}
+	return c.Status(http.StatusCreated).JSON(helper.Response{
+		Data:    voice,
+		Message: "Voz creada",
+	})
+}
+
+func (h *Handler) Update(c *fiber.Ctx) error {
+	var input VoiceUpdate
+	if err := c.BodyParser(&input); err != nil {
+		return helper.JSONError(c, http.StatusBadRequest,
+			"Cuerpo inválido", err.Error())
+	}
+
+	voice, err := h.svc.Update(c.Params("id"), &input)
+	if err != nil {
+		return helper.JSONError(c, http.StatusInternalServerError,
+			"Error actualizando voz", err.Error())
+	}
+	return c.JSON(helper.Response{
+		Data:    voice,
+		Message: "Voz actualizada",
+	})
+}
+
+func (h *Handler) SoftDelete(c *fiber.Ctx) error {
+	if err := h.svc.SoftDelete(c.Params("id")); err != nil {
+		return helper.JSONError(c, http.StatusInternalServerError,
+			"Error eliminando voz", err.Error())
+	}
+	return c.SendStatus(http.StatusNoContent)
+}
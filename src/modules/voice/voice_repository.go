@@ -0,0 +1,46 @@
+package voice
+
+import (
+	"github.com/MetaDandy/cuent-ai-core/helper"
+	"github.com/MetaDandy/cuent-ai-core/src/model"
+	"gorm.io/gorm"
+)
+
+type Repository struct {
+	db *gorm.DB
+}
+
+func NewRepository(db *gorm.DB) *Repository {
+	return &Repository{db: db}
+}
+
+func (r *Repository) Create(voice *model.Voice) error {
+	return r.db.Create(voice).Error
+}
+
+func (r *Repository) Update(voice *model.Voice) error {
+	return r.db.Save(voice).Error
+}
+
+func (r *Repository) FindAll(opts *helper.FindAllOptions) ([]model.Voice, int64, error) {
+	var finded []model.Voice
+	query := r.db.Model(model.Voice{})
+	var total int64
+	query, total = helper.ApplyFindAllOptions(query, opts)
+
+	err := query.Find(&finded).Error
+	return finded, total, err
+}
+
+func (r *Repository) FindById(id string) (*model.Voice, error) {
+	var voice model.Voice
+	err := r.db.First(&voice, "id = ?", id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &voice, nil
+}
+
+func (r *Repository) SoftDelete(id string) error {
+	return r.db.Delete(&model.Voice{}, "id = ?", id).Error
+}
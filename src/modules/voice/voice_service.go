@@ -0,0 +1,106 @@
+package voice
+
+import (
+	"errors"
+
+	"github.com/MetaDandy/cuent-ai-core/helper"
+	"github.com/MetaDandy/cuent-ai-core/src/model"
+	"github.com/google/uuid"
+)
+
+type Service struct {
+	repo *Repository
+}
+
+func NewService(r *Repository) *Service {
+	return &Service{repo: r}
+}
+
+func (s *Service) FindAll(opts *helper.FindAllOptions) (*helper.PaginatedResponse[VoiceResponse], error) {
+	voices, total, err := s.repo.FindAll(opts)
+	if err != nil {
+		return nil, err
+	}
+	dtos := VoicesToListDTO(voices)
+	pages := uint((total + int64(opts.Limit) - 1) / int64(opts.Limit))
+
+	return &helper.PaginatedResponse[VoiceResponse]{
+		Data:   dtos,
+		Total:  total,
+		Limit:  opts.Limit,
+		Offset: opts.Offset,
+		Pages:  pages,
+	}, nil
+}
+
+func (s *Service) FindByID(id string) (*VoiceResponse, error) {
+	voice, err := s.repo.FindById(id)
+	if err != nil {
+		return nil, err
+	}
+	dto := VoiceToDTO(voice)
+	return &dto, nil
+}
+
+func (s *Service) Create(input *VoiceCreate) (*VoiceResponse, error) {
+	provider, err := helper.ParseSpeechProvider(input.Provider)
+	if err != nil {
+		return nil, err
+	}
+	if provider == "" {
+		return nil, errors.New("el proveedor de la voz es obligatorio")
+	}
+
+	voice := model.Voice{
+		ID:              uuid.New(),
+		Name:            input.Name,
+		Provider:        provider,
+		ProviderVoiceID: input.ProviderVoiceID,
+		Language:        input.Language,
+		Stability:       input.Stability,
+		Similarity:      input.Similarity,
+	}
+	if err := s.repo.Create(&voice); err != nil {
+		return nil, err
+	}
+
+	dto := VoiceToDTO(&voice)
+	return &dto, nil
+}
+
+func (s *Service) Update(id string, input *VoiceUpdate) (*VoiceResponse, error) {
+	voice, err := s.repo.FindById(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if input.Name != nil {
+		voice.Name = *input.Name
+	}
+	if input.ProviderVoiceID != nil {
+		voice.ProviderVoiceID = *input.ProviderVoiceID
+	}
+	if input.Language != nil {
+		voice.Language = *input.Language
+	}
+	if input.Stability != nil {
+		voice.Stability = *input.Stability
+	}
+	if input.Similarity != nil {
+		voice.Similarity = *input.Similarity
+	}
+
+	if err := s.repo.Update(voice); err != nil {
+		return nil, err
+	}
+
+	dto := VoiceToDTO(voice)
+	return &dto, nil
+}
+
+func (s *Service) SoftDelete(id string) error {
+	if _, err := s.repo.FindById(id); err != nil {
+		return err
+	}
+	return s.repo.SoftDelete(id)
+}
@@ -0,0 +1,86 @@
+package ws
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"gorm.io/gorm"
+)
+
+// Op es la operación que un Hub le pide a todas las réplicas.
+type Op string
+
+const (
+	// OpBroadcast entrega Data a los clientes de Room.
+	OpBroadcast Op = "broadcast"
+	// OpClose cierra las conexiones de Room; sólo las de UserID si viene.
+	OpClose Op = "close"
+	// OpMembers anuncia los clientes que Origin tiene en Room.
+	OpMembers Op = "members"
+)
+
+// Envelope es lo que viaja por el backplane.
+type Envelope struct {
+	Op      Op              `json:"op"`
+	Origin  string          `json:"origin"`
+	Room    string          `json:"room"`
+	UserID  string          `json:"user_id,omitempty"`
+	Data    json.RawMessage `json:"data,omitempty"`
+	Members []Member        `json:"members,omitempty"`
+}
+
+// Member es un cliente de una sala, esté en esta réplica o en otra.
+type Member struct {
+	ClientID string `json:"client_id"`
+	UserID   string `json:"user_id"`
+}
+
+// Backplane reparte las operaciones de los Hub entre réplicas de la API.
+// Publish debe entregar cada envelope a todos los suscriptores, también al
+// Hub que lo mandó, y en el mismo orden a todos.
+type Backplane interface {
+	Publish(env Envelope) error
+	Subscribe(deliver func(Envelope))
+}
+
+// NewBackplaneFromEnv elige el backplane según WS_BACKPLANE: MEMORY (por
+// defecto, una sola réplica) o POSTGRES (LISTEN/NOTIFY sobre DATABASE_URL).
+func NewBackplaneFromEnv(db *gorm.DB) (Backplane, error) {
+	switch backend := strings.ToUpper(os.Getenv("WS_BACKPLANE")); backend {
+	case "", "MEMORY":
+		return NewMemoryBackplane(), nil
+	case "POSTGRES":
+		return NewPostgresBackplane(db, os.Getenv("DATABASE_URL")), nil
+	default:
+		return nil, fmt.Errorf("backplane de websocket no soportado: %s", backend)
+	}
+}
+
+// MemoryBackplane entrega los envelopes en el mismo proceso, en el momento.
+type MemoryBackplane struct {
+	mu   sync.RWMutex
+	subs []func(Envelope)
+}
+
+func NewMemoryBackplane() *MemoryBackplane {
+	return &MemoryBackplane{}
+}
+
+func (b *MemoryBackplane) Publish(env Envelope) error {
+	b.mu.RLock()
+	subs := b.subs
+	b.mu.RUnlock()
+	for _, deliver := range subs {
+		deliver(env)
+	}
+	return nil
+}
+
+func (b *MemoryBackplane) Subscribe(deliver func(Envelope)) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.subs = append(b.subs, deliver)
+}
@@ -0,0 +1,123 @@
+package ws
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/MetaDandy/cuent-ai-core/src/model"
+	"github.com/jackc/pgx/v5"
+	"gorm.io/gorm"
+)
+
+const (
+	pgChannel = "cuent_ws"
+	// pgNotifyLimit deja margen bajo los 8000 bytes que admite NOTIFY.
+	pgNotifyLimit = 7900
+	// pgSpillTTL es cuánto se guardan los envelopes grandes en ws_messages.
+	pgSpillTTL = 5 * time.Minute
+)
+
+// PostgresBackplane reparte los envelopes entre réplicas con LISTEN/NOTIFY
+// sobre la base que ya usa la API. Publica con el pool de gorm y escucha en
+// una conexión propia, que se reabre si se cae; lo que se publique mientras
+// tanto se pierde para esta réplica.
+type PostgresBackplane struct {
+	db  *gorm.DB
+	dsn string
+
+	mu   sync.RWMutex
+	subs []func(Envelope)
+}
+
+// NewPostgresBackplane empieza a escuchar el canal en segundo plano.
+func NewPostgresBackplane(db *gorm.DB, dsn string) *PostgresBackplane {
+	b := &PostgresBackplane{db: db, dsn: dsn}
+	go b.listen()
+	return b
+}
+
+func (b *PostgresBackplane) Subscribe(deliver func(Envelope)) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.subs = append(b.subs, deliver)
+}
+
+// Publish manda el envelope por NOTIFY. Si no entra, lo guarda en
+// ws_messages y notifica "@<id>".
+func (b *PostgresBackplane) Publish(env Envelope) error {
+	payload, err := json.Marshal(env)
+	if err != nil {
+		return err
+	}
+
+	notify := string(payload)
+	if len(payload) > pgNotifyLimit {
+		msg := model.WsMessage{Payload: payload}
+		if err := b.db.Create(&msg).Error; err != nil {
+			return err
+		}
+		b.db.Where("created_at < ?", time.Now().Add(-pgSpillTTL)).Delete(&model.WsMessage{})
+		notify = "@" + strconv.FormatUint(msg.ID, 10)
+	}
+	return b.db.Exec("SELECT pg_notify(?, ?)", pgChannel, notify).Error
+}
+
+func (b *PostgresBackplane) listen() {
+	for {
+		if err := b.listenOnce(); err != nil {
+			log.Printf("[ws] backplane postgres: %v; reintentando", err)
+		}
+		time.Sleep(2 * time.Second)
+	}
+}
+
+func (b *PostgresBackplane) listenOnce() error {
+	ctx := context.Background()
+	conn, err := pgx.Connect(ctx, b.dsn)
+	if err != nil {
+		return err
+	}
+	defer conn.Close(ctx)
+
+	if _, err := conn.Exec(ctx, "LISTEN "+pgChannel); err != nil {
+		return err
+	}
+	for {
+		n, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+		env, err := b.decode(n.Payload)
+		if err != nil {
+			log.Printf("[ws] backplane postgres: envelope inválido: %v", err)
+			continue
+		}
+
+		b.mu.RLock()
+		subs := b.subs
+		b.mu.RUnlock()
+		for _, deliver := range subs {
+			deliver(env)
+		}
+	}
+}
+
+// decode lee el envelope de la notificación o, si es "@<id>", de
+// ws_messages.
+func (b *PostgresBackplane) decode(payload string) (Envelope, error) {
+	var env Envelope
+	raw := []byte(payload)
+	if id, ok := strings.CutPrefix(payload, "@"); ok {
+		var msg model.WsMessage
+		if err := b.db.First(&msg, "id = ?", id).Error; err != nil {
+			return env, err
+		}
+		raw = msg.Payload
+	}
+	return env, json.Unmarshal(raw, &env)
+}
@@ -1,40 +1,162 @@
 package ws
 
-import "github.com/gofiber/websocket/v2"
+import (
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
 
-// Client representa una conexión en una sala.
+	"github.com/gofiber/websocket/v2"
+	"github.com/google/uuid"
+)
+
+// CloseSlowClient es el código con el que se cierra a un cliente que no lee
+// lo bastante rápido y se le llenó el buffer de envío.
+const CloseSlowClient = websocket.ClosePolicyViolation
+
+// maxMessageSize limita lo que puede mandar un cliente en un mensaje.
+const maxMessageSize = 64 << 10
+
+// Client representa una conexión en una sala. Un mismo usuario puede tener
+// varias (p. ej. dos pestañas); cada una tiene su propio id.
 type Client struct {
+	id     string
 	roomID string
 	userID string
 	conn   *websocket.Conn
 	send   chan []byte
+	cfg    Config
+	hub    *Hub
+
+	evict sync.Once
 }
 
-// NewClient crea un cliente para la sala y usuario especificados.
+// NewClient crea un cliente para la sala y usuario especificados, con la
+// configuración por defecto.
 func NewClient(roomID, userID string, conn *websocket.Conn) *Client {
-	return &Client{roomID: roomID, userID: userID, conn: conn, send: make(chan []byte, 256)}
+	return newClient(roomID, userID, conn, DefaultConfig(), nil)
+}
+
+// NewClient crea un cliente con la configuración del Hub, que además cuenta
+// sus mensajes descartados.
+func (h *Hub) NewClient(roomID, userID string, conn *websocket.Conn) *Client {
+	return newClient(roomID, userID, conn, h.cfg, h)
+}
+
+func newClient(roomID, userID string, conn *websocket.Conn, cfg Config, h *Hub) *Client {
+	return &Client{
+		id:     uuid.NewString(),
+		roomID: roomID,
+		userID: userID,
+		conn:   conn,
+		send:   make(chan []byte, cfg.SendBuffer),
+		cfg:    cfg,
+		hub:    h,
+	}
+}
+
+func (c *Client) ID() string     { return c.id }
+func (c *Client) RoomID() string { return c.roomID }
+func (c *Client) UserID() string { return c.userID }
+
+// Send encola un mensaje para el cliente sin bloquear. Si su buffer está
+// lleno el mensaje se descarta y el cliente se expulsa: perdió mensajes y
+// tiene que reconectarse para recibir un estado completo.
+func (c *Client) Send(msg []byte) {
+	select {
+	case c.send <- msg:
+	default:
+		if c.hub != nil {
+			c.hub.dropped.Add(1)
+		}
+		c.evict.Do(func() {
+			if c.hub != nil {
+				c.hub.evicted.Add(1)
+			}
+			log.Printf("[ws] cliente %s expulsado de la sala %s: buffer de envío lleno", c.id, c.roomID)
+			go c.close(CloseSlowClient, "buffer de envío lleno")
+		})
+	}
+}
+
+// SendJSON serializa v y lo encola para el cliente.
+func (c *Client) SendJSON(v any) {
+	msg, err := json.Marshal(v)
+	if err != nil {
+		log.Printf("[ws] error serializando mensaje: %v", err)
+		return
+	}
+	c.Send(msg)
+}
+
+// close manda el frame de cierre con el código y corta la conexión; el
+// ReadPump termina y saca al cliente de la sala.
+func (c *Client) close(code int, reason string) {
+	if c.conn == nil {
+		return
+	}
+	c.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason),
+		time.Now().Add(c.cfg.WriteWait))
+	c.conn.Close()
 }
 
-// ReadPump lee mensajes del cliente y los retransmite a la sala.
-func (c *Client) ReadPump(h *Hub) {
-	defer h.Unregister(c.roomID, c.userID)
+// ReadPump lee los mensajes del cliente y se los pasa al handler de la sala
+// hasta que se cierra la conexión. Si en PongWait no llega ni un mensaje ni
+// un pong, la conexión se da por muerta.
+func (c *Client) ReadPump(h *Hub, rooms RoomHandler) {
+	defer func() {
+		h.Unregister(c.roomID, c.id)
+		rooms.Leave(h, c)
+	}()
+
+	c.conn.SetReadLimit(maxMessageSize)
+	c.conn.SetReadDeadline(time.Now().Add(c.cfg.PongWait))
+	c.conn.SetPongHandler(func(string) error {
+		return c.conn.SetReadDeadline(time.Now().Add(c.cfg.PongWait))
+	})
 	for {
 		_, msg, err := c.conn.ReadMessage()
 		if err != nil {
 			break
 		}
+		c.conn.SetReadDeadline(time.Now().Add(c.cfg.PongWait))
 
 		if string(msg) == `{"type":"disconnect"}` {
 			return // sale de ReadPump y dispara defer Unregister
 		}
 
-		h.Broadcast(c.roomID, msg)
+		rooms.Message(h, c, msg)
 	}
 }
 
-// WritePump envía mensajes desde el canal send al cliente.
+// WritePump envía mensajes desde el canal send al cliente y le manda un
+// ping cada PingInterval. Ante un error de escritura corta la conexión, lo
+// que también termina el ReadPump.
 func (c *Client) WritePump() {
-	for msg := range c.send {
-		c.conn.WriteMessage(websocket.TextMessage, msg)
+	ticker := time.NewTicker(c.cfg.PingInterval)
+	defer func() {
+		ticker.Stop()
+		c.conn.Close()
+	}()
+
+	for {
+		select {
+		case msg, ok := <-c.send:
+			c.conn.SetWriteDeadline(time.Now().Add(c.cfg.WriteWait))
+			if !ok {
+				// El Hub cerró el canal: el cliente ya salió de la sala.
+				c.conn.WriteMessage(websocket.CloseMessage,
+					websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+				return
+			}
+			if err := c.conn.WriteMessage(websocket.TextMessage, msg); err != nil {
+				return
+			}
+		case <-ticker.C:
+			c.conn.SetWriteDeadline(time.Now().Add(c.cfg.WriteWait))
+			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		}
 	}
 }
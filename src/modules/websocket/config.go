@@ -0,0 +1,74 @@
+package ws
+
+import (
+	"os"
+	"strconv"
+	"time"
+)
+
+// Config son los tiempos y el buffer de cada conexión.
+type Config struct {
+	// PingInterval es cada cuánto se le manda un ping al cliente.
+	PingInterval time.Duration
+	// PongWait es cuánto se espera un pong (o cualquier mensaje) antes de
+	// dar la conexión por muerta; debe ser mayor que PingInterval.
+	PongWait time.Duration
+	// WriteWait es el plazo de cada escritura.
+	WriteWait time.Duration
+	// SendBuffer es cuántos mensajes pueden esperar a ser escritos; si se
+	// llena, el cliente se expulsa con CloseSlowClient.
+	SendBuffer int
+}
+
+// DefaultConfig hace ping cada 25 s, espera el pong 60 s, da 10 s a cada
+// escritura y deja 256 mensajes en cola.
+func DefaultConfig() Config {
+	return Config{
+		PingInterval: 25 * time.Second,
+		PongWait:     60 * time.Second,
+		WriteWait:    10 * time.Second,
+		SendBuffer:   256,
+	}
+}
+
+// ConfigFromEnv lee WS_PING_INTERVAL, WS_PONG_WAIT, WS_WRITE_WAIT (p. ej.
+// "30s") y WS_SEND_BUFFER; lo que falte o no sea válido queda por defecto.
+func ConfigFromEnv() Config {
+	cfg := DefaultConfig()
+	cfg.PingInterval = envDuration("WS_PING_INTERVAL", cfg.PingInterval)
+	cfg.PongWait = envDuration("WS_PONG_WAIT", cfg.PongWait)
+	cfg.WriteWait = envDuration("WS_WRITE_WAIT", cfg.WriteWait)
+	if n, err := strconv.Atoi(os.Getenv("WS_SEND_BUFFER")); err == nil && n > 0 {
+		cfg.SendBuffer = n
+	}
+	return cfg.normalize()
+}
+
+// normalize completa los valores en cero y deja el ping dentro del plazo
+// del pong.
+func (c Config) normalize() Config {
+	def := DefaultConfig()
+	if c.PingInterval <= 0 {
+		c.PingInterval = def.PingInterval
+	}
+	if c.PongWait <= 0 {
+		c.PongWait = def.PongWait
+	}
+	if c.WriteWait <= 0 {
+		c.WriteWait = def.WriteWait
+	}
+	if c.SendBuffer <= 0 {
+		c.SendBuffer = def.SendBuffer
+	}
+	if c.PingInterval >= c.PongWait {
+		c.PingInterval = c.PongWait * 9 / 10
+	}
+	return c
+}
+
+func envDuration(key string, def time.Duration) time.Duration {
+	if d, err := time.ParseDuration(os.Getenv(key)); err == nil && d > 0 {
+		return d
+	}
+	return def
+}
@@ -0,0 +1,52 @@
+package ws
+
+import (
+	"encoding/json"
+	"log"
+)
+
+type EventType string
+
+const (
+	EventAudio  EventType = "asset.audio"
+	EventVideo  EventType = "asset.video"
+	EventMix    EventType = "script.mix"
+	EventRender EventType = "script.video"
+)
+
+// Event es el mensaje que el backend empuja a las salas cuando cambia el
+// estado de generación de un asset o del mix o el video de un script.
+type Event struct {
+	Type     EventType `json:"type"`
+	AssetID  string    `json:"asset_id,omitempty"`
+	ScriptID string    `json:"script_id"`
+	State    string    `json:"state"`
+	URL      string    `json:"url,omitempty"`
+	Error    string    `json:"error,omitempty"`
+}
+
+// Publish serializa el evento y lo difunde en cada sala indicada. Las salas
+// vacías se ignoran. Es seguro llamarlo sobre un Hub nil.
+func (h *Hub) Publish(evt Event, rooms ...string) {
+	h.PublishJSON(evt, rooms...)
+}
+
+// PublishJSON difunde cualquier mensaje serializable, como los de edición
+// colaborativa, con las mismas reglas que Publish.
+func (h *Hub) PublishJSON(v any, rooms ...string) {
+	if h == nil {
+		return
+	}
+
+	msg, err := json.Marshal(v)
+	if err != nil {
+		log.Printf("[ws] error serializando evento: %v", err)
+		return
+	}
+
+	for _, room := range rooms {
+		if room != "" {
+			h.Broadcast(room, msg)
+		}
+	}
+}
@@ -1,100 +1,295 @@
 package ws
 
 import (
+	"context"
 	"errors"
-	"fmt"
+	"log"
 	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ErrRoomFull se devuelve al entrar a una sala que ya tiene maxClients.
+var ErrRoomFull = errors.New("sala llena")
+
+const (
+	// Cada réplica vuelve a anunciar sus clientes cada membersRefresh; los
+	// de una réplica que deja de anunciarlos se olvidan tras membersTTL.
+	membersRefresh = 30 * time.Second
+	membersTTL     = 3 * membersRefresh
 )
 
+// remoteMembers son los clientes que otra réplica tiene en una sala.
+type remoteMembers struct {
+	members []Member
+	seen    time.Time
+}
+
+// Hub guarda las salas de esta réplica. Broadcast, Disconnect y CloseRoom
+// pasan por el backplane para llegar también a los clientes conectados a
+// otras réplicas, y cada réplica anuncia los suyos para que Members y el
+// límite de la sala vean a todos.
 type Hub struct {
+	id         string
+	bp         Backplane
 	mu         sync.Mutex
 	rooms      map[string]map[string]*Client
+	remote     map[string]map[string]*remoteMembers // sala -> réplica
 	maxClients int
+	cfg        Config
+
+	dropped atomic.Int64
+	evicted atomic.Int64
+}
+
+// Stats son los contadores del Hub en esta réplica desde que arrancó.
+type Stats struct {
+	Rooms   int `json:"rooms"`
+	Clients int `json:"clients"`
+	// Mensajes descartados porque el buffer del cliente estaba lleno.
+	Dropped int64 `json:"dropped_messages"`
+	// Clientes expulsados con CloseSlowClient.
+	Evicted int64 `json:"evicted_clients"`
 }
 
-func NewHub(maxClients int) *Hub {
-	return &Hub{
+// NewHub crea el Hub sobre el backplane; con nil usa uno en memoria, que
+// sirve para una sola réplica. Los valores en cero de cfg quedan por
+// defecto. El anuncio periódico de las salas corre hasta que se cancela ctx.
+func NewHub(ctx context.Context, maxClients int, bp Backplane, cfg Config) *Hub {
+	if bp == nil {
+		bp = NewMemoryBackplane()
+	}
+	h := &Hub{
+		id:         uuid.NewString(),
+		bp:         bp,
 		rooms:      make(map[string]map[string]*Client),
+		remote:     make(map[string]map[string]*remoteMembers),
 		maxClients: maxClients,
+		cfg:        cfg.normalize(),
 	}
+	bp.Subscribe(h.deliver)
+	go h.refreshMembers(ctx)
+	return h
 }
 
-// ! no hacer caso a go y no cambiar []byte por fmt.Appendf
-
-// Register añade un cliente a la sala indicada; devuelve error si la sala está llena.
-// Además notifica a los demás usuarios (excepto al recién unido).
-func (h *Hub) Register(roomID, userID string, c *Client) error {
+// Register añade un cliente a la sala indicada; devuelve ErrRoomFull si la
+// sala, contando las otras réplicas, está llena. No le escribe nada al
+// cliente: avisar a los demás le toca al RoomHandler de la sala.
+func (h *Hub) Register(roomID string, c *Client) error {
 	h.mu.Lock()
-	defer h.mu.Unlock()
-	if _, ok := h.rooms[roomID]; !ok {
-		h.rooms[roomID] = make(map[string]*Client)
-	}
 	room := h.rooms[roomID]
-	if len(room) >= h.maxClients {
-		return errors.New("sala llena")
+	if len(room)+h.remoteCount(roomID) >= h.maxClients {
+		h.mu.Unlock()
+		return ErrRoomFull
 	}
-	// Notificar unión a otros clientes
-	for _, client := range room {
-		client.send <- []byte(fmt.Sprintf("%s se ha unido a la sala", userID))
+	if room == nil {
+		room = make(map[string]*Client)
+		h.rooms[roomID] = room
 	}
-	room[userID] = c
+	room[c.id] = c
+	h.mu.Unlock()
+
+	h.announce(roomID)
 	return nil
 }
 
-// Unregister elimina un cliente de la sala; cierra la conexión y elimina la sala si queda vacía.
-// Además notifica a los demás usuarios (excepto al que sale).
-func (h *Hub) Unregister(roomID, userID string) {
+// Unregister elimina un cliente de la sala y cierra su conexión; la sala se
+// borra si queda vacía.
+func (h *Hub) Unregister(roomID, clientID string) {
+	h.mu.Lock()
+	room, ok := h.rooms[roomID]
+	if !ok {
+		h.mu.Unlock()
+		return
+	}
+	if client, exists := room[clientID]; exists {
+		if client.conn != nil {
+			client.conn.Close()
+		}
+		close(client.send)
+		delete(room, clientID)
+	}
+	if len(room) == 0 {
+		delete(h.rooms, roomID)
+	}
+	h.mu.Unlock()
+
+	h.announce(roomID)
+}
+
+// Disconnect cierra, en todas las réplicas, las conexiones del usuario en
+// la sala. Cada una sale de la sala al terminar su ReadPump.
+func (h *Hub) Disconnect(roomID, userID string) {
+	h.publish(Envelope{Op: OpClose, Room: roomID, UserID: userID})
+}
+
+// Clients devuelve los clientes conectados a la sala en esta réplica.
+func (h *Hub) Clients(roomID string) []*Client {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	clients := make([]*Client, 0, len(h.rooms[roomID]))
+	for _, c := range h.rooms[roomID] {
+		clients = append(clients, c)
+	}
+	return clients
+}
+
+// Members devuelve los clientes de la sala en todas las réplicas.
+func (h *Hub) Members(roomID string) []Member {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	members := h.localMembers(roomID)
+	for _, r := range h.remote[roomID] {
+		if time.Since(r.seen) < membersTTL {
+			members = append(members, r.members...)
+		}
+	}
+	return members
+}
+
+// Stats devuelve los contadores del Hub.
+func (h *Hub) Stats() Stats {
 	h.mu.Lock()
-	if room, ok := h.rooms[roomID]; ok {
-		// Notificar salida a otros clientes
-		for uid, client := range room {
-			if uid != userID {
-				client.send <- []byte(fmt.Sprintf("%s ha abandonado la sala", userID))
+	st := Stats{Rooms: len(h.rooms)}
+	for _, room := range h.rooms {
+		st.Clients += len(room)
+	}
+	h.mu.Unlock()
+
+	st.Dropped = h.dropped.Load()
+	st.Evicted = h.evicted.Load()
+	return st
+}
+
+// Broadcast envía un mensaje JSON a todos los clientes de una sala, estén
+// en la réplica que estén.
+func (h *Hub) Broadcast(roomID string, message []byte) {
+	h.publish(Envelope{Op: OpBroadcast, Room: roomID, Data: message})
+}
+
+// CloseRoom cierra todas las conexiones de la sala en todas las réplicas.
+// Los clientes salen de la sala al terminar su ReadPump.
+func (h *Hub) CloseRoom(roomID string) {
+	h.publish(Envelope{Op: OpClose, Room: roomID})
+}
+
+// publish manda el envelope por el backplane; si falla, al menos se aplica
+// en esta réplica.
+func (h *Hub) publish(env Envelope) {
+	env.Origin = h.id
+	if err := h.bp.Publish(env); err != nil {
+		log.Printf("[ws] backplane: %v", err)
+		h.deliver(env)
+	}
+}
+
+// deliver aplica un envelope que llegó por el backplane. Send nunca
+// bloquea, así que un cliente lento no frena a los demás ni retiene h.mu.
+func (h *Hub) deliver(env Envelope) {
+	switch env.Op {
+	case OpBroadcast:
+		h.mu.Lock()
+		for _, client := range h.rooms[env.Room] {
+			client.Send(env.Data)
+		}
+		h.mu.Unlock()
+	case OpClose:
+		for _, c := range h.Clients(env.Room) {
+			if env.UserID == "" || c.userID == env.UserID {
+				c.conn.Close()
 			}
 		}
-		// Cerrar y eliminar cliente
-		if client, exists := room[userID]; exists {
-			client.conn.Close()
-			close(client.send)
-			delete(room, userID)
+	case OpMembers:
+		if env.Origin == h.id {
+			return
 		}
-		debeCerrar := len(room) == 0
+		h.mu.Lock()
+		remote := h.remote[env.Room]
+		_, known := remote[env.Origin]
+		if len(env.Members) == 0 {
+			delete(remote, env.Origin)
+		} else {
+			if remote == nil {
+				remote = make(map[string]*remoteMembers)
+				h.remote[env.Room] = remote
+			}
+			remote[env.Origin] = &remoteMembers{members: env.Members, seen: time.Now()}
+		}
+		if len(remote) == 0 {
+			delete(h.remote, env.Room)
+		}
+		_, local := h.rooms[env.Room]
 		h.mu.Unlock()
 
-		if debeCerrar {
-			h.CloseRoom(roomID)
+		// Una réplica nueva en la sala todavía no conoce nuestros clientes.
+		if !known && local {
+			h.announce(env.Room)
 		}
 	}
 }
 
-// Broadcast envía un mensaje a todos los clientes de una sala.
-func (h *Hub) Broadcast(roomID string, message []byte) {
+// announce publica los clientes que esta réplica tiene en la sala; una
+// lista vacía avisa que ya no tiene ninguno.
+func (h *Hub) announce(roomID string) {
 	h.mu.Lock()
-	room, ok := h.rooms[roomID]
+	members := h.localMembers(roomID)
 	h.mu.Unlock()
-	if !ok {
-		return
-	}
-	for _, client := range room {
+	h.publish(Envelope{Op: OpMembers, Room: roomID, Members: members})
+}
+
+// refreshMembers vuelve a anunciar las salas de esta réplica y olvida las
+// réplicas que dejaron de anunciarse.
+func (h *Hub) refreshMembers(ctx context.Context) {
+	ticker := time.NewTicker(membersRefresh)
+	defer ticker.Stop()
+
+	for {
 		select {
-		case client.send <- message:
-		default:
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		h.mu.Lock()
+		rooms := make([]string, 0, len(h.rooms))
+		for roomID := range h.rooms {
+			rooms = append(rooms, roomID)
+		}
+		for roomID, remote := range h.remote {
+			for origin, r := range remote {
+				if time.Since(r.seen) >= membersTTL {
+					delete(remote, origin)
+				}
+			}
+			if len(remote) == 0 {
+				delete(h.remote, roomID)
+			}
+		}
+		h.mu.Unlock()
+
+		for _, roomID := range rooms {
+			h.announce(roomID)
 		}
 	}
 }
 
-// CloseRoom cierra todas las conexiones en una sala y elimina la sala.
-func (h *Hub) CloseRoom(roomID string) {
-	h.mu.Lock()
-	room, ok := h.rooms[roomID]
-	if ok {
-		delete(h.rooms, roomID)
+// localMembers y remoteCount se llaman con h.mu tomado.
+func (h *Hub) localMembers(roomID string) []Member {
+	members := make([]Member, 0, len(h.rooms[roomID]))
+	for _, c := range h.rooms[roomID] {
+		members = append(members, Member{ClientID: c.id, UserID: c.userID})
 	}
-	h.mu.Unlock()
+	return members
+}
 
-	for _, client := range room {
-		client.send <- []byte(fmt.Sprintf("La sala %s ha sido cerrada por el servidor", roomID))
-		client.conn.Close()
-		close(client.send)
+func (h *Hub) remoteCount(roomID string) int {
+	n := 0
+	for _, r := range h.remote[roomID] {
+		if time.Since(r.seen) < membersTTL {
+			n += len(r.members)
+		}
 	}
+	return n
 }
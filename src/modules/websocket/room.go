@@ -0,0 +1,25 @@
+package ws
+
+// RoomHandler define quién puede entrar a una clase de salas y qué se hace
+// con los mensajes de sus clientes.
+type RoomHandler interface {
+	// Authorize comprueba que el usuario pueda entrar a la sala; se llama
+	// antes de abrir el websocket.
+	Authorize(userID, roomID string) error
+	// Join se llama con el cliente ya registrado en la sala.
+	Join(h *Hub, c *Client)
+	// Message procesa un mensaje del cliente.
+	Message(h *Hub, c *Client, msg []byte)
+	// Leave se llama cuando el cliente ya salió de la sala.
+	Leave(h *Hub, c *Client)
+}
+
+// EventRoom es una sala de sólo lectura: sus clientes reciben los eventos de
+// generación (ver Publish) y lo que mandan se descarta. La función decide
+// quién puede entrar.
+type EventRoom func(userID, roomID string) error
+
+func (f EventRoom) Authorize(userID, roomID string) error { return f(userID, roomID) }
+func (EventRoom) Join(*Hub, *Client)                      {}
+func (EventRoom) Message(*Hub, *Client, []byte)           {}
+func (EventRoom) Leave(*Hub, *Client)                     {}
@@ -1,19 +1,50 @@
 package ws
 
-import "github.com/gofiber/websocket/v2"
+import (
+	"net/http"
 
-// ServeWs devuelve un handler para Fiber/WebSocket que gestiona salas.
-func ServeWs(h *Hub) func(*websocket.Conn) {
+	"github.com/MetaDandy/cuent-ai-core/helper"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/websocket/v2"
+)
+
+// Upgrade abre el websocket de la sala :id para el usuario que autenticó
+// middleware.WsJwtMiddleware, si rooms lo autoriza.
+func Upgrade(h *Hub, rooms RoomHandler) fiber.Handler {
+	serve := websocket.New(ServeWs(h, rooms))
+	return func(c *fiber.Ctx) error {
+		userID, ok := c.Locals("user_id").(string)
+		if !ok || userID == "" {
+			return helper.JSONError(c, http.StatusUnauthorized,
+				"Token sin user_id", "")
+		}
+
+		err := rooms.Authorize(userID, c.Params("id"))
+		if helper.IsNotFound(err) {
+			return helper.JSONError(c, http.StatusNotFound,
+				"Sala no encontrada")
+		}
+		if err != nil {
+			return helper.JSONError(c, http.StatusInternalServerError,
+				"Error abriendo la sala", err.Error())
+		}
+		return serve(c)
+	}
+}
+
+// ServeWs devuelve un handler para Fiber/WebSocket que registra la conexión
+// en la sala :id y le pasa sus mensajes a rooms.
+func ServeWs(h *Hub, rooms RoomHandler) func(*websocket.Conn) {
 	return func(c *websocket.Conn) {
-		roomID := c.Query("room")
-		userID := c.Query("user")
-		client := NewClient(roomID, userID, c)
-		go client.WritePump()
-		if err := h.Register(roomID, userID, client); err != nil {
-			c.WriteMessage(websocket.TextMessage, []byte("sala llena"))
+		userID, _ := c.Locals("user_id").(string)
+		client := h.NewClient(c.Params("id"), userID, c)
+		if err := h.Register(client.roomID, client); err != nil {
+			c.WriteMessage(websocket.TextMessage, []byte(err.Error()))
 			c.Close()
 			return
 		}
-		client.ReadPump(h)
+		go client.WritePump()
+		rooms.Join(h, client)
+		client.ReadPump(h, rooms)
 	}
 }
@@ -0,0 +1,57 @@
+//go:build containers
+
+package fixtures
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/MetaDandy/cuent-ai-core/src/model"
+	"github.com/google/uuid"
+)
+
+// CreateTestScript crea un script de prueba
+func CreateTestScript(projectID uuid.UUID) *model.Script {
+	return &model.Script{
+		ID:             uuid.New(),
+		State:          model.StateFinished,
+		Text_Entry:     "Test script",
+		Processed_Text: "Test script",
+		Version:        1,
+		ProjectID:      projectID,
+		CreatedAt:      time.Now(),
+		UpdatedAt:      time.Now(),
+	}
+}
+
+// CreateTestAssets crea count líneas TTS del script en posiciones 0..count-1
+func CreateTestAssets(scriptID uuid.UUID, count int) []model.Asset {
+	assets := make([]model.Asset, count)
+	for i := range assets {
+		assets[i] = model.Asset{
+			ID:         uuid.New(),
+			Type:       model.AudioTTS,
+			Line:       fmt.Sprintf("Línea %d", i),
+			AudioState: model.StatePending,
+			VideoState: model.StatePending,
+			Position:   i,
+			ScriptID:   scriptID,
+			CreatedAt:  time.Now(),
+			UpdatedAt:  time.Now(),
+		}
+	}
+	return assets
+}
+
+// CreateTestJob crea un job de generación para el asset
+func CreateTestJob(assetID, userID uuid.UUID, provider model.Provider, state model.State) *model.GeneratedJob {
+	return &model.GeneratedJob{
+		ID:        uuid.New(),
+		Provider:  provider,
+		State:     state,
+		AssetID:   assetID,
+		UserID:    userID,
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}
+}
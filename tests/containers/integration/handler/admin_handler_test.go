@@ -0,0 +1,229 @@
+//go:build containers
+
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/MetaDandy/cuent-ai-core/config"
+	"github.com/MetaDandy/cuent-ai-core/helper"
+	"github.com/MetaDandy/cuent-ai-core/src/model"
+	"github.com/MetaDandy/cuent-ai-core/tests/containers/fixtures"
+	"github.com/MetaDandy/cuent-ai-core/tests/containers/setup"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestAdminHandler_RequiresRole verifica que /admin rechaza a usuarios comunes
+// y que support sólo puede consultar
+func TestAdminHandler_RequiresRole(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+
+	ctx := context.Background()
+	testDB, err := setup.SetupTestDB(ctx)
+	require.NoError(t, err)
+	defer testDB.Close(ctx)
+
+	config.Migrate(testDB.DB)
+
+	target := fixtures.CreateTestUserWithEmail("target@example.com")
+	err = testDB.DB.Create(target).Error
+	require.NoError(t, err)
+
+	app := setupFiberApp(t, testDB)
+
+	userToken, err := helper.GenerateJwt(target.ID.String(), target.Email, string(model.RoleUser))
+	require.NoError(t, err)
+	supportToken, err := helper.GenerateJwt("00000000-0000-0000-0000-000000000001", "support@example.com", string(model.RoleSupport))
+	require.NoError(t, err)
+
+	requests := []struct {
+		name   string
+		token  string
+		method string
+		path   string
+		body   string
+		want   int
+	}{
+		{"User lista usuarios", userToken, "GET", "/api/v1/admin/users", "", http.StatusForbidden},
+		{"User lista jobs", userToken, "GET", "/api/v1/admin/jobs", "", http.StatusForbidden},
+		{"Support lista usuarios", supportToken, "GET", "/api/v1/admin/users", "", http.StatusOK},
+		{"Support cambia rol", supportToken, "PATCH", "/api/v1/admin/users/" + target.ID.String() + "/role", `{"role": "ADMIN"}`, http.StatusForbidden},
+	}
+	for _, r := range requests {
+		req, _ := http.NewRequest(r.method, r.path, bytes.NewBufferString(r.body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+r.token)
+
+		res, err := app.Test(req, -1)
+		assert.NoError(t, err)
+		assert.Equal(t, r.want, res.StatusCode, r.name)
+	}
+}
+
+// TestAdminHandler_AdjustTokens verifica el ajuste manual de cuentokens y su
+// asiento en el ledger con el admin que lo hizo
+func TestAdminHandler_AdjustTokens(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+
+	ctx := context.Background()
+	testDB, err := setup.SetupTestDB(ctx)
+	require.NoError(t, err)
+	defer testDB.Close(ctx)
+
+	config.Migrate(testDB.DB)
+
+	admin := fixtures.CreateTestUserWithEmail("admin@example.com")
+	admin.Role = model.RoleAdmin
+	err = testDB.DB.Create(admin).Error
+	require.NoError(t, err)
+
+	target := fixtures.CreateTestUserWithEmail("target@example.com")
+	err = testDB.DB.Create(target).Error
+	require.NoError(t, err)
+
+	plan := fixtures.CreateFreeSubscription()
+	err = testDB.DB.Create(plan).Error
+	require.NoError(t, err)
+
+	sub := fixtures.CreateUserSubscription(target.ID, plan.ID, model.StateActive)
+	err = testDB.DB.Create(sub).Error
+	require.NoError(t, err)
+
+	app := setupFiberApp(t, testDB)
+
+	token, err := helper.GenerateJwt(admin.ID.String(), admin.Email, string(model.RoleAdmin))
+	require.NoError(t, err)
+
+	body := bytes.NewBufferString(`{"amount": 50, "note": "compensación"}`)
+	req, _ := http.NewRequest("POST", "/api/v1/admin/users/"+target.ID.String()+"/tokens", body)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	res, err := app.Test(req, -1)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+
+	var response map[string]interface{}
+	json.NewDecoder(res.Body).Decode(&response)
+	assert.Equal(t, "Cuentokens ajustados", response["message"])
+
+	var stored model.UserSubscribed
+	err = testDB.DB.First(&stored, "id = ?", sub.ID).Error
+	assert.NoError(t, err)
+	assert.Equal(t, sub.TokensRemaining+50, stored.TokensRemaining)
+
+	var entry model.TokenLedger
+	err = testDB.DB.Where("user_id = ? AND reason = ?", target.ID, model.LedgerAdminAdjust).First(&entry).Error
+	assert.NoError(t, err)
+	require.NotNil(t, entry.ActorID)
+	assert.Equal(t, admin.ID, *entry.ActorID)
+	assert.Equal(t, "compensación", entry.Note)
+}
+
+// TestAdminHandler_SelfRole verifica que un admin no puede cambiar su propio rol
+func TestAdminHandler_SelfRole(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+
+	ctx := context.Background()
+	testDB, err := setup.SetupTestDB(ctx)
+	require.NoError(t, err)
+	defer testDB.Close(ctx)
+
+	config.Migrate(testDB.DB)
+
+	admin := fixtures.CreateTestUserWithEmail("admin@example.com")
+	admin.Role = model.RoleAdmin
+	err = testDB.DB.Create(admin).Error
+	require.NoError(t, err)
+
+	app := setupFiberApp(t, testDB)
+
+	token, err := helper.GenerateJwt(admin.ID.String(), admin.Email, string(model.RoleAdmin))
+	require.NoError(t, err)
+
+	body := bytes.NewBufferString(`{"role": "USER"}`)
+	req, _ := http.NewRequest("PATCH", "/api/v1/admin/users/"+admin.ID.String()+"/role", body)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	res, err := app.Test(req, -1)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+
+	var stored model.User
+	err = testDB.DB.First(&stored, "id = ?", admin.ID).Error
+	assert.NoError(t, err)
+	assert.Equal(t, model.RoleAdmin, stored.Role)
+}
+
+// TestAdminHandler_SetRoleRevokesSessions verifica que cambiar el rol cierra
+// las sesiones del usuario, así sus tokens con el rol anterior dejan de valer
+func TestAdminHandler_SetRoleRevokesSessions(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+
+	ctx := context.Background()
+	testDB, err := setup.SetupTestDB(ctx)
+	require.NoError(t, err)
+	defer testDB.Close(ctx)
+
+	config.Migrate(testDB.DB)
+
+	admin := fixtures.CreateTestUserWithEmail("admin@example.com")
+	admin.Role = model.RoleAdmin
+	err = testDB.DB.Create(admin).Error
+	require.NoError(t, err)
+
+	target := fixtures.CreateTestUserWithEmail("target@example.com")
+	target.Role = model.RoleAdmin
+	err = testDB.DB.Create(target).Error
+	require.NoError(t, err)
+
+	session := &model.RefreshToken{
+		ID:        uuid.New(),
+		UserID:    target.ID,
+		SessionID: uuid.New(),
+		TokenHash: helper.HashOpaqueToken("target"),
+		ExpiresAt: time.Now().Add(time.Hour),
+	}
+	err = testDB.DB.Create(session).Error
+	require.NoError(t, err)
+
+	app := setupFiberApp(t, testDB)
+
+	token, err := helper.GenerateJwt(admin.ID.String(), admin.Email, string(model.RoleAdmin))
+	require.NoError(t, err)
+
+	body := bytes.NewBufferString(`{"role": "USER"}`)
+	req, _ := http.NewRequest("PATCH", "/api/v1/admin/users/"+target.ID.String()+"/role", body)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	res, err := app.Test(req, -1)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+
+	var stored model.RefreshToken
+	err = testDB.DB.First(&stored, "id = ?", session.ID).Error
+	assert.NoError(t, err)
+	assert.NotNil(t, stored.RevokedAt)
+
+	var revoked int64
+	err = testDB.DB.Model(&model.RevokedToken{}).Where("jti = ?", session.SessionID).Count(&revoked).Error
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), revoked)
+}
@@ -40,14 +40,13 @@ func TestProjectHandler_CreateProject(t *testing.T) {
 	app := setupFiberApp(t, testDB)
 
 	// Generar JWT
-	token, err := helper.GenerateJwt(testUser.ID.String(), testUser.Email)
+	token, err := helper.GenerateJwt(testUser.ID.String(), testUser.Email, string(model.RoleUser))
 	require.NoError(t, err)
 
 	// Preparar request
 	body := bytes.NewBufferString(`{
 		"name": "New Project",
-		"description": "Test project",
-		"user_id": "` + testUser.ID.String() + `"
+		"description": "Test project"
 	}`)
 
 	req, _ := http.NewRequest("POST", "/api/v1/projects", body)
@@ -99,7 +98,7 @@ func TestProjectHandler_GetProject(t *testing.T) {
 	app := setupFiberApp(t, testDB)
 
 	// Generar JWT
-	token, err := helper.GenerateJwt(testUser.ID.String(), testUser.Email)
+	token, err := helper.GenerateJwt(testUser.ID.String(), testUser.Email, string(model.RoleUser))
 	require.NoError(t, err)
 
 	// Preparar request
@@ -147,7 +146,7 @@ func TestProjectHandler_GetProjects(t *testing.T) {
 	app := setupFiberApp(t, testDB)
 
 	// Generar JWT
-	token, err := helper.GenerateJwt(testUser.ID.String(), testUser.Email)
+	token, err := helper.GenerateJwt(testUser.ID.String(), testUser.Email, string(model.RoleUser))
 	require.NoError(t, err)
 
 	// Preparar request
@@ -193,7 +192,7 @@ func TestProjectHandler_UpdateProject(t *testing.T) {
 	app := setupFiberApp(t, testDB)
 
 	// Generar JWT
-	token, err := helper.GenerateJwt(testUser.ID.String(), testUser.Email)
+	token, err := helper.GenerateJwt(testUser.ID.String(), testUser.Email, string(model.RoleUser))
 	require.NoError(t, err)
 
 	// Preparar request
@@ -247,7 +246,7 @@ func TestProjectHandler_DeleteProject(t *testing.T) {
 	app := setupFiberApp(t, testDB)
 
 	// Generar JWT
-	token, err := helper.GenerateJwt(testUser.ID.String(), testUser.Email)
+	token, err := helper.GenerateJwt(testUser.ID.String(), testUser.Email, string(model.RoleUser))
 	require.NoError(t, err)
 
 	// Preparar request
@@ -300,3 +299,62 @@ func TestProjectHandler_CreateProject_MissingToken(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, http.StatusUnauthorized, res.StatusCode)
 }
+
+// TestProjectHandler_ForeignProject verifica que un proyecto de otro usuario
+// responde 404 y no se modifica
+func TestProjectHandler_ForeignProject(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+
+	ctx := context.Background()
+	testDB, err := setup.SetupTestDB(ctx)
+	require.NoError(t, err)
+	defer testDB.Close(ctx)
+
+	config.Migrate(testDB.DB)
+	require.NoError(t, err)
+
+	// Crear dueño, intruso y proyecto del dueño
+	owner := fixtures.CreateTestUserWithEmail("owner@example.com")
+	err = testDB.DB.Create(owner).Error
+	require.NoError(t, err)
+
+	intruder := fixtures.CreateTestUserWithEmail("intruder@example.com")
+	err = testDB.DB.Create(intruder).Error
+	require.NoError(t, err)
+
+	testProject := fixtures.CreateTestProject(owner.ID)
+	err = testDB.DB.Create(testProject).Error
+	require.NoError(t, err)
+
+	app := setupFiberApp(t, testDB)
+
+	// JWT del intruso
+	token, err := helper.GenerateJwt(intruder.ID.String(), intruder.Email, string(model.RoleUser))
+	require.NoError(t, err)
+
+	requests := []struct {
+		method string
+		body   string
+	}{
+		{"GET", ""},
+		{"PATCH", `{"name": "Hijacked"}`},
+		{"DELETE", ""},
+	}
+	for _, r := range requests {
+		req, _ := http.NewRequest(r.method, "/api/v1/projects/"+testProject.ID.String(), bytes.NewBufferString(r.body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+token)
+
+		res, err := app.Test(req, -1)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusNotFound, res.StatusCode, r.method)
+	}
+
+	// El proyecto sigue intacto
+	var stored model.Project
+	findErr := testDB.DB.First(&stored, "id = ?", testProject.ID).Error
+	assert.NoError(t, findErr)
+	assert.Equal(t, testProject.Name, stored.Name)
+}
@@ -8,7 +8,10 @@ import (
 	"encoding/json"
 	"net/http"
 	"os"
+	"path/filepath"
+	"regexp"
 	"testing"
+	"time"
 
 	"github.com/MetaDandy/cuent-ai-core/cmd/api"
 	"github.com/MetaDandy/cuent-ai-core/config"
@@ -34,7 +37,7 @@ func setupFiberApp(t *testing.T, testDB *setup.PostgresTestDB) *fiber.App {
 	app := fiber.New()
 
 	// Setup container con BD de test
-	container := src.SetupContainer()
+	container := src.SetupContainer(t.Context())
 
 	// Setup API
 	api.SetupApi(app, container)
@@ -178,6 +181,74 @@ func TestUserHandler_SignIn(t *testing.T) {
 	err = json.NewDecoder(res.Body).Decode(&resp)
 	assert.NoError(t, err)
 	assert.NotEmpty(t, resp.Token)
+	assert.NotEmpty(t, resp.RefreshToken)
+}
+
+// TestUserHandler_RefreshAndLogout verifica la rotación del refresh token y
+// que tras el logout ni el access token ni el refresh token sirven
+func TestUserHandler_RefreshAndLogout(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+
+	ctx := context.Background()
+	testDB, err := setup.SetupTestDB(ctx)
+	require.NoError(t, err)
+	defer testDB.Close(ctx)
+
+	config.Migrate(testDB.DB)
+
+	hashedPassword, err := helper.HashPassword("password123")
+	require.NoError(t, err)
+
+	testUser := fixtures.CreateTestUserWithEmail("session@example.com")
+	testUser.Password = hashedPassword
+	err = testDB.DB.Create(testUser).Error
+	require.NoError(t, err)
+
+	app := setupFiberApp(t, testDB)
+
+	send := func(method, path, token, body string) (*http.Response, helper.Response) {
+		req, _ := http.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		res, err := app.Test(req, -1)
+		require.NoError(t, err)
+
+		var resp helper.Response
+		json.NewDecoder(res.Body).Decode(&resp)
+		return res, resp
+	}
+
+	// Iniciar sesión
+	res, login := send("POST", "/api/v1/users/sign-in", "",
+		`{"email": "session@example.com", "password": "password123"}`)
+	require.Equal(t, http.StatusCreated, res.StatusCode)
+	require.NotEmpty(t, login.RefreshToken)
+
+	// Renovar: llega un par nuevo
+	res, refreshed := send("POST", "/api/v1/users/refresh", "",
+		`{"refresh_token": "`+login.RefreshToken+`"}`)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.NotEmpty(t, refreshed.Token)
+	assert.NotEqual(t, login.RefreshToken, refreshed.RefreshToken)
+
+	// Cerrar sesión con el access token renovado
+	res, _ = send("POST", "/api/v1/users/logout", refreshed.Token, "")
+	assert.Equal(t, http.StatusNoContent, res.StatusCode)
+
+	// Los dos access tokens de la sesión quedan revocados
+	for _, token := range []string{login.Token, refreshed.Token} {
+		res, _ = send("GET", "/api/v1/users/profile", token, "")
+		assert.Equal(t, http.StatusUnauthorized, res.StatusCode)
+	}
+
+	// Y el refresh token tampoco sirve
+	res, _ = send("POST", "/api/v1/users/refresh", "",
+		`{"refresh_token": "`+refreshed.RefreshToken+`"}`)
+	assert.Equal(t, http.StatusUnauthorized, res.StatusCode)
 }
 
 // TestUserHandler_SignIn_InvalidPassword verifica contraseña incorrecta
@@ -248,7 +319,7 @@ func TestUserHandler_GetProfile(t *testing.T) {
 	app := setupFiberApp(t, testDB)
 
 	// Generar JWT
-	token, err := helper.GenerateJwt(testUser.ID.String(), testUser.Email)
+	token, err := helper.GenerateJwt(testUser.ID.String(), testUser.Email, string(model.RoleUser))
 	require.NoError(t, err)
 
 	// Preparar request con Authorization header
@@ -317,7 +388,7 @@ func TestUserHandler_FindById(t *testing.T) {
 	app := setupFiberApp(t, testDB)
 
 	// Generar JWT
-	token, err := helper.GenerateJwt(testUser.ID.String(), testUser.Email)
+	token, err := helper.GenerateJwt(testUser.ID.String(), testUser.Email, string(model.RoleUser))
 	require.NoError(t, err)
 
 	// Preparar request
@@ -336,3 +407,136 @@ func TestUserHandler_FindById(t *testing.T) {
 	err = json.NewDecoder(res.Body).Decode(&resp)
 	assert.NoError(t, err)
 }
+
+// mailedToken espera el correo enviado a dir y devuelve el token del enlace
+func mailedToken(t *testing.T, dir string) string {
+	t.Helper()
+	tokenRx := regexp.MustCompile(`token=([A-Za-z0-9_-]+)`)
+
+	var token string
+	require.Eventually(t, func() bool {
+		files, _ := filepath.Glob(filepath.Join(dir, "*.eml"))
+		for _, f := range files {
+			raw, err := os.ReadFile(f)
+			if err != nil {
+				continue
+			}
+			if m := tokenRx.FindStringSubmatch(string(raw)); m != nil {
+				token = m[1]
+				os.Remove(f)
+				return true
+			}
+		}
+		return false
+	}, 5*time.Second, 50*time.Millisecond)
+	return token
+}
+
+// TestUserHandler_VerifyEmail verifica que el sign-up envía el enlace y que
+// sólo sirve una vez
+func TestUserHandler_VerifyEmail(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+
+	ctx := context.Background()
+	testDB, err := setup.SetupTestDB(ctx)
+	require.NoError(t, err)
+	defer testDB.Close(ctx)
+
+	config.Migrate(testDB.DB)
+	err = fixtures.SeedSubscriptions(testDB.DB)
+	require.NoError(t, err)
+
+	mailDir := t.TempDir()
+	t.Setenv("MAILER_BACKEND", "FILE")
+	t.Setenv("MAIL_DIR", mailDir)
+	app := setupFiberApp(t, testDB)
+
+	body := bytes.NewBufferString(`{"name": "Verify", "email": "verify@example.com", "password": "password123"}`)
+	req, _ := http.NewRequest("POST", "/api/v1/users/sign-up", body)
+	req.Header.Set("Content-Type", "application/json")
+	res, err := app.Test(req, -1)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusCreated, res.StatusCode)
+
+	token := mailedToken(t, mailDir)
+
+	for _, want := range []int{http.StatusOK, http.StatusBadRequest} {
+		req, _ = http.NewRequest("POST", "/api/v1/users/verify-email", bytes.NewBufferString(`{"token": "`+token+`"}`))
+		req.Header.Set("Content-Type", "application/json")
+		res, err = app.Test(req, -1)
+		assert.NoError(t, err)
+		assert.Equal(t, want, res.StatusCode)
+	}
+
+	var stored model.User
+	err = testDB.DB.First(&stored, "email = ?", "verify@example.com").Error
+	assert.NoError(t, err)
+	assert.NotNil(t, stored.EmailVerifiedAt)
+}
+
+// TestUserHandler_ResetPassword verifica el flujo de recuperación: el enlace
+// cambia la contraseña, cierra las sesiones y no se puede reusar
+func TestUserHandler_ResetPassword(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+
+	ctx := context.Background()
+	testDB, err := setup.SetupTestDB(ctx)
+	require.NoError(t, err)
+	defer testDB.Close(ctx)
+
+	config.Migrate(testDB.DB)
+
+	hashedPassword, err := helper.HashPassword("password123")
+	require.NoError(t, err)
+	testUser := fixtures.CreateTestUserWithEmail("forgot@example.com")
+	testUser.Password = hashedPassword
+	err = testDB.DB.Create(testUser).Error
+	require.NoError(t, err)
+
+	mailDir := t.TempDir()
+	t.Setenv("MAILER_BACKEND", "FILE")
+	t.Setenv("MAIL_DIR", mailDir)
+	app := setupFiberApp(t, testDB)
+
+	send := func(path, body string) *http.Response {
+		req, _ := http.NewRequest("POST", path, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		res, err := app.Test(req, -1)
+		require.NoError(t, err)
+		return res
+	}
+
+	// Sesión abierta antes del reset
+	res := send("/api/v1/users/sign-in", `{"email": "forgot@example.com", "password": "password123"}`)
+	require.Equal(t, http.StatusCreated, res.StatusCode)
+	var login helper.Response
+	json.NewDecoder(res.Body).Decode(&login)
+
+	// Un email desconocido responde igual
+	res = send("/api/v1/users/forgot-password", `{"email": "nobody@example.com"}`)
+	assert.Equal(t, http.StatusAccepted, res.StatusCode)
+
+	res = send("/api/v1/users/forgot-password", `{"email": "forgot@example.com"}`)
+	assert.Equal(t, http.StatusAccepted, res.StatusCode)
+	token := mailedToken(t, mailDir)
+
+	reset := `{"token": "` + token + `", "new_password": "newpassword123", "confirm_password": "newpassword123"}`
+	res = send("/api/v1/users/reset-password", reset)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+
+	// El enlace no sirve dos veces
+	res = send("/api/v1/users/reset-password", reset)
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+
+	// La sesión anterior quedó cerrada
+	res = send("/api/v1/users/refresh", `{"refresh_token": "`+login.RefreshToken+`"}`)
+	assert.Equal(t, http.StatusUnauthorized, res.StatusCode)
+
+	// La contraseña nueva funciona
+	res = send("/api/v1/users/sign-in", `{"email": "forgot@example.com", "password": "newpassword123"}`)
+	assert.Equal(t, http.StatusCreated, res.StatusCode)
+}
@@ -0,0 +1,85 @@
+//go:build containers
+
+package handler
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/MetaDandy/cuent-ai-core/config"
+	"github.com/MetaDandy/cuent-ai-core/helper"
+	"github.com/MetaDandy/cuent-ai-core/src/model"
+	"github.com/MetaDandy/cuent-ai-core/tests/containers/setup"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestVoiceHandler_AdminOnlyWrites verifica que cualquier usuario puede
+// consultar el catálogo de voces pero sólo un admin lo modifica
+func TestVoiceHandler_AdminOnlyWrites(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+
+	ctx := context.Background()
+	testDB, err := setup.SetupTestDB(ctx)
+	require.NoError(t, err)
+	defer testDB.Close(ctx)
+
+	config.Migrate(testDB.DB)
+
+	existing := &model.Voice{ID: uuid.New(), Name: "Narrador", Provider: model.ProviderOffline, ProviderVoiceID: "sine"}
+	err = testDB.DB.Create(existing).Error
+	require.NoError(t, err)
+
+	app := setupFiberApp(t, testDB)
+
+	userToken, err := helper.GenerateJwt(uuid.NewString(), "user@example.com", string(model.RoleUser))
+	require.NoError(t, err)
+	supportToken, err := helper.GenerateJwt(uuid.NewString(), "support@example.com", string(model.RoleSupport))
+	require.NoError(t, err)
+	adminToken, err := helper.GenerateJwt(uuid.NewString(), "admin@example.com", string(model.RoleAdmin))
+	require.NoError(t, err)
+
+	voicePath := "/api/v1/voices/" + existing.ID.String()
+	create := `{"name": "Nueva", "provider": "OFFLINE", "provider_voice_id": "sine-2"}`
+	requests := []struct {
+		name   string
+		token  string
+		method string
+		path   string
+		body   string
+		want   int
+	}{
+		{"Sin token", "", "GET", "/api/v1/voices", "", http.StatusUnauthorized},
+		{"User lista voces", userToken, "GET", "/api/v1/voices", "", http.StatusOK},
+		{"User ve una voz", userToken, "GET", voicePath, "", http.StatusOK},
+		{"User crea voz", userToken, "POST", "/api/v1/voices", create, http.StatusForbidden},
+		{"User edita voz", userToken, "PATCH", voicePath, `{"name": "Otra"}`, http.StatusForbidden},
+		{"User borra voz", userToken, "DELETE", voicePath, "", http.StatusForbidden},
+		{"Support crea voz", supportToken, "POST", "/api/v1/voices", create, http.StatusForbidden},
+		{"Admin crea voz", adminToken, "POST", "/api/v1/voices", create, http.StatusCreated},
+		{"Admin edita voz", adminToken, "PATCH", voicePath, `{"name": "Otra"}`, http.StatusOK},
+		{"Admin borra voz", adminToken, "DELETE", voicePath, "", http.StatusNoContent},
+	}
+	for _, r := range requests {
+		req, _ := http.NewRequest(r.method, r.path, bytes.NewBufferString(r.body))
+		req.Header.Set("Content-Type", "application/json")
+		if r.token != "" {
+			req.Header.Set("Authorization", "Bearer "+r.token)
+		}
+
+		res, err := app.Test(req, -1)
+		assert.NoError(t, err)
+		assert.Equal(t, r.want, res.StatusCode, r.name)
+	}
+
+	var stored model.Voice
+	err = testDB.DB.Unscoped().First(&stored, "id = ?", existing.ID).Error
+	require.NoError(t, err)
+	assert.Equal(t, "Otra", stored.Name)
+	assert.True(t, stored.DeletedAt.Valid)
+}
@@ -0,0 +1,187 @@
+//go:build containers
+
+package repository
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/MetaDandy/cuent-ai-core/config"
+	"github.com/MetaDandy/cuent-ai-core/src/model"
+	generatejob "github.com/MetaDandy/cuent-ai-core/src/modules/generate_job"
+	"github.com/MetaDandy/cuent-ai-core/tests/containers/fixtures"
+	"github.com/MetaDandy/cuent-ai-core/tests/containers/setup"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// seedJobAssets crea un usuario con un script de count líneas
+func seedJobAssets(t *testing.T, db *gorm.DB, count int) (uuid.UUID, []model.Asset) {
+	testUser := fixtures.CreateTestUser()
+	require.NoError(t, db.Create(testUser).Error)
+	project := fixtures.CreateTestProject(testUser.ID)
+	require.NoError(t, db.Create(project).Error)
+	script := fixtures.CreateTestScript(project.ID)
+	require.NoError(t, db.Create(script).Error)
+	assets := fixtures.CreateTestAssets(script.ID, count)
+	require.NoError(t, db.Create(&assets).Error)
+	return testUser.ID, assets
+}
+
+// TestGeneratedJobRepository_ClaimNext verifica que se toma el job PENDING
+// más antiguo de los proveedores pedidos y queda ACTIVE con claimed_at
+func TestGeneratedJobRepository_ClaimNext(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+
+	ctx := context.Background()
+	testDB, err := setup.SetupTestDB(ctx)
+	require.NoError(t, err)
+	defer testDB.Close(ctx)
+
+	config.Migrate(testDB.DB)
+
+	userID, assets := seedJobAssets(t, testDB.DB, 3)
+	eleven := fixtures.CreateTestJob(assets[0].ID, userID, model.ProviderElevenlab, model.StatePending)
+	eleven.CreatedAt = time.Now().Add(-time.Minute)
+	older := fixtures.CreateTestJob(assets[1].ID, userID, model.ProviderOpenAI, model.StatePending)
+	older.CreatedAt = time.Now().Add(-30 * time.Second)
+	newer := fixtures.CreateTestJob(assets[2].ID, userID, model.ProviderOpenAI, model.StatePending)
+	require.NoError(t, testDB.DB.Create([]*model.GeneratedJob{eleven, older, newer}).Error)
+
+	repo := generatejob.NewRepository(testDB.DB)
+
+	// ElevenLabs sin cupo: sólo se pide OpenAI
+	job, err := repo.ClaimNext([]model.Provider{model.ProviderOpenAI})
+	require.NoError(t, err)
+	assert.Equal(t, older.ID, job.ID)
+	assert.Equal(t, model.StateActive, job.State)
+
+	var stored model.GeneratedJob
+	require.NoError(t, testDB.DB.First(&stored, "id = ?", older.ID).Error)
+	assert.Equal(t, model.StateActive, stored.State)
+	require.NotNil(t, stored.ClaimedAt)
+
+	job, err = repo.ClaimNext([]model.Provider{model.ProviderOpenAI})
+	require.NoError(t, err)
+	assert.Equal(t, newer.ID, job.ID)
+
+	// No quedan jobs de OpenAI aunque el de ElevenLabs siga PENDING
+	_, err = repo.ClaimNext([]model.Provider{model.ProviderOpenAI})
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+
+	require.NoError(t, testDB.DB.First(&stored, "id = ?", eleven.ID).Error)
+	assert.Equal(t, model.StatePending, stored.State)
+}
+
+// TestGeneratedJobRepository_ClaimNextConcurrent verifica que varios workers
+// a la vez nunca toman el mismo job
+func TestGeneratedJobRepository_ClaimNextConcurrent(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+
+	ctx := context.Background()
+	testDB, err := setup.SetupTestDB(ctx)
+	require.NoError(t, err)
+	defer testDB.Close(ctx)
+
+	config.Migrate(testDB.DB)
+
+	const jobs = 10
+	userID, assets := seedJobAssets(t, testDB.DB, jobs)
+	for _, a := range assets {
+		require.NoError(t, testDB.DB.Create(fixtures.CreateTestJob(a.ID, userID, model.ProviderOffline, model.StatePending)).Error)
+	}
+
+	repo := generatejob.NewRepository(testDB.DB)
+
+	var (
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+		claimed = map[uuid.UUID]int{}
+	)
+	for range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				job, err := repo.ClaimNext([]model.Provider{model.ProviderOffline})
+				if err != nil {
+					return
+				}
+				mu.Lock()
+				claimed[job.ID]++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.Len(t, claimed, jobs)
+	for id, n := range claimed {
+		assert.Equal(t, 1, n, "job %s tomado %d veces", id, n)
+	}
+}
+
+// TestGeneratedJobRepository_RequeueExpired verifica que sólo vuelven a la
+// cola los jobs ACTIVE cuyo lease venció, y que el latido lo renueva
+func TestGeneratedJobRepository_RequeueExpired(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+
+	ctx := context.Background()
+	testDB, err := setup.SetupTestDB(ctx)
+	require.NoError(t, err)
+	defer testDB.Close(ctx)
+
+	config.Migrate(testDB.DB)
+
+	userID, assets := seedJobAssets(t, testDB.DB, 4)
+	old := time.Now().Add(-time.Hour)
+	expired := fixtures.CreateTestJob(assets[0].ID, userID, model.ProviderOpenAI, model.StateActive)
+	expired.ClaimedAt = &old
+	beating := fixtures.CreateTestJob(assets[1].ID, userID, model.ProviderOpenAI, model.StateActive)
+	beating.ClaimedAt = &old
+	// Jobs ACTIVE de antes del lease, sin claimed_at
+	legacy := fixtures.CreateTestJob(assets[2].ID, userID, model.ProviderOpenAI, model.StateActive)
+	finished := fixtures.CreateTestJob(assets[3].ID, userID, model.ProviderOpenAI, model.StateFinished)
+	finished.ClaimedAt = &old
+	require.NoError(t, testDB.DB.Create([]*model.GeneratedJob{expired, beating, legacy, finished}).Error)
+
+	repo := generatejob.NewRepository(testDB.DB)
+
+	require.NoError(t, repo.Heartbeat(beating.ID))
+	// El latido no revive un job que ya terminó
+	require.NoError(t, repo.Heartbeat(finished.ID))
+
+	n, err := repo.RequeueExpired(2 * time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), n)
+
+	states := map[uuid.UUID]model.GeneratedJob{}
+	var stored []model.GeneratedJob
+	require.NoError(t, testDB.DB.Find(&stored).Error)
+	for _, j := range stored {
+		states[j.ID] = j
+	}
+
+	assert.Equal(t, model.StatePending, states[expired.ID].State)
+	assert.Nil(t, states[expired.ID].ClaimedAt)
+	assert.Equal(t, model.StatePending, states[legacy.ID].State)
+	assert.Equal(t, model.StateActive, states[beating.ID].State)
+	assert.Equal(t, model.StateFinished, states[finished.ID].State)
+	require.NotNil(t, states[finished.ID].ClaimedAt)
+	assert.WithinDuration(t, old, *states[finished.ID].ClaimedAt, time.Second)
+
+	// Un job reencolado se puede volver a tomar
+	job, err := repo.ClaimNext([]model.Provider{model.ProviderOpenAI})
+	require.NoError(t, err)
+	assert.Contains(t, []uuid.UUID{expired.ID, legacy.ID}, job.ID)
+}
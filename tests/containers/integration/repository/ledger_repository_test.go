@@ -0,0 +1,237 @@
+//go:build containers
+
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/MetaDandy/cuent-ai-core/config"
+	"github.com/MetaDandy/cuent-ai-core/helper"
+	"github.com/MetaDandy/cuent-ai-core/src/core/user"
+	"github.com/MetaDandy/cuent-ai-core/src/model"
+	"github.com/MetaDandy/cuent-ai-core/tests/containers/fixtures"
+	"github.com/MetaDandy/cuent-ai-core/tests/containers/setup"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// TestUserRepository_DebitCredit verifica que cada movimiento de saldo deja
+// su asiento en el ledger con el saldo resultante
+func TestUserRepository_DebitCredit(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+
+	ctx := context.Background()
+	testDB, err := setup.SetupTestDB(ctx)
+	require.NoError(t, err)
+	defer testDB.Close(ctx)
+
+	config.Migrate(testDB.DB)
+
+	testUser := fixtures.CreateTestUser()
+	require.NoError(t, testDB.DB.Create(testUser).Error)
+	free := fixtures.CreateFreeSubscription()
+	require.NoError(t, testDB.DB.Create(free).Error)
+	sub := fixtures.CreateUserSubscription(testUser.ID, free.ID, model.StateActive)
+	require.NoError(t, testDB.DB.Create(sub).Error)
+
+	repo := user.NewRepository(testDB.DB)
+
+	require.NoError(t, repo.Grant(testDB.DB, sub))
+	require.NoError(t, repo.Debit(testDB.DB, sub, 30, model.TokenLedger{Reason: model.LedgerScriptCreate}))
+	require.NoError(t, repo.Credit(testDB.DB, sub, 10, model.TokenLedger{Reason: model.LedgerSubscriptionGrant}))
+	// El débito se limita al saldo disponible
+	require.NoError(t, repo.Debit(testDB.DB, sub, 500, model.TokenLedger{Reason: model.LedgerScriptMix}))
+
+	var stored model.UserSubscribed
+	require.NoError(t, testDB.DB.First(&stored, "id = ?", sub.ID).Error)
+	assert.Equal(t, uint(0), stored.TokensRemaining)
+
+	entries, total, err := repo.FindLedgerByUserID(testUser.ID.String(), &helper.FindAllOptions{
+		OrderBy: "created_at",
+		Sort:    "asc",
+		Limit:   10,
+	})
+	require.NoError(t, err)
+	require.Equal(t, int64(4), total)
+
+	assert.Equal(t, []int{100, -30, 10, -80}, []int{entries[0].Amount, entries[1].Amount, entries[2].Amount, entries[3].Amount})
+	assert.Equal(t, []uint{100, 70, 80, 0}, []uint{entries[0].BalanceAfter, entries[1].BalanceAfter, entries[2].BalanceAfter, entries[3].BalanceAfter})
+
+	// Los asientos no se pueden modificar ni borrar
+	assert.Error(t, testDB.DB.Model(&entries[0]).Update("amount", 1).Error)
+	assert.Error(t, testDB.DB.Delete(&entries[0]).Error)
+}
+
+// TestUserRepository_Reservation verifica reservar, capturar el costo real y
+// liberar lo retenido cuando la operación falla
+func TestUserRepository_Reservation(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+
+	ctx := context.Background()
+	testDB, err := setup.SetupTestDB(ctx)
+	require.NoError(t, err)
+	defer testDB.Close(ctx)
+
+	config.Migrate(testDB.DB)
+
+	testUser := fixtures.CreateTestUser()
+	require.NoError(t, testDB.DB.Create(testUser).Error)
+	free := fixtures.CreateFreeSubscription()
+	require.NoError(t, testDB.DB.Create(free).Error)
+	sub := fixtures.CreateUserSubscription(testUser.ID, free.ID, model.StateActive)
+	require.NoError(t, testDB.DB.Create(sub).Error)
+
+	repo := user.NewRepository(testDB.DB)
+	balance := func() uint {
+		var stored model.UserSubscribed
+		require.NoError(t, testDB.DB.First(&stored, "id = ?", sub.ID).Error)
+		return stored.TokensRemaining
+	}
+
+	// No se puede reservar más que el saldo
+	_, err = repo.Reserve(testUser.ID.String(), 101, model.TokenLedger{Reason: model.LedgerScriptCreate})
+	assert.Error(t, err)
+	assert.Equal(t, uint(100), balance())
+
+	// Reserva 40, captura 25: se devuelven 15
+	res, err := repo.Reserve(testUser.ID.String(), 40, model.TokenLedger{Reason: model.LedgerScriptCreate})
+	require.NoError(t, err)
+	assert.Equal(t, uint(60), balance())
+	require.NoError(t, repo.Capture(testDB.DB, res, 25))
+	assert.Equal(t, uint(75), balance())
+	assert.Equal(t, model.ReservationCaptured, res.State)
+	assert.Equal(t, uint(25), res.Captured)
+
+	// Una reserva capturada no se puede volver a capturar ni liberar
+	assert.Error(t, repo.Capture(testDB.DB, res, 25))
+	require.NoError(t, repo.Release(res))
+	assert.Equal(t, uint(75), balance())
+
+	// Reserva 30 y la operación falla: se devuelve todo
+	res, err = repo.Reserve(testUser.ID.String(), 30, model.TokenLedger{Reason: model.LedgerAssetAudio})
+	require.NoError(t, err)
+	assert.Equal(t, uint(45), balance())
+	require.NoError(t, repo.Release(res))
+	require.NoError(t, repo.Release(res))
+	assert.Equal(t, uint(75), balance())
+	assert.Equal(t, model.ReservationReleased, res.State)
+}
+
+// TestUserRepository_Renew verifica que una renovación expira el saldo
+// anterior, acredita el del plan y que reaplicar la misma factura no hace nada
+func TestUserRepository_Renew(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+
+	ctx := context.Background()
+	testDB, err := setup.SetupTestDB(ctx)
+	require.NoError(t, err)
+	defer testDB.Close(ctx)
+
+	config.Migrate(testDB.DB)
+
+	testUser := fixtures.CreateTestUser()
+	require.NoError(t, testDB.DB.Create(testUser).Error)
+	premium := fixtures.CreatePremiumSubscription()
+	require.NoError(t, testDB.DB.Create(premium).Error)
+	sub := fixtures.CreateUserSubscription(testUser.ID, premium.ID, model.StateActive)
+	sub.TokensRemaining = 40
+	sub.StripeSubscriptionID = "sub_123"
+	require.NoError(t, testDB.DB.Create(sub).Error)
+
+	repo := user.NewRepository(testDB.DB)
+	found, err := repo.FindUserSubscribedByStripeID("sub_123")
+	require.NoError(t, err)
+
+	start := time.Now().Truncate(time.Second)
+	end := start.AddDate(0, 1, 0)
+	renew := func() error {
+		return repo.Renew(found, start, end, "in_cycle_1", &model.Payment{
+			ID:     uuid.New(),
+			UserID: testUser.ID.String(),
+			Amount: 1000,
+			Status: model.StateActive,
+		})
+	}
+	require.NoError(t, renew())
+	// Stripe puede reenviar el evento: la segunda vez no debe acreditar
+	require.NoError(t, renew())
+
+	var stored model.UserSubscribed
+	require.NoError(t, testDB.DB.First(&stored, "id = ?", sub.ID).Error)
+	assert.Equal(t, premium.Cuentokens, stored.TokensRemaining)
+	assert.Equal(t, "in_cycle_1", stored.StripeLatestInvoiceID)
+	assert.True(t, stored.EndDate.Equal(end))
+
+	entries, total, err := repo.FindLedgerByUserID(testUser.ID.String(), &helper.FindAllOptions{
+		OrderBy: "created_at",
+		Sort:    "asc",
+		Limit:   10,
+	})
+	require.NoError(t, err)
+	require.Equal(t, int64(2), total)
+	assert.Equal(t, model.LedgerSubscriptionExpire, entries[0].Reason)
+	assert.Equal(t, -40, entries[0].Amount)
+	assert.Equal(t, model.LedgerSubscriptionRenewal, entries[1].Reason)
+	assert.Equal(t, int(premium.Cuentokens), entries[1].Amount)
+
+	var payments int64
+	require.NoError(t, testDB.DB.Model(&model.Payment{}).Where("user_suscribed_id = ?", sub.ID.String()).Count(&payments).Error)
+	assert.Equal(t, int64(1), payments)
+}
+
+// TestUserRepository_HeldReservation verifica que un job reencolado encuentra
+// la reserva que dejó retenida y que una reserva cerrada ya no se reusa
+func TestUserRepository_HeldReservation(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+
+	ctx := context.Background()
+	testDB, err := setup.SetupTestDB(ctx)
+	require.NoError(t, err)
+	defer testDB.Close(ctx)
+
+	config.Migrate(testDB.DB)
+
+	testUser := fixtures.CreateTestUser()
+	require.NoError(t, testDB.DB.Create(testUser).Error)
+	free := fixtures.CreateFreeSubscription()
+	require.NoError(t, testDB.DB.Create(free).Error)
+	sub := fixtures.CreateUserSubscription(testUser.ID, free.ID, model.StateActive)
+	require.NoError(t, testDB.DB.Create(sub).Error)
+
+	repo := user.NewRepository(testDB.DB)
+	jobID := uuid.New()
+
+	_, err = repo.HeldReservation(jobID)
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+
+	res, err := repo.Reserve(testUser.ID.String(), 30, model.TokenLedger{Reason: model.LedgerAssetAudio, JobID: &jobID})
+	require.NoError(t, err)
+
+	held, err := repo.HeldReservation(jobID)
+	require.NoError(t, err)
+	assert.Equal(t, res.ID, held.ID)
+
+	// Otro job no la ve
+	_, err = repo.HeldReservation(uuid.New())
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+
+	require.NoError(t, repo.Capture(testDB.DB, held, 30))
+	_, err = repo.HeldReservation(jobID)
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+
+	var stored model.UserSubscribed
+	require.NoError(t, testDB.DB.First(&stored, "id = ?", sub.ID).Error)
+	assert.Equal(t, uint(70), stored.TokensRemaining)
+}
@@ -14,6 +14,7 @@ import (
 	"github.com/MetaDandy/cuent-ai-core/tests/containers/setup"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
 )
 
 // TestProjectRepository_Create verifica que se crea un proyecto correctamente
@@ -73,7 +74,7 @@ func TestProjectRepository_FindById(t *testing.T) {
 
 	// Ejecutar test
 	repo := project.NewRepository(testDB.DB)
-	found, err := repo.FindById(testProject.ID.String())
+	found, err := repo.FindById(testProject.ID.String(), user.ID.String())
 
 	// Verificaciones
 	assert.NoError(t, err)
@@ -232,7 +233,7 @@ func TestProjectRepository_FindAll(t *testing.T) {
 		Limit:  10,
 		Offset: 0,
 	}
-	found, total, err := repo.FindAll(opts)
+	found, total, err := repo.FindAll(user.ID.String(), opts)
 
 	// Verificaciones
 	assert.NoError(t, err)
@@ -271,7 +272,7 @@ func TestProjectRepository_FindAll_Pagination(t *testing.T) {
 		Limit:  10,
 		Offset: 0,
 	}
-	found, total, err := repo.FindAll(opts)
+	found, total, err := repo.FindAll(user.ID.String(), opts)
 	assert.NoError(t, err)
 	assert.Equal(t, int64(15), total)
 	assert.Len(t, found, 10)
@@ -281,8 +282,51 @@ func TestProjectRepository_FindAll_Pagination(t *testing.T) {
 		Limit:  10,
 		Offset: 10,
 	}
-	found, total, err = repo.FindAll(opts)
+	found, total, err = repo.FindAll(user.ID.String(), opts)
 	assert.NoError(t, err)
 	assert.Equal(t, int64(15), total)
 	assert.Len(t, found, 5)
 }
+
+// TestProjectRepository_OwnerScope verifica que las consultas sólo ven los
+// proyectos del usuario indicado
+func TestProjectRepository_OwnerScope(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+
+	ctx := context.Background()
+	testDB, err := setup.SetupTestDB(ctx)
+	require.NoError(t, err)
+	defer testDB.Close(ctx)
+
+	config.Migrate(testDB.DB)
+
+	// Crear dos usuarios con proyectos propios
+	owner := fixtures.CreateTestUserWithEmail("owner@example.com")
+	err = testDB.DB.Create(owner).Error
+	require.NoError(t, err)
+
+	other := fixtures.CreateTestUserWithEmail("other@example.com")
+	err = testDB.DB.Create(other).Error
+	require.NoError(t, err)
+
+	for _, p := range fixtures.CreateMultipleTestProjects(owner.ID, 3) {
+		require.NoError(t, testDB.DB.Create(p).Error)
+	}
+	foreign := fixtures.CreateTestProject(other.ID)
+	require.NoError(t, testDB.DB.Create(foreign).Error)
+
+	repo := project.NewRepository(testDB.DB)
+
+	found, total, err := repo.FindAll(owner.ID.String(), &helper.FindAllOptions{Limit: 10})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), total)
+	assert.Len(t, found, 3)
+
+	_, err = repo.FindById(foreign.ID.String(), owner.ID.String())
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+
+	_, err = repo.FindByIdUnscoped(foreign.ID.String(), owner.ID.String())
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+}
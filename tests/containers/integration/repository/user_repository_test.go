@@ -4,7 +4,9 @@ package repository
 
 import (
 	"context"
+	"fmt"
 	"testing"
+	"time"
 
 	"github.com/MetaDandy/cuent-ai-core/config"
 	"github.com/MetaDandy/cuent-ai-core/helper"
@@ -12,6 +14,7 @@ import (
 	"github.com/MetaDandy/cuent-ai-core/src/model"
 	"github.com/MetaDandy/cuent-ai-core/tests/containers/fixtures"
 	"github.com/MetaDandy/cuent-ai-core/tests/containers/setup"
+	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -279,3 +282,118 @@ func TestUserRepository_FindAll(t *testing.T) {
 	assert.Equal(t, int64(5), total)
 	assert.Len(t, found, 5)
 }
+
+// TestUserRepository_RotateRefreshToken verifica la rotación y que reusar un
+// refresh token ya rotado revoca toda la sesión
+func TestUserRepository_RotateRefreshToken(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+
+	ctx := context.Background()
+	testDB, err := setup.SetupTestDB(ctx)
+	require.NoError(t, err)
+	defer testDB.Close(ctx)
+
+	config.Migrate(testDB.DB)
+
+	testUser := fixtures.CreateTestUser()
+	err = testDB.DB.Create(testUser).Error
+	require.NoError(t, err)
+
+	repo := user.NewRepository(testDB.DB)
+
+	first := &model.RefreshToken{
+		ID:        uuid.New(),
+		UserID:    testUser.ID,
+		SessionID: uuid.New(),
+		TokenHash: helper.HashOpaqueToken("first"),
+		ExpiresAt: time.Now().Add(time.Hour),
+	}
+	err = repo.CreateRefreshToken(first)
+	require.NoError(t, err)
+
+	// Primera rotación: el token nuevo hereda la sesión
+	second := &model.RefreshToken{
+		ID:        uuid.New(),
+		TokenHash: helper.HashOpaqueToken("second"),
+		ExpiresAt: time.Now().Add(time.Hour),
+	}
+	used, err := repo.RotateRefreshToken(first.TokenHash, second)
+	require.NoError(t, err)
+	assert.Equal(t, first.ID, used.ID)
+	assert.Equal(t, first.SessionID, second.SessionID)
+
+	revoked, err := repo.IsRevoked(first.SessionID.String())
+	assert.NoError(t, err)
+	assert.False(t, revoked)
+
+	// Reusar el primero cierra la sesión, incluido el token vigente
+	_, err = repo.RotateRefreshToken(first.TokenHash, &model.RefreshToken{
+		ID:        uuid.New(),
+		TokenHash: helper.HashOpaqueToken("third"),
+		ExpiresAt: time.Now().Add(time.Hour),
+	})
+	assert.ErrorIs(t, err, user.ErrRefreshReused)
+
+	revoked, err = repo.IsRevoked(first.SessionID.String())
+	assert.NoError(t, err)
+	assert.True(t, revoked)
+
+	_, err = repo.RotateRefreshToken(second.TokenHash, &model.RefreshToken{
+		ID:        uuid.New(),
+		TokenHash: helper.HashOpaqueToken("fourth"),
+		ExpiresAt: time.Now().Add(time.Hour),
+	})
+	assert.ErrorIs(t, err, user.ErrRefreshReused)
+
+	// Un token desconocido es inválido
+	_, err = repo.RotateRefreshToken(helper.HashOpaqueToken("unknown"), &model.RefreshToken{ID: uuid.New()})
+	assert.ErrorIs(t, err, user.ErrRefreshInvalid)
+}
+
+// TestUserRepository_RevokeAllSessions verifica que se cierran todas las
+// sesiones del usuario y no las de otros
+func TestUserRepository_RevokeAllSessions(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+
+	ctx := context.Background()
+	testDB, err := setup.SetupTestDB(ctx)
+	require.NoError(t, err)
+	defer testDB.Close(ctx)
+
+	config.Migrate(testDB.DB)
+
+	owner := fixtures.CreateTestUserWithEmail("owner@example.com")
+	err = testDB.DB.Create(owner).Error
+	require.NoError(t, err)
+	other := fixtures.CreateTestUserWithEmail("other@example.com")
+	err = testDB.DB.Create(other).Error
+	require.NoError(t, err)
+
+	repo := user.NewRepository(testDB.DB)
+
+	var sessions []uuid.UUID
+	for i, u := range []*model.User{owner, owner, other} {
+		tok := &model.RefreshToken{
+			ID:        uuid.New(),
+			UserID:    u.ID,
+			SessionID: uuid.New(),
+			TokenHash: helper.HashOpaqueToken(fmt.Sprintf("token-%d", i)),
+			ExpiresAt: time.Now().Add(time.Hour),
+		}
+		require.NoError(t, repo.CreateRefreshToken(tok))
+		sessions = append(sessions, tok.SessionID)
+	}
+
+	err = repo.RevokeAllSessions(owner.ID.String())
+	require.NoError(t, err)
+
+	for i, want := range []bool{true, true, false} {
+		revoked, err := repo.IsRevoked(sessions[i].String())
+		assert.NoError(t, err)
+		assert.Equal(t, want, revoked, i)
+	}
+}
@@ -0,0 +1,228 @@
+//go:build containers
+
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"os/exec"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/MetaDandy/cuent-ai-core/config"
+	"github.com/MetaDandy/cuent-ai-core/helper"
+	usercore "github.com/MetaDandy/cuent-ai-core/src/core/user"
+	"github.com/MetaDandy/cuent-ai-core/src/model"
+	"github.com/MetaDandy/cuent-ai-core/src/modules/asset"
+	"github.com/MetaDandy/cuent-ai-core/src/modules/character"
+	generatejob "github.com/MetaDandy/cuent-ai-core/src/modules/generate_job"
+	"github.com/MetaDandy/cuent-ai-core/src/modules/project"
+	"github.com/MetaDandy/cuent-ai-core/src/modules/script"
+	"github.com/MetaDandy/cuent-ai-core/src/modules/voice"
+	ws "github.com/MetaDandy/cuent-ai-core/src/modules/websocket"
+	"github.com/MetaDandy/cuent-ai-core/tests/containers/fixtures"
+	"github.com/MetaDandy/cuent-ai-core/tests/containers/setup"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// eventRecorder es el hub falso: guarda, por sala, los eventos de
+// generación que se difunden por el backplane
+type eventRecorder struct {
+	mu     sync.Mutex
+	events map[string][]ws.Event
+}
+
+func recordEvents(bus *ws.MemoryBackplane) *eventRecorder {
+	r := &eventRecorder{events: map[string][]ws.Event{}}
+	bus.Subscribe(func(env ws.Envelope) {
+		if env.Op != ws.OpBroadcast {
+			return
+		}
+		var evt ws.Event
+		if json.Unmarshal(env.Data, &evt) != nil || evt.State == "" {
+			return
+		}
+		r.mu.Lock()
+		r.events[env.Room] = append(r.events[env.Room], evt)
+		r.mu.Unlock()
+	})
+	return r
+}
+
+// states devuelve los estados de los eventos typ publicados en la sala
+func (r *eventRecorder) states(room string, typ ws.EventType) []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	states := []string{}
+	for _, evt := range r.events[room] {
+		if evt.Type == typ {
+			states = append(states, evt.State)
+		}
+	}
+	return states
+}
+
+// failingStore rechaza las subidas, para que la generación falle después de
+// marcar el asset ACTIVE
+type failingStore struct {
+	helper.BlobStore
+}
+
+func (failingStore) Put(context.Context, string, string, io.Reader, string) (string, error) {
+	return "", errors.New("storage caído")
+}
+
+// generationFixture crea un usuario con saldo y un script de una línea, y los
+// servicios de assets y scripts publicando en un hub con eventRecorder
+type generationFixture struct {
+	user      *model.User
+	project   *model.Project
+	script    *model.Script
+	asset     model.Asset
+	events    *eventRecorder
+	assetSvc  *asset.Service
+	scriptSvc *script.Service
+	genRepo   *generatejob.Repository
+}
+
+func newGenerationFixture(t *testing.T, db *gorm.DB, store helper.BlobStore) *generationFixture {
+	user := fixtures.CreateTestUser()
+	require.NoError(t, db.Create(user).Error)
+	free := fixtures.CreateFreeSubscription()
+	require.NoError(t, db.Create(free).Error)
+	require.NoError(t, db.Create(fixtures.CreateUserSubscription(user.ID, free.ID, model.StateActive)).Error)
+	testProject := fixtures.CreateTestProject(user.ID)
+	require.NoError(t, db.Create(testProject).Error)
+	testScript := fixtures.CreateTestScript(testProject.ID)
+	require.NoError(t, db.Create(testScript).Error)
+	assets := fixtures.CreateTestAssets(testScript.ID, 1)
+	require.NoError(t, db.Create(&assets).Error)
+
+	bus := ws.NewMemoryBackplane()
+	hub := ws.NewHub(t.Context(), 10, bus, ws.Config{})
+	genRepo := generatejob.NewRepository(db)
+	return &generationFixture{
+		user:    user,
+		project: testProject,
+		script:  testScript,
+		asset:   assets[0],
+		events:  recordEvents(bus),
+		assetSvc: asset.NewService(asset.NewRepository(db), genRepo, usercore.NewRepository(db),
+			voice.NewRepository(db), character.NewRepository(db), store, nil, hub),
+		scriptSvc: script.NewService(script.NewRepository(db), project.NewRepository(db), asset.NewRepository(db),
+			usercore.NewRepository(db), character.NewRepository(db), store, nil, hub),
+		genRepo: genRepo,
+	}
+}
+
+// generate encola el audio del asset y lo procesa con la cola hasta que el
+// job termina
+func (f *generationFixture) generate(t *testing.T, db *gorm.DB) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	q := asset.NewQueue(f.assetSvc, f.genRepo, 1, map[model.Provider]int{model.ProviderOffline: 0})
+	require.NoError(t, q.Start(ctx))
+
+	_, err := f.assetSvc.GenerateOne(f.asset.ID.String(), f.user.ID.String(), string(model.ProviderOffline))
+	require.NoError(t, err)
+
+	require.Eventually(t, func() bool {
+		var job model.GeneratedJob
+		if db.First(&job, "asset_id = ?", f.asset.ID).Error != nil {
+			return false
+		}
+		return job.State == model.StateFinished || job.State == model.StateError
+	}, 30*time.Second, 100*time.Millisecond)
+}
+
+// TestGenerationEvents_Success verifica que generar el audio y mezclar
+// publican ACTIVE y luego FINISHED en la sala del script y en la del proyecto
+func TestGenerationEvents_Success(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+
+	ctx := context.Background()
+	testDB, err := setup.SetupTestDB(ctx)
+	require.NoError(t, err)
+	defer testDB.Close(ctx)
+
+	config.Migrate(testDB.DB)
+
+	store, err := helper.NewLocalStore(t.TempDir(), "http://localhost/storage", "secret")
+	require.NoError(t, err)
+	f := newGenerationFixture(t, testDB.DB, store)
+	rooms := []string{f.script.ID.String(), f.project.ID.String()}
+
+	f.generate(t, testDB.DB)
+	for _, room := range rooms {
+		assert.Equal(t, []string{"ACTIVE", "FINISHED"}, f.events.states(room, ws.EventAudio), room)
+	}
+	finished := f.events.events[rooms[0]][1]
+	assert.Equal(t, f.asset.ID.String(), finished.AssetID)
+	assert.NotEmpty(t, finished.URL)
+
+	if _, err := exec.LookPath("ffmpeg"); err != nil {
+		t.Skip("ffmpeg no está instalado")
+	}
+	_, err = f.scriptSvc.MixAudio(f.script.ID.String(), f.user.ID.String())
+	require.NoError(t, err)
+	for _, room := range rooms {
+		assert.Equal(t, []string{"ACTIVE", "FINISHED"}, f.events.states(room, ws.EventMix), room)
+	}
+}
+
+// TestGenerationEvents_Error verifica que un fallo después de empezar
+// publica ACTIVE y luego ERROR, con el motivo, en las dos salas
+func TestGenerationEvents_Error(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+
+	ctx := context.Background()
+	testDB, err := setup.SetupTestDB(ctx)
+	require.NoError(t, err)
+	defer testDB.Close(ctx)
+
+	config.Migrate(testDB.DB)
+
+	local, err := helper.NewLocalStore(t.TempDir(), "http://localhost/storage", "secret")
+	require.NoError(t, err)
+	f := newGenerationFixture(t, testDB.DB, failingStore{local})
+	rooms := []string{f.script.ID.String(), f.project.ID.String()}
+
+	f.generate(t, testDB.DB)
+	for _, room := range rooms {
+		assert.Equal(t, []string{"ACTIVE", "ERROR"}, f.events.states(room, ws.EventAudio), room)
+	}
+	failed := f.events.events[rooms[0]][1]
+	assert.Contains(t, failed.Error, "storage caído")
+
+	// Con una línea sin audio la mezcla se rechaza antes de reservar y sin
+	// publicar nada
+	var before model.UserSubscribed
+	require.NoError(t, testDB.DB.First(&before, "user_id = ?", f.user.ID).Error)
+	_, err = f.scriptSvc.MixAudio(f.script.ID.String(), f.user.ID.String())
+	assert.ErrorIs(t, err, script.ErrNotGenerated)
+	var after model.UserSubscribed
+	require.NoError(t, testDB.DB.First(&after, "user_id = ?", f.user.ID).Error)
+	assert.Equal(t, before.TokensRemaining, after.TokensRemaining)
+	assert.Empty(t, f.events.states(rooms[0], ws.EventMix))
+
+	// La mezcla falla al bajar un audio que no está en el storage
+	require.NoError(t, testDB.DB.Model(&f.asset).Updates(map[string]any{
+		"audio_state": model.StateFinished,
+		"audio_url":   helper.ObjectRef("audio", "missing.wav"),
+		"duration":    1,
+	}).Error)
+	_, err = f.scriptSvc.MixAudio(f.script.ID.String(), f.user.ID.String())
+	require.Error(t, err)
+	for _, room := range rooms {
+		assert.Equal(t, []string{"ACTIVE", "ERROR"}, f.events.states(room, ws.EventMix), room)
+	}
+}
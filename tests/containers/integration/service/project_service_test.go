@@ -42,10 +42,10 @@ func TestProjectService_FindByID(t *testing.T) {
 
 	// Crear servicio
 	repo := project.NewRepository(testDB.DB)
-	svc := project.NewService(repo, nil)
+	svc := project.NewService(repo, nil, nil)
 
 	// Ejecutar test
-	result, err := svc.FindByID(testProject.ID.String())
+	result, err := svc.FindByID(testProject.ID.String(), user.ID.String())
 
 	// Verificaciones
 	assert.NoError(t, err)
@@ -75,18 +75,17 @@ func TestProjectService_Create(t *testing.T) {
 
 	repo := project.NewRepository(testDB.DB)
 	userRepo := usercore.NewRepository(testDB.DB)
-	svc := project.NewService(repo, userRepo)
+	svc := project.NewService(repo, userRepo, nil)
 
 	// Preparar proyecto
 	testProject := fixtures.CreateTestProject(user.ID)
 	input := &project.ProjectCreate{
 		Name:        testProject.Name,
 		Description: testProject.Description,
-		UserId:      user.ID.String(),
 	}
 
 	// Ejecutar test
-	result, err := svc.Create(input)
+	result, err := svc.Create(user.ID.String(), input)
 
 	// Verificaciones
 	assert.NoError(t, err)
@@ -124,7 +123,7 @@ func TestProjectService_Update(t *testing.T) {
 
 	repo := project.NewRepository(testDB.DB)
 	userRepo := usercore.NewRepository(testDB.DB)
-	svc := project.NewService(repo, userRepo)
+	svc := project.NewService(repo, userRepo, nil)
 
 	// Preparar actualización
 	updatedName := "Updated Project"
@@ -135,7 +134,7 @@ func TestProjectService_Update(t *testing.T) {
 	}
 
 	// Ejecutar test
-	result, err := svc.Update(testProject.ID.String(), input)
+	result, err := svc.Update(testProject.ID.String(), user.ID.String(), input)
 
 	// Verificaciones
 	assert.NoError(t, err)
@@ -174,10 +173,10 @@ func TestProjectService_Delete(t *testing.T) {
 
 	repo := project.NewRepository(testDB.DB)
 	userRepo := usercore.NewRepository(testDB.DB)
-	svc := project.NewService(repo, userRepo)
+	svc := project.NewService(repo, userRepo, nil)
 
 	// Ejecutar test
-	_, err = svc.SoftDelete(testProject.ID.String())
+	_, err = svc.SoftDelete(testProject.ID.String(), user.ID.String())
 
 	// Verificaciones
 	assert.NoError(t, err)
@@ -220,14 +219,14 @@ func TestProjectService_GetAll(t *testing.T) {
 
 	repo := project.NewRepository(testDB.DB)
 	userRepo := usercore.NewRepository(testDB.DB)
-	svc := project.NewService(repo, userRepo)
+	svc := project.NewService(repo, userRepo, nil)
 
 	// Ejecutar test
 	opts := &helper.FindAllOptions{
 		Limit:  10,
 		Offset: 0,
 	}
-	result, err := svc.FindAll(opts)
+	result, err := svc.FindAll(user.ID.String(), opts)
 
 	// Verificaciones
 	assert.NoError(t, err)
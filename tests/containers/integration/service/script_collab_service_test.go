@@ -0,0 +1,309 @@
+//go:build containers
+
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/MetaDandy/cuent-ai-core/config"
+	"github.com/MetaDandy/cuent-ai-core/src/model"
+	"github.com/MetaDandy/cuent-ai-core/src/modules/script"
+	"github.com/MetaDandy/cuent-ai-core/src/modules/validation"
+	ws "github.com/MetaDandy/cuent-ai-core/src/modules/websocket"
+	"github.com/MetaDandy/cuent-ai-core/tests/containers/setup"
+	"github.com/fasthttp/websocket"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// roomRecorder guarda los mensajes de edición que se difunden en una sala
+type roomRecorder struct {
+	mu   sync.Mutex
+	msgs []script.CollabMessage
+}
+
+func recordRoom(bus *ws.MemoryBackplane, room string) *roomRecorder {
+	r := &roomRecorder{}
+	bus.Subscribe(func(env ws.Envelope) {
+		if env.Op != ws.OpBroadcast || env.Room != room {
+			return
+		}
+		var msg script.CollabMessage
+		if json.Unmarshal(env.Data, &msg) != nil || msg.Seq == 0 {
+			return
+		}
+		r.mu.Lock()
+		r.msgs = append(r.msgs, msg)
+		r.mu.Unlock()
+	})
+	return r
+}
+
+func (r *roomRecorder) messages() []script.CollabMessage {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]script.CollabMessage(nil), r.msgs...)
+}
+
+// TestCollab_Sequencing verifica que las ediciones de la sala se difunden
+// con seq consecutivas, en orden, aunque lleguen de varios clientes a la vez
+func TestCollab_Sequencing(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+
+	ctx := context.Background()
+	testDB, err := setup.SetupTestDB(ctx)
+	require.NoError(t, err)
+	defer testDB.Close(ctx)
+
+	config.Migrate(testDB.DB)
+
+	user, testScript, assets := seedScriptLines(t, testDB.DB, 2)
+	room := testScript.ID.String()
+
+	bus := ws.NewMemoryBackplane()
+	hub := ws.NewHub(t.Context(), 10, bus, ws.Config{})
+	rec := recordRoom(bus, room)
+	collab := script.NewCollab(newScriptService(testDB.DB, hub), validation.Validate)
+
+	first := hub.NewClient(room, user.ID.String(), nil)
+	collab.Message(hub, first, []byte(`{"type":"line.insert","client_seq":1,"line":{"text":"Hola","type":"TTS"}}`))
+	collab.Message(hub, first, []byte(fmt.Sprintf(`{"type":"line.update","client_seq":2,"asset_id":%q,"line":{"text":"Cambio","type":"TTS"}}`, assets[0].ID)))
+	collab.Message(hub, first, []byte(fmt.Sprintf(`{"type":"line.move","client_seq":3,"asset_id":%q,"position":2}`, assets[0].ID)))
+
+	msgs := rec.messages()
+	require.Len(t, msgs, 3)
+	for i, msg := range msgs {
+		assert.Equal(t, int64(i+1), msg.Seq)
+		assert.Equal(t, int64(i+1), msg.ClientSeq)
+		assert.Equal(t, first.ID(), msg.ClientID)
+		assert.Equal(t, user.ID.String(), msg.UserID)
+	}
+	assert.Equal(t, []script.CollabType{script.CollabInsert, script.CollabUpdate, script.CollabMove},
+		[]script.CollabType{msgs[0].Type, msgs[1].Type, msgs[2].Type})
+	require.NotNil(t, msgs[1].Asset)
+	assert.Equal(t, "Cambio", msgs[1].Asset.Line)
+
+	// Varios clientes a la vez: la sala recibe las seq en orden, sin huecos
+	const clients, edits = 4, 5
+	var wg sync.WaitGroup
+	for i := range clients {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c := hub.NewClient(room, user.ID.String(), nil)
+			for j := range edits {
+				collab.Message(hub, c, []byte(fmt.Sprintf(`{"type":"line.insert","client_seq":%d,"line":{"text":"Cliente %d","type":"TTS"}}`, j+1, i)))
+			}
+		}()
+	}
+	wg.Wait()
+
+	msgs = rec.messages()
+	require.Len(t, msgs, 3+clients*edits)
+	for i, msg := range msgs {
+		assert.Equal(t, int64(i+1), msg.Seq)
+	}
+	assert.Equal(t, int64(3+clients*edits), scriptSeq(t, testDB.DB, testScript.ID))
+	assert.Len(t, lineOrder(t, testDB.DB, testScript.ID), 3+clients*edits)
+}
+
+// TestCollab_BaseSeqConflict verifica que una edición hecha sobre una
+// versión vieja de la línea se rechaza sin tocarla ni avanzar la seq
+func TestCollab_BaseSeqConflict(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+
+	ctx := context.Background()
+	testDB, err := setup.SetupTestDB(ctx)
+	require.NoError(t, err)
+	defer testDB.Close(ctx)
+
+	config.Migrate(testDB.DB)
+
+	user, testScript, assets := seedScriptLines(t, testDB.DB, 2)
+	room := testScript.ID.String()
+
+	bus := ws.NewMemoryBackplane()
+	hub := ws.NewHub(t.Context(), 10, bus, ws.Config{})
+	rec := recordRoom(bus, room)
+	collab := script.NewCollab(newScriptService(testDB.DB, hub), validation.Validate)
+
+	alice := hub.NewClient(room, user.ID.String(), nil)
+	bob := hub.NewClient(room, user.ID.String(), nil)
+	update := func(c *ws.Client, baseSeq int64, text string) {
+		collab.Message(hub, c, []byte(fmt.Sprintf(`{"type":"line.update","base_seq":%d,"asset_id":%q,"line":{"text":%q,"type":"TTS"}}`,
+			baseSeq, assets[0].ID, text)))
+	}
+
+	// Los dos vieron la línea con seq 0; gana el primero
+	update(alice, 0, "Alice")
+	update(bob, 0, "Bob")
+
+	var stored model.Asset
+	require.NoError(t, testDB.DB.First(&stored, "id = ?", assets[0].ID).Error)
+	assert.Equal(t, "Alice", stored.Line)
+	assert.Equal(t, int64(1), stored.Seq)
+	assert.Equal(t, int64(1), scriptSeq(t, testDB.DB, testScript.ID))
+	require.Len(t, rec.messages(), 1)
+
+	// Un cambio en otra línea no afecta a la base de ésta
+	collab.Message(hub, alice, []byte(fmt.Sprintf(`{"type":"line.update","base_seq":0,"asset_id":%q,"line":{"text":"Otra","type":"TTS"}}`, assets[1].ID)))
+
+	// Con la seq que trajo el mensaje de Alice, Bob sí puede editar
+	update(bob, 1, "Bob")
+	require.NoError(t, testDB.DB.First(&stored, "id = ?", assets[0].ID).Error)
+	assert.Equal(t, "Bob", stored.Line)
+	assert.Equal(t, int64(3), stored.Seq)
+
+	msgs := rec.messages()
+	require.Len(t, msgs, 3)
+	assert.Equal(t, bob.ID(), msgs[2].ClientID)
+	assert.Equal(t, int64(3), msgs[2].Seq)
+}
+
+// TestScriptRepository_SnapshotConsistent verifica que el snapshot con el
+// que entra un cliente trae exactamente las líneas de su seq, aunque se
+// edite el script a la vez
+func TestScriptRepository_SnapshotConsistent(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+
+	ctx := context.Background()
+	testDB, err := setup.SetupTestDB(ctx)
+	require.NoError(t, err)
+	defer testDB.Close(ctx)
+
+	config.Migrate(testDB.DB)
+
+	const initial, inserts = 3, 30
+	user, testScript, _ := seedScriptLines(t, testDB.DB, initial)
+	svc := newScriptService(testDB.DB, ws.NewHub(t.Context(), 10, nil, ws.Config{}))
+	repo := script.NewRepository(testDB.DB)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := range inserts {
+			_, err := svc.InsertLine(testScript.ID.String(), user.ID.String(), &script.LineInsert{
+				Line: script.Line{Text: fmt.Sprintf("Nueva %d", i), Type: model.AudioTTS},
+			})
+			assert.NoError(t, err)
+		}
+	}()
+
+	// Cada inserción avanza la seq en uno y agrega una línea
+	for running := true; running; {
+		select {
+		case <-done:
+			running = false
+		default:
+		}
+		snap, err := repo.Snapshot(testScript.ID)
+		require.NoError(t, err)
+		require.Len(t, snap.Assets, initial+int(snap.Seq), "seq %d", snap.Seq)
+		for i, a := range snap.Assets {
+			assert.Equal(t, i, a.Position)
+		}
+	}
+
+	snap, err := repo.Snapshot(testScript.ID)
+	require.NoError(t, err)
+	assert.Equal(t, int64(inserts), snap.Seq)
+	assert.Len(t, snap.Assets, initial+inserts)
+}
+
+// TestCollab_JoinDuringEdits verifica que un cliente que entra mientras se
+// edita el script recibe, después de su snapshot, todas las ediciones
+// siguientes en orden: ninguna se le adelanta al snapshot ni se pierde
+func TestCollab_JoinDuringEdits(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+
+	ctx := context.Background()
+	testDB, err := setup.SetupTestDB(ctx)
+	require.NoError(t, err)
+	defer testDB.Close(ctx)
+
+	config.Migrate(testDB.DB)
+
+	const edits, joins = 60, 15
+	user, testScript, assets := seedScriptLines(t, testDB.DB, 1)
+	room := testScript.ID.String()
+
+	hub := ws.NewHub(t.Context(), joins+1, nil, ws.Config{})
+	collab := script.NewCollab(newScriptService(testDB.DB, hub), validation.Validate)
+
+	app := fiber.New()
+	app.Get("/ws/scripts/:id", func(c *fiber.Ctx) error {
+		c.Locals("user_id", user.ID.String())
+		return c.Next()
+	}, ws.Upgrade(hub, collab))
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go app.Listener(ln)
+	defer app.Shutdown()
+	url := fmt.Sprintf("ws://%s/ws/scripts/%s", ln.Addr(), room)
+
+	editor := hub.NewClient(room, user.ID.String(), nil)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := range edits {
+			collab.Message(hub, editor, []byte(fmt.Sprintf(`{"type":"line.update","asset_id":%q,"line":{"text":"Edición %d","type":"TTS"}}`,
+				assets[0].ID, i)))
+		}
+	}()
+
+	// Los clientes entran mientras el editor sigue cambiando la línea
+	var conns []*websocket.Conn
+	for running := true; running && len(conns) < joins; {
+		select {
+		case <-done:
+			running = false
+		default:
+		}
+		conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+		require.NoError(t, err)
+		defer conn.Close()
+		conns = append(conns, conn)
+	}
+	<-done
+	final := scriptSeq(t, testDB.DB, testScript.ID)
+	require.Equal(t, int64(edits), final)
+
+	for i, conn := range conns {
+		var snapshot *script.CollabMessage
+		last := int64(-1)
+		for last < final {
+			require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+			_, raw, err := conn.ReadMessage()
+			require.NoError(t, err, "cliente %d: esperaba hasta la seq %d, llegó a %d", i, final, last)
+			var msg script.CollabMessage
+			require.NoError(t, json.Unmarshal(raw, &msg))
+
+			switch {
+			case msg.Type == script.CollabSnapshot:
+				require.Nil(t, snapshot, "cliente %d: snapshot repetido", i)
+				snapshot = &msg
+				last = msg.Seq
+			case snapshot == nil || msg.Seq == 0:
+				// Lo anterior al snapshot ya está incluido en él
+			default:
+				require.Equal(t, last+1, msg.Seq, "cliente %d: edición fuera de orden tras el snapshot %d", i, snapshot.Seq)
+				last = msg.Seq
+			}
+		}
+	}
+}
@@ -0,0 +1,246 @@
+//go:build containers
+
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/MetaDandy/cuent-ai-core/config"
+	usercore "github.com/MetaDandy/cuent-ai-core/src/core/user"
+	"github.com/MetaDandy/cuent-ai-core/src/model"
+	"github.com/MetaDandy/cuent-ai-core/src/modules/asset"
+	"github.com/MetaDandy/cuent-ai-core/src/modules/character"
+	"github.com/MetaDandy/cuent-ai-core/src/modules/project"
+	"github.com/MetaDandy/cuent-ai-core/src/modules/script"
+	ws "github.com/MetaDandy/cuent-ai-core/src/modules/websocket"
+	"github.com/MetaDandy/cuent-ai-core/tests/containers/fixtures"
+	"github.com/MetaDandy/cuent-ai-core/tests/containers/setup"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// newScriptService arma el servicio de scripts sin storage ni proveedores
+// de imágenes, con un Hub en memoria
+func newScriptService(db *gorm.DB, hub *ws.Hub) *script.Service {
+	return script.NewService(
+		script.NewRepository(db),
+		project.NewRepository(db),
+		asset.NewRepository(db),
+		usercore.NewRepository(db),
+		character.NewRepository(db),
+		nil, nil, hub,
+	)
+}
+
+// seedScriptLines crea un usuario con un script de count líneas
+func seedScriptLines(t *testing.T, db *gorm.DB, count int) (*model.User, *model.Script, []model.Asset) {
+	user := fixtures.CreateTestUser()
+	require.NoError(t, db.Create(user).Error)
+	testProject := fixtures.CreateTestProject(user.ID)
+	require.NoError(t, db.Create(testProject).Error)
+	testScript := fixtures.CreateTestScript(testProject.ID)
+	require.NoError(t, db.Create(testScript).Error)
+	assets := fixtures.CreateTestAssets(testScript.ID, count)
+	require.NoError(t, db.Create(&assets).Error)
+	return user, testScript, assets
+}
+
+// lineOrder devuelve los IDs de las líneas vigentes ordenadas por posición y
+// verifica que las posiciones sean 0..n-1
+func lineOrder(t *testing.T, db *gorm.DB, scriptID uuid.UUID) []uuid.UUID {
+	var assets []model.Asset
+	require.NoError(t, db.Where("script_id = ?", scriptID).Order("position").Find(&assets).Error)
+	ids := make([]uuid.UUID, len(assets))
+	for i, a := range assets {
+		assert.Equal(t, i, a.Position, "posición de %s", a.ID)
+		ids[i] = a.ID
+	}
+	return ids
+}
+
+func scriptSeq(t *testing.T, db *gorm.DB, scriptID uuid.UUID) int64 {
+	var stored model.Script
+	require.NoError(t, db.First(&stored, "id = ?", scriptID).Error)
+	return stored.Seq
+}
+
+// TestScriptService_EditLinesPositions verifica que insertar y reordenar
+// reescriben las posiciones 0..n-1 y avanzan la secuencia del script
+func TestScriptService_EditLinesPositions(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+
+	ctx := context.Background()
+	testDB, err := setup.SetupTestDB(ctx)
+	require.NoError(t, err)
+	defer testDB.Close(ctx)
+
+	config.Migrate(testDB.DB)
+
+	user, testScript, assets := seedScriptLines(t, testDB.DB, 3)
+	svc := newScriptService(testDB.DB, ws.NewHub(t.Context(), 10, nil, ws.Config{}))
+	id, userID := testScript.ID.String(), user.ID.String()
+
+	position := 1
+	_, err = svc.InsertLine(id, userID, &script.LineInsert{
+		Line:     script.Line{Text: "Nueva", Type: model.AudioTTS},
+		Position: &position,
+	})
+	require.NoError(t, err)
+
+	order := lineOrder(t, testDB.DB, testScript.ID)
+	require.Len(t, order, 4)
+	assert.Equal(t, []uuid.UUID{assets[0].ID, assets[1].ID, assets[2].ID}, []uuid.UUID{order[0], order[2], order[3]})
+	inserted := order[1]
+	assert.Equal(t, int64(1), scriptSeq(t, testDB.DB, testScript.ID))
+
+	// Más allá del final va al final
+	position = 99
+	_, err = svc.InsertLine(id, userID, &script.LineInsert{
+		Line:     script.Line{Text: "Última", Type: model.AudioSFX, Duration: 2},
+		Position: &position,
+	})
+	require.NoError(t, err)
+	order = lineOrder(t, testDB.DB, testScript.ID)
+	require.Len(t, order, 5)
+	last := order[4]
+
+	reversed := []string{last.String(), assets[2].ID.String(), assets[1].ID.String(), inserted.String(), assets[0].ID.String()}
+	_, err = svc.ReorderLines(id, userID, &script.LineOrder{AssetIDs: reversed})
+	require.NoError(t, err)
+
+	order = lineOrder(t, testDB.DB, testScript.ID)
+	assert.Equal(t, []uuid.UUID{last, assets[2].ID, assets[1].ID, inserted, assets[0].ID}, order)
+	assert.Equal(t, int64(3), scriptSeq(t, testDB.DB, testScript.ID))
+}
+
+// TestScriptService_ReorderLinesInvalid verifica que un orden que no trae
+// todas las líneas una vez se rechaza con ErrLineOrder sin tocar nada
+func TestScriptService_ReorderLinesInvalid(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+
+	ctx := context.Background()
+	testDB, err := setup.SetupTestDB(ctx)
+	require.NoError(t, err)
+	defer testDB.Close(ctx)
+
+	config.Migrate(testDB.DB)
+
+	user, testScript, assets := seedScriptLines(t, testDB.DB, 3)
+	svc := newScriptService(testDB.DB, ws.NewHub(t.Context(), 10, nil, ws.Config{}))
+	a, b, c := assets[0].ID.String(), assets[1].ID.String(), assets[2].ID.String()
+
+	orders := map[string][]string{
+		"Falta una línea":   {c, a},
+		"Línea repetida":    {c, a, a},
+		"Línea desconocida": {c, a, uuid.NewString()},
+		"Línea de más":      {c, b, a, uuid.NewString()},
+	}
+	for name, ids := range orders {
+		_, err := svc.ReorderLines(testScript.ID.String(), user.ID.String(), &script.LineOrder{AssetIDs: ids})
+		assert.ErrorIs(t, err, script.ErrLineOrder, name)
+	}
+
+	assert.Equal(t, []uuid.UUID{assets[0].ID, assets[1].ID, assets[2].ID}, lineOrder(t, testDB.DB, testScript.ID))
+	assert.Equal(t, int64(0), scriptSeq(t, testDB.DB, testScript.ID))
+}
+
+// TestScriptService_LineBusy verifica que una línea cuyo audio se está
+// generando no se puede editar, borrar ni cambiar de lugar
+func TestScriptService_LineBusy(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+
+	ctx := context.Background()
+	testDB, err := setup.SetupTestDB(ctx)
+	require.NoError(t, err)
+	defer testDB.Close(ctx)
+
+	config.Migrate(testDB.DB)
+
+	user, testScript, assets := seedScriptLines(t, testDB.DB, 3)
+	require.NoError(t, testDB.DB.Model(&assets[1]).Update("audio_state", model.StateActive).Error)
+
+	svc := newScriptService(testDB.DB, ws.NewHub(t.Context(), 10, nil, ws.Config{}))
+	id, userID := testScript.ID.String(), user.ID.String()
+	a, b, c := assets[0].ID.String(), assets[1].ID.String(), assets[2].ID.String()
+
+	_, err = svc.UpdateLine(id, b, userID, &script.Line{Text: "Cambio", Type: model.AudioTTS})
+	assert.ErrorIs(t, err, script.ErrLineBusy)
+
+	_, err = svc.DeleteLine(id, b, userID)
+	assert.ErrorIs(t, err, script.ErrLineBusy)
+
+	_, err = svc.ReorderLines(id, userID, &script.LineOrder{AssetIDs: []string{b, a, c}})
+	assert.ErrorIs(t, err, script.ErrLineBusy)
+
+	var stored model.Asset
+	require.NoError(t, testDB.DB.First(&stored, "id = ?", assets[1].ID).Error)
+	assert.Equal(t, "Línea 1", stored.Line)
+	assert.Equal(t, []uuid.UUID{assets[0].ID, assets[1].ID, assets[2].ID}, lineOrder(t, testDB.DB, testScript.ID))
+
+	// Las demás se pueden mover mientras la ocupada quede en su lugar
+	_, err = svc.ReorderLines(id, userID, &script.LineOrder{AssetIDs: []string{c, b, a}})
+	require.NoError(t, err)
+	assert.Equal(t, []uuid.UUID{assets[2].ID, assets[1].ID, assets[0].ID}, lineOrder(t, testDB.DB, testScript.ID))
+}
+
+// TestScriptService_DeleteLine verifica que borrar una línea es lógico,
+// corre las siguientes y que el audio que termina después no la revive
+func TestScriptService_DeleteLine(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+
+	ctx := context.Background()
+	testDB, err := setup.SetupTestDB(ctx)
+	require.NoError(t, err)
+	defer testDB.Close(ctx)
+
+	config.Migrate(testDB.DB)
+
+	user, testScript, assets := seedScriptLines(t, testDB.DB, 3)
+	svc := newScriptService(testDB.DB, ws.NewHub(t.Context(), 10, nil, ws.Config{}))
+
+	_, err = svc.DeleteLine(testScript.ID.String(), assets[1].ID.String(), user.ID.String())
+	require.NoError(t, err)
+
+	assert.Equal(t, []uuid.UUID{assets[0].ID, assets[2].ID}, lineOrder(t, testDB.DB, testScript.ID))
+
+	var deleted model.Asset
+	require.NoError(t, testDB.DB.Unscoped().First(&deleted, "id = ?", assets[1].ID).Error)
+	assert.True(t, deleted.DeletedAt.Valid)
+	assert.Equal(t, "Línea 1", deleted.Line)
+
+	_, err = svc.DeleteLine(testScript.ID.String(), assets[1].ID.String(), user.ID.String())
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+
+	// El worker sólo escribe el audio y no toca una línea borrada
+	assets[1].Audio_URL = "audio/late.mp3"
+	assets[1].AudioState = model.StateFinished
+	assets[1].Line = "pisada"
+	require.NoError(t, asset.NewRepository(testDB.DB).UpdateAudio(&assets[1]))
+
+	require.NoError(t, testDB.DB.Unscoped().First(&deleted, "id = ?", assets[1].ID).Error)
+	assert.True(t, deleted.DeletedAt.Valid)
+	assert.Empty(t, deleted.Audio_URL)
+	assert.Equal(t, "Línea 1", deleted.Line)
+
+	// En una línea vigente escribe sólo las columnas de audio
+	assets[0].Audio_URL = "audio/ok.mp3"
+	assets[0].AudioState = model.StateFinished
+	assets[0].Position = 7
+	require.NoError(t, asset.NewRepository(testDB.DB).UpdateAudio(&assets[0]))
+
+	var kept model.Asset
+	require.NoError(t, testDB.DB.First(&kept, "id = ?", assets[0].ID).Error)
+	assert.Equal(t, "audio/ok.mp3", kept.Audio_URL)
+	assert.Equal(t, 0, kept.Position)
+}
@@ -0,0 +1,219 @@
+//go:build containers
+
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/MetaDandy/cuent-ai-core/config"
+	"github.com/MetaDandy/cuent-ai-core/src/core/user"
+	"github.com/MetaDandy/cuent-ai-core/src/model"
+	"github.com/MetaDandy/cuent-ai-core/tests/containers/fixtures"
+	"github.com/MetaDandy/cuent-ai-core/tests/containers/setup"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stripe/stripe-go/v82"
+)
+
+func stripeEvent(id, typ, object string) stripe.Event {
+	return stripe.Event{
+		ID:   id,
+		Type: stripe.EventType(typ),
+		Data: &stripe.EventData{Raw: json.RawMessage(object)},
+	}
+}
+
+// TestUserService_StripeWebhook_Idempotent verifica que un evento reenviado
+// por Stripe se aplica una sola vez
+func TestUserService_StripeWebhook_Idempotent(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+
+	ctx := context.Background()
+	testDB, err := setup.SetupTestDB(ctx)
+	require.NoError(t, err)
+	defer testDB.Close(ctx)
+
+	config.Migrate(testDB.DB)
+
+	testUser := fixtures.CreateTestUser()
+	require.NoError(t, testDB.DB.Create(testUser).Error)
+	premium := fixtures.CreatePremiumSubscription()
+	require.NoError(t, testDB.DB.Create(premium).Error)
+	sub := fixtures.CreateUserSubscription(testUser.ID, premium.ID, model.StateActive)
+	require.NoError(t, testDB.DB.Create(sub).Error)
+
+	payment := &model.Payment{
+		ID:                    uuid.New(),
+		UserID:                testUser.ID.String(),
+		UserSuscribedID:       sub.ID.String(),
+		StripePaymentIntentID: "pi_1",
+		Amount:                1000,
+		Status:                model.StateActive,
+	}
+	require.NoError(t, testDB.DB.Create(payment).Error)
+
+	svc := user.NewService(user.NewRepository(testDB.DB), nil)
+
+	refund := stripeEvent("evt_refund", "charge.refunded",
+		`{"id":"ch_1","payment_intent":"pi_1","amount_refunded":1000,"refunded":true}`)
+	_, err = svc.StripeWebhook(refund)
+	require.NoError(t, err)
+	// El reintento de Stripe no vuelve a aplicarse
+	_, err = svc.StripeWebhook(refund)
+	require.NoError(t, err)
+
+	var stored model.Payment
+	require.NoError(t, testDB.DB.First(&stored, "id = ?", payment.ID).Error)
+	assert.Equal(t, model.StateRefunded, stored.Status)
+	assert.Equal(t, 1000, stored.AmountRefunded)
+
+	var evt model.StripeEvent
+	require.NoError(t, testDB.DB.First(&evt, "id = ?", "evt_refund").Error)
+	assert.Equal(t, model.StateFinished, evt.Status)
+	assert.Equal(t, 1, evt.Attempts)
+	assert.NotNil(t, evt.ProcessedAt)
+}
+
+// TestUserService_StripeWebhook_Replay verifica que un evento fallido queda
+// guardado con su error y puede reprocesarse
+func TestUserService_StripeWebhook_Replay(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+
+	ctx := context.Background()
+	testDB, err := setup.SetupTestDB(ctx)
+	require.NoError(t, err)
+	defer testDB.Close(ctx)
+
+	config.Migrate(testDB.DB)
+
+	testUser := fixtures.CreateTestUser()
+	require.NoError(t, testDB.DB.Create(testUser).Error)
+	premium := fixtures.CreatePremiumSubscription()
+	require.NoError(t, testDB.DB.Create(premium).Error)
+	sub := fixtures.CreateUserSubscription(testUser.ID, premium.ID, model.StatePending)
+	require.NoError(t, testDB.DB.Create(sub).Error)
+
+	svc := user.NewService(user.NewRepository(testDB.DB), nil)
+
+	// El pago aún no existe, así que el evento falla
+	failed := stripeEvent("evt_failed", "payment_intent.payment_failed",
+		`{"id":"pi_2","amount":500,"currency":"usd","last_payment_error":{"message":"card declined"}}`)
+	_, err = svc.StripeWebhook(failed)
+	require.Error(t, err)
+
+	var evt model.StripeEvent
+	require.NoError(t, testDB.DB.First(&evt, "id = ?", "evt_failed").Error)
+	assert.Equal(t, model.StateError, evt.Status)
+	assert.NotEmpty(t, evt.Error)
+
+	payment := &model.Payment{
+		ID:                    uuid.New(),
+		UserID:                testUser.ID.String(),
+		UserSuscribedID:       sub.ID.String(),
+		StripePaymentIntentID: "pi_2",
+		Status:                model.StatePending,
+	}
+	require.NoError(t, testDB.DB.Create(payment).Error)
+
+	replayed, err := svc.ReplayStripeEvent("evt_failed")
+	require.NoError(t, err)
+	assert.Equal(t, string(model.StateFinished), replayed.Status)
+	assert.Equal(t, 2, replayed.Attempts)
+
+	var stored model.Payment
+	require.NoError(t, testDB.DB.First(&stored, "id = ?", payment.ID).Error)
+	assert.Equal(t, model.StateError, stored.Status)
+	assert.Equal(t, "card declined", stored.FailureMessage)
+	assert.Equal(t, 500, stored.Amount)
+
+	// Un evento ya procesado no se reprocesa
+	_, err = svc.ReplayStripeEvent("evt_failed")
+	assert.Error(t, err)
+}
+
+// TestUserService_SubscriptionActivatesOnPayment verifica que un plan de pago
+// queda PENDING y sin saldo hasta que Stripe confirma el pago, y que el saldo
+// se otorga una sola vez aunque el pago llegue por dos eventos
+func TestUserService_SubscriptionActivatesOnPayment(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+
+	ctx := context.Background()
+	testDB, err := setup.SetupTestDB(ctx)
+	require.NoError(t, err)
+	defer testDB.Close(ctx)
+
+	config.Migrate(testDB.DB)
+
+	testUser := fixtures.CreateTestUser()
+	require.NoError(t, testDB.DB.Create(testUser).Error)
+	free := fixtures.CreateFreeSubscription()
+	premium := fixtures.CreatePremiumSubscription()
+	require.NoError(t, testDB.DB.Create([]*model.Subscription{free, premium}).Error)
+	current := fixtures.CreateUserSubscription(testUser.ID, free.ID, model.StateActive)
+	require.NoError(t, testDB.DB.Create(current).Error)
+
+	repo := user.NewRepository(testDB.DB)
+	svc := user.NewService(repo, nil)
+
+	pending, err := svc.AddSubscription(testUser.ID.String(), premium.ID.String())
+	require.NoError(t, err)
+	assert.Equal(t, string(model.StatePending), pending.Status)
+	assert.Zero(t, pending.Total_Cuentokens)
+
+	// Mientras no se pague sigue vigente el plan anterior
+	active, err := repo.GetActiveSubscription(testUser.ID.String())
+	require.NoError(t, err)
+	assert.Equal(t, current.ID, active.ID)
+
+	payment := &model.Payment{
+		ID:              uuid.New(),
+		UserID:          testUser.ID.String(),
+		UserSuscribedID: pending.ID,
+		Status:          model.StatePending,
+	}
+	require.NoError(t, testDB.DB.Create(payment).Error)
+
+	metadata := fmt.Sprintf(`{"subs_user_id":%q,"payment_id":%q}`, pending.ID, payment.ID)
+	start, end := time.Now().Unix(), time.Now().AddDate(0, 1, 0).Unix()
+	events := []stripe.Event{
+		stripeEvent("evt_invoice", "invoice.paid", fmt.Sprintf(
+			`{"id":"in_1","billing_reason":"subscription_create","amount_paid":2999,"currency":"usd",`+
+				`"parent":{"subscription_details":{"subscription":"sub_1","metadata":%s}},`+
+				`"lines":{"data":[{"period":{"start":%d,"end":%d}}]}}`, metadata, start, end)),
+		stripeEvent("evt_checkout", "checkout.session.completed", fmt.Sprintf(
+			`{"id":"cs_1","mode":"subscription","amount_total":2999,"currency":"usd","subscription":"sub_1","metadata":%s}`, metadata)),
+	}
+	for _, evt := range events {
+		_, err := svc.StripeWebhook(evt)
+		require.NoError(t, err, evt.Type)
+	}
+
+	active, err = repo.GetActiveSubscription(testUser.ID.String())
+	require.NoError(t, err)
+	assert.Equal(t, pending.ID, active.ID.String())
+	assert.Equal(t, model.StateActive, active.Status)
+	assert.Equal(t, premium.Cuentokens, active.TokensRemaining)
+	assert.Equal(t, "sub_1", active.StripeSubscriptionID)
+
+	var grants int64
+	require.NoError(t, testDB.DB.Model(&model.TokenLedger{}).
+		Where("user_subscribed_id = ? AND reason = ?", active.ID, model.LedgerSubscriptionGrant).
+		Count(&grants).Error)
+	assert.Equal(t, int64(1), grants)
+
+	// El plan anterior queda cerrado
+	var closed model.UserSubscribed
+	require.NoError(t, testDB.DB.First(&closed, "id = ?", current.ID).Error)
+	assert.False(t, closed.EndDate.After(time.Now()))
+}
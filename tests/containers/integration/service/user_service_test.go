@@ -37,7 +37,7 @@ func TestUserService_FindById(t *testing.T) {
 
 	// Crear servicio
 	repo := user.NewRepository(testDB.DB)
-	svc := user.NewService(repo)
+	svc := user.NewService(repo, nil)
 
 	// Ejecutar test
 	result, err := svc.FindById(testUser.ID.String())
@@ -67,7 +67,7 @@ func TestUserService_SignUp(t *testing.T) {
 	require.NoError(t, err)
 
 	repo := user.NewRepository(testDB.DB)
-	svc := user.NewService(repo)
+	svc := user.NewService(repo, nil)
 
 	// Preparar input
 	input := &user.Singup{
@@ -118,7 +118,7 @@ func TestUserService_SignUp_InvalidEmail(t *testing.T) {
 	require.NoError(t, err)
 
 	repo := user.NewRepository(testDB.DB)
-	svc := user.NewService(repo)
+	svc := user.NewService(repo, nil)
 
 	// Email inválido
 	input := &user.Singup{
@@ -154,7 +154,7 @@ func TestUserService_SignUp_WeakPassword(t *testing.T) {
 	require.NoError(t, err)
 
 	repo := user.NewRepository(testDB.DB)
-	svc := user.NewService(repo)
+	svc := user.NewService(repo, nil)
 
 	// Contraseña débil (< 8 caracteres)
 	input := &user.Singup{
@@ -195,7 +195,7 @@ func TestUserService_SignUp_EmailTaken(t *testing.T) {
 	require.NoError(t, err)
 
 	repo := user.NewRepository(testDB.DB)
-	svc := user.NewService(repo)
+	svc := user.NewService(repo, nil)
 
 	// Intentar registrar con email existente
 	input := &user.Singup{
@@ -241,7 +241,7 @@ func TestUserService_SignIn(t *testing.T) {
 	require.NoError(t, err)
 
 	repo := user.NewRepository(testDB.DB)
-	svc := user.NewService(repo)
+	svc := user.NewService(repo, nil)
 
 	// Ejecutar test
 	input := &user.Signin{
@@ -285,7 +285,7 @@ func TestUserService_SignIn_InvalidPassword(t *testing.T) {
 	require.NoError(t, err)
 
 	repo := user.NewRepository(testDB.DB)
-	svc := user.NewService(repo)
+	svc := user.NewService(repo, nil)
 
 	// Intentar con contraseña incorrecta
 	input := &user.Signin{
@@ -321,7 +321,7 @@ func TestUserService_FindAll(t *testing.T) {
 	}
 
 	repo := user.NewRepository(testDB.DB)
-	svc := user.NewService(repo)
+	svc := user.NewService(repo, nil)
 
 	// Ejecutar test
 	opts := &helper.FindAllOptions{
@@ -0,0 +1,112 @@
+//go:build containers
+
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/MetaDandy/cuent-ai-core/config"
+	usercore "github.com/MetaDandy/cuent-ai-core/src/core/user"
+	"github.com/MetaDandy/cuent-ai-core/src/model"
+	"github.com/MetaDandy/cuent-ai-core/src/modules/asset"
+	"github.com/MetaDandy/cuent-ai-core/src/modules/character"
+	generatejob "github.com/MetaDandy/cuent-ai-core/src/modules/generate_job"
+	"github.com/MetaDandy/cuent-ai-core/src/modules/voice"
+	"github.com/MetaDandy/cuent-ai-core/tests/containers/fixtures"
+	"github.com/MetaDandy/cuent-ai-core/tests/containers/setup"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func createTestVoice(name string, provider model.Provider) *model.Voice {
+	return &model.Voice{
+		ID:              uuid.New(),
+		Name:            name,
+		Provider:        provider,
+		ProviderVoiceID: name,
+	}
+}
+
+// TestAssetService_VoiceResolution verifica el orden en que se elige la voz
+// de una línea: la propia del asset, la de su personaje, la del proyecto y,
+// sin ninguna, la por defecto del proveedor
+func TestAssetService_VoiceResolution(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+	t.Setenv("TTS_PROVIDER", string(model.ProviderOffline))
+
+	ctx := context.Background()
+	testDB, err := setup.SetupTestDB(ctx)
+	require.NoError(t, err)
+	defer testDB.Close(ctx)
+
+	config.Migrate(testDB.DB)
+	db := testDB.DB
+
+	assetVoice := createTestVoice("asset", model.ProviderOffline)
+	charVoice := createTestVoice("character", model.ProviderOffline)
+	projectVoice := createTestVoice("project", model.ProviderOffline)
+	otherVoice := createTestVoice("other", model.ProviderOpenAI)
+	for _, v := range []*model.Voice{assetVoice, charVoice, projectVoice, otherVoice} {
+		require.NoError(t, db.Create(v).Error)
+	}
+
+	user := fixtures.CreateTestUser()
+	require.NoError(t, db.Create(user).Error)
+	free := fixtures.CreateFreeSubscription()
+	require.NoError(t, db.Create(free).Error)
+	require.NoError(t, db.Create(fixtures.CreateUserSubscription(user.ID, free.ID, model.StateActive)).Error)
+
+	withVoice := fixtures.CreateTestProject(user.ID)
+	withVoice.VoiceID = &projectVoice.ID
+	withoutVoice := fixtures.CreateTestProjectWithName(user.ID, "Sin voz")
+	require.NoError(t, db.Create([]*model.Project{withVoice, withoutVoice}).Error)
+
+	edipo := &model.Character{ID: uuid.New(), Name: "Edipo", ProjectID: withVoice.ID, VoiceID: &charVoice.ID}
+	require.NoError(t, db.Create(edipo).Error)
+
+	first := fixtures.CreateTestScript(withVoice.ID)
+	second := fixtures.CreateTestScript(withoutVoice.ID)
+	require.NoError(t, db.Create([]*model.Script{first, second}).Error)
+
+	lines := fixtures.CreateTestAssets(first.ID, 4)
+	// Voz propia y personaje: gana la propia
+	lines[0].VoiceID = &assetVoice.ID
+	lines[0].CharacterID = &edipo.ID
+	// Sólo personaje
+	lines[1].CharacterID = &edipo.ID
+	// Voz propia de otro proveedor que el del job: se ignora
+	lines[3].VoiceID = &otherVoice.ID
+	require.NoError(t, db.Create(&lines).Error)
+	orphan := fixtures.CreateTestAssets(second.ID, 1)
+	require.NoError(t, db.Create(&orphan).Error)
+
+	svc := asset.NewService(asset.NewRepository(db), generatejob.NewRepository(db), usercore.NewRepository(db),
+		voice.NewRepository(db), character.NewRepository(db), nil, nil, nil)
+
+	jobVoice := func(assetID uuid.UUID) (model.Provider, *uuid.UUID) {
+		var job model.GeneratedJob
+		require.NoError(t, db.First(&job, "asset_id = ?", assetID).Error)
+		return job.Provider, job.VoiceID
+	}
+
+	_, err = svc.GenerateAll(first.ID.String(), user.ID.String(), false, string(model.ProviderOffline))
+	require.NoError(t, err)
+	_, err = svc.GenerateAll(second.ID.String(), user.ID.String(), false, "")
+	require.NoError(t, err)
+
+	want := []*uuid.UUID{&assetVoice.ID, &charVoice.ID, &projectVoice.ID, nil}
+	for i, a := range lines {
+		provider, voiceID := jobVoice(a.ID)
+		assert.Equal(t, model.ProviderOffline, provider, "línea %d", i)
+		assert.Equal(t, want[i], voiceID, "línea %d", i)
+	}
+
+	// Sin voz en ningún nivel se usa el proveedor por defecto sin voz
+	provider, voiceID := jobVoice(orphan[0].ID)
+	assert.Equal(t, model.ProviderOffline, provider)
+	assert.Nil(t, voiceID)
+}
@@ -28,7 +28,7 @@ func (s *UserServiceAdapter) Signin(in *user.Signin) (*user.UserResponse, string
 	if !helper.CheckPasswordHash(in.Password, u.Password) {
 		return nil, "", errors.New("la contraseña no coincide")
 	}
-	token, err := helper.GenerateJwt(u.ID.String(), u.Email)
+	token, err := helper.GenerateJwt(u.ID.String(), u.Email, string(model.RoleUser))
 	if err != nil {
 		return nil, "", err
 	}
@@ -0,0 +1,107 @@
+//go:build unit
+
+package formatter_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/MetaDandy/cuent-ai-core/helper"
+)
+
+func TestNormalizeLines(t *testing.T) {
+	in := []helper.FormattedLine{
+		{Type: "TTS", Text: " Era una noche oscura. ", Speaker: "Narrator"},
+		{Type: "tts", Text: "¿Quién anda ahí?", Speaker: " Ana ", Duration: 3},
+		{Type: "SFX", Text: "*door creaking slowly*", Speaker: "Ana", Duration: 2},
+		{Type: "TTS", Text: "Dijo Luis.", Speaker: "narrador", Pause: 1.5},
+	}
+
+	want := []helper.FormattedLine{
+		{Type: "TTS", Text: "Era una noche oscura."},
+		{Type: "TTS", Text: "¿Quién anda ahí?", Speaker: "Ana"},
+		{Type: "SFX", Text: "door creaking slowly", Duration: 2},
+		{Type: "TTS", Text: "Dijo Luis.", Pause: 1.5},
+	}
+
+	got := helper.NormalizeLines(in)
+	if len(got) != len(want) {
+		t.Fatalf("esperaba %d líneas, obtuve %d: %+v", len(want), len(got), got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("línea %d: esperaba %+v, obtuve %+v", i, want[i], got[i])
+		}
+	}
+}
+
+func TestValidateLines(t *testing.T) {
+	tests := []struct {
+		name  string
+		lines []helper.FormattedLine
+		want  string // fragmento esperado del problema; vacío si es válido
+	}{
+		{"Valid", []helper.FormattedLine{{Type: "TTS", Text: "Hola"}, {Type: "SFX", Text: "rain", Duration: 4, Pause: 1}}, ""},
+		{"Empty script", nil, "no tiene líneas"},
+		{"Unknown type", []helper.FormattedLine{{Type: "DIALOGUE", Text: "Hola"}}, "debe ser TTS o SFX"},
+		{"Empty text", []helper.FormattedLine{{Type: "TTS", Text: ""}}, "text vacío"},
+		{"TTS too long", []helper.FormattedLine{{Type: "TTS", Text: strings.Repeat("a", helper.MaxTTSChars+1)}}, "supera"},
+		{"SFX too long", []helper.FormattedLine{{Type: "SFX", Text: "rain", Duration: 30}}, "duration"},
+		{"Negative pause", []helper.FormattedLine{{Type: "TTS", Text: "Hola", Pause: -1}}, "pause"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			problems := helper.ValidateLines(tt.lines)
+			if tt.want == "" {
+				if len(problems) > 0 {
+					t.Fatalf("no esperaba problemas, obtuve %v", problems)
+				}
+				return
+			}
+			if len(problems) != 1 || !strings.Contains(problems[0], tt.want) {
+				t.Errorf("esperaba un problema con %q, obtuve %v", tt.want, problems)
+			}
+		})
+	}
+}
+
+func TestParseFormattedLines(t *testing.T) {
+	lines, err := helper.ParseFormattedLines(`[
+		{"type": "TTS", "speaker": "", "text": "Llovía."},
+		{"type": "SFX", "speaker": "", "text": "heavy rain", "duration": 5},
+		{"type": "TTS", "speaker": "Ana", "text": "Qué frío.", "pause": 0.5}
+	]`)
+	if err != nil {
+		t.Fatalf("error inesperado: %v", err)
+	}
+	if len(lines) != 3 || lines[1].Duration != 5 || lines[2].Speaker != "Ana" || lines[2].Pause != 0.5 {
+		t.Errorf("líneas inesperadas: %+v", lines)
+	}
+
+	for _, raw := range []string{
+		"1. Llovía.\n*heavy rain",
+		"```json\n[]\n```",
+		`[{"type": "LINE", "speaker": "", "text": "Llovía."}]`,
+	} {
+		_, err := helper.ParseFormattedLines(raw)
+		var ferr *helper.FormatterError
+		if !errors.As(err, &ferr) {
+			t.Errorf("esperaba FormatterError para %q, obtuve %v", raw, err)
+		}
+	}
+}
+
+func TestRenderLines(t *testing.T) {
+	lines := []helper.FormattedLine{
+		{Type: "TTS", Text: "Era una noche oscura."},
+		{Type: "TTS", Text: "¿Quién anda ahí?", Speaker: "Ana"},
+		{Type: "SFX", Text: "door creaking slowly"},
+	}
+
+	want := "Era una noche oscura.\nAna: ¿Quién anda ahí?\n*door creaking slowly"
+	if got := helper.RenderLines(lines); got != want {
+		t.Errorf("esperaba %q, obtuve %q", want, got)
+	}
+}
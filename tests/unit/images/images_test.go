@@ -0,0 +1,183 @@
+//go:build unit
+
+package images_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/MetaDandy/cuent-ai-core/helper"
+	"github.com/MetaDandy/cuent-ai-core/src/model"
+)
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func newLibrary(t *testing.T) *helper.ImageLibrary {
+	t.Helper()
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "bosque", "noche-luna.jpg"), "luna")
+	writeFile(t, filepath.Join(dir, "bosque", "dia_sol.png"), "sol")
+	writeFile(t, filepath.Join(dir, "mar", "noche.webp"), "mar")
+	writeFile(t, filepath.Join(dir, "notas.txt"), "no es imagen")
+
+	lib, err := helper.NewImageLibrary(dir, "http://api.test/library")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return lib
+}
+
+func ids(images []helper.Image) string {
+	out := make([]string, len(images))
+	for i, img := range images {
+		out[i] = img.ID
+	}
+	return strings.Join(out, ",")
+}
+
+func TestImageLibrary_Search(t *testing.T) {
+	lib := newLibrary(t)
+
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"", "bosque/dia_sol.png,bosque/noche-luna.jpg,mar/noche.webp"},
+		{"noche", "bosque/noche-luna.jpg,mar/noche.webp"},
+		{"Bosque noche", "bosque/noche-luna.jpg"},
+		{"sol", "bosque/dia_sol.png"},
+		{"desierto", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			images, err := lib.Search(context.Background(), helper.ImageQuery{Text: tt.query})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := ids(images); got != tt.want {
+				t.Errorf("expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+
+	images, _ := lib.Search(context.Background(), helper.ImageQuery{Text: "luna"})
+	if images[0].Source != model.ImageLibrary || images[0].URL != "http://api.test/library/bosque/noche-luna.jpg" {
+		t.Errorf("unexpected image: %+v", images[0])
+	}
+}
+
+func TestImageLibrary_Lookup(t *testing.T) {
+	lib := newLibrary(t)
+	ctx := context.Background()
+
+	img, err := lib.Lookup(ctx, "", "bosque/noche-luna.jpg")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	body, err := lib.Open(ctx, *img)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	body.Close()
+
+	for _, id := range []string{"../secret.jpg", "bosque/no-existe.jpg", "notas.txt", "bosque"} {
+		if _, err := lib.Lookup(ctx, "", id); !errors.Is(err, helper.ErrImageNotFound) {
+			t.Errorf("%q: expected ErrImageNotFound, got %v", id, err)
+		}
+	}
+}
+
+func TestUploadImages(t *testing.T) {
+	ctx := context.Background()
+	store, err := helper.NewLocalStore(t.TempDir(), "http://api.test/storage", "secret")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	uploads := helper.NewUploadImages(store)
+
+	// El tipo sale del contenido: el nombre no alcanza para colar otro archivo
+	jpeg := "\xff\xd8\xff\xe0\x00\x10JFIF\x00jpg"
+	png := "\x89PNG\r\n\x1a\npng"
+	for _, body := range []string{"%PDF-1.4 x", "<html><body>x</body></html>", ""} {
+		if _, err := uploads.Upload(ctx, "user-1", "foto.jpg", strings.NewReader(body)); !errors.Is(err, helper.ErrInvalidImage) {
+			t.Fatalf("expected ErrInvalidImage for %q, got %v", body, err)
+		}
+	}
+
+	img, err := uploads.Upload(ctx, "user-1", "Mi Portada Final.JPG", strings.NewReader(jpeg))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.HasPrefix(img.ID, "user-1/") || !strings.HasSuffix(img.ID, "_mi-portada-final.jpg") || img.URL != "images/"+img.ID {
+		t.Errorf("unexpected image: %+v", img)
+	}
+	// Un png con extensión equivocada se guarda como png
+	other, err := uploads.Upload(ctx, "user-2", "otra.jpg", strings.NewReader(png))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.HasSuffix(other.ID, "_otra.png") {
+		t.Errorf("expected a .png key, got %q", other.ID)
+	}
+
+	// Cada usuario sólo ve y usa sus propias imágenes
+	found, err := uploads.Search(ctx, helper.ImageQuery{Text: "portada", UserID: "user-1"})
+	if err != nil || ids(found) != img.ID {
+		t.Errorf("expected only %q, got %q (%v)", img.ID, ids(found), err)
+	}
+	if found, _ := uploads.Search(ctx, helper.ImageQuery{Text: "portada", UserID: "user-2"}); len(found) != 0 {
+		t.Errorf("user-2 should not see user-1 images: %v", ids(found))
+	}
+	if _, err := uploads.Lookup(ctx, "user-2", img.ID); !errors.Is(err, helper.ErrImageNotFound) {
+		t.Errorf("expected ErrImageNotFound for another user, got %v", err)
+	}
+	if got, err := uploads.Lookup(ctx, "user-1", img.ID); err != nil || got.URL != img.URL {
+		t.Errorf("unexpected lookup: %+v %v", got, err)
+	}
+
+	// Download resuelve el proveedor por la fuente de la imagen
+	providers := helper.ImageProviders{model.ImageUpload: uploads}
+	dest := filepath.Join(t.TempDir(), "img.jpg")
+	if err := providers.Download(ctx, *img, dest); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if b, _ := os.ReadFile(dest); string(b) != jpeg {
+		t.Errorf("unexpected content %q", b)
+	}
+}
+
+func TestImageProviders_Get(t *testing.T) {
+	providers := helper.ImageProviders{
+		model.ImageUnsplash: &helper.UnsplashProvider{},
+		model.ImageLibrary:  newLibrary(t),
+	}
+
+	t.Setenv("IMAGE_PROVIDER", "")
+	if p, err := providers.Get(""); err != nil || p.Source() != model.ImageUnsplash {
+		t.Errorf("expected Unsplash by default, got %v %v", p, err)
+	}
+	if p, err := providers.Get("library"); err != nil || p.Source() != model.ImageLibrary {
+		t.Errorf("expected the library, got %v %v", p, err)
+	}
+
+	t.Setenv("IMAGE_PROVIDER", "LIBRARY")
+	if p, err := providers.Get(""); err != nil || p.Source() != model.ImageLibrary {
+		t.Errorf("expected IMAGE_PROVIDER to pick the library, got %v %v", p, err)
+	}
+	if _, err := providers.Get("upload"); !errors.Is(err, helper.ErrImageSource) {
+		t.Errorf("expected ErrImageSource, got %v", err)
+	}
+}
@@ -0,0 +1,93 @@
+//go:build unit
+
+package mailer_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/MetaDandy/cuent-ai-core/helper"
+)
+
+func TestFileMailer(t *testing.T) {
+	dir := t.TempDir()
+	mailer, err := helper.NewFileMailer(dir, "no-reply@test.com")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	err = mailer.Send(context.Background(), helper.Mail{
+		To:      "user@test.com",
+		Subject: "Restablece tu contraseña",
+		Body:    "Hola,\nabre este enlace",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.eml"))
+	if err != nil || len(files) != 1 {
+		t.Fatalf("expected 1 file, got %v (%v)", files, err)
+	}
+	raw, err := os.ReadFile(files[0])
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	msg := string(raw)
+
+	for _, want := range []string{
+		"From: no-reply@test.com\r\n",
+		"To: user@test.com\r\n",
+		"Subject: =?utf-8?q?Restablece_tu_contrase=C3=B1a?=\r\n",
+		"Content-Type: text/plain; charset=utf-8\r\n",
+		"\r\n\r\nHola,\r\nabre este enlace",
+	} {
+		if !strings.Contains(msg, want) {
+			t.Errorf("message missing %q:\n%s", want, msg)
+		}
+	}
+}
+
+func TestFileMailer_CanceledContext(t *testing.T) {
+	mailer, err := helper.NewFileMailer(t.TempDir(), "no-reply@test.com")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := mailer.Send(ctx, helper.Mail{To: "user@test.com"}); err == nil {
+		t.Error("expected error with canceled context")
+	}
+}
+
+func TestNewMailerFromEnv(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		wantErr bool
+	}{
+		{"File by default", map[string]string{"MAILER_BACKEND": "", "MAIL_DIR": t.TempDir()}, false},
+		{"SMTP", map[string]string{"MAILER_BACKEND": "smtp", "SMTP_HOST": "localhost"}, false},
+		{"SMTP without host", map[string]string{"MAILER_BACKEND": "SMTP", "SMTP_HOST": ""}, true},
+		{"Unknown backend", map[string]string{"MAILER_BACKEND": "PIGEON"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			mailer, err := helper.NewMailerFromEnv()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expected error=%v, got %v", tt.wantErr, err)
+			}
+			if !tt.wantErr && mailer == nil {
+				t.Error("expected a mailer")
+			}
+		})
+	}
+}
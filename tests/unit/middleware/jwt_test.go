@@ -0,0 +1,155 @@
+//go:build unit
+
+package middleware_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/MetaDandy/cuent-ai-core/helper"
+	"github.com/MetaDandy/cuent-ai-core/middleware"
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+type fakeRevocations struct {
+	revoked map[string]bool
+	err     error
+}
+
+func (f fakeRevocations) IsRevoked(jti string) (bool, error) {
+	return f.revoked[jti], f.err
+}
+
+func TestJwtMiddleware_Revocation(t *testing.T) {
+	t.Setenv("JWT_SECRET", "test-secret")
+	defer middleware.UseRevocationStore(nil)
+
+	app := fiber.New()
+	app.Get("/me", middleware.JwtMiddleware(), func(c *fiber.Ctx) error {
+		return c.SendString(c.Locals("jti").(string))
+	})
+
+	live, err := helper.GenerateJwtWithID("11111111-1111-1111-1111-111111111111", "user-1", "user@test.com", "USER")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	closed, err := helper.GenerateJwtWithID("22222222-2222-2222-2222-222222222222", "user-1", "user@test.com", "USER")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// Un token sin jti, como los emitidos antes de las sesiones
+	legacy, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"sub":   "user-1",
+		"email": "user@test.com",
+		"role":  "USER",
+		"exp":   time.Now().Add(time.Hour).Unix(),
+	}).SignedString([]byte(os.Getenv("JWT_SECRET")))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		store middleware.RevocationStore
+		token string
+		want  int
+	}{
+		{"Sesión vigente", fakeRevocations{revoked: map[string]bool{"22222222-2222-2222-2222-222222222222": true}}, live, http.StatusOK},
+		{"Sesión revocada", fakeRevocations{revoked: map[string]bool{"22222222-2222-2222-2222-222222222222": true}}, closed, http.StatusUnauthorized},
+		{"Store caído", fakeRevocations{err: errors.New("db down")}, live, http.StatusInternalServerError},
+		{"Sin store", nil, closed, http.StatusOK},
+		{"Sin jti", fakeRevocations{}, legacy, http.StatusUnauthorized},
+		{"Sin jti ni store", nil, legacy, http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			middleware.UseRevocationStore(tt.store)
+
+			req := httptest.NewRequest(http.MethodGet, "/me", nil)
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+			res, err := app.Test(req, -1)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if res.StatusCode != tt.want {
+				t.Errorf("expected status %d, got %d", tt.want, res.StatusCode)
+			}
+		})
+	}
+}
+
+func TestOpaqueToken(t *testing.T) {
+	raw, hash, err := helper.NewOpaqueToken()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if raw == "" || len(hash) != 64 {
+		t.Fatalf("unexpected token %q / hash %q", raw, hash)
+	}
+	if helper.HashOpaqueToken(raw) != hash {
+		t.Error("hash of raw token does not match")
+	}
+
+	other, _, err := helper.NewOpaqueToken()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if other == raw {
+		t.Error("expected different tokens")
+	}
+}
+
+func TestWsJwtMiddleware(t *testing.T) {
+	t.Setenv("JWT_SECRET", "test-secret")
+	middleware.UseRevocationStore(nil)
+
+	app := fiber.New()
+	app.Get("/ws/scripts/:id", middleware.WsJwtMiddleware(), func(c *fiber.Ctx) error {
+		return c.SendString(c.Locals("user_id").(string))
+	})
+
+	token, err := helper.GenerateJwtWithID("11111111-1111-1111-1111-111111111111", "user-1", "user@test.com", "USER")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		query   string
+		header  string
+		upgrade bool
+		want    int
+	}{
+		{"Sin upgrade", "?token=" + token, "", false, http.StatusUpgradeRequired},
+		{"Sin token", "", "", true, http.StatusUnauthorized},
+		{"Token en query", "?token=" + token, "", true, http.StatusOK},
+		{"Token en cabecera", "", "Bearer " + token, true, http.StatusOK},
+		{"Token inválido", "?token=nope", "", true, http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/ws/scripts/abc"+tt.query, nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			if tt.upgrade {
+				req.Header.Set("Connection", "Upgrade")
+				req.Header.Set("Upgrade", "websocket")
+			}
+			res, err := app.Test(req, -1)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if res.StatusCode != tt.want {
+				t.Errorf("expected status %d, got %d", tt.want, res.StatusCode)
+			}
+		})
+	}
+}
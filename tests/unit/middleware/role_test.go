@@ -0,0 +1,89 @@
+//go:build unit
+
+package middleware_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/MetaDandy/cuent-ai-core/helper"
+	"github.com/MetaDandy/cuent-ai-core/middleware"
+	"github.com/MetaDandy/cuent-ai-core/src/model"
+	"github.com/gofiber/fiber/v2"
+)
+
+func newApp() *fiber.App {
+	app := fiber.New()
+	app.Get("/read", middleware.JwtMiddleware(),
+		middleware.RequireRole(model.RoleAdmin, model.RoleSupport),
+		func(c *fiber.Ctx) error { return c.SendString(string(middleware.CurrentRole(c))) })
+	app.Get("/write", middleware.JwtMiddleware(),
+		middleware.RequireRole(model.RoleAdmin),
+		func(c *fiber.Ctx) error { return c.SendStatus(http.StatusNoContent) })
+	return app
+}
+
+func TestRequireRole(t *testing.T) {
+	t.Setenv("JWT_SECRET", "test-secret")
+	app := newApp()
+
+	tests := []struct {
+		name string
+		role string
+		path string
+		want int
+	}{
+		{"Admin reads", string(model.RoleAdmin), "/read", http.StatusOK},
+		{"Support reads", string(model.RoleSupport), "/read", http.StatusOK},
+		{"User cannot read", string(model.RoleUser), "/read", http.StatusForbidden},
+		{"Token without role counts as user", "", "/read", http.StatusForbidden},
+		{"Admin writes", string(model.RoleAdmin), "/write", http.StatusNoContent},
+		{"Support cannot write", string(model.RoleSupport), "/write", http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, err := helper.GenerateJwt("user-1", "user@test.com", tt.role)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			req.Header.Set("Authorization", "Bearer "+token)
+			res, err := app.Test(req, -1)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if res.StatusCode != tt.want {
+				t.Errorf("expected status %d, got %d", tt.want, res.StatusCode)
+			}
+		})
+	}
+}
+
+func TestParseRole(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    model.Role
+		wantErr bool
+	}{
+		{"admin", model.RoleAdmin, false},
+		{" Support ", model.RoleSupport, false},
+		{"USER", model.RoleUser, false},
+		{"root", "", true},
+		{"", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := model.ParseRole(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expected error=%v, got %v", tt.wantErr, err)
+			}
+			if got != tt.want {
+				t.Errorf("expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
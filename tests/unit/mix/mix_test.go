@@ -0,0 +1,198 @@
+//go:build unit
+
+package mix_test
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/MetaDandy/cuent-ai-core/helper"
+	"github.com/MetaDandy/cuent-ai-core/src/model"
+	"github.com/google/uuid"
+)
+
+func asset(kind model.AudioLine, pause float64) model.Asset {
+	return model.Asset{ID: uuid.New(), Type: kind, Pause: pause}
+}
+
+func near(a, b float64) bool { return math.Abs(a-b) < 1e-9 }
+
+func TestBuildTimeline(t *testing.T) {
+	tts1 := asset(model.AudioTTS, 0)
+	sfx := asset(model.AudioSFX, 0)
+	tts2 := asset(model.AudioTTS, 1.5)
+	tts3 := asset(model.AudioTTS, 0)
+	assets := []model.Asset{tts1, sfx, tts2, tts3}
+	durations := []float64{2, 4, 3, 1}
+
+	tests := []struct {
+		name      string
+		mix       model.MixSettings
+		wantStart []float64
+		wantTotal float64
+	}{
+		{
+			name:      "Narración seguida y SFX superpuesto",
+			mix:       model.MixSettings{},
+			wantStart: []float64{0, 2, 2, 6.5},
+			wantTotal: 7.5,
+		},
+		{
+			name:      "Gap por defecto y Pause del asset",
+			mix:       model.MixSettings{Gap: 0.5},
+			wantStart: []float64{0, 2.5, 2.5, 7},
+			wantTotal: 8,
+		},
+		{
+			name: "Offset por asset",
+			mix: model.MixSettings{Tracks: map[string]model.TrackSettings{
+				sfx.ID.String():  {Offset: -5},
+				tts2.ID.String(): {Offset: 1},
+			}},
+			wantStart: []float64{0, 0, 3, 7.5},
+			wantTotal: 8.5,
+		},
+		{
+			name:      "Crossfade entre líneas",
+			mix:       model.MixSettings{Crossfade: 0.5},
+			wantStart: []float64{0, 2, 1.5, 5.5},
+			wantTotal: 6.5,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clips, total := helper.BuildTimeline(assets, durations, tt.mix)
+			if len(clips) != len(assets) {
+				t.Fatalf("expected %d clips, got %d", len(assets), len(clips))
+			}
+			for i, c := range clips {
+				if !near(c.Start, tt.wantStart[i]) {
+					t.Errorf("clip %d: expected start %.3f, got %.3f", i, tt.wantStart[i], c.Start)
+				}
+			}
+			if !near(total, tt.wantTotal) {
+				t.Errorf("expected total %.3f, got %.3f", tt.wantTotal, total)
+			}
+			if clips[1].Layer != helper.LayerSFX || clips[0].Layer != helper.LayerVoice {
+				t.Errorf("unexpected layers: %v / %v", clips[0].Layer, clips[1].Layer)
+			}
+		})
+	}
+}
+
+func TestBuildTimeline_Fades(t *testing.T) {
+	a := asset(model.AudioTTS, 0)
+	b := asset(model.AudioTTS, 0)
+	mix := model.MixSettings{
+		Crossfade: 0.5,
+		Tracks: map[string]model.TrackSettings{
+			a.ID.String(): {FadeIn: 3, FadeOut: 1},
+		},
+	}
+
+	clips, _ := helper.BuildTimeline([]model.Asset{a, b}, []float64{2, 2}, mix)
+
+	// Los fundidos de a (3 + 1) no caben en 2 s y se escalan
+	if !near(clips[0].FadeIn, 1.5) || !near(clips[0].FadeOut, 0.5) {
+		t.Errorf("expected fades 1.5/0.5, got %.3f/%.3f", clips[0].FadeIn, clips[0].FadeOut)
+	}
+	// b entra con el fundido cruzado
+	if !near(clips[1].FadeIn, 0.5) {
+		t.Errorf("expected fade in 0.5, got %.3f", clips[1].FadeIn)
+	}
+}
+
+func TestMixFilterGraph(t *testing.T) {
+	assets := []model.Asset{asset(model.AudioTTS, 0), asset(model.AudioSFX, 0), asset(model.AudioTTS, 0)}
+	clips, total := helper.BuildTimeline(assets, []float64{2, 1, 2}, model.MixSettings{})
+	off := false
+
+	tests := []struct {
+		name     string
+		mix      model.MixSettings
+		music    int
+		contains []string
+		excludes []string
+	}{
+		{
+			name:  "Sin música",
+			mix:   model.MixSettings{},
+			music: -1,
+			contains: []string{
+				"[c0][c2]amix=inputs=2:duration=longest:dropout_transition=0:normalize=0[voice];",
+				"[c1]anull[sfx];",
+				"[voice][sfx]amix=inputs=2",
+				"loudnorm=I=-16.000:TP=-1.5:LRA=11",
+				"adelay=2000|2000[c2]",
+			},
+			excludes: []string{"sidechaincompress", "[music]"},
+		},
+		{
+			name:  "Música con ducking",
+			mix:   model.MixSettings{Music: "audio/music.mp3"},
+			music: 3,
+			contains: []string{
+				"[3:a]aformat=sample_fmts=fltp:sample_rates=44100:channel_layouts=stereo,volume=-18.000dB,atrim=0:4.000",
+				"[voice]asplit=2[vmix][vkey];",
+				"[music][vkey]sidechaincompress=",
+				"[vmix][sfx][ducked]amix=inputs=3",
+			},
+		},
+		{
+			name:     "Música sin ducking",
+			mix:      model.MixSettings{Music: "audio/music.mp3", Ducking: &off},
+			music:    3,
+			contains: []string{"[voice][sfx][music]amix=inputs=3"},
+			excludes: []string{"sidechaincompress"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			graph := helper.MixFilterGraph(clips, total, tt.mix, tt.music)
+			for _, want := range tt.contains {
+				if !strings.Contains(graph, want) {
+					t.Errorf("graph missing %q:\n%s", want, graph)
+				}
+			}
+			for _, bad := range tt.excludes {
+				if strings.Contains(graph, bad) {
+					t.Errorf("graph should not contain %q:\n%s", bad, graph)
+				}
+			}
+			if !strings.HasSuffix(graph, "[out]") {
+				t.Errorf("graph should end in [out]:\n%s", graph)
+			}
+		})
+	}
+}
+
+func TestMixSettingsValidate(t *testing.T) {
+	loud := -3.0
+	gain := 5.0
+
+	tests := []struct {
+		name    string
+		mix     model.MixSettings
+		wantErr bool
+	}{
+		{"Defaults", model.MixSettings{}, false},
+		{"Valid", model.MixSettings{Gap: 0.5, Crossfade: 0.3, Tracks: map[string]model.TrackSettings{"a": {Offset: -1, Gain: 3, FadeIn: 0.2}}}, false},
+		{"Negative gap", model.MixSettings{Gap: -1}, true},
+		{"Loudness too high", model.MixSettings{Loudness: &loud}, true},
+		{"Music gain positive", model.MixSettings{MusicGain: &gain}, true},
+		{"Track fade negative", model.MixSettings{Tracks: map[string]model.TrackSettings{"a": {FadeOut: -1}}}, true},
+		{"NaN offset", model.MixSettings{Tracks: map[string]model.TrackSettings{"a": {Offset: math.NaN()}}}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.mix.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("expected error=%v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
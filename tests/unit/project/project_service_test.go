@@ -13,6 +13,9 @@ import (
 	"gorm.io/gorm"
 )
 
+// Dueño de los proyectos de prueba; el servicio siempre consulta en su nombre.
+var ownerID = uuid.New()
+
 // Mock Project Repository
 type mockProjectRepository struct {
 	projects            map[string]*model.Project
@@ -47,32 +50,34 @@ func (m *mockProjectRepository) Update(p *model.Project) error {
 	return nil
 }
 
-func (m *mockProjectRepository) FindAll(opts *helper.FindAllOptions) ([]model.Project, int64, error) {
+func (m *mockProjectRepository) FindAll(userID string, opts *helper.FindAllOptions) ([]model.Project, int64, error) {
 	if m.findAllFunc != nil {
 		return m.findAllFunc(opts)
 	}
 	projects := make([]model.Project, 0, len(m.projects))
 	for _, p := range m.projects {
-		projects = append(projects, *p)
+		if p.UserID.String() == userID {
+			projects = append(projects, *p)
+		}
 	}
 	return projects, int64(len(projects)), nil
 }
 
-func (m *mockProjectRepository) FindById(id string) (*model.Project, error) {
+func (m *mockProjectRepository) FindById(id, userID string) (*model.Project, error) {
 	if m.findByIdFunc != nil {
 		return m.findByIdFunc(id)
 	}
-	if project, ok := m.projects[id]; ok {
+	if project, ok := m.projects[id]; ok && project.UserID.String() == userID {
 		return project, nil
 	}
 	return nil, gorm.ErrRecordNotFound
 }
 
-func (m *mockProjectRepository) FindByIdUnscoped(id string) (*model.Project, error) {
+func (m *mockProjectRepository) FindByIdUnscoped(id, userID string) (*model.Project, error) {
 	if m.findByIdUnscopedFunc != nil {
 		return m.findByIdUnscopedFunc(id)
 	}
-	if project, ok := m.projects[id]; ok {
+	if project, ok := m.projects[id]; ok && project.UserID.String() == userID {
 		return project, nil
 	}
 	return nil, gorm.ErrRecordNotFound
@@ -116,6 +121,7 @@ func TestService_FindByID(t *testing.T) {
 	projectID := uuid.New()
 	mockProject := &model.Project{
 		ID:          projectID,
+		UserID:      ownerID,
 		Name:        "Test Project",
 		Description: "Description",
 		State:       model.StatePending,
@@ -164,6 +170,17 @@ func TestService_FindByID(t *testing.T) {
 			expectedError: true,
 			expectedFound: false,
 		},
+		{
+			name:    "Failure - Project Of Another User",
+			inputID: projectID.String(),
+			mockSetup: func(m *mockProjectRepository) {
+				foreign := *mockProject
+				foreign.UserID = uuid.New()
+				m.projects = map[string]*model.Project{projectID.String(): &foreign}
+			},
+			expectedError: true,
+			expectedFound: false,
+		},
 	}
 
 	for _, tt := range tests {
@@ -171,9 +188,9 @@ func TestService_FindByID(t *testing.T) {
 			mockRepo := &mockProjectRepository{}
 			tt.mockSetup(mockRepo)
 
-			svc := project.NewService(mockRepo, nil)
+			svc := project.NewService(mockRepo, nil, nil)
 
-			result, err := svc.FindByID(tt.inputID)
+			result, err := svc.FindByID(tt.inputID, ownerID.String())
 
 			if tt.expectedError {
 				if err == nil {
@@ -204,6 +221,7 @@ func TestService_Update(t *testing.T) {
 	projectID := uuid.New()
 	mockProject := &model.Project{
 		ID:          projectID,
+		UserID:      ownerID,
 		Name:        "Old Name",
 		Description: "Old Description",
 		State:       model.StatePending,
@@ -318,8 +336,8 @@ func TestService_Update(t *testing.T) {
 			}
 			tt.mockSetup(mockRepo)
 
-			svc := project.NewService(mockRepo, nil)
-			result, err := svc.Update(tt.inputID, tt.input)
+			svc := project.NewService(mockRepo, nil, nil)
+			result, err := svc.Update(tt.inputID, ownerID.String(), tt.input)
 
 			if tt.expectedError {
 				if err == nil {
@@ -342,9 +360,10 @@ func TestService_Update(t *testing.T) {
 func TestService_SoftDelete(t *testing.T) {
 	projectID := uuid.New()
 	mockProject := &model.Project{
-		ID:    projectID,
-		Name:  "Test Project",
-		State: model.StatePending,
+		ID:     projectID,
+		UserID: ownerID,
+		Name:   "Test Project",
+		State:  model.StatePending,
 	}
 
 	tests := []struct {
@@ -405,8 +424,8 @@ func TestService_SoftDelete(t *testing.T) {
 			}
 			tt.mockSetup(mockRepo)
 
-			svc := project.NewService(mockRepo, nil)
-			deleted, err := svc.SoftDelete(tt.inputID)
+			svc := project.NewService(mockRepo, nil, nil)
+			deleted, err := svc.SoftDelete(tt.inputID, ownerID.String())
 
 			if tt.expectedError {
 				if err == nil {
@@ -427,9 +446,10 @@ func TestService_SoftDelete(t *testing.T) {
 func TestService_Restore(t *testing.T) {
 	projectID := uuid.New()
 	mockProject := &model.Project{
-		ID:    projectID,
-		Name:  "Test Project",
-		State: model.StatePending,
+		ID:     projectID,
+		UserID: ownerID,
+		Name:   "Test Project",
+		State:  model.StatePending,
 	}
 
 	tests := []struct {
@@ -490,8 +510,8 @@ func TestService_Restore(t *testing.T) {
 			}
 			tt.mockSetup(mockRepo)
 
-			svc := project.NewService(mockRepo, nil)
-			result, err := svc.Restore(tt.inputID)
+			svc := project.NewService(mockRepo, nil, nil)
+			result, err := svc.Restore(tt.inputID, ownerID.String())
 
 			if tt.expectedError {
 				if err == nil {
@@ -515,14 +535,16 @@ func TestService_Restore(t *testing.T) {
 
 func TestService_FindAll(t *testing.T) {
 	mockProject1 := &model.Project{
-		ID:    uuid.New(),
-		Name:  "Project 1",
-		State: model.StatePending,
+		ID:     uuid.New(),
+		UserID: ownerID,
+		Name:   "Project 1",
+		State:  model.StatePending,
 	}
 	mockProject2 := &model.Project{
-		ID:    uuid.New(),
-		Name:  "Project 2",
-		State: model.StateActive,
+		ID:     uuid.New(),
+		UserID: ownerID,
+		Name:   "Project 2",
+		State:  model.StateActive,
 	}
 
 	tests := []struct {
@@ -539,9 +561,11 @@ func TestService_FindAll(t *testing.T) {
 				Offset: 0,
 			},
 			mockSetup: func(m *mockProjectRepository) {
+				foreign := &model.Project{ID: uuid.New(), UserID: uuid.New(), Name: "Ajeno"}
 				m.projects = map[string]*model.Project{
 					mockProject1.ID.String(): mockProject1,
 					mockProject2.ID.String(): mockProject2,
+					foreign.ID.String():      foreign,
 				}
 			},
 			expectedCount: 2,
@@ -568,8 +592,8 @@ func TestService_FindAll(t *testing.T) {
 			}
 			tt.mockSetup(mockRepo)
 
-			svc := project.NewService(mockRepo, nil)
-			result, err := svc.FindAll(tt.opts)
+			svc := project.NewService(mockRepo, nil, nil)
+			result, err := svc.FindAll(ownerID.String(), tt.opts)
 
 			if tt.expectedError {
 				if err == nil {
@@ -0,0 +1,73 @@
+//go:build unit
+
+package queue_test
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/MetaDandy/cuent-ai-core/src/model"
+	"github.com/MetaDandy/cuent-ai-core/src/modules/asset"
+)
+
+func free(s *asset.ProviderSlots) []string {
+	out := []string{}
+	for _, p := range s.Free() {
+		out = append(out, string(p))
+	}
+	sort.Strings(out)
+	return out
+}
+
+func TestProviderSlots_ProviderLimit(t *testing.T) {
+	s := asset.NewProviderSlots(4, map[model.Provider]int{
+		model.ProviderElevenlab: 1,
+		model.ProviderOpenAI:    2,
+		model.ProviderOffline:   0,
+	})
+
+	s.Acquire(model.ProviderElevenlab)
+	if got := free(s); len(got) != 2 || got[0] != "OFFLINE" || got[1] != "OPENAI" {
+		t.Fatalf("ElevenLabs va de a uno, got %v", got)
+	}
+
+	s.Acquire(model.ProviderOpenAI)
+	s.Acquire(model.ProviderOpenAI)
+	if got := free(s); len(got) != 1 || got[0] != "OFFLINE" {
+		t.Fatalf("expected only OFFLINE (sin límite), got %v", got)
+	}
+
+	s.Release(model.ProviderElevenlab)
+	if got := free(s); len(got) != 2 || got[0] != "ELEVENLAB" {
+		t.Fatalf("expected ELEVENLAB back after release, got %v", got)
+	}
+}
+
+func TestProviderSlots_WorkerPool(t *testing.T) {
+	s := asset.NewProviderSlots(2, map[model.Provider]int{
+		model.ProviderOffline: 0,
+		model.ProviderOpenAI:  2,
+	})
+
+	s.Acquire(model.ProviderOffline)
+	s.Acquire(model.ProviderOffline)
+	if got := s.Free(); len(got) != 0 {
+		t.Fatalf("expected no slots with the pool full, got %v", got)
+	}
+
+	s.Release(model.ProviderOffline)
+	if got := free(s); len(got) != 2 {
+		t.Fatalf("expected both providers after release, got %v", got)
+	}
+}
+
+func TestProviderSlots_AtLeastOneWorker(t *testing.T) {
+	s := asset.NewProviderSlots(0, map[model.Provider]int{model.ProviderOffline: 0})
+	if got := s.Free(); len(got) != 1 {
+		t.Fatalf("expected one worker by default, got %v", got)
+	}
+	s.Acquire(model.ProviderOffline)
+	if got := s.Free(); len(got) != 0 {
+		t.Fatalf("expected the single worker to be busy, got %v", got)
+	}
+}
@@ -0,0 +1,161 @@
+//go:build unit
+
+package render_test
+
+import (
+	"errors"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/MetaDandy/cuent-ai-core/helper"
+)
+
+func near(a, b float64) bool { return math.Abs(a-b) < 1e-9 }
+
+func TestRenderOptions_Normalize(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    helper.RenderOptions
+		wantErr bool
+	}{
+		{"Defaults", helper.RenderOptions{}, false},
+		{"Vertical 1080", helper.RenderOptions{Aspect: "9:16", Resolution: 1080, Transition: "SlideLeft"}, false},
+		{"Sin transición", helper.RenderOptions{Transition: "none"}, false},
+		{"Aspecto inválido", helper.RenderOptions{Aspect: "4:3"}, true},
+		{"Resolución inválida", helper.RenderOptions{Resolution: 600}, true},
+		{"Transición desconocida", helper.RenderOptions{Transition: "spin"}, true},
+		{"Transición muy larga", helper.RenderOptions{TransitionDuration: 5}, true},
+		{"SFX inválido", helper.RenderOptions{SFX: "hide"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.opts.Normalize()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expected error=%v, got %v", tt.wantErr, err)
+			}
+			if err != nil && !errors.Is(err, helper.ErrRenderOptions) {
+				t.Errorf("expected ErrRenderOptions, got %v", err)
+			}
+		})
+	}
+
+	opts := helper.RenderOptions{}
+	_ = opts.Normalize()
+	if opts.Aspect != "16:9" || opts.Resolution != 720 || opts.Transition != "fade" || opts.TransitionDuration != 0.5 || opts.SFX != helper.SFXSkip {
+		t.Errorf("unexpected defaults: %+v", opts)
+	}
+}
+
+func TestRenderOptions_Size(t *testing.T) {
+	tests := []struct {
+		aspect     string
+		resolution int
+		w, h       int
+	}{
+		{"16:9", 720, 1280, 720},
+		{"16:9", 480, 854, 480},
+		{"9:16", 1080, 1080, 1920},
+		{"1:1", 720, 720, 720},
+	}
+
+	for _, tt := range tests {
+		w, h := helper.RenderOptions{Aspect: tt.aspect, Resolution: tt.resolution}.Size()
+		if w != tt.w || h != tt.h {
+			t.Errorf("%s@%d: expected %dx%d, got %dx%d", tt.aspect, tt.resolution, tt.w, tt.h, w, h)
+		}
+	}
+}
+
+func TestVideoSegments(t *testing.T) {
+	clips := []helper.MixClip{
+		{Layer: helper.LayerVoice, Start: 0.2, Duration: 2},
+		{Layer: helper.LayerSFX, Start: 2.2, Duration: 5},
+		{Layer: helper.LayerVoice, Start: 2.7, Duration: 3},
+	}
+
+	segs := helper.VideoSegments(clips, 7.2)
+	want := []helper.VideoSegment{
+		{Asset: 0, Start: 0, Duration: 2.7},
+		{Asset: 2, Start: 2.7, Duration: 4.5},
+	}
+	if len(segs) != len(want) {
+		t.Fatalf("expected %d segments, got %d", len(want), len(segs))
+	}
+	for i := range want {
+		if segs[i].Asset != want[i].Asset || !near(segs[i].Start, want[i].Start) || !near(segs[i].Duration, want[i].Duration) {
+			t.Errorf("segment %d: expected %+v, got %+v", i, want[i], segs[i])
+		}
+	}
+
+	// Un script sólo con SFX usa un segmento por efecto
+	sfx := helper.VideoSegments([]helper.MixClip{
+		{Layer: helper.LayerSFX, Start: 0, Duration: 2},
+		{Layer: helper.LayerSFX, Start: 0, Duration: 3},
+	}, 3)
+	if len(sfx) != 1 || sfx[0].Asset != 1 || !near(sfx[0].Duration, 3) {
+		t.Errorf("unexpected SFX segments: %+v", sfx)
+	}
+}
+
+func TestRenderFilterGraph(t *testing.T) {
+	segs := []helper.VideoSegment{
+		{Asset: 0, Start: 0, Duration: 2},
+		{Asset: 1, Start: 2, Duration: 0.6},
+		{Asset: 2, Start: 2.6, Duration: 3},
+	}
+
+	tests := []struct {
+		name      string
+		opts      helper.RenderOptions
+		subtitles bool
+		contains  []string
+		excludes  []string
+	}{
+		{
+			name: "Transición limitada al segmento más corto",
+			opts: helper.RenderOptions{Transition: "wipeleft", TransitionDuration: 1},
+			contains: []string{
+				"[0:v]scale=1280:720:force_original_aspect_ratio=increase,crop=1280:720",
+				"trim=duration=2.300,setpts=PTS-STARTPTS[s0];",
+				"trim=duration=3.000,setpts=PTS-STARTPTS[s2];",
+				"[s0][s1]xfade=transition=wipeleft:duration=0.300:offset=2.000[x1];",
+				"[x1][s2]xfade=transition=wipeleft:duration=0.300:offset=2.600[x2];",
+				"[x2]null[v]",
+			},
+			excludes: []string{"concat", "subtitles"},
+		},
+		{
+			name:      "Corte seco con subtítulos",
+			opts:      helper.RenderOptions{Aspect: "9:16", Transition: "none"},
+			subtitles: true,
+			contains: []string{
+				"crop=720:1280",
+				"trim=duration=2.000,setpts=PTS-STARTPTS[s0];",
+				"[s0][s1][s2]concat=n=3:v=1:a=0[x];",
+				"[x]subtitles=subs.srt[v]",
+			},
+			excludes: []string{"xfade"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.opts.Normalize(); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			graph := helper.RenderFilterGraph(segs, tt.opts, tt.subtitles)
+			for _, want := range tt.contains {
+				if !strings.Contains(graph, want) {
+					t.Errorf("graph missing %q:\n%s", want, graph)
+				}
+			}
+			for _, bad := range tt.excludes {
+				if strings.Contains(graph, bad) {
+					t.Errorf("graph should not contain %q:\n%s", bad, graph)
+				}
+			}
+		})
+	}
+}
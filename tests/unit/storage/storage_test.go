@@ -0,0 +1,415 @@
+//go:build unit
+
+package storage_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/MetaDandy/cuent-ai-core/helper"
+)
+
+func readAll(t *testing.T, rc io.ReadCloser) string {
+	t.Helper()
+	defer rc.Close()
+	b, err := io.ReadAll(rc)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return string(b)
+}
+
+func TestLocalStore_RoundTrip(t *testing.T) {
+	ctx := context.Background()
+	store, err := helper.NewLocalStore(t.TempDir(), "http://api.test/storage", "secret")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	url, err := store.Put(ctx, "audio", "script-1/tts_a.mp3", strings.NewReader("aaa"), "audio/mpeg")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if url != "http://api.test/storage/audio/script-1/tts_a.mp3" {
+		t.Errorf("unexpected url %q", url)
+	}
+	if _, err := store.Put(ctx, "audio", "script-1/tts_b.mp3", strings.NewReader("bbb"), "audio/mpeg"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	rc, err := store.Get(ctx, "audio", "script-1/tts_a.mp3")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := readAll(t, rc); got != "aaa" {
+		t.Errorf("expected aaa, got %q", got)
+	}
+
+	// OpenURL reconoce las URLs del propio store
+	rc, err = helper.OpenURL(ctx, store, url)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := readAll(t, rc); got != "aaa" {
+		t.Errorf("expected aaa, got %q", got)
+	}
+
+	keys, err := store.List(ctx, "audio", "script-1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	sort.Strings(keys)
+	if strings.Join(keys, ",") != "script-1/tts_a.mp3,script-1/tts_b.mp3" {
+		t.Errorf("unexpected keys %v", keys)
+	}
+
+	if err := helper.DeletePrefix(ctx, store, "audio", "script-1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := store.Get(ctx, "audio", "script-1/tts_a.mp3"); !errors.Is(err, helper.ErrObjectNotFound) {
+		t.Errorf("expected ErrObjectNotFound, got %v", err)
+	}
+	if keys, _ := store.List(ctx, "audio", "missing"); len(keys) != 0 {
+		t.Errorf("expected no keys, got %v", keys)
+	}
+}
+
+// serveRange sirve la referencia ref con http.ServeContent, como el stream de
+// audio, y devuelve el cuerpo de la respuesta parcial
+func serveRange(t *testing.T, store helper.BlobStore, ref, rng string) string {
+	t.Helper()
+	obj, err := helper.OpenObject(context.Background(), store, ref)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer obj.Close()
+
+	req := httptest.NewRequest(http.MethodGet, "/audio", nil)
+	req.Header.Set("Range", rng)
+	rec := httptest.NewRecorder()
+	http.ServeContent(rec, req, "audio.mp3", time.Time{}, obj)
+	if rec.Code != http.StatusPartialContent {
+		t.Fatalf("expected 206, got %d", rec.Code)
+	}
+	return rec.Body.String()
+}
+
+func TestObject_Range(t *testing.T) {
+	ctx := context.Background()
+	store, err := helper.NewLocalStore(t.TempDir(), "http://api.test/storage", "secret")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := store.Put(ctx, "audio", "s/a.mp3", strings.NewReader("0123456789"), "audio/mpeg"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	obj, err := helper.OpenObject(ctx, store, "audio/s/a.mp3")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if obj.Size() != 10 {
+		t.Errorf("expected size 10, got %d", obj.Size())
+	}
+	if _, err := obj.Seek(-3, io.SeekEnd); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := readAll(t, obj); got != "789" {
+		t.Errorf("expected 789, got %q", got)
+	}
+
+	if got := serveRange(t, store, "audio/s/a.mp3", "bytes=2-5"); got != "2345" {
+		t.Errorf("expected 2345, got %q", got)
+	}
+	if _, err := helper.OpenObject(ctx, store, "audio/s/missing.mp3"); !errors.Is(err, helper.ErrObjectNotFound) {
+		t.Errorf("expected ErrObjectNotFound, got %v", err)
+	}
+}
+
+func TestLocalStore_RejectsTraversal(t *testing.T) {
+	store, err := helper.NewLocalStore(t.TempDir(), "http://api.test/storage", "secret")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	_, err = store.Put(context.Background(), "audio", "../../etc/passwd", strings.NewReader("x"), "text/plain")
+	if err == nil {
+		t.Error("expected error for key outside the bucket")
+	}
+}
+
+func TestLocalStore_SignedURL(t *testing.T) {
+	store, err := helper.NewLocalStore(t.TempDir(), "http://api.test/storage", "secret")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	signed, err := store.SignedURL(context.Background(), "video", "s/a.mp4", time.Minute)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	u, err := url.Parse(signed)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	q := u.Query()
+
+	if err := store.Verify("video", "s/a.mp4", q.Get("expires"), q.Get("signature")); err != nil {
+		t.Errorf("expected valid signature, got %v", err)
+	}
+	if err := store.Verify("video", "s/b.mp4", q.Get("expires"), q.Get("signature")); err == nil {
+		t.Error("expected error for another key")
+	}
+
+	expired, _ := store.SignedURL(context.Background(), "video", "s/a.mp4", -time.Minute)
+	u, _ = url.Parse(expired)
+	if err := store.Verify("video", "s/a.mp4", u.Query().Get("expires"), u.Query().Get("signature")); err == nil {
+		t.Error("expected error for expired url")
+	}
+}
+
+func TestS3Store_SignsRequests(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		objects = map[string]string{}
+		auths   []string
+		ranges  []string
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		auths = append(auths, r.Header.Get("Authorization"))
+
+		switch {
+		case r.Method == http.MethodPut:
+			b, _ := io.ReadAll(r.Body)
+			objects[r.URL.Path] = string(b)
+		case r.Method == http.MethodGet && r.URL.Query().Get("list-type") == "2":
+			io.WriteString(w, `<ListBucketResult><Contents><Key>s/a.mp3</Key></Contents><IsTruncated>false</IsTruncated></ListBucketResult>`)
+		case r.Method == http.MethodGet:
+			body, ok := objects[r.URL.Path]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			ranges = append(ranges, r.Header.Get("Range"))
+			http.ServeContent(w, r, "", time.Time{}, strings.NewReader(body))
+		case r.Method == http.MethodDelete:
+			delete(objects, r.URL.Path)
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer srv.Close()
+
+	store, err := helper.NewS3Store(helper.S3Config{
+		Endpoint:  srv.URL,
+		AccessKey: "AKID",
+		SecretKey: "SECRET",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	ctx := context.Background()
+
+	url, err := store.Put(ctx, "audio", "s/a.mp3", strings.NewReader("mp3"), "audio/mpeg")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if url != srv.URL+"/audio/s/a.mp3" {
+		t.Errorf("unexpected url %q", url)
+	}
+
+	rc, err := helper.OpenURL(ctx, store, url)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := readAll(t, rc); got != "mp3" {
+		t.Errorf("expected mp3, got %q", got)
+	}
+
+	keys, err := store.List(ctx, "audio", "s")
+	if err != nil || len(keys) != 1 || keys[0] != "s/a.mp3" {
+		t.Errorf("unexpected list %v (%v)", keys, err)
+	}
+
+	// Un Range sólo pide al storage desde el punto de salto
+	if _, err := store.Put(ctx, "audio", "s/long.mp3", strings.NewReader("0123456789"), "audio/mpeg"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	ranges = nil
+	if got := serveRange(t, store, "audio/s/long.mp3", "bytes=4-6"); got != "456" {
+		t.Errorf("expected 456, got %q", got)
+	}
+	if strings.Join(ranges, ",") != ",bytes=4-" {
+		t.Errorf("unexpected storage ranges %q", ranges)
+	}
+
+	if err := store.Delete(ctx, "audio", "s/a.mp3"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := store.Get(ctx, "audio", "s/a.mp3"); !errors.Is(err, helper.ErrObjectNotFound) {
+		t.Errorf("expected ErrObjectNotFound, got %v", err)
+	}
+	if _, err := helper.OpenObject(ctx, store, "audio/s/a.mp3"); !errors.Is(err, helper.ErrObjectNotFound) {
+		t.Errorf("expected ErrObjectNotFound, got %v", err)
+	}
+
+	for _, auth := range auths {
+		if !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=AKID/") ||
+			!strings.Contains(auth, "/us-east-1/s3/aws4_request") ||
+			!strings.Contains(auth, "Signature=") {
+			t.Errorf("unexpected authorization header %q", auth)
+		}
+	}
+
+	signed, err := store.SignedURL(ctx, "audio", "s/a.mp3", time.Hour)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, param := range []string{"X-Amz-Algorithm=AWS4-HMAC-SHA256", "X-Amz-Expires=3600", "X-Amz-SignedHeaders=host", "X-Amz-Signature="} {
+		if !strings.Contains(signed, param) {
+			t.Errorf("expected %s in %q", param, signed)
+		}
+	}
+}
+
+func TestSupabaseStore(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer service-key" || r.Header.Get("apikey") != "service-key" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		switch r.URL.Path {
+		case "/storage/v1/object/list/audio":
+			var body map[string]any
+			json.NewDecoder(r.Body).Decode(&body)
+			if body["prefix"] != "s/" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			io.WriteString(w, `[{"name":"a.mp3","id":"1"},{"name":"sub","id":null}]`)
+		case "/storage/v1/object/sign/audio/s/a.mp3":
+			io.WriteString(w, `{"signedURL":"/object/sign/audio/s/a.mp3?token=abc"}`)
+		case "/storage/v1/object/audio/s/a.mp3":
+			if r.Method == http.MethodPost && r.Header.Get("x-upsert") != "true" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			io.WriteString(w, "mp3")
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	store := helper.NewSupabaseStore(srv.URL, "service-key")
+	ctx := context.Background()
+
+	url, err := store.Put(ctx, "audio", "s/a.mp3", strings.NewReader("mp3"), "audio/mpeg")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if url != srv.URL+"/storage/v1/object/audio/s/a.mp3" {
+		t.Errorf("unexpected url %q", url)
+	}
+
+	rc, err := helper.OpenURL(ctx, store, url)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := readAll(t, rc); got != "mp3" {
+		t.Errorf("expected mp3, got %q", got)
+	}
+
+	// Si el servidor ignora el Range se salta hasta el punto pedido
+	rc, size, err := store.GetRange(ctx, "audio", "s/a.mp3", 1)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := readAll(t, rc); got != "p3" || size != 3 {
+		t.Errorf("expected p3 of 3 bytes, got %q of %d", got, size)
+	}
+
+	keys, err := store.List(ctx, "audio", "s")
+	if err != nil || len(keys) != 1 || keys[0] != "s/a.mp3" {
+		t.Errorf("unexpected list %v (%v)", keys, err)
+	}
+
+	signed, err := store.SignedURL(ctx, "audio", "s/a.mp3", time.Minute)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if signed != srv.URL+"/storage/v1/object/sign/audio/s/a.mp3?token=abc" {
+		t.Errorf("unexpected signed url %q", signed)
+	}
+
+	if _, err := store.Get(ctx, "audio", "s/missing.mp3"); !errors.Is(err, helper.ErrObjectNotFound) {
+		t.Errorf("expected ErrObjectNotFound, got %v", err)
+	}
+}
+
+func TestObjectRef(t *testing.T) {
+	store := helper.NewSupabaseStore("https://proj.supabase.co", "key")
+
+	tests := []struct {
+		name   string
+		ref    string
+		bucket string
+		key    string
+		ok     bool
+	}{
+		{"Plain ref", helper.ObjectRef("audio", "/s/a.mp3"), "audio", "s/a.mp3", true},
+		{"Legacy Supabase url", "https://proj.supabase.co/storage/v1/object/audio/s/a.mp3", "audio", "s/a.mp3", true},
+		{"Legacy public url", "https://proj.supabase.co/storage/v1/object/public/video/s/a.mp4", "video", "s/a.mp4", true},
+		{"External url", "https://images.test/a.jpg", "", "", false},
+		{"Bucket only", "audio", "", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bucket, key, ok := helper.SplitObjectRef(store, tt.ref)
+			if ok != tt.ok || bucket != tt.bucket || key != tt.key {
+				t.Errorf("expected (%q, %q, %v), got (%q, %q, %v)", tt.bucket, tt.key, tt.ok, bucket, key, ok)
+			}
+		})
+	}
+}
+
+func TestPresignRef(t *testing.T) {
+	store, err := helper.NewLocalStore(t.TempDir(), "http://api.test/storage", "secret")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	t.Setenv("STORAGE_URL_TTL", "2m")
+	ctx := context.Background()
+
+	signed := helper.PresignRef(ctx, store, "audio/s/a.mp3")
+	u, err := url.Parse(signed)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if u.Path != "/storage/audio/s/a.mp3" || u.Query().Get("signature") == "" {
+		t.Errorf("unexpected signed url %q", signed)
+	}
+	if helper.SignedURLTTL() != 2*time.Minute {
+		t.Errorf("expected ttl of 2m, got %v", helper.SignedURLTTL())
+	}
+
+	if got := helper.PresignRef(ctx, store, ""); got != "" {
+		t.Errorf("expected empty ref to stay empty, got %q", got)
+	}
+	if got := helper.PresignRef(ctx, store, "https://images.test/a.jpg"); got != "https://images.test/a.jpg" {
+		t.Errorf("expected external url untouched, got %q", got)
+	}
+}
@@ -0,0 +1,205 @@
+//go:build unit
+
+package stripe_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/MetaDandy/cuent-ai-core/helper"
+	"github.com/stripe/stripe-go/v82"
+)
+
+// stubRequest es lo que el stub recibió de la última llamada.
+type stubRequest struct {
+	Method string
+	Path   string
+	Form   url.Values
+}
+
+// newStripeStub levanta un servidor que imita la API de Stripe y apunta el
+// SDK a él mediante STRIPE_API_BASE.
+func newStripeStub(t *testing.T, response string) (*helper.StripeClient, func() stubRequest) {
+	t.Helper()
+
+	var (
+		mu   sync.Mutex
+		last stubRequest
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		form, _ := url.ParseQuery(string(body))
+
+		mu.Lock()
+		last = stubRequest{Method: r.Method, Path: r.URL.Path, Form: form}
+		mu.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, response)
+	}))
+	t.Cleanup(srv.Close)
+
+	t.Setenv("STRIPE_SECRET_KEY", "sk_test_stub")
+	t.Setenv("STRIPE_API_BASE", srv.URL)
+
+	return helper.NewStripeClient(), func() stubRequest {
+		mu.Lock()
+		defer mu.Unlock()
+		return last
+	}
+}
+
+func TestSetCancelAtPeriodEnd(t *testing.T) {
+	tests := []struct {
+		name   string
+		cancel bool
+		want   string
+	}{
+		{"Cancel", true, "true"},
+		{"Resume", false, "false"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, last := newStripeStub(t,
+				`{"id":"sub_123","object":"subscription","cancel_at_period_end":`+tt.want+`}`)
+
+			sub, err := client.SetCancelAtPeriodEnd(context.Background(), "sub_123", tt.cancel)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if sub.CancelAtPeriodEnd != tt.cancel {
+				t.Errorf("expected cancel_at_period_end=%v, got %v", tt.cancel, sub.CancelAtPeriodEnd)
+			}
+
+			req := last()
+			if req.Method != http.MethodPost || req.Path != "/v1/subscriptions/sub_123" {
+				t.Errorf("unexpected request %s %s", req.Method, req.Path)
+			}
+			if got := req.Form.Get("cancel_at_period_end"); got != tt.want {
+				t.Errorf("expected cancel_at_period_end=%s in body, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestCreateSubscriptionSession(t *testing.T) {
+	client, last := newStripeStub(t,
+		`{"id":"cs_123","object":"checkout.session","mode":"subscription","url":"https://checkout.test/cs_123"}`)
+
+	sess, err := client.CreateSubscriptionSession(
+		context.Background(),
+		"cus_123", "price_pro",
+		"https://app.test/ok", "https://app.test/cancel",
+		map[string]string{"subs_user_id": "us-1", "payment_id": "pay-1"},
+		true,
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if sess.URL != "https://checkout.test/cs_123" {
+		t.Errorf("unexpected session url %q", sess.URL)
+	}
+
+	req := last()
+	if req.Path != "/v1/checkout/sessions" {
+		t.Errorf("unexpected path %s", req.Path)
+	}
+	checks := map[string]string{
+		"mode":                   "subscription",
+		"customer":               "cus_123",
+		"line_items[0][price]":   "price_pro",
+		"metadata[subs_user_id]": "us-1",
+		"subscription_data[metadata][subs_user_id]": "us-1",
+		"subscription_data[metadata][payment_id]":   "pay-1",
+	}
+	for key, want := range checks {
+		if got := req.Form.Get(key); got != want {
+			t.Errorf("expected %s=%q, got %q", key, want, got)
+		}
+	}
+}
+
+func TestInvoiceSubscription(t *testing.T) {
+	var inv stripe.Invoice
+	raw := `{
+		"id": "in_123",
+		"billing_reason": "subscription_cycle",
+		"parent": {
+			"type": "subscription_details",
+			"subscription_details": {
+				"subscription": "sub_123",
+				"metadata": {"subs_user_id": "us-1"}
+			}
+		}
+	}`
+	if err := json.Unmarshal([]byte(raw), &inv); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	id, metadata := helper.InvoiceSubscription(&inv)
+	if id != "sub_123" {
+		t.Errorf("expected sub_123, got %q", id)
+	}
+	if metadata["subs_user_id"] != "us-1" {
+		t.Errorf("expected metadata subs_user_id=us-1, got %v", metadata)
+	}
+	if inv.BillingReason != stripe.InvoiceBillingReasonSubscriptionCycle {
+		t.Errorf("unexpected billing reason %q", inv.BillingReason)
+	}
+
+	var oneTime stripe.Invoice
+	if id, _ := helper.InvoiceSubscription(&oneTime); id != "" {
+		t.Errorf("expected empty id for one-time invoice, got %q", id)
+	}
+}
+
+func TestInvoicePeriod(t *testing.T) {
+	t.Run("Uses line period", func(t *testing.T) {
+		var inv stripe.Invoice
+		raw := `{
+			"period_start": 100,
+			"period_end": 100,
+			"lines": {"data": [{"period": {"start": 1700000000, "end": 1702592000}}]}
+		}`
+		if err := json.Unmarshal([]byte(raw), &inv); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		start, end := helper.InvoicePeriod(&inv)
+		if !start.Equal(time.Unix(1700000000, 0)) || !end.Equal(time.Unix(1702592000, 0)) {
+			t.Errorf("unexpected period %v – %v", start, end)
+		}
+	})
+
+	t.Run("Falls back to invoice period", func(t *testing.T) {
+		inv := stripe.Invoice{PeriodStart: 10, PeriodEnd: 20}
+
+		start, end := helper.InvoicePeriod(&inv)
+		if start.Unix() != 10 || end.Unix() != 20 {
+			t.Errorf("unexpected period %v – %v", start, end)
+		}
+	})
+}
+
+func TestSubscriptionPriceID(t *testing.T) {
+	var sub stripe.Subscription
+	raw := `{"id": "sub_123", "items": {"data": [{"price": {"id": "price_pro"}}]}}`
+	if err := json.Unmarshal([]byte(raw), &sub); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if got := helper.SubscriptionPriceID(&sub); got != "price_pro" {
+		t.Errorf("expected price_pro, got %q", got)
+	}
+	if got := helper.SubscriptionPriceID(&stripe.Subscription{}); got != "" {
+		t.Errorf("expected empty price, got %q", got)
+	}
+}
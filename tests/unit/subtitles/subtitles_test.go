@@ -0,0 +1,152 @@
+//go:build unit
+
+package subtitles_test
+
+import (
+	"errors"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/MetaDandy/cuent-ai-core/helper"
+	"github.com/MetaDandy/cuent-ai-core/src/model"
+	"github.com/google/uuid"
+)
+
+func line(kind model.AudioLine, text string, duration float64) model.Asset {
+	return model.Asset{ID: uuid.New(), Type: kind, Line: text, Duration: duration}
+}
+
+func TestFormatSubtitles(t *testing.T) {
+	assets := []model.Asset{
+		line(model.AudioTTS, "Había una vez", 2),
+		line(model.AudioSFX, "*lluvia", 4),
+		line(model.AudioTTS, "un  rey\nsin reino", 1.25),
+	}
+	durations, err := helper.AssetDurations(assets)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		format helper.SubtitleFormat
+		sfx    helper.SFXMode
+		want   string
+	}{
+		{
+			name:   "SRT sin SFX",
+			format: helper.SubtitleSRT,
+			sfx:    helper.SFXSkip,
+			want: "1\n00:00:00,000 --> 00:00:02,000\nHabía una vez\n\n" +
+				"2\n00:00:02,000 --> 00:00:03,250\nun rey sin reino\n\n",
+		},
+		{
+			name:   "VTT con SFX entre corchetes",
+			format: helper.SubtitleVTT,
+			sfx:    helper.SFXBracket,
+			want: "WEBVTT\n\n" +
+				"00:00:00.000 --> 00:00:02.000\nHabía una vez\n\n" +
+				"00:00:02.000 --> 00:00:03.250\nun rey sin reino\n\n" +
+				"00:00:02.000 --> 00:00:06.000\n[lluvia]\n\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cues := helper.BuildCues(assets, durations, model.MixSettings{}, tt.sfx)
+			if got := helper.FormatSubtitles(cues, tt.format); got != tt.want {
+				t.Errorf("unexpected subtitles:\n%q\nwant:\n%q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBuildCues_FollowsMix(t *testing.T) {
+	a := line(model.AudioTTS, "uno", 2)
+	b := line(model.AudioTTS, "dos", 2)
+	b.Pause = 1
+
+	cues := helper.BuildCues([]model.Asset{a, b, line(model.AudioTTS, "tres", 1)}, []float64{2, 2, 1},
+		model.MixSettings{Crossfade: 0.2}, helper.SFXSkip)
+
+	// b entra 0.2 s antes por el crossfade y a termina cuando empieza b;
+	// tras b hay 1 s de pausa menos el crossfade
+	want := []helper.Cue{
+		{Start: 0, End: 1.8, Text: "uno"},
+		{Start: 1.8, End: 3.8, Text: "dos"},
+		{Start: 4.6, End: 5.6, Text: "tres"},
+	}
+	if len(cues) != len(want) {
+		t.Fatalf("expected %d cues, got %d", len(want), len(cues))
+	}
+	for i := range want {
+		if cues[i].Text != want[i].Text || !near(cues[i].Start, want[i].Start) || !near(cues[i].End, want[i].End) {
+			t.Errorf("cue %d: expected %+v, got %+v", i, want[i], cues[i])
+		}
+	}
+}
+
+func TestBuildCues_SplitsLongLines(t *testing.T) {
+	text := strings.Repeat("palabra ", 30) // 239 caracteres
+	cues := helper.BuildCues([]model.Asset{line(model.AudioTTS, text, 9)}, []float64{9},
+		model.MixSettings{}, helper.SFXSkip)
+
+	if len(cues) < 3 {
+		t.Fatalf("expected the line to be split, got %d cues", len(cues))
+	}
+	if cues[0].Start != 0 || !near(cues[len(cues)-1].End, 9) {
+		t.Errorf("cues should cover the whole line: %+v", cues)
+	}
+	for i, c := range cues {
+		for _, row := range strings.Split(c.Text, "\n") {
+			if len(row) > 42 {
+				t.Errorf("cue %d: row longer than 42 chars: %q", i, row)
+			}
+		}
+		if i > 0 && !near(c.Start, cues[i-1].End) {
+			t.Errorf("cue %d should start where the previous one ends", i)
+		}
+	}
+}
+
+func TestAssetDurations_MissingAudio(t *testing.T) {
+	sfx := line(model.AudioSFX, "trueno", 0)
+	sfx.SfxDuration = 3
+
+	durations, err := helper.AssetDurations([]model.Asset{line(model.AudioTTS, "hola", 1), sfx})
+	if err != nil || durations[1] != 3 {
+		t.Fatalf("SFX should fall back to its requested duration: %v %v", durations, err)
+	}
+
+	_, err = helper.AssetDurations([]model.Asset{line(model.AudioTTS, "hola", 0)})
+	if !errors.Is(err, helper.ErrNoDuration) {
+		t.Errorf("expected ErrNoDuration, got %v", err)
+	}
+}
+
+func TestParseSubtitleFormat(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    helper.SubtitleFormat
+		wantErr bool
+	}{
+		{"", helper.SubtitleSRT, false},
+		{"srt", helper.SubtitleSRT, false},
+		{"VTT", helper.SubtitleVTT, false},
+		{"ass", "", true},
+	}
+
+	for _, tt := range tests {
+		got, err := helper.ParseSubtitleFormat(tt.in)
+		if got != tt.want || (err != nil) != tt.wantErr {
+			t.Errorf("ParseSubtitleFormat(%q) = %q, %v", tt.in, got, err)
+		}
+	}
+
+	if _, err := helper.ParseSFXMode("hide"); !errors.Is(err, helper.ErrSFXMode) {
+		t.Errorf("expected ErrSFXMode, got %v", err)
+	}
+}
+
+func near(a, b float64) bool { return math.Abs(a-b) < 1e-9 }
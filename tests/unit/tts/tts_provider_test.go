@@ -0,0 +1,112 @@
+//go:build unit
+
+package tts_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/MetaDandy/cuent-ai-core/helper"
+	"github.com/MetaDandy/cuent-ai-core/src/model"
+)
+
+func TestParseSpeechProvider(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected model.Provider
+		wantErr  bool
+	}{
+		{"Empty uses default", "", "", false},
+		{"ElevenLabs", "ELEVENLAB", model.ProviderElevenlab, false},
+		{"OpenAI lowercase", "openai", model.ProviderOpenAI, false},
+		{"Offline with spaces", "  offline ", model.ProviderOffline, false},
+		{"Gemini has no TTS", "GEMINI", "", true},
+		{"Unknown", "polly", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := helper.ParseSpeechProvider(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expected error=%v, got %v", tt.wantErr, err)
+			}
+			if got != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestNewSpeechProvider_DefaultFromEnv(t *testing.T) {
+	t.Setenv("TTS_PROVIDER", "offline")
+
+	p, err := helper.NewSpeechProvider("")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if p.Name() != model.ProviderOffline {
+		t.Errorf("expected OFFLINE provider, got %s", p.Name())
+	}
+}
+
+func TestOfflineProvider_Deterministic(t *testing.T) {
+	p := &helper.OfflineProvider{}
+
+	a, err := p.TextToSpeech("Había una vez un dragón.", helper.VoiceSettings{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	b, _ := p.TextToSpeech("Había una vez un dragón.", helper.VoiceSettings{})
+	if !bytes.Equal(a.Data, b.Data) {
+		t.Error("expected identical audio for identical input")
+	}
+
+	c, _ := p.TextToSpeech("Otra línea distinta.", helper.VoiceSettings{})
+	if bytes.Equal(a.Data, c.Data) {
+		t.Error("expected different audio for different input")
+	}
+
+	d, _ := p.TextToSpeech("Había una vez un dragón.", helper.VoiceSettings{ID: "narrador"})
+	if bytes.Equal(a.Data, d.Data) {
+		t.Error("expected different audio for a different voice")
+	}
+}
+
+func TestOfflineProvider_Duration(t *testing.T) {
+	p := &helper.OfflineProvider{}
+
+	short, _ := p.TextToSpeech("Hola", helper.VoiceSettings{})
+	if short.Duration != time.Second {
+		t.Errorf("expected minimum duration of 1s, got %v", short.Duration)
+	}
+
+	long, _ := p.TextToSpeech(strings.Repeat("a", 45), helper.VoiceSettings{})
+	if long.Duration != 3*time.Second {
+		t.Errorf("expected 3s for 45 chars, got %v", long.Duration)
+	}
+	if long.Chars != 45 {
+		t.Errorf("expected 45 chars, got %d", long.Chars)
+	}
+}
+
+func TestSineWav_Header(t *testing.T) {
+	wav := helper.SineWav(0, 2*time.Second)
+
+	if string(wav[0:4]) != "RIFF" || string(wav[8:12]) != "WAVE" {
+		t.Fatal("expected RIFF/WAVE header")
+	}
+	rate := binary.LittleEndian.Uint32(wav[24:28])
+	dataLen := binary.LittleEndian.Uint32(wav[40:44])
+	if got := time.Duration(dataLen/2) * time.Second / time.Duration(rate); got != 2*time.Second {
+		t.Errorf("expected 2s of audio, got %v", got)
+	}
+	for _, b := range wav[44:] {
+		if b != 0 {
+			t.Fatal("expected silence for freq 0")
+		}
+	}
+}
@@ -0,0 +1,81 @@
+//go:build unit
+
+package validation_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/MetaDandy/cuent-ai-core/helper"
+	"github.com/MetaDandy/cuent-ai-core/src/model"
+	"github.com/MetaDandy/cuent-ai-core/src/modules/script"
+	"github.com/MetaDandy/cuent-ai-core/src/modules/validation"
+)
+
+func TestLineInsertValidation(t *testing.T) {
+	pos := func(p int) *int { return &p }
+
+	tests := []struct {
+		name      string
+		input     script.LineInsert
+		shouldErr bool
+	}{
+		{
+			name:  "TTS al final",
+			input: script.LineInsert{Line: script.Line{Type: model.AudioTTS, Text: "Hola"}},
+		},
+		{
+			name:  "SFX en una posición",
+			input: script.LineInsert{Line: script.Line{Type: model.AudioSFX, Text: "lluvia", Duration: 3}, Position: pos(0)},
+		},
+		{
+			name:      "TTS demasiado largo",
+			input:     script.LineInsert{Line: script.Line{Type: model.AudioTTS, Text: strings.Repeat("a", helper.MaxTTSChars+1)}},
+			shouldErr: true,
+		},
+		{
+			name:  "SFX largo",
+			input: script.LineInsert{Line: script.Line{Type: model.AudioSFX, Text: strings.Repeat("a", helper.MaxTTSChars+1)}},
+		},
+		{
+			name:      "posición negativa",
+			input:     script.LineInsert{Line: script.Line{Type: model.AudioTTS, Text: "Hola"}, Position: pos(-1)},
+			shouldErr: true,
+		},
+		{
+			name:      "tipo inválido",
+			input:     script.LineInsert{Line: script.Line{Type: "MUSIC", Text: "Hola"}},
+			shouldErr: true,
+		},
+		{
+			name:      "duración de SFX fuera de rango",
+			input:     script.LineInsert{Line: script.Line{Type: model.AudioSFX, Text: "trueno", Duration: 30}},
+			shouldErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validation.Validate.Struct(&tt.input)
+			if tt.shouldErr && err == nil {
+				t.Error("expected a validation error")
+			}
+			if !tt.shouldErr && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestLineOrderValidation(t *testing.T) {
+	if err := validation.Validate.Struct(&script.LineOrder{}); err == nil {
+		t.Error("expected an error for an empty order")
+	}
+	if err := validation.Validate.Struct(&script.LineOrder{AssetIDs: []string{"no-es-uuid"}}); err == nil {
+		t.Error("expected an error for an invalid id")
+	}
+	order := script.LineOrder{AssetIDs: []string{"8f1b4bde-3a55-4d0c-9d33-2f0f7f1e5a10"}}
+	if err := validation.Validate.Struct(&order); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,111 @@
+//go:build unit
+
+package versions_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/MetaDandy/cuent-ai-core/helper"
+	"github.com/MetaDandy/cuent-ai-core/src/model"
+	"github.com/google/uuid"
+)
+
+func eq(a, b string) bool { return a == b }
+
+// render resume el diff como "=a -b +c" para compararlo fácilmente.
+func render(from, to []string, ops []helper.LineDiff) string {
+	out := make([]string, len(ops))
+	for i, op := range ops {
+		switch op.Op {
+		case helper.DiffEqual:
+			out[i] = "=" + from[op.From]
+		case helper.DiffDelete:
+			out[i] = "-" + from[op.From]
+		case helper.DiffInsert:
+			out[i] = "+" + to[op.To]
+		}
+	}
+	return strings.Join(out, " ")
+}
+
+func TestDiffLines(t *testing.T) {
+	tests := []struct {
+		name     string
+		from, to []string
+		want     string
+	}{
+		{"iguales", []string{"a", "b"}, []string{"a", "b"}, "=a =b"},
+		{"vacías", nil, nil, ""},
+		{"todo nuevo", nil, []string{"a", "b"}, "+a +b"},
+		{"todo borrado", []string{"a", "b"}, nil, "-a -b"},
+		{"cambio en medio", []string{"a", "b", "c"}, []string{"a", "x", "c"}, "=a -b +x =c"},
+		{"inserción", []string{"a", "c"}, []string{"a", "b", "c"}, "=a +b =c"},
+		{"movida", []string{"a", "b", "c"}, []string{"b", "c", "a"}, "-a =b =c +a"},
+		{"repetidas", []string{"a", "a", "b"}, []string{"a", "b", "a"}, "=a -a =b +a"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ops := helper.DiffLines(tt.from, tt.to, eq)
+			if got := render(tt.from, tt.to, ops); got != tt.want {
+				t.Errorf("expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestDiffLines_Positions(t *testing.T) {
+	ops := helper.DiffLines([]string{"a", "b"}, []string{"b", "c"}, eq)
+	want := []helper.LineDiff{
+		{Op: helper.DiffDelete, From: 0, To: -1},
+		{Op: helper.DiffEqual, From: 1, To: 0},
+		{Op: helper.DiffInsert, From: -1, To: 1},
+	}
+	if fmt.Sprint(ops) != fmt.Sprint(want) {
+		t.Errorf("expected %v, got %v", want, ops)
+	}
+}
+
+func TestVersionLine_SameContent(t *testing.T) {
+	voice := uuid.New()
+	other := uuid.New()
+	base := model.VersionLine{
+		AssetID: uuid.New(),
+		Type:    model.AudioTTS,
+		Line:    "Hola",
+		Speaker: "Edipo",
+		VoiceID: &voice,
+		Pause:   0.5,
+	}
+
+	same := base
+	same.AssetID = uuid.New()
+	same.Speaker = "EDIPO"
+	same.Pause = 2
+	same.Audio_URL = "audio/otro.mp3"
+	v := voice
+	same.VoiceID = &v
+	if !base.SameContent(same) {
+		t.Error("expected same content: ID, pause, audio and speaker case do not count")
+	}
+
+	changes := map[string]func(l *model.VersionLine){
+		"texto":   func(l *model.VersionLine) { l.Line = "Adiós" },
+		"tipo":    func(l *model.VersionLine) { l.Type = model.AudioSFX },
+		"speaker": func(l *model.VersionLine) { l.Speaker = "Yocasta" },
+		"voz":     func(l *model.VersionLine) { l.VoiceID = &other },
+		"sin voz": func(l *model.VersionLine) { l.VoiceID = nil },
+		"sfx":     func(l *model.VersionLine) { l.SfxDuration = 3 },
+	}
+	for name, change := range changes {
+		t.Run(name, func(t *testing.T) {
+			l := base
+			change(&l)
+			if base.SameContent(l) {
+				t.Errorf("expected different content when %s changes", name)
+			}
+		})
+	}
+}
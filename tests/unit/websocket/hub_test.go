@@ -0,0 +1,168 @@
+//go:build unit
+
+package websocket_test
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+
+	ws "github.com/MetaDandy/cuent-ai-core/src/modules/websocket"
+)
+
+func TestHub_MembersAcrossReplicas(t *testing.T) {
+	bus := ws.NewMemoryBackplane()
+	a := ws.NewHub(t.Context(), 3, bus, ws.Config{})
+	b := ws.NewHub(t.Context(), 3, bus, ws.Config{})
+
+	if err := a.Register("script-1", ws.NewClient("script-1", "user-1", nil)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := b.Members("script-1"); len(got) != 1 || got[0].UserID != "user-1" {
+		t.Fatalf("expected b to see user-1, got %+v", got)
+	}
+	if len(b.Clients("script-1")) != 0 {
+		t.Errorf("expected no local clients in b")
+	}
+
+	// La réplica nueva le anuncia los suyos a la que ya estaba
+	if err := b.Register("script-1", ws.NewClient("script-1", "user-2", nil)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := a.Members("script-1"); len(got) != 2 {
+		t.Fatalf("expected a to see 2 members, got %+v", got)
+	}
+
+	// El límite de la sala cuenta a las dos réplicas
+	if err := a.Register("script-1", ws.NewClient("script-1", "user-3", nil)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := b.Register("script-1", ws.NewClient("script-1", "user-4", nil)); !errors.Is(err, ws.ErrRoomFull) {
+		t.Errorf("expected ErrRoomFull, got %v", err)
+	}
+	if got := b.Members("script-2"); len(got) != 0 {
+		t.Errorf("expected an empty room, got %+v", got)
+	}
+}
+
+func TestHub_BroadcastGoesThroughBackplane(t *testing.T) {
+	bus := ws.NewMemoryBackplane()
+	a := ws.NewHub(t.Context(), 4, bus, ws.Config{})
+	b := ws.NewHub(t.Context(), 4, bus, ws.Config{})
+
+	var (
+		mu   sync.Mutex
+		seen []ws.Envelope
+	)
+	bus.Subscribe(func(env ws.Envelope) {
+		mu.Lock()
+		defer mu.Unlock()
+		if env.Op != ws.OpMembers {
+			seen = append(seen, env)
+		}
+	})
+
+	a.Broadcast("script-1", []byte(`{"type":"line.insert","seq":3}`))
+	b.PublishJSON(map[string]string{"type": "presence"}, "script-1", "")
+	b.CloseRoom("script-1")
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(seen) != 3 {
+		t.Fatalf("expected 3 envelopes, got %+v", seen)
+	}
+	if seen[0].Op != ws.OpBroadcast || string(seen[0].Data) != `{"type":"line.insert","seq":3}` || seen[0].Origin == "" {
+		t.Errorf("unexpected broadcast: %+v", seen[0])
+	}
+	if seen[1].Op != ws.OpBroadcast || seen[1].Origin == seen[0].Origin {
+		t.Errorf("expected a broadcast from b, got %+v", seen[1])
+	}
+	if seen[2].Op != ws.OpClose || seen[2].Room != "script-1" {
+		t.Errorf("unexpected close: %+v", seen[2])
+	}
+}
+
+func TestNewBackplaneFromEnv(t *testing.T) {
+	t.Setenv("WS_BACKPLANE", "")
+	if bp, err := ws.NewBackplaneFromEnv(nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	} else if _, ok := bp.(*ws.MemoryBackplane); !ok {
+		t.Errorf("expected the memory backplane by default, got %T", bp)
+	}
+
+	t.Setenv("WS_BACKPLANE", "redis")
+	if _, err := ws.NewBackplaneFromEnv(nil); err == nil {
+		t.Error("expected an error for an unknown backplane")
+	}
+}
+
+func TestHub_EvictsSlowClients(t *testing.T) {
+	h := ws.NewHub(t.Context(), 4, nil, ws.Config{SendBuffer: 2})
+	slow := h.NewClient("script-1", "user-1", nil)
+	if err := h.Register("script-1", slow); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for i := 0; i < 4; i++ {
+		h.Broadcast("script-1", []byte(`{"type":"cursor"}`))
+	}
+	st := h.Stats()
+	if st.Rooms != 1 || st.Clients != 1 {
+		t.Errorf("unexpected rooms/clients: %+v", st)
+	}
+	if st.Dropped != 2 || st.Evicted != 1 {
+		t.Errorf("expected 2 dropped messages and 1 eviction, got %+v", st)
+	}
+
+	// Al salir de la sala ya no ocupa lugar
+	h.Unregister("script-1", slow.ID())
+	if st := h.Stats(); st.Clients != 0 || st.Rooms != 0 {
+		t.Errorf("expected an empty hub, got %+v", st)
+	}
+}
+
+func TestHub_StopsWithContext(t *testing.T) {
+	before := runtime.NumGoroutine()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	hubs := make([]*ws.Hub, 20)
+	for i := range hubs {
+		hubs[i] = ws.NewHub(ctx, 4, nil, ws.Config{})
+	}
+	if n := runtime.NumGoroutine(); n < before+len(hubs) {
+		t.Fatalf("expected a refresh goroutine per hub, got %d -> %d", before, n)
+	}
+
+	// Al cancelar ctx los anuncios periódicos terminan
+	cancel()
+	deadline := time.Now().Add(2 * time.Second)
+	for runtime.NumGoroutine() >= before+len(hubs) {
+		if time.Now().After(deadline) {
+			t.Fatalf("refresh goroutines still running: %d -> %d", before, runtime.NumGoroutine())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestConfigFromEnv(t *testing.T) {
+	t.Setenv("WS_PING_INTERVAL", "")
+	t.Setenv("WS_PONG_WAIT", "")
+	t.Setenv("WS_WRITE_WAIT", "")
+	t.Setenv("WS_SEND_BUFFER", "")
+	if got := ws.ConfigFromEnv(); got != ws.DefaultConfig() {
+		t.Errorf("expected the defaults, got %+v", got)
+	}
+
+	t.Setenv("WS_PING_INTERVAL", "90s")
+	t.Setenv("WS_PONG_WAIT", "1m")
+	t.Setenv("WS_WRITE_WAIT", "nope")
+	t.Setenv("WS_SEND_BUFFER", "16")
+	got := ws.ConfigFromEnv()
+	want := ws.Config{PingInterval: 54 * time.Second, PongWait: time.Minute, WriteWait: 10 * time.Second, SendBuffer: 16}
+	if got != want {
+		t.Errorf("expected %+v, got %+v", want, got)
+	}
+}